@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+var errAnalysisRunNotFound = errors.New("analysis run not found")
+
+// recordAnalysisRun saves a full analysis of tid as a new run and makes it
+// current. The model and prompt come from the extract-structure run in
+// provenance.
+func recordAnalysisRun(tid int64, statements []Statement, provenance []storage.PromptRun) {
+	run := storage.AnalysisRun{TranscriptID: tid}
+	run.Provider, run.Model = describeLLM()
+	for _, p := range provenance {
+		if p.PromptID == promptExtractStructure {
+			run.Provider, run.Model = p.Provider, p.Model
+			run.PromptVersion, run.PromptHash = p.PromptVersion, p.PromptHash
+			break
+		}
+	}
+	id, err := saveAnalysisRun(run, statements)
+	if err != nil {
+		log.Printf("recordAnalysisRun: transcript %d: %v", tid, err)
+		return
+	}
+	if err := store.SetCurrentAnalysisRun(tid, id); err != nil {
+		log.Printf("recordAnalysisRun: mark %d current: %v", id, err)
+	}
+}
+
+// snapshotLiveTree saves the stored tree as a run when it differs from the
+// current run's: a transcript analyzed before run history existed, or one
+// corrected since by incremental updates or revisions. Re-analyzing it then
+// doesn't lose that tree.
+func snapshotLiveTree(tid int64) {
+	tree := transcriptStatements(tid)
+	if len(tree) == 0 {
+		return
+	}
+	runs, err := store.ListAnalysisRuns(tid)
+	if err != nil {
+		return
+	}
+	for _, r := range runs {
+		if !r.Current {
+			continue
+		}
+		if _, current, err := loadAnalysisRun(tid, r.ID); err == nil && sameTree(current, tree) {
+			return
+		}
+		break
+	}
+	if _, err := saveAnalysisRun(storage.AnalysisRun{TranscriptID: tid}, tree); err != nil {
+		log.Printf("snapshotLiveTree: transcript %d: %v", tid, err)
+	}
+}
+
+// sameTree reports whether two trees have the same statements, compared by
+// text, type and msg_index, nested the same way.
+func sameTree(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Text != b[i].Text || a[i].Type != b[i].Type || !sameMsgIndex(a[i].MsgIndex, b[i].MsgIndex) ||
+			!sameTree(a[i].Children, b[i].Children) {
+			return false
+		}
+	}
+	return true
+}
+
+func saveAnalysisRun(run storage.AnalysisRun, statements []Statement) (int64, error) {
+	data, err := json.Marshal(statements)
+	if err != nil {
+		return 0, err
+	}
+	run.Statements = data
+	for _, s := range statements {
+		run.StatementCount += 1 + countDescendants(s)
+	}
+	return store.SaveAnalysisRun(run)
+}
+
+// loadAnalysisRun returns run id of tid with its tree.
+func loadAnalysisRun(tid, id int64) (*storage.AnalysisRun, []Statement, error) {
+	run, err := store.GetAnalysisRun(id)
+	if err != nil || run.TranscriptID != tid {
+		return nil, nil, errAnalysisRunNotFound
+	}
+	var statements []Statement
+	if err := json.Unmarshal(run.Statements, &statements); err != nil {
+		return nil, nil, fmt.Errorf("analysis run %d: %w", id, err)
+	}
+	return run, statements, nil
+}
+
+// pinAnalysisRun resets the live tree to run id's and makes it current.
+// The live tree is kept as a run first when it has changed since the
+// current run, so nothing added or corrected since is lost.
+func pinAnalysisRun(tid, id int64) ([]Statement, error) {
+	_, statements, err := loadAnalysisRun(tid, id)
+	if err != nil {
+		return nil, err
+	}
+	canonicalizeStatements(statements)
+
+	unlock := lockTranscript(tid)
+	defer unlock()
+
+	snapshotLiveTree(tid)
+	t, err := store.GetTranscript(tid)
+	if err != nil {
+		return nil, err
+	}
+	if persistStatements(t.AudioPath, statements, nil, nil, nil, tid) == 0 {
+		return nil, fmt.Errorf("analysis run %d: could not save its tree", id)
+	}
+	if err := store.SetCurrentAnalysisRun(tid, id); err != nil {
+		return nil, err
+	}
+	return transcriptStatements(tid), nil
+}
+
+// treeDiffEntry is one statement in a tree diff. Parents are given by their
+// text, empty for the top level.
+type treeDiffEntry struct {
+	MsgIndex  *int   `json:"msg_index,omitempty"`
+	Text      string `json:"text"`
+	Type      string `json:"type"`
+	OldType   string `json:"old_type,omitempty"`
+	OldParent string `json:"old_parent,omitempty"`
+	NewParent string `json:"new_parent,omitempty"`
+}
+
+type treeDiff struct {
+	Added      []treeDiffEntry `json:"added"`
+	Removed    []treeDiffEntry `json:"removed"`
+	Retyped    []treeDiffEntry `json:"retyped"`
+	Reparented []treeDiffEntry `json:"reparented"`
+}
+
+// alignedStatement is a statement flattened out of its tree for diffing.
+type alignedStatement struct {
+	key, parentKey string
+	stmt           Statement
+	parentText     string
+}
+
+// alignStatements flattens a tree in pre-order, keying each statement by
+// msg_index (by text when it has none). Repeats of a key are numbered in
+// order, so the nth statement on a message aligns with the nth in the other
+// tree.
+func alignStatements(tree []Statement) ([]alignedStatement, map[string]alignedStatement) {
+	var order []alignedStatement
+	byKey := map[string]alignedStatement{}
+	seen := map[string]int{}
+	var walk func(stmts []Statement, parent *alignedStatement)
+	walk = func(stmts []Statement, parent *alignedStatement) {
+		for _, s := range stmts {
+			base := "-|" + s.Text
+			if s.MsgIndex != nil {
+				base = strconv.Itoa(*s.MsgIndex)
+			}
+			seen[base]++
+			a := alignedStatement{key: fmt.Sprintf("%s#%d", base, seen[base]), stmt: s}
+			if parent != nil {
+				a.parentKey, a.parentText = parent.key, parent.stmt.Text
+			}
+			order = append(order, a)
+			byKey[a.key] = a
+			walk(s.Children, &a)
+		}
+	}
+	walk(tree, nil)
+	return order, byKey
+}
+
+// diffTrees aligns two trees by msg_index and reports statements only in
+// to (added), only in from (removed), and aligned statements whose type or
+// parent changed.
+func diffTrees(from, to []Statement) treeDiff {
+	d := treeDiff{Added: []treeDiffEntry{}, Removed: []treeDiffEntry{}, Retyped: []treeDiffEntry{}, Reparented: []treeDiffEntry{}}
+	fromOrder, fromByKey := alignStatements(from)
+	toOrder, toByKey := alignStatements(to)
+	entry := func(a alignedStatement) treeDiffEntry {
+		return treeDiffEntry{MsgIndex: a.stmt.MsgIndex, Text: a.stmt.Text, Type: a.stmt.Type}
+	}
+	for _, a := range fromOrder {
+		if _, ok := toByKey[a.key]; !ok {
+			d.Removed = append(d.Removed, entry(a))
+		}
+	}
+	for _, b := range toOrder {
+		a, ok := fromByKey[b.key]
+		if !ok {
+			d.Added = append(d.Added, entry(b))
+			continue
+		}
+		if a.stmt.Type != b.stmt.Type {
+			e := entry(b)
+			e.OldType = a.stmt.Type
+			d.Retyped = append(d.Retyped, e)
+		}
+		if a.parentKey != b.parentKey {
+			e := entry(b)
+			e.OldParent, e.NewParent = a.parentText, b.parentText
+			d.Reparented = append(d.Reparented, e)
+		}
+	}
+	return d
+}
+
+// GET /api/transcripts/{slug}/analyses
+// GET /api/transcripts/{slug}/analyses/{id}
+// POST /api/transcripts/{slug}/analyses/{id}/pin
+// GET /api/transcripts/{slug}/analyses/diff?from={id}&to={id}
+//
+// A diff without to compares against the live tree, which includes any
+// corrections made since the current run.
+func handleAnalyses(w http.ResponseWriter, r *http.Request, t *storage.Transcript, rest string) {
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runs, err := store.ListAnalysisRuns(t.ID)
+		if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		json.NewEncoder(w).Encode(runs)
+		return
+	}
+
+	if rest == "diff" {
+		if r.Method != http.MethodGet {
+			jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fromID, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		if err != nil {
+			jsonError(w, "from must be an analysis run id", 400)
+			return
+		}
+		_, from, err := loadAnalysisRun(t.ID, fromID)
+		if err != nil {
+			analysisRunError(w, err)
+			return
+		}
+		to := transcriptStatements(t.ID)
+		if s := r.URL.Query().Get("to"); s != "" {
+			toID, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				jsonError(w, "to must be an analysis run id", 400)
+				return
+			}
+			if _, to, err = loadAnalysisRun(t.ID, toID); err != nil {
+				analysisRunError(w, err)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(diffTrees(from, to))
+		return
+	}
+
+	idStr, pin := strings.CutSuffix(rest, "/pin")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		jsonError(w, "not found", 404)
+		return
+	}
+	if !pin {
+		if r.Method != http.MethodGet {
+			jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		run, statements, err := loadAnalysisRun(t.ID, id)
+		if err != nil {
+			analysisRunError(w, err)
+			return
+		}
+		run.Statements = nil
+		json.NewEncoder(w).Encode(map[string]any{"run": run, "statements": statements})
+		return
+	}
+	if r.Method != http.MethodPost {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	statements, err := pinAnalysisRun(t.ID, id)
+	if err != nil {
+		analysisRunError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"statements": statements})
+}
+
+func analysisRunError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errAnalysisRunNotFound) {
+		jsonError(w, err.Error(), 404)
+		return
+	}
+	jsonError(w, err.Error(), 500)
+}
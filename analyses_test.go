@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func TestDiffTrees(t *testing.T) {
+	from := []Statement{
+		{Text: "Go is simpler", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Text: "Python has libraries", Type: "response", MsgIndex: intp(2)},
+			{Text: "Go has enough", Type: "response", MsgIndex: intp(3)},
+		}},
+		{Text: "Deploys matter", Type: "claim", MsgIndex: intp(4)},
+		{Text: "An aside", Type: "tangent"},
+	}
+	to := []Statement{
+		{Text: "Go is simpler to deploy", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Text: "Python has libraries", Type: "rebuttal", MsgIndex: intp(2), Children: []Statement{
+				{Text: "Go has enough", Type: "response", MsgIndex: intp(3)},
+			}},
+		}},
+		{Text: "Deploys matter", Type: "claim", MsgIndex: intp(4)},
+		{Text: "Binaries are small", Type: "evidence", MsgIndex: intp(4)},
+	}
+
+	d := diffTrees(from, to)
+	if len(d.Added) != 1 || d.Added[0].Text != "Binaries are small" {
+		t.Errorf("added = %+v", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Text != "An aside" {
+		t.Errorf("removed = %+v", d.Removed)
+	}
+	if len(d.Retyped) != 1 || *d.Retyped[0].MsgIndex != 2 || d.Retyped[0].OldType != "response" || d.Retyped[0].Type != "rebuttal" {
+		t.Errorf("retyped = %+v", d.Retyped)
+	}
+	// msg 1's new text doesn't make it a different statement
+	if len(d.Reparented) != 1 || *d.Reparented[0].MsgIndex != 3 ||
+		d.Reparented[0].OldParent != "Go is simpler" || d.Reparented[0].NewParent != "Python has libraries" {
+		t.Errorf("reparented = %+v", d.Reparented)
+	}
+
+	if d := diffTrees(to, to); len(d.Added)+len(d.Removed)+len(d.Retyped)+len(d.Reparented) != 0 {
+		t.Errorf("identical trees differ: %+v", d)
+	}
+}
+
+func TestAnalysisRuns(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// A transcript analyzed before run history keeps its tree as a run
+	tid := persistStatements("", []Statement{{Text: "Go is simpler", Type: "claim", MsgIndex: intp(1)}}, nil, nil, nil, 0)
+	tr, _ := store.GetTranscript(tid)
+	base := "/api/transcripts/" + tr.Slug + "/analyses"
+
+	body, _ := json.Marshal(map[string]any{"transcript": "[1] (speaker_1) Ada: Go is simpler\n[2] (speaker_2) Ben: Python is faster to write", "slug": tr.Slug})
+	if w := do("POST", "/api/analyze", body); w.Code != 200 {
+		t.Fatalf("analyze: %d %s", w.Code, w.Body.String())
+	}
+
+	w := do("GET", base, nil)
+	var runs []storage.AnalysisRun
+	json.Unmarshal(w.Body.Bytes(), &runs)
+	if len(runs) != 2 {
+		t.Fatalf("runs = %s", w.Body.String())
+	}
+	legacy, analyzed := runs[0], runs[1]
+	if legacy.Current || legacy.Provider != "" || legacy.StatementCount != 1 {
+		t.Errorf("legacy run = %+v", legacy)
+	}
+	if !analyzed.Current || analyzed.Provider != "fake" || analyzed.PromptVersion != 1 || analyzed.PromptHash == "" || analyzed.Statements != nil {
+		t.Errorf("analyzed run = %+v", analyzed)
+	}
+
+	w = do("GET", fmt.Sprintf("%s/diff?from=%d&to=%d", base, legacy.ID, analyzed.ID), nil)
+	var d treeDiff
+	json.Unmarshal(w.Body.Bytes(), &d)
+	if w.Code != 200 || len(d.Added) == 0 {
+		t.Errorf("diff: %d %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", fmt.Sprintf("%s/%d/pin", base, legacy.ID), nil)
+	if w.Code != 200 {
+		t.Fatalf("pin: %d %s", w.Code, w.Body.String())
+	}
+	if tree := transcriptStatements(tid); len(tree) != 1 || tree[0].Text != "Go is simpler" {
+		t.Errorf("live tree after pin = %+v", tree)
+	}
+	runs, _ = store.ListAnalysisRuns(tid)
+	if !runs[0].Current || runs[1].Current {
+		t.Errorf("current after pin = %+v", runs)
+	}
+
+	// Without to, the diff is against the live tree
+	w = do("GET", fmt.Sprintf("%s/diff?from=%d", base, legacy.ID), nil)
+	json.Unmarshal(w.Body.Bytes(), &d)
+	if len(d.Added)+len(d.Removed)+len(d.Retyped)+len(d.Reparented) != 0 {
+		t.Errorf("pinned run differs from live tree: %s", w.Body.String())
+	}
+
+	w = do("GET", fmt.Sprintf("%s/%d", base, analyzed.ID), nil)
+	var one struct {
+		Run        storage.AnalysisRun `json:"run"`
+		Statements []Statement         `json:"statements"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &one)
+	if one.Run.ID != analyzed.ID || len(one.Statements) == 0 {
+		t.Errorf("get run: %s", w.Body.String())
+	}
+
+	// Re-analyzing an unchanged tree adds only the new run, but a tree
+	// corrected since its run is kept as a run of its own first
+	pinned := len(runs)
+	if w := do("POST", "/api/analyze", body); w.Code != 200 {
+		t.Fatalf("re-analyze: %d %s", w.Code, w.Body.String())
+	}
+	if runs, _ = store.ListAnalysisRuns(tid); len(runs) != pinned+1 {
+		t.Fatalf("unchanged tree was snapshotted: %d runs", len(runs))
+	}
+	persistIncremental(tid, &IncrementalResult{Updates: []StatementUpdate{{MsgIndex: 1, Type: strp("question")}}})
+	edited := transcriptStatements(tid)
+	if w := do("POST", "/api/analyze", body); w.Code != 200 {
+		t.Fatalf("re-analyze: %d %s", w.Code, w.Body.String())
+	}
+	runs, _ = store.ListAnalysisRuns(tid)
+	if len(runs) != pinned+3 {
+		t.Fatalf("edited tree not snapshotted: %d runs", len(runs))
+	}
+	if _, snap, _ := loadAnalysisRun(tid, runs[len(runs)-2].ID); !sameTree(snap, edited) {
+		t.Errorf("snapshot = %+v, want %+v", snap, edited)
+	}
+
+	// Pinning keeps statements added since the current run as a run too
+	persistIncremental(tid, &IncrementalResult{Statements: []Statement{{Text: "Rust is safer", Type: "claim", MsgIndex: intp(2)}}})
+	live := transcriptStatements(tid)
+	if w := do("POST", fmt.Sprintf("%s/%d/pin", base, legacy.ID), nil); w.Code != 200 {
+		t.Fatalf("pin: %d %s", w.Code, w.Body.String())
+	}
+	runs, _ = store.ListAnalysisRuns(tid)
+	if len(runs) != pinned+4 {
+		t.Fatalf("live tree not snapshotted before pin: %d runs", len(runs))
+	}
+	if _, snap, _ := loadAnalysisRun(tid, runs[len(runs)-1].ID); !sameTree(snap, live) {
+		t.Errorf("snapshot before pin = %+v, want %+v", snap, live)
+	}
+
+	other := persistStatements("", nil, nil, nil, nil, 0)
+	otherRun, _ := saveAnalysisRun(storage.AnalysisRun{TranscriptID: other}, nil)
+	for _, path := range []string{fmt.Sprintf("%s/%d", base, otherRun), fmt.Sprintf("%s/diff?from=%d", base, otherRun)} {
+		if w := do("GET", path, nil); w.Code != 404 {
+			t.Errorf("GET %s: %d, want 404", path, w.Code)
+		}
+	}
+	if w := do("GET", base+"/diff", nil); w.Code != 400 {
+		t.Errorf("diff without from: %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Talk-time and turn-taking analytics. A turn is a run of consecutive
+// utterances by one speaker. Utterances without EndMs end where the next
+// one starts; a final one without EndMs is estimated from its length.
+const (
+	// interruptionMinOverlapMs separates interruptions from the brief
+	// overlaps of ordinary back-and-forth.
+	interruptionMinOverlapMs = 500
+	estimatedMsPerWord       = 400
+	maxMonologues            = 5
+	timelineBuckets          = 60
+	minTimelineBucketMs      = 5000
+)
+
+type conversationAnalytics struct {
+	Timed             bool               `json:"timed"` // false if utterances have no timestamps
+	DurationMs        int64              `json:"duration_ms"`
+	Turns             int                `json:"turns"`
+	Speakers          []speakerAnalytics `json:"speakers"`
+	Overlaps          []overlap          `json:"overlaps"`
+	LongestMonologues []analyticsTurn    `json:"longest_monologues"`
+	ResponseLatency   latencyStats       `json:"response_latency"`
+	TimelineBucketMs  int64              `json:"timeline_bucket_ms,omitempty"`
+	Timeline          []timelineBucket   `json:"timeline"`
+}
+
+type speakerAnalytics struct {
+	SpeakerID     string  `json:"speaker_id"`
+	Name          string  `json:"name"`
+	Messages      int     `json:"messages"`
+	Words         int     `json:"words"`
+	Turns         int     `json:"turns"`
+	TalkMs        int64   `json:"talk_ms"`
+	TalkShare     float64 `json:"talk_share"`
+	LongestTurnMs int64   `json:"longest_turn_ms"`
+	Interruptions int     `json:"interruptions"` // made
+	Interrupted   int     `json:"interrupted"`
+	AvgLatencyMs  int64   `json:"avg_response_latency_ms"`
+}
+
+type analyticsTurn struct {
+	SpeakerID  string `json:"speaker_id"`
+	Name       string `json:"name"`
+	MsgIndex   int    `json:"msg_index"` // 1-based, first utterance of the turn
+	Messages   int    `json:"messages"`
+	Words      int    `json:"words"`
+	StartMs    int64  `json:"start_ms"`
+	EndMs      int64  `json:"end_ms"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// overlap is a turn starting before the previous speaker's turn ended.
+type overlap struct {
+	AtMs         int64  `json:"at_ms"`
+	MsgIndex     int    `json:"msg_index"`
+	By           string `json:"by"`
+	Of           string `json:"of"`
+	OverlapMs    int64  `json:"overlap_ms"`
+	Interruption bool   `json:"interruption"`
+}
+
+// latencyStats describes the gaps between one speaker finishing and the
+// next starting. Overlapping turns count as zero.
+type latencyStats struct {
+	Count    int            `json:"count"`
+	MeanMs   int64          `json:"mean_ms"`
+	MedianMs int64          `json:"median_ms"`
+	P90Ms    int64          `json:"p90_ms"`
+	Buckets  []latencyRange `json:"buckets"`
+}
+
+type latencyRange struct {
+	Label string `json:"label"`
+	MaxMs int64  `json:"max_ms,omitempty"` // exclusive; 0 on the last bucket
+	Count int    `json:"count"`
+}
+
+// timelineBucket holds each speaker's talk time within one slice of the
+// conversation, keyed by speaker id.
+type timelineBucket struct {
+	StartMs int64            `json:"start_ms"`
+	TalkMs  map[string]int64 `json:"talk_ms"`
+}
+
+var latencyRanges = []latencyRange{
+	{Label: "<0.5s", MaxMs: 500},
+	{Label: "0.5-1s", MaxMs: 1000},
+	{Label: "1-2s", MaxMs: 2000},
+	{Label: "2-5s", MaxMs: 5000},
+	{Label: ">5s"},
+}
+
+// utteranceSpans returns each message's start and end, or ok=false if the
+// conversation has no timestamps.
+func utteranceSpans(messages []storage.DiarizeMessage) (starts, ends []int64, ok bool) {
+	for _, m := range messages {
+		if m.StartMs != nil {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	starts = make([]int64, len(messages))
+	ends = make([]int64, len(messages))
+	var last int64
+	for i, m := range messages {
+		if m.StartMs != nil {
+			last = *m.StartMs
+		}
+		starts[i] = last
+	}
+	for i, m := range messages {
+		switch {
+		case m.EndMs != nil && *m.EndMs > starts[i]:
+			ends[i] = *m.EndMs
+		case i+1 < len(messages) && starts[i+1] > starts[i]:
+			ends[i] = starts[i+1]
+		case i+1 == len(messages):
+			ends[i] = starts[i] + int64(len(strings.Fields(m.Text)))*estimatedMsPerWord
+		default:
+			ends[i] = starts[i]
+		}
+	}
+	return starts, ends, true
+}
+
+func buildAnalytics(speakers map[string]string, messages []storage.DiarizeMessage) conversationAnalytics {
+	a := conversationAnalytics{
+		Speakers: []speakerAnalytics{}, Overlaps: []overlap{}, LongestMonologues: []analyticsTurn{},
+		Timeline: []timelineBucket{}, ResponseLatency: summarizeLatencies(nil),
+	}
+
+	byID := map[string]*speakerAnalytics{}
+	var order []string
+	get := func(id string) *speakerAnalytics {
+		if s, ok := byID[id]; ok {
+			return s
+		}
+		name := speakers[id]
+		if name == "" {
+			name = id
+		}
+		s := &speakerAnalytics{SpeakerID: id, Name: name}
+		byID[id] = s
+		order = append(order, id)
+		return s
+	}
+	ids := make([]string, 0, len(speakers))
+	for id := range speakers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		get(id)
+	}
+
+	starts, ends, timed := utteranceSpans(messages)
+	a.Timed = timed
+
+	// Group utterances into turns
+	var turns []analyticsTurn
+	for i, m := range messages {
+		s := get(m.Speaker)
+		words := len(strings.Fields(m.Text))
+		s.Messages++
+		s.Words += words
+		if n := len(turns); n > 0 && turns[n-1].SpeakerID == m.Speaker {
+			t := &turns[n-1]
+			t.Messages++
+			t.Words += words
+			if timed && ends[i] > t.EndMs {
+				t.EndMs = ends[i]
+			}
+			continue
+		}
+		t := analyticsTurn{SpeakerID: m.Speaker, Name: s.Name, MsgIndex: i + 1, Messages: 1, Words: words}
+		if timed {
+			t.StartMs, t.EndMs = starts[i], ends[i]
+		}
+		turns = append(turns, t)
+	}
+	a.Turns = len(turns)
+
+	var latencies []int64
+	latencySum := map[string]int64{}
+	latencyCount := map[string]int{}
+	for i := range turns {
+		t := &turns[i]
+		t.DurationMs = t.EndMs - t.StartMs
+		s := byID[t.SpeakerID]
+		s.Turns++
+		s.LongestTurnMs = max(s.LongestTurnMs, t.DurationMs)
+		if !timed || i == 0 {
+			continue
+		}
+		prev := turns[i-1]
+		if gap := t.StartMs - prev.EndMs; gap < 0 {
+			o := overlap{AtMs: t.StartMs, MsgIndex: t.MsgIndex, By: t.Name, Of: prev.Name, OverlapMs: -gap}
+			o.Interruption = o.OverlapMs >= interruptionMinOverlapMs
+			if o.Interruption {
+				s.Interruptions++
+				byID[prev.SpeakerID].Interrupted++
+			}
+			a.Overlaps = append(a.Overlaps, o)
+			latencies = append(latencies, 0)
+		} else {
+			latencies = append(latencies, gap)
+			latencySum[t.SpeakerID] += gap
+		}
+		latencyCount[t.SpeakerID]++
+	}
+
+	if timed {
+		var total, last int64
+		for i := range messages {
+			d := ends[i] - starts[i]
+			get(messages[i].Speaker).TalkMs += d
+			total += d
+			last = max(last, ends[i])
+		}
+		// Timestamps can arrive out of order, so measure from the earliest
+		a.DurationMs = last - slices.Min(starts)
+		for _, s := range byID {
+			if total > 0 {
+				s.TalkShare = float64(s.TalkMs) / float64(total)
+			}
+			if n := latencyCount[s.SpeakerID]; n > 0 {
+				s.AvgLatencyMs = latencySum[s.SpeakerID] / int64(n)
+			}
+		}
+
+		longest := append([]analyticsTurn(nil), turns...)
+		sort.SliceStable(longest, func(i, j int) bool { return longest[i].DurationMs > longest[j].DurationMs })
+		a.LongestMonologues = longest[:min(maxMonologues, len(longest))]
+
+		a.ResponseLatency = summarizeLatencies(latencies)
+		a.TimelineBucketMs, a.Timeline = talkTimeline(messages, starts, ends)
+	}
+
+	for _, id := range order {
+		a.Speakers = append(a.Speakers, *byID[id])
+	}
+	return a
+}
+
+func summarizeLatencies(latencies []int64) latencyStats {
+	st := latencyStats{Count: len(latencies), Buckets: append([]latencyRange(nil), latencyRanges...)}
+	if len(latencies) == 0 {
+		return st
+	}
+	sorted := append([]int64(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum int64
+	for _, l := range sorted {
+		sum += l
+		for i := range st.Buckets {
+			if st.Buckets[i].MaxMs == 0 || l < st.Buckets[i].MaxMs {
+				st.Buckets[i].Count++
+				break
+			}
+		}
+	}
+	st.MeanMs = sum / int64(len(sorted))
+	st.MedianMs = sorted[len(sorted)/2]
+	st.P90Ms = sorted[(len(sorted)*9)/10]
+	return st
+}
+
+// talkTimeline splits the conversation into about timelineBuckets slices
+// and sums each speaker's talk time within them.
+func talkTimeline(messages []storage.DiarizeMessage, starts, ends []int64) (int64, []timelineBucket) {
+	if len(messages) == 0 {
+		return 0, []timelineBucket{}
+	}
+	origin := slices.Min(starts)
+	end := origin
+	for _, e := range ends {
+		end = max(end, e)
+	}
+	size := max(int64(minTimelineBucketMs), (end-origin+timelineBuckets-1)/timelineBuckets)
+	size = (size + 999) / 1000 * 1000
+	n := int((end-origin)/size) + 1
+	buckets := make([]timelineBucket, n)
+	for i := range buckets {
+		buckets[i] = timelineBucket{StartMs: origin + int64(i)*size, TalkMs: map[string]int64{}}
+	}
+	for i, m := range messages {
+		for s, e := starts[i], ends[i]; s < e; {
+			b := int((s - origin) / size)
+			cut := min(e, origin+int64(b+1)*size)
+			buckets[b].TalkMs[m.Speaker] += cut - s
+			s = cut
+		}
+	}
+	return size, buckets
+}
+
+// GET /api/transcripts/{slug}/analytics
+func handleAnalytics(w http.ResponseWriter, r *http.Request, t *storage.Transcript) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	speakers, messages, err := store.GetDiarization(t.ID)
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	json.NewEncoder(w).Encode(buildAnalytics(speakers, messages))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func timedMessage(speaker, text string, start, end int64) storage.DiarizeMessage {
+	m := storage.DiarizeMessage{Speaker: speaker, Text: text, StartMs: &start}
+	if end > 0 {
+		m.EndMs = &end
+	}
+	return m
+}
+
+func TestBuildAnalytics(t *testing.T) {
+	speakers := map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}
+	a := buildAnalytics(speakers, []storage.DiarizeMessage{
+		timedMessage("speaker_1", "one two", 0, 4000),
+		timedMessage("speaker_1", "three four", 4000, 10000),
+		timedMessage("speaker_2", "hold on", 9000, 12000),    // 1s overlap: interruption
+		timedMessage("speaker_1", "fine", 14000, 15000),      // 2s gap
+		timedMessage("speaker_2", "thanks", 14800, 16000),    // 200ms overlap
+		timedMessage("speaker_1", "one two three", 17000, 0), // ends by word estimate
+	})
+
+	if !a.Timed || a.Turns != 5 || a.DurationMs != 18200 {
+		t.Fatalf("timed %v turns %d duration %d", a.Timed, a.Turns, a.DurationMs)
+	}
+	ada, ben := a.Speakers[0], a.Speakers[1]
+	if ada.Name != "Ada" || ada.Messages != 4 || ada.Turns != 3 || ada.TalkMs != 12200 || ada.LongestTurnMs != 10000 {
+		t.Fatalf("ada: %+v", ada)
+	}
+	if ben.Interruptions != 1 || ada.Interrupted != 1 || len(a.Overlaps) != 2 || a.Overlaps[1].Interruption {
+		t.Fatalf("overlaps: %+v / %+v %+v", a.Overlaps, ada, ben)
+	}
+	if a.LongestMonologues[0].MsgIndex != 1 || a.LongestMonologues[0].Messages != 2 {
+		t.Fatalf("longest: %+v", a.LongestMonologues[0])
+	}
+	// Latencies: 0 (overlap), 2000, 0 (overlap), 1000
+	if l := a.ResponseLatency; l.Count != 4 || l.MeanMs != 750 || l.Buckets[0].Count != 2 || l.Buckets[2].Count != 1 || l.Buckets[3].Count != 1 {
+		t.Fatalf("latency: %+v", l)
+	}
+	var talk int64
+	for _, b := range a.Timeline {
+		for _, ms := range b.TalkMs {
+			talk += ms
+		}
+	}
+	if a.TimelineBucketMs != minTimelineBucketMs || talk != ada.TalkMs+ben.TalkMs {
+		t.Fatalf("timeline: bucket %d talk %d", a.TimelineBucketMs, talk)
+	}
+}
+
+func TestBuildAnalyticsOutOfOrder(t *testing.T) {
+	a := buildAnalytics(map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}, []storage.DiarizeMessage{
+		timedMessage("speaker_1", "later", 60000, 62000),
+		timedMessage("speaker_2", "earlier", 1000, 3000),
+	})
+	if a.DurationMs != 61000 {
+		t.Fatalf("duration %d, want 61000", a.DurationMs)
+	}
+	var talk int64
+	for _, b := range a.Timeline {
+		for _, ms := range b.TalkMs {
+			talk += ms
+		}
+	}
+	if a.Timeline[0].StartMs != 1000 || talk != 4000 {
+		t.Fatalf("timeline starts %d with %dms talk", a.Timeline[0].StartMs, talk)
+	}
+}
+
+func TestAnalyticsEndpointUntimed(t *testing.T) {
+	setupTestStore(t)
+	tid, _ := store.SaveTranscript("", "")
+	store.SaveDiarization(tid, map[string]string{"speaker_1": "Ada"}, []storage.DiarizeMessage{{Speaker: "speaker_1", Text: "hello there"}})
+	tr, _ := store.GetTranscript(tid)
+
+	w := authRequestAs(t, "", "GET", "/api/transcripts/"+tr.Slug+"/analytics", "")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var a conversationAnalytics
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if a.Timed || a.Turns != 1 || a.Speakers[0].Words != 2 || a.Speakers[0].TalkMs != 0 {
+		t.Fatalf("untimed: %+v", a)
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Accounts are optional. Anonymous visitors keep working as before on
+// conversations nobody owns; conversations created while signed in belong
+// to that user and start out unlisted, so their slug URL is a share link.
+//
+// Requests authenticate with the session cookie set by login/signup or an
+// "Authorization: Bearer" API token.
+const (
+	sessionCookie = "argraphments_session"
+	sessionTTL    = 30 * 24 * time.Hour
+	tokenPrefix   = "arg_"
+)
+
+var (
+	allowSignup = getEnv("ALLOW_SIGNUP", "true") != "false"
+	// passwordIterations is the PBKDF2-SHA256 work factor for new hashes;
+	// stored hashes record their own.
+	passwordIterations = 600_000
+)
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func checkPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[2])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// newToken returns a random token and the hash it is stored under.
+func newToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// requestUser returns the signed-in user, or nil for anonymous requests.
+func requestUser(r *http.Request) *storage.User {
+	token := requestToken(r)
+	if token == "" || store == nil {
+		return nil
+	}
+	u, err := store.UserForToken(hashToken(token))
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func userID(u *storage.User) int64 {
+	if u == nil {
+		return 0
+	}
+	return u.ID
+}
+
+// --- Authorization ---
+
+func transcriptAccess(tid int64) storage.TranscriptAccess {
+	a, err := store.GetTranscriptAccess(tid)
+	if err != nil {
+		log.Printf("transcript access %d: %v", tid, err)
+		// Fail closed
+		return storage.TranscriptAccess{TranscriptID: tid, OwnerID: -1, Visibility: storage.VisibilityPrivate}
+	}
+	return a
+}
+
+func isOwner(u *storage.User, a storage.TranscriptAccess) bool {
+	return u != nil && a.OwnerID == u.ID
+}
+
+// canView: private conversations are for their owner; anything else is
+// readable by whoever has the slug.
+func canView(u *storage.User, a storage.TranscriptAccess) bool {
+	return a.Visibility != storage.VisibilityPrivate || isOwner(u, a)
+}
+
+// canEdit: unowned conversations stay editable by anyone.
+func canEdit(u *storage.User, a storage.TranscriptAccess) bool {
+	return a.OwnerID == 0 || isOwner(u, a)
+}
+
+// isListed reports whether a conversation shows up in the user's lists,
+// search results and cross-conversation views.
+func isListed(u *storage.User, a storage.TranscriptAccess) bool {
+	return a.Visibility == storage.VisibilityPublic || isOwner(u, a)
+}
+
+// hiddenTranscripts returns the conversations left out of the user's lists.
+func hiddenTranscripts(u *storage.User) map[int64]bool {
+	hidden, err := store.HiddenTranscriptIDs(userID(u))
+	if err != nil {
+		log.Printf("hidden transcripts: %v", err)
+		return map[int64]bool{}
+	}
+	return hidden
+}
+
+func idList(m map[int64]bool) []int64 {
+	out := make([]int64, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+// hiddenClaims returns the claims only mentioned in hidden conversations.
+func hiddenClaims(hidden map[int64]bool) map[int64]bool {
+	claims, err := store.HiddenClaimIDs(idList(hidden))
+	if err != nil {
+		log.Printf("hidden claims: %v", err)
+		return map[int64]bool{}
+	}
+	return claims
+}
+
+func hiddenSlugs(hidden map[int64]bool) map[string]bool {
+	slugs := map[string]bool{}
+	for tid := range hidden {
+		if t, err := store.GetTranscript(tid); err == nil {
+			slugs[t.Slug] = true
+		}
+	}
+	return slugs
+}
+
+// canEditSpeaker reports whether the user may edit every conversation the
+// speaker appears in, as a global rename touches all of them.
+func canEditSpeaker(u *storage.User, name string) bool {
+	convos, err := store.GetSpeakerConversations(name)
+	if err != nil {
+		return false
+	}
+	for _, c := range convos {
+		t, err := store.GetTranscriptBySlug(c.Slug)
+		if err != nil || !canEdit(u, transcriptAccess(t.ID)) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterGraph drops hidden claims, and edges touching them, from a graph
+// as it will be encoded: {"nodes": [{"id": ...}], "edges": [{"from", "to"}]}.
+func filterGraph(g any, hidden map[int64]bool) any {
+	if len(hidden) == 0 {
+		return g
+	}
+	data, err := json.Marshal(g)
+	if err != nil {
+		return g
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return g
+	}
+	isHidden := func(v any) bool {
+		id, ok := v.(float64)
+		return ok && hidden[int64(id)]
+	}
+	for key, v := range doc {
+		items, ok := v.([]any)
+		if !ok {
+			continue
+		}
+		kept := items[:0]
+		for _, item := range items {
+			obj, _ := item.(map[string]any)
+			if obj != nil && (isHidden(obj["id"]) || isHidden(obj["from"]) || isHidden(obj["to"]) ||
+				isHidden(obj["source"]) || isHidden(obj["target"])) {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		doc[key] = kept
+	}
+	return doc
+}
+
+// --- Handlers ---
+
+type authRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// startSession issues a session token as a cookie and in the body, for
+// clients that can't keep cookies.
+func startSession(w http.ResponseWriter, u *storage.User, status int) {
+	token, hash := newToken()
+	expires := time.Now().Add(sessionTTL).UTC()
+	if _, err := store.CreateAuthToken(u.ID, storage.TokenSession, "", hash, &expires); err != nil {
+		jsonError(w, "failed to start session", 500)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: token, Path: "/", Expires: expires,
+		HttpOnly: true, SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"user": u, "token": token})
+}
+
+// /api/auth/signup, /login, /logout, /me, /tokens and /tokens/{id}
+func handleAPIAuth(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/argraphments")
+	path = strings.TrimPrefix(path, "/api/auth/")
+
+	switch {
+	case path == "signup" && r.Method == http.MethodPost:
+		if !allowSignup {
+			jsonError(w, "signup is disabled", http.StatusForbidden)
+			return
+		}
+		var req authRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid JSON", 400)
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		if len(req.Username) < 2 || len(req.Username) > 40 || strings.ContainsAny(req.Username, " /") {
+			jsonError(w, "username must be 2-40 characters without spaces or slashes", 400)
+			return
+		}
+		if len(req.Password) < 8 {
+			jsonError(w, "password must be at least 8 characters", 400)
+			return
+		}
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			jsonError(w, "signup failed", 500)
+			return
+		}
+		u, err := store.CreateUser(req.Username, hash)
+		if errors.Is(err, storage.ErrUsernameTaken) {
+			jsonError(w, "username taken", http.StatusConflict)
+			return
+		} else if err != nil {
+			jsonError(w, "signup failed", 500)
+			return
+		}
+		startSession(w, u, http.StatusCreated)
+
+	case path == "login" && r.Method == http.MethodPost:
+		var req authRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid JSON", 400)
+			return
+		}
+		u, hash, err := store.GetUserByUsername(strings.TrimSpace(req.Username))
+		if err != nil || !checkPassword(req.Password, hash) {
+			jsonError(w, "invalid username or password", http.StatusUnauthorized)
+			return
+		}
+		startSession(w, u, http.StatusOK)
+
+	case path == "logout" && r.Method == http.MethodPost:
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			store.DeleteAuthTokenByHash(hashToken(c.Value))
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	case path == "me" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"user": requestUser(r), "signup": allowSignup})
+
+	case path == "tokens" || strings.HasPrefix(path, "tokens/"):
+		handleAPITokens(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "tokens"), "/"))
+
+	default:
+		jsonError(w, "not found", 404)
+	}
+}
+
+// GET/POST /api/auth/tokens and DELETE /api/auth/tokens/{id}. A new
+// token's value is only ever returned by the POST that creates it.
+func handleAPITokens(w http.ResponseWriter, r *http.Request, rest string) {
+	u := requestUser(r)
+	if u == nil {
+		jsonError(w, "sign in required", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		tokens, err := store.ListAuthTokens(u.ID)
+		if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		json.NewEncoder(w).Encode(tokens)
+	case rest == "" && r.Method == http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		token, hash := newToken()
+		t, err := store.CreateAuthToken(u.ID, storage.TokenAPI, strings.TrimSpace(req.Name), hash, nil)
+		if err != nil {
+			jsonError(w, "failed to create token", 500)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"token": token, "info": t})
+	case rest != "" && r.Method == http.MethodDelete:
+		id, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			jsonError(w, "invalid id", 400)
+			return
+		}
+		if err := store.DeleteAuthToken(u.ID, id); errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "not found", 404)
+			return
+		} else if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET/PUT /api/transcripts/{slug}/access — owner and visibility. Only the
+// owner may change visibility.
+func handleTranscriptAccess(w http.ResponseWriter, r *http.Request, u *storage.User, a storage.TranscriptAccess) {
+	if r.Method == http.MethodPut {
+		if !isOwner(u, a) {
+			jsonError(w, "only the owner can change visibility", http.StatusForbidden)
+			return
+		}
+		var req struct {
+			Visibility string `json:"visibility"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid JSON", 400)
+			return
+		}
+		switch req.Visibility {
+		case storage.VisibilityPrivate, storage.VisibilityUnlisted, storage.VisibilityPublic:
+		default:
+			jsonError(w, "visibility must be private, unlisted or public", 400)
+			return
+		}
+		a.Visibility = req.Visibility
+		if err := store.SetTranscriptAccess(a); err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+	} else if r.Method != http.MethodGet {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	json.NewEncoder(w).Encode(accessInfo(u, a))
+}
+
+// accessInfo describes a transcript's access for the requesting user.
+func accessInfo(u *storage.User, a storage.TranscriptAccess) map[string]any {
+	info := map[string]any{
+		"visibility": a.Visibility,
+		"can_edit":   canEdit(u, a),
+		"is_owner":   isOwner(u, a),
+	}
+	if a.OwnerID > 0 {
+		if owner, err := store.GetUser(a.OwnerID); err == nil {
+			info["owner"] = owner.Username
+		}
+	}
+	return info
+}
+
+// claimTranscript makes a newly created transcript the user's.
+func claimTranscript(tid, ownerID int64) {
+	if ownerID <= 0 || tid <= 0 {
+		return
+	}
+	a := storage.TranscriptAccess{TranscriptID: tid, OwnerID: ownerID, Visibility: storage.VisibilityUnlisted}
+	if err := store.SetTranscriptAccess(a); err != nil {
+		log.Printf("claim transcript %d: %v", tid, err)
+	}
+}
+
+// authorizeAnalyze stamps an analyze request with its requester and checks
+// they may write to the conversation it updates, if any.
+func authorizeAnalyze(u *storage.User, req *analyzeRequest) error {
+	req.OwnerID = userID(u)
+	if req.Slug == "" || store == nil {
+		return nil
+	}
+	t, err := store.GetTranscriptBySlug(req.Slug)
+	if err != nil {
+		return nil
+	}
+	if !canEdit(u, transcriptAccess(t.ID)) {
+		return errors.New("not allowed to edit this conversation")
+	}
+	return nil
+}
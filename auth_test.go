@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func authRequestAs(t *testing.T, token, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, req)
+	return w
+}
+
+func signup(t *testing.T, username string) string {
+	t.Helper()
+	w := authRequestAs(t, "", "POST", "/api/auth/signup", `{"username":"`+username+`","password":"correct horse"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("signup %s: status %d: %s", username, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Token == "" {
+		t.Fatal("signup returned no token")
+	}
+	return resp.Token
+}
+
+func setupAuth(t *testing.T) {
+	t.Helper()
+	setupTestStore(t)
+	old := passwordIterations
+	passwordIterations = 1000
+	t.Cleanup(func() { passwordIterations = old })
+}
+
+// newOwnedSession creates a conversation as the token's user and gives it
+// a claim and a title so it shows up in lists and search.
+func newOwnedSession(t *testing.T, token, title string) string {
+	t.Helper()
+	w := authRequestAs(t, token, "POST", "/api/session/new", "")
+	var resp struct {
+		Slug string `json:"slug"`
+		ID   int64  `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Slug == "" {
+		t.Fatalf("new session: %d %s", w.Code, w.Body.String())
+	}
+	persistStatements("", []Statement{{Speaker: "speaker_1", Text: title + " is a claim", Type: "claim", MsgIndex: intp(1)}},
+		map[string]string{"speaker_1": "Ada"}, []storage.DiarizeMessage{{Speaker: "speaker_1", Text: title + " is a claim"}}, nil, resp.ID)
+	store.UpdateTitle(resp.ID, title)
+	indexTranscriptSearch(resp.ID)
+	return resp.Slug
+}
+
+func TestAuthSignupLoginMe(t *testing.T) {
+	setupAuth(t)
+	signup(t, "ada")
+
+	if w := authRequestAs(t, "", "POST", "/api/auth/signup", `{"username":"ADA","password":"another one"}`); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate signup: status %d", w.Code)
+	}
+	if w := authRequestAs(t, "", "POST", "/api/auth/login", `{"username":"ada","password":"wrong password"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad password: status %d", w.Code)
+	}
+	w := authRequestAs(t, "", "POST", "/api/auth/login", `{"username":"ada","password":"correct horse"}`)
+	if w.Code != 200 {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("login set no session cookie: %v", w.Result().Cookies())
+	}
+
+	req := httptest.NewRequest("GET", "/api/auth/me", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	setupMux().ServeHTTP(w, req)
+	var me struct {
+		User *storage.User `json:"user"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &me)
+	if me.User == nil || me.User.Username != "ada" {
+		t.Fatalf("me: %s", w.Body.String())
+	}
+}
+
+func TestAuthAPITokens(t *testing.T) {
+	setupAuth(t)
+	session := signup(t, "ada")
+
+	w := authRequestAs(t, session, "POST", "/api/auth/tokens", `{"name":"cli"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: status %d", w.Code)
+	}
+	var created struct {
+		Token string            `json:"token"`
+		Info  storage.AuthToken `json:"info"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Token, tokenPrefix) {
+		t.Fatalf("token %q", created.Token)
+	}
+	if w := authRequestAs(t, created.Token, "GET", "/api/auth/me", ""); !strings.Contains(w.Body.String(), `"username":"ada"`) {
+		t.Fatalf("me with API token: %s", w.Body.String())
+	}
+	if w := authRequestAs(t, created.Token, "DELETE", "/api/auth/tokens/"+strconv.FormatInt(created.Info.ID, 10), ""); w.Code != 200 {
+		t.Fatalf("revoke: status %d", w.Code)
+	}
+	if w := authRequestAs(t, created.Token, "GET", "/api/auth/me", ""); strings.Contains(w.Body.String(), `"username"`) {
+		t.Fatalf("revoked token still works: %s", w.Body.String())
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	setupAuth(t)
+	ada := signup(t, "ada")
+	ben := signup(t, "ben")
+	slug := newOwnedSession(t, ada, "Zeppelin")
+
+	// New conversations are unlisted: readable by slug, not listed or searchable
+	if w := authRequestAs(t, ben, "GET", "/api/transcripts/"+slug, ""); w.Code != 200 {
+		t.Fatalf("unlisted by slug: status %d", w.Code)
+	}
+	if items, _, _ := listPage(t, "/api/transcripts"); len(items) != 0 {
+		t.Fatalf("unlisted conversation listed: %v", items)
+	}
+	if hits := search(t, "q=zeppelin"); len(hits) != 0 {
+		t.Fatalf("unlisted conversation searchable: %v", hits)
+	}
+	if w := authRequestAs(t, ada, "GET", "/api/transcripts", ""); !strings.Contains(w.Body.String(), slug) {
+		t.Fatalf("owner's list misses their conversation: %s", w.Body.String())
+	}
+
+	// Numeric IDs don't reach an unlisted conversation, on any subresource
+	tr, _ := store.GetTranscriptBySlug(slug)
+	byID := fmt.Sprintf("/api/transcripts/%d", tr.ID)
+	for _, path := range []string{"", "/events", "/export", "/analytics", "/revisions", "/analyses"} {
+		for _, as := range []string{"", ben} {
+			if w := authRequestAs(t, as, "GET", byID+path, ""); w.Code != 404 {
+				t.Fatalf("unlisted by id %s as %q: status %d", path, as, w.Code)
+			}
+		}
+	}
+	if w := authRequestAs(t, ada, "GET", byID, ""); w.Code != 200 {
+		t.Fatalf("owner by id: status %d", w.Code)
+	}
+
+	// Only the owner edits or changes visibility
+	if w := authRequestAs(t, ben, "PUT", "/api/transcripts/"+slug+"/speakers", `{"speakers":{"speaker_1":"Eve"}}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non-owner edit: status %d", w.Code)
+	}
+	if w := authRequestAs(t, ben, "PUT", "/api/transcripts/"+slug+"/access", `{"visibility":"public"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non-owner visibility change: status %d", w.Code)
+	}
+	if w := authRequestAs(t, ada, "PUT", "/api/transcripts/"+slug+"/access", `{"visibility":"private"}`); w.Code != 200 {
+		t.Fatalf("owner visibility change: status %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := authRequestAs(t, ben, "GET", "/api/transcripts/"+slug, ""); w.Code != 404 {
+		t.Fatalf("private to others: status %d", w.Code)
+	}
+	if w := authRequestAs(t, "", "GET", "/convo/"+slug+"/report", ""); w.Code != 404 {
+		t.Fatalf("private report: status %d", w.Code)
+	}
+	w := authRequestAs(t, ada, "GET", "/api/transcripts/"+slug, "")
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"is_owner":true`) {
+		t.Fatalf("private to owner: status %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := authRequestAs(t, ada, "PUT", "/api/transcripts/"+slug+"/access", `{"visibility":"public"}`); w.Code != 200 {
+		t.Fatalf("publish: status %d", w.Code)
+	}
+	if hits := search(t, "q=zeppelin"); len(hits) == 0 {
+		t.Fatal("public conversation not searchable")
+	}
+}
+
+func TestUnownedConversationsStayOpen(t *testing.T) {
+	setupAuth(t)
+	ben := signup(t, "ben")
+	slug := newOwnedSession(t, "", "Anonymous")
+
+	if w := authRequestAs(t, "", "GET", "/api/transcripts/"+slug, ""); !strings.Contains(w.Body.String(), `"can_edit":true`) {
+		t.Fatalf("unowned detail: %s", w.Body.String())
+	}
+	if w := authRequestAs(t, ben, "PUT", "/api/transcripts/"+slug+"/speakers", `{"speakers":{"speaker_1":"Eve"}}`); w.Code != 200 {
+		t.Fatalf("edit unowned: status %d: %s", w.Code, w.Body.String())
+	}
+	if items, _, _ := listPage(t, "/api/transcripts"); len(items) != 1 {
+		t.Fatalf("unowned conversation not listed: %v", items)
+	}
+}
+
+func TestJobsReadableByOwnerOnly(t *testing.T) {
+	setupAuth(t)
+	startTestJobWorkers(t, 1)
+	ada := signup(t, "ada")
+	ben := signup(t, "ben")
+
+	w := authRequestAs(t, ada, "POST", "/api/jobs", `{"kind":"diarize","payload":{"transcript":"hello there"}}`)
+	var job storage.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil || job.ID == 0 {
+		t.Fatalf("create job: %d %s", w.Code, w.Body.String())
+	}
+	if owner, _ := store.JobOwner(job.ID); owner == 0 {
+		t.Fatal("job saved without its owner")
+	}
+	path := fmt.Sprintf("/api/jobs/%d", job.ID)
+	for _, as := range []string{"", ben} {
+		if w := authRequestAs(t, as, "GET", path, ""); w.Code != 404 {
+			t.Fatalf("job as %q: status %d", as, w.Code)
+		}
+	}
+	if w := authRequestAs(t, ada, "GET", path, ""); w.Code != 200 {
+		t.Fatalf("job as owner: status %d", w.Code)
+	}
+}
+
+func TestPrivateClaimsHiddenWithoutMentions(t *testing.T) {
+	setupAuth(t)
+	ada := signup(t, "ada")
+	ben := signup(t, "ben")
+	w := authRequestAs(t, ada, "POST", "/api/session/new", "")
+	var resp struct {
+		Slug string `json:"slug"`
+		ID   int64  `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w := authRequestAs(t, ada, "PUT", "/api/transcripts/"+resp.Slug+"/access", `{"visibility":"private"}`); w.Code != 200 {
+		t.Fatalf("make private: status %d", w.Code)
+	}
+	// Normalizes to nothing, so no canonical claim or mention is recorded
+	persistStatements("", []Statement{{Speaker: "speaker_1", Text: "👍", Type: "claim", MsgIndex: intp(0)}},
+		map[string]string{"speaker_1": "Ada"}, []storage.DiarizeMessage{{Speaker: "speaker_1", Text: "👍"}}, nil, resp.ID)
+	tree, err := store.GetClaimTree(resp.ID)
+	if err != nil || len(tree) != 1 {
+		t.Fatalf("tree: %v %v", tree, err)
+	}
+	id := tree[0].ClaimID
+
+	for _, as := range []string{"", ben} {
+		if w := authRequestAs(t, as, "GET", "/api/graph", ""); strings.Contains(w.Body.String(), "👍") {
+			t.Fatalf("graph as %q leaks private claim: %s", as, w.Body.String())
+		}
+		if w := authRequestAs(t, as, "GET", "/api/claims/"+strconv.FormatInt(id, 10), ""); w.Code != 404 {
+			t.Fatalf("claim as %q: status %d", as, w.Code)
+		}
+	}
+	if w := authRequestAs(t, ada, "GET", "/api/graph", ""); !strings.Contains(w.Body.String(), "👍") {
+		t.Fatalf("owner's graph misses their claim: %s", w.Body.String())
+	}
+}
+
+func TestClaimDetailTextFromVisibleMention(t *testing.T) {
+	setupAuth(t)
+	signup(t, "ada")
+	ben := signup(t, "ben")
+	ada, _, _ := store.GetUserByUsername("ada")
+
+	// The private conversation creates the canonical claim, so its wording
+	// is the canonical text
+	private := persistClaimConversation(t, "Private", []Statement{
+		{Speaker: "speaker_1", Text: "Remote work makes teams more productive at Acme.", Type: "claim", MsgIndex: intp(1)},
+	})
+	store.SetTranscriptAccess(storage.TranscriptAccess{TranscriptID: private, OwnerID: ada.ID, Visibility: storage.VisibilityPrivate})
+	persistClaimConversation(t, "Public", []Statement{
+		{Speaker: "speaker_1", Text: "Remote work makes teams more productive at acme", Type: "claim", MsgIndex: intp(1)},
+	})
+	tree, _ := store.GetClaimTree(private)
+	canonicalID, err := store.CanonicalIDForClaim(tree[0].ClaimID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mentions, _ := store.GetClaimMentions(canonicalID)
+	if len(mentions) != 2 {
+		t.Fatalf("want both conversations on one canonical claim, got %d mentions", len(mentions))
+	}
+
+	w := authRequestAs(t, ben, "GET", fmt.Sprintf("/api/claims/%d", mentions[1].ClaimID), "")
+	var d claimDetail
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if d.Text != "Remote work makes teams more productive at acme" {
+		t.Fatalf("detail shows hidden wording: %q", d.Text)
+	}
+}
+
+func TestSpeakerListCountsListedConversations(t *testing.T) {
+	setupAuth(t)
+	ada := signup(t, "ada")
+	newOwnedSession(t, "", "Open")
+	slug := newOwnedSession(t, ada, "Secret")
+	if w := authRequestAs(t, ada, "PUT", "/api/transcripts/"+slug+"/access", `{"visibility":"private"}`); w.Code != 200 {
+		t.Fatalf("make private: status %d", w.Code)
+	}
+
+	counts := func(token string) (float64, float64) {
+		w := authRequestAs(t, token, "GET", "/api/speakers", "")
+		var items []map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil || len(items) != 1 {
+			t.Fatalf("speakers: %d %s", w.Code, w.Body.String())
+		}
+		return items[0]["conversation_count"].(float64), items[0]["claim_count"].(float64)
+	}
+	if convos, claims := counts(""); convos != 1 || claims != 1 {
+		t.Fatalf("anonymous counts include the private conversation: %v conversations, %v claims", convos, claims)
+	}
+	if convos, claims := counts(ada); convos != 2 || claims != 2 {
+		t.Fatalf("owner counts: %v conversations, %v claims", convos, claims)
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Claim canonicalization links paraphrases of the same claim across
+// conversations. A statement joins an existing canonical claim when its
+// normalized text matches exactly, or when the content-word Jaccard
+// similarity reaches CLAIM_MATCH_THRESHOLD. With CLAIM_LLM_CONFIRM set,
+// fuzzy matches below CLAIM_AUTO_MERGE are only taken if the LLM agrees.
+var (
+	claimMatchThreshold = getEnvFloat("CLAIM_MATCH_THRESHOLD", 0.6)
+	claimAutoMerge      = getEnvFloat("CLAIM_AUTO_MERGE", 0.85)
+	claimLLMConfirm     = getEnv("CLAIM_LLM_CONFIRM", "") != ""
+)
+
+const (
+	claimCandidateLimit = 20
+	// Fuzzy matching needs this many content words on both sides; shorter
+	// statements ("I agree", "No it isn't") only merge on exact text.
+	claimMinTokens      = 3
+	claimConfirmTimeout = 30 * time.Second
+)
+
+// canonicalMu keeps concurrent persists from creating the same canonical
+// claim twice.
+var canonicalMu sync.Mutex
+
+var claimStopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an the and or but if so of to in on at by for with from as is are was were
+		be been being am it its this that these those there here i you he she we they me him her us them my your
+		our their his do does did doing have has had not no just very really also than then too can could
+		would should will shall may might must about into over what which who whom whose think thing things like`) {
+		claimStopwords[w] = true
+	}
+}
+
+// normalizeClaimText lowercases and strips punctuation, so claims differing
+// only in case, punctuation or spacing compare equal.
+func normalizeClaimText(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '\'' || r == '’':
+			// drop, so "isn't" and "isnt" agree
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// claimTokens returns the sorted distinct content words of normalized text,
+// with a plural "s" stripped.
+func claimTokens(normalized string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, w := range strings.Fields(normalized) {
+		if claimStopwords[w] {
+			continue
+		}
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = w[:len(w)-1]
+		}
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func tokenJaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(a))
+	for _, t := range a {
+		set[t] = true
+	}
+	shared := 0
+	for _, t := range b {
+		if set[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+const sameClaimPrompt = "Do these two statements make the same claim"
+
+// confirmSameClaim asks the LLM whether two texts are paraphrases. Errors
+// count as "no" so a flaky provider never merges claims.
+func confirmSameClaim(a, b string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), claimConfirmTimeout)
+	defer cancel()
+	ctx = trackLLMCacheHit(ctx)
+	prompt := sameClaimPrompt + ", even if worded differently? Answer with only yes or no.\n\nA: " + a + "\nB: " + b
+	opts := CompletionOptions{MaxTokens: 5}
+	reply, err := llm.Complete(ctx, prompt, opts)
+	if err != nil {
+		log.Printf("confirmSameClaim: %v", err)
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(reply))
+	if strings.HasPrefix(answer, "yes") || strings.HasPrefix(answer, "no") {
+		acceptLLMReply(ctx, prompt, opts, reply)
+	}
+	return strings.HasPrefix(answer, "yes")
+}
+
+// canonicalizeClaim returns the canonical claim for text, creating one when
+// nothing close enough exists. An LLM confirmation is asked for without
+// holding canonicalMu.
+func canonicalizeClaim(text string) (int64, error) {
+	normalized := normalizeClaimText(text)
+	if normalized == "" {
+		return 0, fmt.Errorf("empty claim text")
+	}
+	tokens := claimTokens(normalized)
+
+	canonicalMu.Lock()
+	defer canonicalMu.Unlock()
+
+	id, unconfirmed, err := matchCanonicalClaim(normalized, tokens)
+	if err != nil || id > 0 {
+		return id, err
+	}
+	if unconfirmed != nil {
+		canonicalMu.Unlock()
+		same := confirmSameClaim(unconfirmed.Text, text)
+		canonicalMu.Lock()
+		if same {
+			return unconfirmed.ID, nil
+		}
+		// Another persist may have created this claim while we waited
+		if id, err := store.FindCanonicalClaim(normalized); err == nil {
+			return id, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+	return store.CreateCanonicalClaim(text, normalized, tokens)
+}
+
+// matchCanonicalClaim returns the canonical claim normalized matches exactly
+// or closely enough to merge outright. Failing that, it returns the best
+// fuzzy match that needs the LLM's confirmation, if any.
+func matchCanonicalClaim(normalized string, tokens []string) (int64, *storage.CanonicalClaim, error) {
+	if id, err := store.FindCanonicalClaim(normalized); err == nil {
+		return id, nil, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, err
+	}
+	if len(tokens) < claimMinTokens {
+		return 0, nil, nil
+	}
+	candidates, err := store.CanonicalCandidates(tokens, claimCandidateLimit)
+	if err != nil {
+		return 0, nil, err
+	}
+	var best *storage.CanonicalClaim
+	bestScore := 0.0
+	for i, c := range candidates {
+		if len(c.Tokens) < claimMinTokens {
+			continue
+		}
+		if score := tokenJaccard(tokens, c.Tokens); score > bestScore {
+			best, bestScore = &candidates[i], score
+		}
+	}
+	if best == nil || bestScore < claimMatchThreshold {
+		return 0, nil, nil
+	}
+	if !claimLLMConfirm || bestScore >= claimAutoMerge {
+		return best.ID, nil, nil
+	}
+	return 0, best, nil
+}
+
+// canonicalizeStatements resolves the canonical claim of every statement in
+// the tree ahead of persisting it, so LLM confirmations don't run under the
+// transcript lock.
+func canonicalizeStatements(stmts []Statement) {
+	if store == nil {
+		return
+	}
+	for i := range stmts {
+		if id, err := canonicalizeClaim(stmts[i].Text); err == nil {
+			stmts[i].canonicalID = id
+		}
+		canonicalizeStatements(stmts[i].Children)
+	}
+}
+
+// canonicalizeUpdates does the same for the corrected texts of updates.
+func canonicalizeUpdates(updates []StatementUpdate) {
+	if store == nil {
+		return
+	}
+	for i, u := range updates {
+		if u.Text == nil || *u.Text == "" {
+			continue
+		}
+		if id, err := canonicalizeClaim(*u.Text); err == nil {
+			updates[i].canonicalID = id
+		}
+	}
+}
+
+// statementCanonicalID returns the canonical claim canonicalizeStatements
+// resolved for s, or resolves it now.
+func statementCanonicalID(s Statement) (int64, error) {
+	if s.canonicalID > 0 {
+		return s.canonicalID, nil
+	}
+	return canonicalizeClaim(s.Text)
+}
+
+// backfillClaimMentions links the statements of conversations saved before
+// claim canonicalization existed to canonical claims. Claims are matched
+// before each conversation is locked, since matching may ask the LLM.
+func backfillClaimMentions() {
+	mentioned, err := store.MentionedTranscripts()
+	if err != nil {
+		log.Printf("claim backfill: %v", err)
+		return
+	}
+	transcripts, err := store.ListTranscripts()
+	if err != nil {
+		log.Printf("claim backfill: %v", err)
+		return
+	}
+	n := 0
+	for _, t := range transcripts {
+		if mentioned[t.ID] {
+			continue
+		}
+		canonical := map[string]int64{}
+		var walk func(stmts []Statement)
+		walk = func(stmts []Statement) {
+			for _, s := range stmts {
+				if _, ok := canonical[s.Text]; !ok {
+					if id, err := canonicalizeClaim(s.Text); err == nil {
+						canonical[s.Text] = id
+					}
+				}
+				walk(s.Children)
+			}
+		}
+		walk(transcriptStatements(t.ID))
+		if len(canonical) > 0 && backfillTranscriptMentions(t.ID, canonical) {
+			n++
+		}
+	}
+	if n > 0 {
+		log.Printf("claim backfill: linked %d conversations", n)
+	}
+}
+
+// backfillTranscriptMentions saves mentions for tid's current tree using
+// the canonical ids matched for each text, and reports whether it did.
+func backfillTranscriptMentions(tid int64, canonical map[string]int64) bool {
+	unlock := lockTranscript(tid)
+	defer unlock()
+
+	var mentions []storage.ClaimMention
+	var walk func(stmts []Statement, parentCanonicalID *int64)
+	walk = func(stmts []Statement, parentCanonicalID *int64) {
+		for _, s := range stmts {
+			var canonicalID *int64
+			if id, ok := canonical[s.Text]; ok && s.claimID > 0 {
+				canonicalID = &id
+				mentions = append(mentions, storage.ClaimMention{CanonicalID: id, ClaimID: s.claimID, TranscriptID: tid,
+					Speaker: s.SpeakerID, MsgIndex: s.MsgIndex, Text: s.Text, Type: s.Type, ParentCanonicalID: parentCanonicalID})
+			}
+			walk(s.Children, canonicalID)
+		}
+	}
+	walk(transcriptStatements(tid), nil)
+	saved, err := store.BackfillClaimMentions(tid, mentions)
+	if err != nil {
+		log.Printf("claim backfill: transcript %d: %v", tid, err)
+	}
+	return saved
+}
+
+// claimMentionView is a mention resolved for display.
+type claimMentionView struct {
+	ClaimID      int64  `json:"claim_id"`
+	TranscriptID int64  `json:"transcript_id"`
+	Slug         string `json:"slug"`
+	Title        string `json:"title"`
+	Speaker      string `json:"speaker"`
+	Text         string `json:"text"`
+	Type         string `json:"type"`
+	MsgIndex     *int   `json:"msg_index,omitempty"`
+}
+
+type claimConversation struct {
+	TranscriptID int64  `json:"transcript_id"`
+	Slug         string `json:"slug"`
+	Title        string `json:"title"`
+	Made         int    `json:"made"`
+	Rebutted     int    `json:"rebutted"`
+	Supported    int    `json:"supported"`
+}
+
+type claimSpeaker struct {
+	Name      string `json:"name"`
+	Made      int    `json:"made"`
+	Rebutted  int    `json:"rebutted"`
+	Supported int    `json:"supported"`
+}
+
+type claimDetail struct {
+	ID            int64               `json:"id"`
+	Text          string              `json:"text"`
+	ClaimIDs      []int64             `json:"claim_ids"`
+	Variants      []string            `json:"variants"`
+	Mentions      []claimMentionView  `json:"mentions"`
+	Rebuttals     []claimMentionView  `json:"rebuttals"`
+	Supports      []claimMentionView  `json:"supports"`
+	Conversations []claimConversation `json:"conversations"`
+	Speakers      []claimSpeaker      `json:"speakers"`
+	Graph         any                 `json:"graph,omitempty"`
+}
+
+// buildClaimDetail gathers every conversation and speaker that made,
+// rebutted or supported a canonical claim, leaving out the hidden
+// conversations. The claim's text is that of its first visible mention, as
+// the canonical text may come from a hidden one; sql.ErrNoRows means no
+// mention is visible.
+func buildClaimDetail(canonicalID int64, hidden map[int64]bool) (*claimDetail, error) {
+	c, err := store.GetCanonicalClaim(canonicalID)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := store.GetClaimMentions(canonicalID)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := store.GetClaimReplies(canonicalID)
+	if err != nil {
+		return nil, err
+	}
+
+	type transcriptInfo struct {
+		t        *storage.Transcript
+		speakers map[string]string
+	}
+	transcripts := map[int64]*transcriptInfo{}
+	lookup := func(tid int64) *transcriptInfo {
+		if info, ok := transcripts[tid]; ok {
+			return info
+		}
+		info := &transcriptInfo{t: &storage.Transcript{ID: tid}}
+		if t, err := store.GetTranscript(tid); err == nil {
+			info.t = t
+		}
+		info.speakers, _, _ = store.GetDiarization(tid)
+		transcripts[tid] = info
+		return info
+	}
+
+	d := &claimDetail{
+		ID: c.ID, ClaimIDs: []int64{}, Variants: []string{},
+		Mentions: []claimMentionView{}, Rebuttals: []claimMentionView{}, Supports: []claimMentionView{},
+		Conversations: []claimConversation{}, Speakers: []claimSpeaker{},
+	}
+	convIndex := map[int64]int{}
+	speakerIndex := map[string]int{}
+	seenClaim := map[int64]bool{}
+	seenText := map[string]bool{}
+
+	add := func(m storage.ClaimMention, relation string) {
+		if hidden[m.TranscriptID] {
+			return
+		}
+		info := lookup(m.TranscriptID)
+		speaker := info.speakers[m.Speaker]
+		if speaker == "" {
+			speaker = m.Speaker
+		}
+		v := claimMentionView{
+			ClaimID: m.ClaimID, TranscriptID: m.TranscriptID, Slug: info.t.Slug, Title: info.t.Title,
+			Speaker: speaker, Text: m.Text, Type: m.Type, MsgIndex: m.MsgIndex,
+		}
+		ci, ok := convIndex[m.TranscriptID]
+		if !ok {
+			ci = len(d.Conversations)
+			convIndex[m.TranscriptID] = ci
+			d.Conversations = append(d.Conversations, claimConversation{TranscriptID: m.TranscriptID, Slug: info.t.Slug, Title: info.t.Title})
+		}
+		si, ok := speakerIndex[speaker]
+		if !ok {
+			si = len(d.Speakers)
+			speakerIndex[speaker] = si
+			d.Speakers = append(d.Speakers, claimSpeaker{Name: speaker})
+		}
+		switch relation {
+		case "":
+			d.Mentions = append(d.Mentions, v)
+			d.Conversations[ci].Made++
+			d.Speakers[si].Made++
+		case relationAttack:
+			d.Rebuttals = append(d.Rebuttals, v)
+			d.Conversations[ci].Rebutted++
+			d.Speakers[si].Rebutted++
+		case relationSupport:
+			d.Supports = append(d.Supports, v)
+			d.Conversations[ci].Supported++
+			d.Speakers[si].Supported++
+		}
+	}
+
+	for _, m := range mentions {
+		if hidden[m.TranscriptID] {
+			continue
+		}
+		add(m, "")
+		if d.Text == "" {
+			d.Text = m.Text
+		}
+		if !seenClaim[m.ClaimID] {
+			seenClaim[m.ClaimID] = true
+			d.ClaimIDs = append(d.ClaimIDs, m.ClaimID)
+		}
+		if !seenText[m.Text] {
+			seenText[m.Text] = true
+			d.Variants = append(d.Variants, m.Text)
+		}
+	}
+	if len(d.Mentions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	for _, m := range replies {
+		if rel := statementRelation(m.Type); rel != "" {
+			add(m, rel)
+		}
+	}
+	return d, nil
+}
+
+// GET /api/claims/{id} — id is a claim id as found in graphs and trees; the
+// response describes the canonical claim it belongs to.
+func handleAPIClaim(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := r.URL.Path
+	path = strings.TrimPrefix(path, "/argraphments")
+	path = strings.TrimPrefix(path, "/api/claims/")
+	id, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"invalid id"}`, 400)
+		return
+	}
+	hidden := hiddenTranscripts(requestUser(r))
+	hiddenIDs := hiddenClaims(hidden)
+	if hiddenIDs[id] {
+		http.Error(w, `{"error":"not found"}`, 404)
+		return
+	}
+	g, err := store.GetClaimGraph(id)
+	if err != nil {
+		http.Error(w, `{"error":"not found"}`, 404)
+		return
+	}
+	graph := filterGraph(g, hiddenIDs)
+
+	canonicalID, err := store.CanonicalIDForClaim(id)
+	if err != nil {
+		// Not linked yet: persisted before canonicalization existed
+		json.NewEncoder(w).Encode(map[string]any{"graph": graph})
+		return
+	}
+	d, err := buildClaimDetail(canonicalID, hidden)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"not found"}`, 404)
+		return
+	}
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	d.Graph = graph
+	json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func TestNormalizeClaimText(t *testing.T) {
+	if got := normalizeClaimText("  Remote work ISN'T  productive!! "); got != "remote work isnt productive" {
+		t.Fatalf("got %q", got)
+	}
+	got := claimTokens(normalizeClaimText("The cats are chasing the cats' toys"))
+	if fmt.Sprint(got) != "[cat chasing toy]" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func persistClaimConversation(t *testing.T, title string, stmts []Statement) int64 {
+	t.Helper()
+	tid, _ := store.SaveTranscript("", "")
+	store.UpdateTitle(tid, title)
+	return persistStatements("", stmts, map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}, []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "one"},
+		{Speaker: "speaker_2", Text: "two"},
+	}, nil, tid)
+}
+
+func TestClaimsCanonicalizedAcrossConversations(t *testing.T) {
+	setupTestStore(t)
+	persistClaimConversation(t, "First", []Statement{
+		{Speaker: "speaker_1", Text: "Remote work makes teams more productive.", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_2", Text: "Offices help collaboration", Type: "rebuttal", MsgIndex: intp(2)},
+		}},
+	})
+	persistClaimConversation(t, "Second", []Statement{
+		{Speaker: "speaker_2", Text: "Remote work makes a team more productive", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_1", Text: "Studies show fewer interruptions at home", Type: "evidence", MsgIndex: intp(2)},
+		}},
+		{Speaker: "speaker_1", Text: "Pineapple belongs on pizza", Type: "claim", MsgIndex: intp(2)},
+	})
+
+	canonicalID, err := store.FindCanonicalClaim(normalizeClaimText("Remote work makes teams more productive."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mentions, _ := store.GetClaimMentions(canonicalID)
+	if len(mentions) != 2 {
+		t.Fatalf("want paraphrases merged into one canonical claim, got %d mentions", len(mentions))
+	}
+	pizza, _ := store.FindCanonicalClaim(normalizeClaimText("Pineapple belongs on pizza"))
+	if pizza == canonicalID {
+		t.Fatal("unrelated claim merged")
+	}
+
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/claims/%d", mentions[1].ClaimID), nil))
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var d claimDetail
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != canonicalID || len(d.Variants) != 2 || len(d.Conversations) != 2 {
+		t.Fatalf("unexpected detail: %+v", d)
+	}
+	if len(d.Rebuttals) != 1 || d.Rebuttals[0].Speaker != "Ben" || d.Rebuttals[0].Title != "First" {
+		t.Fatalf("unexpected rebuttals: %+v", d.Rebuttals)
+	}
+	if len(d.Supports) != 1 || d.Supports[0].Title != "Second" {
+		t.Fatalf("unexpected supports: %+v", d.Supports)
+	}
+}
+
+func TestClaimsReanalysisReplacesMentions(t *testing.T) {
+	setupTestStore(t)
+	stmts := []Statement{{Speaker: "speaker_1", Text: "Taxes should be lower", Type: "claim", MsgIndex: intp(1)}}
+	tid := persistClaimConversation(t, "Taxes", stmts)
+	persistStatements("", stmts, nil, nil, nil, tid)
+
+	id, _ := store.FindCanonicalClaim("taxes should be lower")
+	if mentions, _ := store.GetClaimMentions(id); len(mentions) != 1 {
+		t.Fatalf("want 1 mention after re-persist, got %d", len(mentions))
+	}
+}
+
+func TestClaimsLLMConfirm(t *testing.T) {
+	setupTestStore(t)
+	fake := newFakeLLM()
+	prevLLM, prevConfirm, prevAuto := llm, claimLLMConfirm, claimAutoMerge
+	llm, claimLLMConfirm, claimAutoMerge = fake, true, 1
+	t.Cleanup(func() { llm, claimLLMConfirm, claimAutoMerge = prevLLM, prevConfirm, prevAuto })
+
+	// The confirmation runs with neither the canonical nor the transcript
+	// lock held
+	tid := persistClaimConversation(t, "Energy", []Statement{
+		{Speaker: "speaker_1", Text: "Nuclear power is the safest energy source available", Type: "claim", MsgIndex: intp(1)},
+	})
+	var locked []string
+	fake.Respond = func(string) (string, error) {
+		if !canonicalMu.TryLock() {
+			locked = append(locked, "canonical")
+		} else {
+			canonicalMu.Unlock()
+		}
+		if mu, ok := transcriptLocks.Load(tid); ok && !mu.(*sync.Mutex).TryLock() {
+			locked = append(locked, "transcript")
+		} else if ok {
+			mu.(*sync.Mutex).Unlock()
+		}
+		return "yes", nil
+	}
+	persistIncremental(tid, &IncrementalResult{Statements: []Statement{
+		{Speaker: "speaker_2", Text: "Nuclear power is the safest source of energy", Type: "response", MsgIndex: intp(2),
+			ParentText: "Nuclear power is the safest energy source available"},
+	}})
+	if len(fake.Prompts()) != 1 {
+		t.Fatalf("want one confirmation prompt, got %d", len(fake.Prompts()))
+	}
+	if len(locked) > 0 {
+		t.Fatalf("confirmation ran holding the %v lock", locked)
+	}
+	a, _ := store.FindCanonicalClaim(normalizeClaimText("Nuclear power is the safest energy source available"))
+	if mentions, _ := store.GetClaimMentions(a); len(mentions) != 2 {
+		t.Fatalf("confirmed paraphrase not merged: %+v", mentions)
+	}
+}
+
+func TestBackfillClaimMentions(t *testing.T) {
+	setupTestStore(t)
+	tid := persistClaimConversation(t, "Old", []Statement{
+		{Speaker: "speaker_1", Text: "Cities should ban cars downtown", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_2", Text: "Shops would lose customers", Type: "rebuttal", MsgIndex: intp(2)},
+		}},
+	})
+	// As saved before canonicalization existed
+	store.DeleteClaimMentions(tid)
+
+	backfillClaimMentions()
+	id, err := store.FindCanonicalClaim(normalizeClaimText("Cities should ban cars downtown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mentions, _ := store.GetClaimMentions(id); len(mentions) != 1 || mentions[0].TranscriptID != tid || mentions[0].Speaker != "speaker_1" {
+		t.Fatalf("unexpected mentions: %+v", mentions)
+	}
+	if replies, _ := store.GetClaimReplies(id); len(replies) != 1 || replies[0].Type != "rebuttal" {
+		t.Fatalf("unexpected replies: %+v", replies)
+	}
+
+	// A second run leaves linked conversations alone
+	backfillClaimMentions()
+	if mentions, _ := store.GetClaimMentions(id); len(mentions) != 1 {
+		t.Fatalf("backfill repeated: %+v", mentions)
+	}
+}
+
+func TestCanonicalCandidatesRankBySimilarity(t *testing.T) {
+	setupTestStore(t)
+	query := []string{"alpha", "beta", "gamma"}
+	// Long claims sharing every query token, created first
+	for i := 0; i < claimCandidateLimit+5; i++ {
+		toks := append([]string(nil), query...)
+		for j := 0; j < 10; j++ {
+			toks = append(toks, fmt.Sprintf("noise%d_%d", i, j))
+		}
+		store.CreateCanonicalClaim(fmt.Sprint("noise ", i), fmt.Sprint("noise ", i), toks)
+	}
+	best, _ := store.CreateCanonicalClaim("alpha beta gamma delta", "alpha beta gamma delta", []string{"alpha", "beta", "delta", "gamma"})
+
+	candidates, err := store.CanonicalCandidates(query, claimCandidateLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != claimCandidateLimit || candidates[0].ID != best {
+		t.Fatalf("closest claim %d not ranked first: %+v", best, candidates)
+	}
+}
@@ -0,0 +1,251 @@
+// Command eval scores the argument-tree pipeline against hand-labeled
+// conversations. Each *.json file in the gold directory holds a
+// conversation's speakers and messages plus the statement tree it should
+// produce, in the shape /api/analyze returns. The tool runs every
+// conversation through a server's /api/analyze and reports how well the
+// predicted trees map statements to messages, nest them, type them and
+// attribute them.
+//
+// Analysis saves a conversation on the server, so point it at a scratch
+// instance (ARGRAPHMENTS_DB=/tmp/eval.db go run .) or pass a token so the
+// runs are saved unlisted under that account.
+//
+//	go run ./cmd/eval -server http://localhost:8086 -out run.json testdata/eval
+//	go run ./cmd/eval -baseline run.json testdata/eval
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// goldConversation is one labeled file.
+type goldConversation struct {
+	Speakers   map[string]string `json:"speakers"`
+	Messages   []goldMessage     `json:"messages"`
+	Statements []statement       `json:"statements"`
+}
+
+type goldMessage struct {
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+type conversationReport struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+	metrics
+}
+
+type report struct {
+	Server        string               `json:"server"`
+	RanAt         time.Time            `json:"ran_at"`
+	Overall       metrics              `json:"overall"`
+	Conversations []conversationReport `json:"conversations"`
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8086", "argraphments base URL")
+	token := flag.String("token", os.Getenv("ARGRAPHMENTS_TOKEN"), "API token to analyze as")
+	out := flag.String("out", "", "write the JSON report to this file")
+	baseline := flag.String("baseline", "", "JSON report from an earlier run to compare against")
+	timeout := flag.Duration("timeout", 5*time.Minute, "per-conversation analysis timeout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: eval [flags] gold-dir\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := filepath.Glob(filepath.Join(flag.Arg(0), "*.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(files) == 0 {
+		log.Fatalf("no *.json gold files in %s", flag.Arg(0))
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	rep := report{Server: *server, RanAt: time.Now().UTC(), Conversations: []conversationReport{}}
+	var total counts
+	for _, path := range files {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		cr := conversationReport{Name: name}
+		c, err := evaluate(client, *server, *token, path)
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			cr.Error = err.Error()
+		}
+		total.add(c)
+		cr.metrics = c.metrics()
+		rep.Conversations = append(rep.Conversations, cr)
+	}
+	rep.Overall = total.metrics()
+
+	printReport(os.Stdout, rep)
+	if *baseline != "" {
+		data, err := os.ReadFile(*baseline)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var base report
+		if err := json.Unmarshal(data, &base); err != nil {
+			log.Fatalf("%s: %v", *baseline, err)
+		}
+		fmt.Println()
+		printComparison(os.Stdout, base, rep)
+	}
+	if *out != "" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		if err := os.WriteFile(*out, append(data, '\n'), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// evaluate analyzes one gold conversation and scores the result. Gold
+// counts are filled in even when analysis fails, so recall reflects it.
+func evaluate(client *http.Client, server, token, path string) (counts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return counts{}, err
+	}
+	var gold goldConversation
+	if err := json.Unmarshal(data, &gold); err != nil {
+		return counts{}, err
+	}
+	names := map[string]string{}
+	for id, name := range gold.Speakers {
+		if name != "" {
+			names[name] = id
+		}
+	}
+	goldFlat := flatten(gold.Statements, names)
+	if len(gold.Messages) == 0 || len(goldFlat) == 0 {
+		return counts{}, fmt.Errorf("gold file needs messages and statements")
+	}
+
+	pred, err := analyze(client, server, token, gold)
+	if err != nil {
+		return counts{Gold: len(goldFlat)}, err
+	}
+	return score(goldFlat, flatten(pred, names)), nil
+}
+
+// analyze sends the conversation the way the frontend does: numbered
+// "[N] (speaker_id) Name: text" lines plus the diarization.
+func analyze(client *http.Client, server, token string, gold goldConversation) ([]statement, error) {
+	var lines []string
+	for i, m := range gold.Messages {
+		name := gold.Speakers[m.Speaker]
+		if name == "" {
+			name = m.Speaker
+		}
+		lines = append(lines, fmt.Sprintf("[%d] (%s) %s: %s", i+1, m.Speaker, name, m.Text))
+	}
+	body, _ := json.Marshal(map[string]any{
+		"transcript": strings.Join(lines, "\n"),
+		"speakers":   gold.Speakers,
+		"messages":   gold.Messages,
+	})
+	req, err := http.NewRequest("POST", strings.TrimSuffix(server, "/")+"/api/analyze", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("analyze %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var result struct {
+		Statements []statement `json:"statements"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+	return result.Statements, nil
+}
+
+func pct(f float64) string {
+	return fmt.Sprintf("%.1f%%", f*100)
+}
+
+func printReport(w io.Writer, rep report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "conversation\tgold\tpred\tprecision\trecall\tF1\tparent\ttype\tspeaker\t")
+	row := func(name string, m metrics) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", name, m.Gold, m.Predicted,
+			pct(m.Precision), pct(m.Recall), pct(m.F1), pct(m.ParentAccuracy), pct(m.TypeAccuracy), pct(m.SpeakerAccuracy))
+	}
+	for _, c := range rep.Conversations {
+		if c.Error != "" {
+			fmt.Fprintf(tw, "%s\t%d\tfailed\t\t\t\t\t\t\t\n", c.Name, c.Gold)
+			continue
+		}
+		row(c.Name, c.metrics)
+	}
+	row("overall", rep.Overall)
+	tw.Flush()
+
+	labels := confusionLabels(rep.Overall.TypeConfusion)
+	if len(labels) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\ntype confusion (rows gold, columns predicted):")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "\t")
+	for _, l := range labels {
+		fmt.Fprintf(tw, "%s\t", l)
+	}
+	fmt.Fprintln(tw)
+	for _, g := range labels {
+		fmt.Fprintf(tw, "%s\t", g)
+		for _, p := range labels {
+			fmt.Fprintf(tw, "%d\t", rep.Overall.TypeConfusion[g][p])
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+// printComparison shows the overall metrics of both runs and the change.
+func printComparison(w io.Writer, base, cur report) {
+	fmt.Fprintf(w, "compared with %s:\n", base.RanAt.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "metric\tbaseline\tthis run\tchange (pts)\t")
+	for _, m := range []struct {
+		name      string
+		base, cur float64
+	}{
+		{"precision", base.Overall.Precision, cur.Overall.Precision},
+		{"recall", base.Overall.Recall, cur.Overall.Recall},
+		{"F1", base.Overall.F1, cur.Overall.F1},
+		{"parent", base.Overall.ParentAccuracy, cur.Overall.ParentAccuracy},
+		{"type", base.Overall.TypeAccuracy, cur.Overall.TypeAccuracy},
+		{"speaker", base.Overall.SpeakerAccuracy, cur.Overall.SpeakerAccuracy},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+.1f\t\n", m.name, pct(m.base), pct(m.cur), (m.cur-m.base)*100)
+	}
+	tw.Flush()
+}
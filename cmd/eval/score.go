@@ -0,0 +1,198 @@
+package main
+
+import (
+	"sort"
+)
+
+// statement mirrors the server's Statement JSON. Gold files use the same
+// shape, so an analyze reply can be hand-corrected into a label.
+type statement struct {
+	Speaker   string      `json:"speaker"`
+	SpeakerID string      `json:"speaker_id,omitempty"`
+	Text      string      `json:"text"`
+	Type      string      `json:"type"`
+	MsgIndex  *int        `json:"msg_index,omitempty"`
+	Children  []statement `json:"children"`
+}
+
+// flatStatement is a statement with its parent reduced to the parent's
+// msg_index: 0 at the top level, -1 under a parent with no msg_index.
+type flatStatement struct {
+	MsgIndex  int
+	Speaker   string
+	Type      string
+	ParentMsg int
+	Text      string
+}
+
+// flatten walks the tree. Statements without a msg_index get MsgIndex 0 and
+// can't be matched. names maps display names to speaker ids for statements
+// that carry only a name.
+func flatten(stmts []statement, names map[string]string) []flatStatement {
+	var out []flatStatement
+	var walk func(stmts []statement, parent int)
+	walk = func(stmts []statement, parent int) {
+		for _, s := range stmts {
+			f := flatStatement{Speaker: s.SpeakerID, Type: s.Type, ParentMsg: parent, Text: s.Text}
+			if f.Speaker == "" {
+				f.Speaker = names[s.Speaker]
+			}
+			childParent := -1
+			if s.MsgIndex != nil {
+				f.MsgIndex = *s.MsgIndex
+				childParent = *s.MsgIndex
+			}
+			out = append(out, f)
+			walk(s.Children, childParent)
+		}
+	}
+	walk(stmts, 0)
+	return out
+}
+
+// counts are the raw tallies behind the metrics. They add up across
+// conversations, so the overall metrics are micro-averaged.
+type counts struct {
+	Gold           int                       `json:"gold"`
+	Predicted      int                       `json:"predicted"`
+	Matched        int                       `json:"matched"`
+	Unindexed      int                       `json:"unindexed"` // predicted without msg_index
+	ParentCorrect  int                       `json:"parent_correct"`
+	TypeCorrect    int                       `json:"type_correct"`
+	SpeakerCorrect int                       `json:"speaker_correct"`
+	TypeConfusion  map[string]map[string]int `json:"type_confusion"` // gold type → predicted type → count
+}
+
+func (c *counts) add(o counts) {
+	c.Gold += o.Gold
+	c.Predicted += o.Predicted
+	c.Matched += o.Matched
+	c.Unindexed += o.Unindexed
+	c.ParentCorrect += o.ParentCorrect
+	c.TypeCorrect += o.TypeCorrect
+	c.SpeakerCorrect += o.SpeakerCorrect
+	for g, row := range o.TypeConfusion {
+		for p, n := range row {
+			c.confuse(g, p, n)
+		}
+	}
+}
+
+func (c *counts) confuse(gold, pred string, n int) {
+	if c.TypeConfusion == nil {
+		c.TypeConfusion = map[string]map[string]int{}
+	}
+	if c.TypeConfusion[gold] == nil {
+		c.TypeConfusion[gold] = map[string]int{}
+	}
+	c.TypeConfusion[gold][pred] += n
+}
+
+// metrics are the scores reported for a conversation or a whole run.
+// Precision and recall are over statement-to-message mapping; the
+// accuracies are over matched statements.
+type metrics struct {
+	counts
+	Precision       float64 `json:"precision"`
+	Recall          float64 `json:"recall"`
+	F1              float64 `json:"f1"`
+	ParentAccuracy  float64 `json:"parent_accuracy"`
+	TypeAccuracy    float64 `json:"type_accuracy"`
+	SpeakerAccuracy float64 `json:"speaker_accuracy"`
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+func (c counts) metrics() metrics {
+	m := metrics{counts: c}
+	if m.TypeConfusion == nil {
+		m.TypeConfusion = map[string]map[string]int{}
+	}
+	m.Precision = ratio(c.Matched, c.Predicted)
+	m.Recall = ratio(c.Matched, c.Gold)
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+	m.ParentAccuracy = ratio(c.ParentCorrect, c.Matched)
+	m.TypeAccuracy = ratio(c.TypeCorrect, c.Matched)
+	m.SpeakerAccuracy = ratio(c.SpeakerCorrect, c.Matched)
+	return m
+}
+
+// score matches predicted statements to gold ones on msg_index, one to one.
+// Within a message each gold statement takes the unmatched prediction that
+// agrees with it on the most of parent, type and speaker, so the order the
+// model lists statements in doesn't matter.
+func score(gold, pred []flatStatement) counts {
+	c := counts{Gold: len(gold), Predicted: len(pred), TypeConfusion: map[string]map[string]int{}}
+	byMsg := map[int][]int{}
+	for i, p := range pred {
+		if p.MsgIndex == 0 {
+			c.Unindexed++
+			continue
+		}
+		byMsg[p.MsgIndex] = append(byMsg[p.MsgIndex], i)
+	}
+	used := make([]bool, len(pred))
+	agreement := func(g, p flatStatement) int {
+		n := 0
+		if g.ParentMsg == p.ParentMsg {
+			n++
+		}
+		if g.Type == p.Type {
+			n++
+		}
+		if g.Speaker == p.Speaker {
+			n++
+		}
+		return n
+	}
+
+	for _, g := range gold {
+		best, bestScore := -1, -1
+		for _, i := range byMsg[g.MsgIndex] {
+			if s := agreement(g, pred[i]); !used[i] && s > bestScore {
+				best, bestScore = i, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[best] = true
+		p := pred[best]
+		c.Matched++
+		if g.ParentMsg == p.ParentMsg {
+			c.ParentCorrect++
+		}
+		if g.Type == p.Type {
+			c.TypeCorrect++
+		}
+		if g.Speaker == p.Speaker {
+			c.SpeakerCorrect++
+		}
+		c.confuse(g.Type, p.Type, 1)
+	}
+	return c
+}
+
+// confusionLabels lists every type seen on either axis, sorted.
+func confusionLabels(m map[string]map[string]int) []string {
+	seen := map[string]bool{}
+	for g, row := range m {
+		seen[g] = true
+		for p := range row {
+			seen[p] = true
+		}
+	}
+	labels := make([]string, 0, len(seen))
+	for l := range seen {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
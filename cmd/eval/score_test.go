@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func intp(i int) *int { return &i }
+
+func TestFlatten(t *testing.T) {
+	tree := []statement{
+		{SpeakerID: "speaker_1", Type: "claim", MsgIndex: intp(1), Children: []statement{
+			{Speaker: "Ben", Type: "rebuttal", MsgIndex: intp(2)},
+			{SpeakerID: "speaker_1", Type: "evidence", Children: []statement{
+				{SpeakerID: "speaker_2", Type: "question", MsgIndex: intp(4)},
+			}},
+		}},
+	}
+	got := flatten(tree, map[string]string{"Ben": "speaker_2"})
+	want := []flatStatement{
+		{MsgIndex: 1, Speaker: "speaker_1", Type: "claim", ParentMsg: 0},
+		{MsgIndex: 2, Speaker: "speaker_2", Type: "rebuttal", ParentMsg: 1},
+		{MsgIndex: 0, Speaker: "speaker_1", Type: "evidence", ParentMsg: 1},
+		{MsgIndex: 4, Speaker: "speaker_2", Type: "question", ParentMsg: -1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("flatten = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("flatten[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	gold := []flatStatement{
+		{MsgIndex: 1, Speaker: "speaker_1", Type: "claim"},
+		{MsgIndex: 2, Speaker: "speaker_2", Type: "rebuttal", ParentMsg: 1},
+		{MsgIndex: 3, Speaker: "speaker_1", Type: "evidence", ParentMsg: 2},
+		{MsgIndex: 3, Speaker: "speaker_1", Type: "claim", ParentMsg: 0},
+	}
+	pred := []flatStatement{
+		{MsgIndex: 1, Speaker: "speaker_1", Type: "claim"},
+		{MsgIndex: 2, Speaker: "speaker_1", Type: "response", ParentMsg: 1}, // wrong speaker and type
+		{MsgIndex: 3, Speaker: "speaker_1", Type: "claim", ParentMsg: 0},    // listed before its sibling
+		{MsgIndex: 3, Speaker: "speaker_1", Type: "evidence", ParentMsg: 1}, // wrong parent
+		{MsgIndex: 5, Speaker: "speaker_2", Type: "claim"},                  // no such gold message
+		{Speaker: "speaker_2", Type: "claim"},                               // no msg_index
+	}
+	c := score(gold, pred)
+	if c.Gold != 4 || c.Predicted != 6 || c.Matched != 4 || c.Unindexed != 1 {
+		t.Fatalf("counts = %+v", c)
+	}
+	if c.ParentCorrect != 3 || c.TypeCorrect != 3 || c.SpeakerCorrect != 3 {
+		t.Errorf("parent/type/speaker correct = %d/%d/%d, want 3/3/3", c.ParentCorrect, c.TypeCorrect, c.SpeakerCorrect)
+	}
+	if c.TypeConfusion["rebuttal"]["response"] != 1 || c.TypeConfusion["evidence"]["evidence"] != 1 {
+		t.Errorf("confusion = %v", c.TypeConfusion)
+	}
+
+	m := c.metrics()
+	if m.Precision != 4.0/6 || m.Recall != 1 || math.Abs(m.F1-0.8) > 1e-9 {
+		t.Errorf("precision/recall/F1 = %v/%v/%v", m.Precision, m.Recall, m.F1)
+	}
+	if m.ParentAccuracy != 0.75 {
+		t.Errorf("parent accuracy = %v", m.ParentAccuracy)
+	}
+}
+
+func TestCountsAdd(t *testing.T) {
+	var total counts
+	total.add(score([]flatStatement{{MsgIndex: 1, Type: "claim"}}, []flatStatement{{MsgIndex: 1, Type: "claim"}}))
+	total.add(score([]flatStatement{{MsgIndex: 1, Type: "claim"}}, nil))
+	m := total.metrics()
+	if m.Gold != 2 || m.Matched != 1 || m.Recall != 0.5 || m.Precision != 1 {
+		t.Errorf("overall = %+v", m)
+	}
+	if total.TypeConfusion["claim"]["claim"] != 1 {
+		t.Errorf("confusion = %v", total.TypeConfusion)
+	}
+	if (counts{}).metrics().TypeConfusion == nil {
+		t.Error("empty metrics should have an empty confusion matrix")
+	}
+}
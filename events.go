@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseEvent is one Server-Sent Event: Name becomes the "event:" line and
+// Data is JSON-encoded into "data:".
+type sseEvent struct {
+	Name string
+	Data any
+}
+
+// broker fans events out to in-process subscribers by topic. Publishing
+// never blocks: a subscriber that falls behind its buffer misses events.
+type broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan sseEvent]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: map[string]map[chan sseEvent]struct{}{}}
+}
+
+var events = newBroker()
+
+func (b *broker) subscribe(topic string) (<-chan sseEvent, func()) {
+	ch := make(chan sseEvent, 32)
+	b.mu.Lock()
+	if b.subs[topic] == nil {
+		b.subs[topic] = map[chan sseEvent]struct{}{}
+	}
+	b.subs[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[topic], ch)
+			if len(b.subs[topic]) == 0 {
+				delete(b.subs, topic)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (b *broker) publish(topic string, ev sseEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+const sseKeepAlive = 15 * time.Second
+
+// startSSE sets the stream headers and returns the flusher, or writes an
+// error if the ResponseWriter cannot stream.
+func startSSE(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "streaming unsupported", 500)
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable nginx buffering
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return flusher, true
+}
+
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, ev sseEvent) error {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+	if ev.Name != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", ev.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Exports render a conversation's argument tree for argument-mapping tools.
+// Statement types are mapped onto the two relations those tools share:
+// rebuttals attack their parent, agreement and evidence support it, and the
+// rest are dialogue replies with no inferential relation.
+const (
+	relationAttack  = "attack"
+	relationSupport = "support"
+)
+
+func statementRelation(typ string) string {
+	switch typ {
+	case "rebuttal":
+		return relationAttack
+	case "agreement", "evidence":
+		return relationSupport
+	}
+	return ""
+}
+
+// exportDoc is the input shared by every format.
+type exportDoc struct {
+	Title      string
+	Speakers   map[string]string // speaker_id → name
+	Statements []Statement
+}
+
+func (d *exportDoc) speakerName(key string) string {
+	if name := d.Speakers[key]; name != "" {
+		return name
+	}
+	return key
+}
+
+type exportFormat struct {
+	Ext         string
+	ContentType string
+	Render      func(d *exportDoc) []byte
+}
+
+var exportFormats = map[string]exportFormat{
+	"argdown":  {".argdown", "text/plain; charset=utf-8", renderArgdown},
+	"aif":      {".json", "application/ld+json", renderAIF},
+	"dot":      {".dot", "text/vnd.graphviz; charset=utf-8", renderDOT},
+	"markdown": {".md", "text/markdown; charset=utf-8", renderMarkdown},
+}
+
+// GET /api/transcripts/{slug}/export?format=argdown|aif|dot|markdown
+func handleExport(w http.ResponseWriter, r *http.Request, t *storage.Transcript) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("format")
+	format, ok := exportFormats[name]
+	if !ok {
+		names := make([]string, 0, len(exportFormats))
+		for n := range exportFormats {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		jsonError(w, "format must be one of: "+strings.Join(names, ", "), 400)
+		return
+	}
+
+	speakers, _, _ := store.GetDiarization(t.ID)
+	tree, err := store.GetClaimTree(t.ID)
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	doc := &exportDoc{Title: t.Title, Speakers: speakers, Statements: claimTreeToStatements(tree)}
+	if doc.Title == "" {
+		doc.Title = t.Slug
+	}
+
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s%s"`, t.Slug, format.Ext))
+	w.Write(format.Render(doc))
+}
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// oneLine collapses newlines and runs of whitespace in statement text.
+func oneLine(s string) string {
+	return strings.TrimSpace(whitespaceRun.ReplaceAllString(s, " "))
+}
+
+// --- Argdown ---
+
+var argdownEscaper = strings.NewReplacer(
+	`\`, `\\`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `#`, `\#`, `{`, `\{`, `}`, `\}`,
+)
+
+// renderArgdown writes attacks and supports as nested "-" and "+" relations.
+// Argdown has no neutral relation, so other replies start their own
+// top-level block with a comment naming the statement they answer.
+func renderArgdown(d *exportDoc) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "===\ntitle: %s\n===\n\n# %s\n", strconv.Quote(d.Title), argdownEscaper.Replace(oneLine(d.Title)))
+
+	type pending struct {
+		stmt   Statement
+		parent string
+	}
+	var queue []pending
+	n := 0
+	var write func(s Statement, depth int, prefix string)
+	write = func(s Statement, depth int, prefix string) {
+		n++
+		title := fmt.Sprintf("S%d", n)
+		fmt.Fprintf(&b, "%s%s[%s]: %s #%s {speaker: %s",
+			strings.Repeat("  ", depth), prefix, title, argdownEscaper.Replace(oneLine(s.Text)), s.Type,
+			strconv.Quote(d.speakerName(s.Speaker)))
+		if s.MsgIndex != nil {
+			fmt.Fprintf(&b, ", msg_index: %d", *s.MsgIndex)
+		}
+		b.WriteString("}\n")
+		for _, c := range s.Children {
+			switch statementRelation(c.Type) {
+			case relationAttack:
+				write(c, depth+1, "- ")
+			case relationSupport:
+				write(c, depth+1, "+ ")
+			default:
+				queue = append(queue, pending{c, title})
+			}
+		}
+	}
+
+	for _, s := range d.Statements {
+		b.WriteString("\n")
+		write(s, 0, "")
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		fmt.Fprintf(&b, "\n// replies to [%s]\n", p.parent)
+		write(p.stmt, 0, "")
+	}
+	return b.Bytes()
+}
+
+// --- AIF ---
+
+// AIF in the AIFdb JSON layout. Each statement is an I-node (its content)
+// asserted by an L-node (the speaker's locution) through a YA node; replies
+// are TA transitions between locutions, and attacks and supports add CA and
+// RA nodes between the I-nodes.
+type aifNode struct {
+	NodeID string `json:"nodeID"`
+	Text   string `json:"text"`
+	Type   string `json:"type"`
+}
+
+type aifEdge struct {
+	EdgeID string `json:"edgeID"`
+	FromID string `json:"fromID"`
+	ToID   string `json:"toID"`
+}
+
+type aifLocution struct {
+	NodeID   string `json:"nodeID"`
+	PersonID string `json:"personID"`
+}
+
+type aifParticipant struct {
+	ParticipantID string `json:"participantID"`
+	Firstname     string `json:"firstname"`
+	Surname       string `json:"surname"`
+}
+
+type aifDoc struct {
+	Context      map[string]string `json:"@context"`
+	Title        string            `json:"title"`
+	Nodes        []aifNode         `json:"nodes"`
+	Edges        []aifEdge         `json:"edges"`
+	Locutions    []aifLocution     `json:"locutions"`
+	Participants []aifParticipant  `json:"participants"`
+}
+
+func renderAIF(d *exportDoc) []byte {
+	doc := aifDoc{
+		Context:      map[string]string{"@vocab": "http://www.arg.dundee.ac.uk/aif#"},
+		Title:        d.Title,
+		Nodes:        []aifNode{},
+		Edges:        []aifEdge{},
+		Locutions:    []aifLocution{},
+		Participants: []aifParticipant{},
+	}
+	nextID := 0
+	node := func(typ, text string) string {
+		nextID++
+		id := strconv.Itoa(nextID)
+		doc.Nodes = append(doc.Nodes, aifNode{NodeID: id, Text: text, Type: typ})
+		return id
+	}
+	edge := func(from, to string) {
+		doc.Edges = append(doc.Edges, aifEdge{EdgeID: strconv.Itoa(len(doc.Edges) + 1), FromID: from, ToID: to})
+	}
+	people := map[string]string{}
+	person := func(key string) string {
+		if id, ok := people[key]; ok {
+			return id
+		}
+		id := strconv.Itoa(len(people) + 1)
+		people[key] = id
+		doc.Participants = append(doc.Participants, aifParticipant{ParticipantID: id, Firstname: d.speakerName(key)})
+		return id
+	}
+
+	var walk func(s Statement, parentI, parentL string)
+	walk = func(s Statement, parentI, parentL string) {
+		text := oneLine(s.Text)
+		iNode := node("I", text)
+		lNode := node("L", d.speakerName(s.Speaker)+": "+text)
+		doc.Locutions = append(doc.Locutions, aifLocution{NodeID: lNode, PersonID: person(s.Speaker)})
+		illocution := "Asserting"
+		if s.Type == "question" {
+			illocution = "Pure Questioning"
+		}
+		ya := node("YA", illocution)
+		edge(lNode, ya)
+		edge(ya, iNode)
+
+		if parentL != "" {
+			ta := node("TA", "Default Transition")
+			edge(parentL, ta)
+			edge(ta, lNode)
+			switch statementRelation(s.Type) {
+			case relationAttack:
+				ca := node("CA", "Default Conflict")
+				edge(iNode, ca)
+				edge(ca, parentI)
+			case relationSupport:
+				ra := node("RA", "Default Inference")
+				edge(iNode, ra)
+				edge(ra, parentI)
+			}
+		}
+		for _, c := range s.Children {
+			walk(c, iNode, lNode)
+		}
+	}
+	for _, s := range d.Statements {
+		walk(s, "", "")
+	}
+
+	out, _ := json.MarshalIndent(doc, "", "  ")
+	return out
+}
+
+// --- Graphviz ---
+
+var dotTypeColors = map[string]string{
+	"claim":         "#7c6ff0",
+	"response":      "#6ec1e4",
+	"question":      "#e4c76e",
+	"agreement":     "#7ce4a1",
+	"rebuttal":      "#e47070",
+	"tangent":       "#b070e4",
+	"clarification": "#6ec1e4",
+	"evidence":      "#7ce4a1",
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// wrapText breaks s into lines of about width characters for node labels.
+func wrapText(s string, width int) string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderDOT draws each reply as an edge to the statement it answers, so
+// roots sit at the top with rankdir=BT.
+func renderDOT(d *exportDoc) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph argument {\n  label=%s;\n  labelloc=t;\n  rankdir=BT;\n", dotQuote(d.Title))
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", fillcolor=\"#eeeeee\"];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+
+	n := 0
+	var walk func(s Statement, parent string)
+	walk = func(s Statement, parent string) {
+		n++
+		id := fmt.Sprintf("s%d", n)
+		label := d.speakerName(s.Speaker) + ":\n" + wrapText(oneLine(s.Text), 40)
+		fmt.Fprintf(&b, "  %s [label=%s", id, dotQuote(label))
+		if color, ok := dotTypeColors[s.Type]; ok {
+			fmt.Fprintf(&b, ", fillcolor=%s", dotQuote(color))
+		}
+		b.WriteString("];\n")
+		if parent != "" {
+			fmt.Fprintf(&b, "  %s -> %s [label=%s", id, parent, dotQuote(s.Type))
+			switch statementRelation(s.Type) {
+			case relationAttack:
+				b.WriteString(`, color="#e47070"`)
+			case relationSupport:
+				b.WriteString(`, color="#3fa66a"`)
+			default:
+				b.WriteString(`, style=dashed, color="#888888"`)
+			}
+			b.WriteString("];\n")
+		}
+		for _, c := range s.Children {
+			walk(c, id)
+		}
+	}
+	for _, s := range d.Statements {
+		walk(s, "")
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// --- Markdown ---
+
+func renderMarkdown(d *exportDoc) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", oneLine(d.Title))
+	var walk func(s Statement, depth int)
+	walk = func(s Statement, depth int) {
+		fmt.Fprintf(&b, "%s- **%s** _(%s)_: %s", strings.Repeat("  ", depth), d.speakerName(s.Speaker), s.Type, oneLine(s.Text))
+		if s.MsgIndex != nil {
+			fmt.Fprintf(&b, " [%d]", *s.MsgIndex)
+		}
+		b.WriteString("\n")
+		for _, c := range s.Children {
+			walk(c, depth+1)
+		}
+	}
+	for _, s := range d.Statements {
+		walk(s, 0)
+	}
+	return b.Bytes()
+}
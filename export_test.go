@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func setupExportSession(t *testing.T) string {
+	t.Helper()
+	setupTestStore(t)
+	tid, _ := store.SaveTranscript("", "")
+	store.UpdateTitle(tid, "Go vs Python")
+	persistStatements("", []Statement{
+		{Speaker: "speaker_1", Text: "Go is simpler to deploy", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_2", Text: "Python has [more] libraries", Type: "rebuttal", MsgIndex: intp(2), Children: []Statement{
+				{Speaker: "speaker_1", Text: "Go's standard library covers most needs", Type: "evidence", MsgIndex: intp(3)},
+			}},
+			{Speaker: "speaker_2", Text: "What about GUIs?", Type: "question", MsgIndex: intp(4)},
+		}},
+	}, map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}, []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "Go is simpler to deploy"},
+		{Speaker: "speaker_2", Text: "Python has [more] libraries"},
+		{Speaker: "speaker_1", Text: "Go's standard library covers most needs"},
+		{Speaker: "speaker_2", Text: "What about GUIs?"},
+	}, nil, tid)
+	tr, _ := store.GetTranscript(tid)
+	return tr.Slug
+}
+
+func exportAs(t *testing.T, slug, format string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", "/api/transcripts/"+slug+"/export?format="+format, nil))
+	return w
+}
+
+func TestExportArgdown(t *testing.T) {
+	slug := setupExportSession(t)
+	w := exportAs(t, slug, "argdown")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	got := w.Body.String()
+	for _, want := range []string{
+		`[S1]: Go is simpler to deploy #claim {speaker: "Ada", msg_index: 1}`,
+		`  - [S2]: Python has \[more\] libraries #rebuttal {speaker: "Ben", msg_index: 2}`,
+		`    + [S3]: Go's standard library covers most needs #evidence`,
+		"// replies to [S1]\n[S4]: What about GUIs? #question",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestExportAIF(t *testing.T) {
+	slug := setupExportSession(t)
+	w := exportAs(t, slug, "aif")
+	var doc aifDoc
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	counts := map[string]int{}
+	for _, n := range doc.Nodes {
+		counts[n.Type]++
+	}
+	if counts["I"] != 4 || counts["L"] != 4 || counts["YA"] != 4 || counts["TA"] != 3 || counts["CA"] != 1 || counts["RA"] != 1 {
+		t.Fatalf("unexpected node counts: %v", counts)
+	}
+	if len(doc.Participants) != 2 || doc.Participants[1].Firstname != "Ben" || len(doc.Locutions) != 4 {
+		t.Fatalf("unexpected participants: %+v", doc.Participants)
+	}
+}
+
+func TestExportDOTAndMarkdown(t *testing.T) {
+	slug := setupExportSession(t)
+	dot := exportAs(t, slug, "dot").Body.String()
+	if !strings.HasPrefix(dot, "digraph argument {") || !strings.Contains(dot, `s2 -> s1 [label="rebuttal", color="#e47070"]`) ||
+		!strings.Contains(dot, `s4 -> s1 [label="question", style=dashed`) {
+		t.Fatalf("unexpected DOT:\n%s", dot)
+	}
+
+	md := exportAs(t, slug, "markdown").Body.String()
+	if !strings.HasPrefix(md, "# Go vs Python\n") || !strings.Contains(md, "\n    - **Ada** _(evidence)_: Go's standard library covers most needs [3]\n") {
+		t.Fatalf("unexpected Markdown:\n%s", md)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	slug := setupExportSession(t)
+	if w := exportAs(t, slug, "pdf"); w.Code != 400 {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Fixture tests run the real provider clients against golden files in
+// testdata/fixtures/<test name>/, one per outbound call, keyed by a hash of
+// the request (for LLM calls, effectively the prompt). By default they
+// replay and need no keys or network; a call with no fixture fails the test.
+// To re-record against the live services:
+//
+//	ANTHROPIC_API_KEY=... FIXTURES=record go test -run TestFixture
+//
+// Recording uses the default Anthropic model, which replay assumes. Headers
+// are never written, so keys stay out of the files. Changing a prompt
+// changes its key; re-record and commit the new files.
+const fixtureDir = "testdata/fixtures"
+
+func recordingFixtures() bool {
+	return os.Getenv("FIXTURES") == "record"
+}
+
+// httpFixture is one recorded HTTP round trip.
+type httpFixture struct {
+	Request struct {
+		Method string          `json:"method"`
+		Path   string          `json:"path"`
+		Body   json.RawMessage `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int             `json:"status"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"response"`
+}
+
+// ytdlpFixture is one recorded caption fetch.
+type ytdlpFixture struct {
+	URL      string         `json:"url"`
+	Text     string         `json:"text"`
+	Title    string         `json:"title"`
+	Segments []TimedSegment `json:"segments"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// fixtureTransport records round trips to dir through next, or replays them
+// from dir when next is nil. A missing fixture is a transport error, which
+// callers surface like any other provider failure.
+type fixtureTransport struct {
+	t    *testing.T
+	dir  string
+	next http.RoundTripper
+}
+
+func (f *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	key, err := fixtureKey(req, body)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(f.dir, "http-"+key+".json")
+
+	if f.next == nil {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("no fixture for %s %s (%s); re-record with FIXTURES=record", req.Method, req.URL.Path, path)
+		}
+		var fx httpFixture
+		if err := json.Unmarshal(data, &fx); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &http.Response{
+			StatusCode: fx.Response.Status,
+			Status:     fmt.Sprintf("%d %s", fx.Response.Status, http.StatusText(fx.Response.Status)),
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(fx.Response.Body)),
+			Request:    req,
+		}, nil
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := f.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	var fx httpFixture
+	fx.Request.Method = req.Method
+	fx.Request.Path = req.URL.Path
+	if json.Valid(body) {
+		fx.Request.Body = body
+	}
+	fx.Response.Status = resp.StatusCode
+	fx.Response.Body = fixtureJSON(respBody)
+	writeFixture(f.t, path, fx)
+	return resp, nil
+}
+
+// fixtureKey hashes the method, path and body. Multipart bodies hash their
+// parts instead, since the boundary is random.
+func fixtureKey(req *http.Request, body []byte) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.Path)
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s %s\n", part.FormName(), part.FileName())
+			io.Copy(h, part)
+		}
+	} else {
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// fixtureJSON keeps a JSON body as-is and wraps anything else in a string.
+func fixtureJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	s, _ := json.Marshal(string(body))
+	return s
+}
+
+func writeFixture(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureFetchYouTube records or replays yt-dlp caption fetches in dir.
+func fixtureFetchYouTube(t *testing.T, dir string, record bool) func(string) (string, string, []TimedSegment, error) {
+	return func(videoURL string) (string, string, []TimedSegment, error) {
+		sum := sha256.Sum256([]byte(videoURL))
+		path := filepath.Join(dir, "ytdlp-"+hex.EncodeToString(sum[:])[:16]+".json")
+		var fx ytdlpFixture
+		if record {
+			text, title, segments, err := fetchYouTubeTranscript(videoURL)
+			fx = ytdlpFixture{URL: videoURL, Text: text, Title: title, Segments: segments}
+			if err != nil {
+				fx.Error = err.Error()
+			}
+			writeFixture(t, path, fx)
+			return text, title, segments, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("no yt-dlp fixture for %s (%s); re-record with FIXTURES=record", videoURL, path)
+		}
+		if err := json.Unmarshal(data, &fx); err != nil {
+			return "", "", nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if fx.Error != "" {
+			return fx.Text, fx.Title, fx.Segments, fmt.Errorf("%s", fx.Error)
+		}
+		return fx.Text, fx.Title, fx.Segments, nil
+	}
+}
+
+// useFixtures points the LLM, HTTP client and yt-dlp fetcher at the test's
+// fixtures until it finishes. Recording starts from an empty directory so
+// calls the test no longer makes don't linger.
+func useFixtures(t *testing.T) {
+	t.Helper()
+	dir := filepath.Join(fixtureDir, t.Name())
+	record := recordingFixtures()
+
+	prevLLM, prevClient, prevFetch := llm, httpClient, fetchYouTube
+	t.Cleanup(func() { llm, httpClient, fetchYouTube = prevLLM, prevClient, prevFetch })
+
+	transport := &fixtureTransport{t: t, dir: dir}
+	if record {
+		if p := os.Getenv("LLM_PROVIDER"); (p != "" && p != "anthropic") || os.Getenv("LLM_MODEL") != "" {
+			t.Fatal("fixtures are recorded against the default Anthropic model; unset LLM_PROVIDER and LLM_MODEL")
+		}
+		os.RemoveAll(dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		recorder, err := newLLMFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		llm = recorder
+		transport.next = http.DefaultTransport
+	} else {
+		llm = &anthropicLLM{apiKey: "replay", model: defaultAnthropicModel, baseURL: "https://api.anthropic.com"}
+	}
+	httpClient = &http.Client{Transport: transport}
+	fetchYouTube = fixtureFetchYouTube(t, dir, record)
+}
+
+func TestFixtureKey(t *testing.T) {
+	newReq := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "https://api.anthropic.com/v1/messages", strings.NewReader(body))
+	}
+	a, _ := fixtureKey(newReq(`{"prompt":"a"}`), []byte(`{"prompt":"a"}`))
+	b, _ := fixtureKey(newReq(`{"prompt":"b"}`), []byte(`{"prompt":"b"}`))
+	if a == b {
+		t.Error("different prompts share a key")
+	}
+
+	// The same multipart upload keys the same under different boundaries
+	multipartKey := func() string {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("model", "whisper-1")
+		part, _ := w.CreateFormFile("file", "a.wav")
+		part.Write([]byte("RIFF"))
+		w.Close()
+		req := httptest.NewRequest("POST", "https://api.openai.com/v1/audio/transcriptions", nil)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		key, err := fixtureKey(req, buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	if multipartKey() != multipartKey() {
+		t.Error("multipart key depends on the boundary")
+	}
+}
+
+func TestFixtureTransportReplayMissing(t *testing.T) {
+	client := &http.Client{Transport: &fixtureTransport{t: t, dir: t.TempDir()}}
+	if _, err := client.Post("https://api.anthropic.com/v1/messages", "application/json", strings.NewReader(`{}`)); err == nil ||
+		!strings.Contains(err.Error(), "FIXTURES=record") {
+		t.Errorf("missing fixture error = %v, want a re-record hint", err)
+	}
+}
+
+func TestFixtureTransportRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content":[{"type":"text","text":"recorded"}]}`))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	httpClient = &http.Client{Transport: &fixtureTransport{t: t, dir: dir, next: http.DefaultTransport}}
+	defer func() { httpClient = http.DefaultClient }()
+	a := &anthropicLLM{apiKey: "secret-key", model: defaultAnthropicModel, baseURL: srv.URL}
+	if got, err := a.Complete(t.Context(), "hello", CompletionOptions{MaxTokens: 10}); err != nil || got != "recorded" {
+		t.Fatalf("record: %q, %v", got, err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("recorded %d fixtures, want 1", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if strings.Contains(string(data), "secret-key") {
+		t.Error("fixture contains the API key")
+	}
+
+	// Replay from a different host gives the same answer without a server
+	httpClient = &http.Client{Transport: &fixtureTransport{t: t, dir: dir}}
+	a.baseURL = "https://api.anthropic.com"
+	if got, err := a.Complete(t.Context(), "hello", CompletionOptions{MaxTokens: 10}); err != nil || got != "recorded" {
+		t.Fatalf("replay: %q, %v", got, err)
+	}
+}
+
+// fixturePost sends a JSON request through the mux and decodes the reply.
+func fixturePost(t *testing.T, mux *http.ServeMux, path string, payload, out any) {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("POST %s: %d %s", path, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+}
+
+// TestFixturePipeline imports a YouTube debate and takes it through
+// diarization, analysis, persistence and a live incremental update.
+func TestFixturePipeline(t *testing.T) {
+	useFixtures(t)
+	setupTestStore(t)
+	mux := setupMux()
+
+	var imported struct {
+		Text     string         `json:"text"`
+		Title    string         `json:"title"`
+		Segments []TimedSegment `json:"segments"`
+	}
+	fixturePost(t, mux, "/api/import/youtube", map[string]string{"url": "https://www.youtube.com/watch?v=fx0Nuclear1"}, &imported)
+	if imported.Text == "" || len(imported.Segments) == 0 {
+		t.Fatalf("import returned no captions: %+v", imported)
+	}
+
+	var diarized DiarizeResult
+	fixturePost(t, mux, "/api/diarize", map[string]any{"transcript": imported.Text, "segments": imported.Segments}, &diarized)
+	if len(diarized.Speakers) != 2 || len(diarized.Messages) < 4 {
+		t.Fatalf("diarize: %d speakers, %d messages", len(diarized.Speakers), len(diarized.Messages))
+	}
+	for i, m := range diarized.Messages {
+		if m.StartMs == nil {
+			t.Errorf("message %d has no timestamp", i+1)
+		}
+	}
+
+	var lines []string
+	for _, m := range diarized.Messages {
+		name := diarized.Speakers[m.Speaker]
+		if name == "" {
+			name = m.Speaker
+		}
+		lines = append(lines, fmt.Sprintf("(%s) %s: %s", m.Speaker, name, m.Text))
+	}
+	var analyzed analyzeResponse
+	fixturePost(t, mux, "/api/analyze", map[string]any{
+		"transcript": strings.Join(lines, "\n"),
+		"speakers":   diarized.Speakers,
+		"messages":   diarized.Messages,
+	}, &analyzed)
+	if analyzed.Slug == "" || analyzed.Title == "" {
+		t.Fatalf("analyze: slug %q, title %q", analyzed.Slug, analyzed.Title)
+	}
+	if analyzed.Validation != nil {
+		t.Errorf("recorded analysis needed repairs: %+v", analyzed.Validation)
+	}
+	rebuttals, factChecks := 0, 0
+	var walk func([]Statement)
+	walk = func(stmts []Statement) {
+		for _, s := range stmts {
+			if s.Type == "rebuttal" {
+				rebuttals++
+			}
+			if s.FactCheck != nil {
+				factChecks++
+			}
+			walk(s.Children)
+		}
+	}
+	walk(analyzed.Statements)
+	if rebuttals == 0 || factChecks == 0 {
+		t.Errorf("analysis has %d rebuttals and %d fact checks, want some of each", rebuttals, factChecks)
+	}
+
+	// A new message arrives while the conversation is live
+	newLine := numberTranscriptLinesOffset("(speaker_2) Priya: Fine, but France built most of its reactors in about fifteen years.", len(lines))
+	var inc IncrementalResult
+	fixturePost(t, mux, "/api/analyze-incremental", map[string]any{
+		"new_text":     newLine,
+		"context_text": numberTranscriptLines(strings.Join(lines, "\n")),
+		"existing":     analyzed.Statements,
+		"slug":         analyzed.Slug,
+	}, &inc)
+	if len(inc.Statements) != 1 || inc.Statements[0].ParentText == "" {
+		t.Fatalf("incremental: %+v", inc.Statements)
+	}
+
+	var count func([]Statement) int
+	count = func(stmts []Statement) int {
+		n := len(stmts)
+		for _, s := range stmts {
+			n += count(s.Children)
+		}
+		return n
+	}
+	tr := mustTranscript(t, analyzed.Slug)
+	stored := transcriptStatements(tr.ID)
+	before, after := count(analyzed.Statements), count(stored)
+	if after != before+1 {
+		t.Errorf("stored %d statements after the live update, want %d", after, before+1)
+	}
+	if parent := findStatementByText(stored, inc.Statements[0].ParentText); parent == nil ||
+		findStatementByText(parent.Children, inc.Statements[0].Text) == nil {
+		t.Errorf("live statement not nested under %q", inc.Statements[0].ParentText)
+	}
+	if tr.Title != analyzed.Title {
+		t.Errorf("stored title %q, want %q", tr.Title, analyzed.Title)
+	}
+}
+
+// TestFixturesHaveNoSecrets guards against committing recorded keys.
+func TestFixturesHaveNoSecrets(t *testing.T) {
+	secret := regexp.MustCompile(`sk-(ant-)?[A-Za-z0-9_-]{20,}`)
+	var files []string
+	filepath.Walk(fixtureDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.Match(data) {
+			t.Errorf("%s looks like it contains an API key", path)
+		}
+	}
+}
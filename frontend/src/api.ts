@@ -8,6 +8,18 @@ import type {
   Statement,
   SpeakerDetail,
   DiarizeMessage,
+  TimedSegment,
+  ValidationReport,
+  Revision,
+  ImportResponse,
+  SearchHit,
+  Page,
+  User,
+  Visibility,
+  TranscriptAccess,
+  SpeakerAppearance,
+  SpeakerProfile,
+  ConversationAnalytics,
 } from './types';
 
 export function getBasePath(): string {
@@ -21,12 +33,27 @@ export async function createSession(): Promise<{ slug: string; id: number }> {
   return resp.json();
 }
 
-export async function transcribeAudio(form: FormData): Promise<{ text: string }> {
+export async function transcribeAudio(form: FormData): Promise<{ text: string; segments?: TimedSegment[] }> {
   const resp = await fetch(bp() + '/api/transcribe', { method: 'POST', body: form });
   return resp.json();
 }
 
-export async function diarize(transcript: string, segments?: unknown[]): Promise<DiarizeData> {
+// WebSocket URL for streaming 16-bit mono PCM into a session.
+export function ingestURL(slug: string, sampleRate: number): string {
+  const proto = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+  return `${proto}//${window.location.host}${bp()}/api/transcripts/${encodeURIComponent(slug)}/ingest?sample_rate=${sampleRate}`;
+}
+
+export interface IngestMessage {
+  type: 'segment' | 'error' | 'done';
+  text?: string;
+  start_ms?: number;
+  end_ms?: number;
+  msg_index?: number;
+  error?: string;
+}
+
+export async function diarize(transcript: string, segments?: TimedSegment[]): Promise<DiarizeData> {
   const body: Record<string, unknown> = { transcript };
   if (segments?.length) body.segments = segments;
   const resp = await fetch(bp() + '/api/diarize', {
@@ -71,8 +98,9 @@ export async function analyzeIncremental(
   existing: Statement[],
   msgOffset: number,
   contextText?: string,
-  fullReview?: boolean
-): Promise<{ statements: Statement[]; updates?: StatementUpdate[] }> {
+  fullReview?: boolean,
+  slug?: string | null
+): Promise<{ statements: Statement[]; updates?: StatementUpdate[]; validation?: ValidationReport }> {
   const resp = await fetch(bp() + '/api/analyze-incremental', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
@@ -82,14 +110,25 @@ export async function analyzeIncremental(
       existing,
       msg_offset: msgOffset,
       full_review: !!fullReview,
+      slug: slug || '',
     }),
   });
   return resp.json();
 }
 
-export async function listTranscripts(): Promise<TranscriptListItem[]> {
-  const resp = await fetch(bp() + '/api/transcripts');
-  return resp.json();
+// List endpoints return an array page with the total and next cursor in headers.
+async function listPage<T>(path: string, params: Record<string, string>): Promise<Page<T>> {
+  const query = new URLSearchParams(params).toString();
+  const resp = await fetch(bp() + path + (query ? '?' + query : ''));
+  return {
+    items: await resp.json(),
+    total: Number(resp.headers.get('X-Total-Count') || 0),
+    nextCursor: resp.headers.get('X-Next-Cursor') || undefined,
+  };
+}
+
+export function listTranscripts(params: Record<string, string> = {}): Promise<Page<TranscriptListItem>> {
+  return listPage('/api/transcripts', params);
 }
 
 export async function getTranscript(slug: string): Promise<TranscriptDetail> {
@@ -97,6 +136,63 @@ export async function getTranscript(slug: string): Promise<TranscriptDetail> {
   return resp.json();
 }
 
+export type ExportFormat = 'argdown' | 'aif' | 'dot' | 'markdown';
+
+export function exportURL(slug: string, format: ExportFormat): string {
+  return bp() + '/api/transcripts/' + encodeURIComponent(slug) + '/export?format=' + format;
+}
+
+export async function setVisibility(slug: string, visibility: Visibility): Promise<TranscriptAccess> {
+  const resp = await fetch(bp() + '/api/transcripts/' + encodeURIComponent(slug) + '/access', {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ visibility }),
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Failed to change visibility');
+  return data;
+}
+
+export async function getAnalytics(slug: string): Promise<ConversationAnalytics> {
+  const resp = await fetch(bp() + '/api/transcripts/' + encodeURIComponent(slug) + '/analytics');
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Failed to load analytics');
+  return data;
+}
+
+export async function listRevisions(slug: string): Promise<Revision[]> {
+  const resp = await fetch(bp() + '/api/transcripts/' + encodeURIComponent(slug) + '/revisions');
+  return resp.json();
+}
+
+export async function revertRevision(slug: string, id: number): Promise<{ statements: Statement[] }> {
+  const resp = await fetch(bp() + '/api/transcripts/' + encodeURIComponent(slug) + '/revisions/' + id + '/revert', {
+    method: 'POST',
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Revert failed');
+  return data;
+}
+
+export interface TranscriptEventHandlers {
+  transcript?: (t: TranscriptDetail['transcript']) => void;
+  utterances?: (e: { offset: number; speakers?: Record<string, string>; messages: DiarizeMessage[] }) => void;
+  statements?: (e: { statements: Statement[]; replace?: boolean }) => void;
+  updates?: (e: { updates: StatementUpdate[] }) => void;
+  speakers?: (e: { speakers: Record<string, string> }) => void;
+}
+
+// Subscribes to a session's live events. Returns a function that closes
+// the stream; EventSource reconnects on its own until then.
+export function subscribeTranscriptEvents(slug: string, handlers: TranscriptEventHandlers): () => void {
+  const es = new EventSource(bp() + '/api/transcripts/' + encodeURIComponent(slug) + '/events');
+  for (const [name, handler] of Object.entries(handlers)) {
+    if (!handler) continue;
+    es.addEventListener(name, (ev) => handler(JSON.parse((ev as MessageEvent).data)));
+  }
+  return () => es.close();
+}
+
 export async function updateTranscriptSpeakers(
   slug: string,
   speakers: Record<string, string>,
@@ -109,9 +205,8 @@ export async function updateTranscriptSpeakers(
   });
 }
 
-export async function listSpeakers(): Promise<SpeakerSummary[]> {
-  const resp = await fetch(bp() + '/api/speakers');
-  return resp.json();
+export function listSpeakers(params: Record<string, string> = {}): Promise<Page<SpeakerSummary>> {
+  return listPage('/api/speakers', params);
 }
 
 export async function getSpeaker(name: string): Promise<SpeakerDetail> {
@@ -127,6 +222,45 @@ export async function renameSpeakerAPI(oldName: string, newName: string): Promis
   });
 }
 
+export async function getSpeakerProfile(name: string): Promise<SpeakerProfile> {
+  const resp = await fetch(bp() + '/api/speakers/' + encodeURIComponent(name) + '/profile');
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Failed to load profile');
+  return data;
+}
+
+async function speakerRequest<T>(name: string, sub: string, method: string, body?: unknown): Promise<T> {
+  const resp = await fetch(bp() + '/api/speakers/' + encodeURIComponent(name) + '/' + sub, {
+    method,
+    headers: body ? { 'Content-Type': 'application/json' } : undefined,
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Request failed');
+  return data;
+}
+
+// Folds the speaker called from into name; from becomes an alias.
+export function mergeSpeakers(name: string, from: string): Promise<SpeakerDetail> {
+  return speakerRequest(name, 'merge', 'POST', { from });
+}
+
+export function splitSpeaker(
+  name: string,
+  to: string,
+  appearances: SpeakerAppearance[]
+): Promise<{ from: SpeakerDetail; to: SpeakerDetail }> {
+  return speakerRequest(name, 'split', 'POST', { name: to, appearances });
+}
+
+export function addSpeakerAlias(name: string, alias: string): Promise<string[]> {
+  return speakerRequest(name, 'aliases', 'POST', { alias });
+}
+
+export function removeSpeakerAlias(name: string, alias: string): Promise<string[]> {
+  return speakerRequest(name, 'aliases/' + encodeURIComponent(alias), 'DELETE');
+}
+
 export async function fetchSample(): Promise<SampleResponse> {
   const resp = await fetch(bp() + '/api/sample', { method: 'POST' });
   if (!resp.ok) {
@@ -136,6 +270,23 @@ export async function fetchSample(): Promise<SampleResponse> {
   return resp.json();
 }
 
+export async function importTranscript(file: File): Promise<ImportResponse> {
+  const form = new FormData();
+  form.append('file', file);
+  const resp = await fetch(bp() + '/api/import/transcript', { method: 'POST', body: form });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Import failed');
+  return data;
+}
+
+export async function search(q: string, filters: Record<string, string> = {}): Promise<SearchHit[]> {
+  const params = new URLSearchParams({ q, ...filters });
+  const resp = await fetch(bp() + '/api/search?' + params);
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Search failed');
+  return data.hits;
+}
+
 export async function importYouTubeTitleOnly(url: string): Promise<{ title?: string }> {
   const resp = await fetch(bp() + '/api/import/youtube', {
     method: 'POST',
@@ -144,3 +295,24 @@ export async function importYouTubeTitleOnly(url: string): Promise<{ title?: str
   });
   return resp.json();
 }
+
+export async function getMe(): Promise<{ user: User | null; signup: boolean }> {
+  const resp = await fetch(bp() + '/api/auth/me');
+  return resp.json();
+}
+
+// Signs in, or signs up when signup is set; the server sets the session cookie.
+export async function login(username: string, password: string, signup = false): Promise<User> {
+  const resp = await fetch(bp() + '/api/auth/' + (signup ? 'signup' : 'login'), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ username, password }),
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Sign in failed');
+  return data.user;
+}
+
+export async function logout(): Promise<void> {
+  await fetch(bp() + '/api/auth/logout', { method: 'POST' });
+}
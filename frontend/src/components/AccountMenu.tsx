@@ -0,0 +1,71 @@
+import React, { useEffect, useState } from 'react';
+import { getMe, login, logout } from '../api';
+import type { User } from '../types';
+
+// Sign in/out in the header. Accounts are optional: anonymous visitors can
+// do everything except own conversations.
+export default function AccountMenu() {
+  const [user, setUser] = useState<User | null>(null);
+  const [canSignup, setCanSignup] = useState(false);
+  const [open, setOpen] = useState(false);
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState('');
+
+  useEffect(() => {
+    getMe()
+      .then((me) => {
+        setUser(me.user);
+        setCanSignup(me.signup);
+      })
+      .catch(() => {});
+  }, []);
+
+  const submit = async (e: React.FormEvent, signup: boolean) => {
+    e.preventDefault();
+    setError('');
+    try {
+      setUser(await login(username, password, signup));
+      setOpen(false);
+      setPassword('');
+      // Access to the current page may have changed
+      window.location.reload();
+    } catch (err) {
+      setError((err as Error).message);
+    }
+  };
+
+  const signOut = async () => {
+    await logout();
+    setUser(null);
+    window.location.reload();
+  };
+
+  if (user) {
+    return (
+      <div className="account-menu">
+        <span className="account-name">{user.username}</span>
+        <button className="account-link" onClick={signOut}>sign out</button>
+      </div>
+    );
+  }
+
+  return (
+    <div className="account-menu">
+      <button className="account-link" onClick={() => setOpen(!open)}>sign in</button>
+      {open && (
+        <form className="account-form" onSubmit={(e) => submit(e, false)}>
+          <input type="text" placeholder="username" value={username} onChange={(e) => setUsername(e.target.value)} autoFocus />
+          <input type="password" placeholder="password" value={password} onChange={(e) => setPassword(e.target.value)} />
+          {error && <div className="account-error">{error}</div>}
+          <div className="account-actions">
+            <button className="btn" type="submit">Sign in</button>
+            {canSignup && (
+              <button className="btn btn-secondary" type="button" onClick={(e) => submit(e, true)}>Sign up</button>
+            )}
+          </div>
+        </form>
+      )}
+    </div>
+  );
+}
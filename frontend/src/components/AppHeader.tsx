@@ -2,6 +2,7 @@ import React from 'react';
 import { getBasePath } from '../api';
 import { useSession } from '../context/SessionContext';
 import { useSpeakers } from '../context/SpeakerContext';
+import AccountMenu from './AccountMenu';
 
 export default function AppHeader() {
   const { setView, resetSession, setSpeakerPageName } = useSession();
@@ -38,6 +39,7 @@ export default function AppHeader() {
         <a href={bp + '/speakers'} onClick={goSpeakers}>speakers</a>
         <a href={bp + '/conversations'} onClick={goConversations}>conversations</a>
       </nav>
+      <AccountMenu />
       <a href="https://kayushkin.com" className="attribution">kayushkin.com</a>
     </header>
   );
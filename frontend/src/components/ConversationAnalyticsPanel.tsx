@@ -0,0 +1,68 @@
+import React, { useState } from 'react';
+import { getAnalytics } from '../api';
+import { useSpeakers } from '../context/SpeakerContext';
+import type { ConversationAnalytics } from '../types';
+import { formatMs } from '../utils/format';
+
+// Talk time and turn-taking, loaded when first opened.
+export default function ConversationAnalyticsPanel({ slug }: { slug: string }) {
+  const { getSpeakerColor } = useSpeakers();
+  const [data, setData] = useState<ConversationAnalytics | null>(null);
+  const [error, setError] = useState('');
+
+  const load = (e: React.SyntheticEvent<HTMLDetailsElement>) => {
+    if (!e.currentTarget.open || data) return;
+    getAnalytics(slug).then(setData).catch((err) => setError(err.message));
+  };
+
+  const peak = data ? Math.max(1, ...data.timeline.map((b) => Object.values(b.talk_ms).reduce((a, n) => a + n, 0))) : 1;
+
+  return (
+    <details className="conversation-analytics" onToggle={load}>
+      <summary>Analytics</summary>
+      {error && <div className="revision-error">{error}</div>}
+      {data && !data.timed && <p className="text-dim">No timestamps: talk time and turn-taking need timed utterances.</p>}
+      {data && (
+        <>
+          <table className="analytics-speakers">
+            <thead>
+              <tr>
+                <th>Speaker</th><th>Talk</th><th>Turns</th><th>Longest</th><th>Interrupted others</th><th>Was interrupted</th><th>Avg reply</th>
+              </tr>
+            </thead>
+            <tbody>
+              {data.speakers.map((s) => (
+                <tr key={s.speaker_id}>
+                  <td><span className="speaker-dot" style={{ background: getSpeakerColor(s.speaker_id) }}></span> {s.name}</td>
+                  <td>{data.timed ? `${formatMs(s.talk_ms)} (${Math.round(s.talk_share * 100)}%)` : `${s.words}w`}</td>
+                  <td>{s.turns}</td>
+                  <td>{data.timed ? formatMs(s.longest_turn_ms) : '—'}</td>
+                  <td>{s.interruptions}</td>
+                  <td>{s.interrupted}</td>
+                  <td>{data.timed ? formatMs(s.avg_response_latency_ms) : '—'}</td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+          {data.timed && data.timeline.length > 0 && (
+            <div className="analytics-timeline" title="Talk time over the conversation">
+              {data.timeline.map((b) => (
+                <div key={b.start_ms} className="analytics-timeline-bar" title={formatMs(b.start_ms)}>
+                  {Object.entries(b.talk_ms).map(([id, ms]) => (
+                    <div key={id} style={{ height: `${(ms / peak) * 100}%`, background: getSpeakerColor(id) }}></div>
+                  ))}
+                </div>
+              ))}
+            </div>
+          )}
+          {data.timed && (
+            <p className="text-dim">
+              {data.turns} turns over {formatMs(data.duration_ms)} · median reply {formatMs(data.response_latency.median_ms)}
+              {data.overlaps.length > 0 && ` · ${data.overlaps.filter((o) => o.interruption).length} interruptions`}
+            </p>
+          )}
+        </>
+      )}
+    </details>
+  );
+}
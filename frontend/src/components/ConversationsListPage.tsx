@@ -1,32 +1,99 @@
 import React, { useEffect, useState } from 'react';
-import { getBasePath, listTranscripts } from '../api';
+import { getBasePath, listTranscripts, search } from '../api';
 import { useSession } from '../context/SessionContext';
-import type { TranscriptListItem } from '../types';
-import { getConversationDisplayTitle } from '../utils/format';
+import type { SearchHit, TranscriptListItem } from '../types';
+import { formatMs, getConversationDisplayTitle } from '../utils/format';
 import AppHeader from './AppHeader';
 
+// Snippets mark matches with <mark></mark> around otherwise raw text.
+function Snippet({ text }: { text: string }) {
+  const parts = text.split(/<mark>|<\/mark>/);
+  return <>{parts.map((p, i) => (i % 2 ? <mark key={i}>{p}</mark> : p))}</>;
+}
+
 export default function ConversationsListPage() {
   const [convos, setConvos] = useState<TranscriptListItem[] | null>(null);
+  const [total, setTotal] = useState(0);
+  const [nextCursor, setNextCursor] = useState<string | undefined>();
+  const [query, setQuery] = useState('');
+  const [hits, setHits] = useState<SearchHit[] | null>(null);
   const { setView, setSlug } = useSession();
   const bp = getBasePath();
 
   useEffect(() => {
-    listTranscripts().then(setConvos).catch(() => setConvos([]));
+    listTranscripts()
+      .then((p) => {
+        setConvos(p.items);
+        setTotal(p.total);
+        setNextCursor(p.nextCursor);
+      })
+      .catch(() => setConvos([]));
   }, []);
 
-  const loadConvo = (slug: string, e: React.MouseEvent) => {
+  const loadMore = () => {
+    if (!nextCursor) return;
+    listTranscripts({ cursor: nextCursor }).then((p) => {
+      setConvos((prev) => [...(prev || []), ...p.items]);
+      setNextCursor(p.nextCursor);
+    });
+  };
+
+  useEffect(() => {
+    if (!query.trim()) {
+      setHits(null);
+      return;
+    }
+    const timer = setTimeout(() => {
+      search(query).then(setHits).catch(() => setHits([]));
+    }, 250);
+    return () => clearTimeout(timer);
+  }, [query]);
+
+  const loadConvo = (slug: string, e: React.MouseEvent, msgIndex?: number) => {
     e.preventDefault();
     setSlug(slug);
     setView('session');
-    history.pushState({ slug }, '', bp + '/convo/' + slug);
+    history.pushState({ slug }, '', bp + '/convo/' + slug + (msgIndex ? '#msg-' + msgIndex : ''));
   };
 
   return (
     <div className="container">
       <AppHeader />
       <div className="list-page">
-        <h2>Conversations</h2>
-        {convos === null ? (
+        <h2>Conversations{total > 0 && <span className="list-count">{total}</span>}</h2>
+        <input
+          className="search-input"
+          type="search"
+          placeholder="Search transcripts and claims…"
+          value={query}
+          onChange={(e) => setQuery(e.target.value)}
+        />
+        {hits !== null ? (
+          hits.length === 0 ? (
+            <p className="text-dim">No matches.</p>
+          ) : (
+            <div className="list-items">
+              {hits.map((h, i) => (
+                <a
+                  key={i}
+                  className="list-item search-hit"
+                  href={bp + '/convo/' + h.slug + (h.msg_index ? '#msg-' + h.msg_index : '')}
+                  onClick={(e) => loadConvo(h.slug, e, h.msg_index)}
+                >
+                  <div>
+                    {h.speaker && <span className="list-item-name">{h.speaker}: </span>}
+                    <span className="search-snippet"><Snippet text={h.snippet} /></span>
+                  </div>
+                  <span className="list-item-meta">
+                    {getConversationDisplayTitle(h.title, h.slug)}
+                    {h.start_ms != null && ' · ' + formatMs(h.start_ms)}
+                    {h.kind !== 'utterance' && ' · ' + (h.type || h.kind)}
+                  </span>
+                </a>
+              ))}
+            </div>
+          )
+        ) : convos === null ? (
           <p className="text-dim">Loading…</p>
         ) : convos.length === 0 ? (
           <p className="text-dim">No conversations yet. Record or paste one!</p>
@@ -47,10 +114,14 @@ export default function ConversationsListPage() {
                   <div>
                     <span className="list-item-name">{displayTitle}</span>
                   </div>
-                  <span className="list-item-meta">{date}</span>
+                  <span className="list-item-meta">
+                    {t.claim_count > 0 && `${t.claim_count} claims · `}
+                    {date}
+                  </span>
                 </a>
               );
             })}
+            {nextCursor && <button className="btn btn-secondary" onClick={loadMore}>Load more</button>}
           </div>
         )}
       </div>
@@ -12,8 +12,8 @@ export default function DiscoverySection() {
   const bp = getBasePath();
 
   useEffect(() => {
-    listSpeakers().then(setSpeakers).catch(() => {});
-    listTranscripts().then(setConvos).catch(() => {});
+    listSpeakers({ sort: 'conversations', limit: '10' }).then((p) => setSpeakers(p.items)).catch(() => {});
+    listTranscripts({ limit: '10' }).then((p) => setConvos(p.items)).catch(() => {});
   }, []);
 
   if (!speakers.length && !convos.length) return null;
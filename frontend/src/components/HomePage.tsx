@@ -5,6 +5,7 @@ import { useSession } from '../context/SessionContext';
 import { useSpeakers } from '../context/SpeakerContext';
 import { useRecording } from '../hooks/useRecording';
 import { assignWordBasedTimestamps } from '../utils/timestamps';
+import type { ImportResponse, SampleResponse } from '../types';
 import DiscoverySection from './DiscoverySection';
 import AppHeader from './AppHeader';
 
@@ -92,43 +93,64 @@ export default function HomePage() {
     setShowFinal(true);
   };
 
+  // Opens an already-diarized conversation as a new session and analyzes it
+  const startDiarized = async (data: SampleResponse | ImportResponse) => {
+    resetSpeakers();
+    setSourceURL(data.url || '');
+    const dd = { speakers: data.speakers, messages: data.messages };
+    assignWordBasedTimestamps(dd.messages);
+    setDiarizeData(dd);
+    setFullTranscript(data.text);
+    // Set speaker names
+    const names: Record<string, string> = {};
+    const autoGen: Record<string, boolean> = {};
+    for (const [id, name] of Object.entries(data.speakers)) {
+      names[id] = name || pickAnonName();
+      if (!name) autoGen[id] = true;
+    }
+    setSpeakerNames(names);
+    setSpeakerAutoGen(autoGen);
+    setAnalyzedStatements([]);
+    lastAnalyzedTranscript.current = '';
+    await createNewSession();
+    if (data.title) setSourceTitle(data.title);
+    setShowFinal(true);
+    goToSession();
+    // Run analysis
+    const transcript = dd.messages.map((m) => `${names[m.speaker] || m.speaker}: ${m.text}`).join('\n');
+    pendingAnalyze.current = true;
+    analyzeAsync(transcript).finally(() => { pendingAnalyze.current = false; });
+  };
+
   const handleSample = async () => {
     setYtStatus('Generating sample conversation...');
     setYtStatusClass('loading');
     try {
       const data = await api.fetchSample();
       setYtStatus('');
-      resetSpeakers();
-      setSourceURL(data.url || '');
-      const dd = { speakers: data.speakers, messages: data.messages };
-      assignWordBasedTimestamps(dd.messages);
-      setDiarizeData(dd);
-      setFullTranscript(data.text);
-      // Set speaker names
-      const names: Record<string, string> = {};
-      const autoGen: Record<string, boolean> = {};
-      for (const [id, name] of Object.entries(data.speakers)) {
-        names[id] = name || pickAnonName();
-        if (!name) autoGen[id] = true;
-      }
-      setSpeakerNames(names);
-      setSpeakerAutoGen(autoGen);
-      setAnalyzedStatements([]);
-      lastAnalyzedTranscript.current = '';
-      await createNewSession();
-      if (data.title) setSourceTitle(data.title);
-      setShowFinal(true);
-      goToSession();
-      // Run analysis
-      const transcript = dd.messages.map((m) => `${names[m.speaker] || m.speaker}: ${m.text}`).join('\n');
-      pendingAnalyze.current = true;
-      analyzeAsync(transcript).finally(() => { pendingAnalyze.current = false; });
+      await startDiarized(data);
     } catch (e: any) {
       setYtStatus('Failed: ' + e.message);
       setYtStatusClass('error');
     }
   };
 
+  const handleImport = async (e: React.ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0];
+    e.target.value = '';
+    if (!file) return;
+    setYtStatus('Importing transcript...');
+    setYtStatusClass('loading');
+    try {
+      const data = await api.importTranscript(file);
+      setYtStatus('');
+      await startDiarized(data);
+    } catch (err: any) {
+      setYtStatus('Import failed: ' + err.message);
+      setYtStatusClass('error');
+    }
+  };
+
   const handleUpload = async (e: React.ChangeEvent<HTMLInputElement>) => {
     const file = e.target.files?.[0];
     if (!file) return;
@@ -147,7 +169,7 @@ export default function HomePage() {
       const text = (data.text || '').trim();
       if (!text) return;
       setFullTranscript(text);
-      await diarizeAsync(text);
+      await diarizeAsync(text, data.segments);
       setShowFinal(true);
     } catch {}
     e.target.value = '';
@@ -202,6 +224,10 @@ export default function HomePage() {
                 <input type="file" accept="audio/*,video/*" onChange={handleUpload} hidden />
                 Upload Audio
               </label>
+              <label className="btn btn-secondary btn-upload" title="SRT, WebVTT, Otter/Zoom text or JSON">
+                <input type="file" accept=".srt,.vtt,.txt,.json" onChange={handleImport} hidden />
+                Import Transcript
+              </label>
               <button type="button" className="btn btn-secondary" onClick={handleSample}>
                 Try a sample
               </button>
@@ -0,0 +1,60 @@
+import React, { useEffect, useState } from 'react';
+import { listRevisions, revertRevision } from '../api';
+import type { Revision, Statement } from '../types';
+
+interface Props {
+  slug: string;
+  statements: Statement[];
+  onReverted: (statements: Statement[]) => void;
+}
+
+const place = (parent: string) => (parent ? `under "${parent}"` : 'to the top level');
+
+function describe(r: Revision): string {
+  const during = r.source === 'revert' ? 'on revert' : `during ${r.source}`;
+  switch (r.field) {
+    case 'type':
+      return `type changed from ${r.old_value} to ${r.new_value} ${during}`;
+    case 'text':
+      return `text changed from "${r.old_value}" to "${r.new_value}" ${during}`;
+    case 'parent':
+      return `moved ${place(r.new_value)} (was ${r.old_value ? `under "${r.old_value}"` : 'top level'}) ${during}`;
+  }
+}
+
+// Lists corrections applied to the stored tree; reloads whenever the tree
+// changes, since that's when new revisions can appear.
+export default function RevisionHistory({ slug, statements, onReverted }: Props) {
+  const [revisions, setRevisions] = useState<Revision[]>([]);
+  const [error, setError] = useState('');
+
+  useEffect(() => {
+    listRevisions(slug).then(setRevisions).catch(() => {});
+  }, [slug, statements]);
+
+  if (!revisions.length) return null;
+
+  const revert = (id: number) => {
+    setError('');
+    revertRevision(slug, id)
+      .then((data) => onReverted(data.statements))
+      .catch((e) => setError(e.message));
+  };
+
+  return (
+    <details className="revision-history">
+      <summary>Review history ({revisions.length})</summary>
+      {error && <div className="revision-error">{error}</div>}
+      <ul>
+        {[...revisions].reverse().map((r) => (
+          <li key={r.id} className={r.reverted_at ? 'reverted' : ''}>
+            <span className="revision-msg">[{r.msg_index}]</span> {describe(r)}
+            {!r.reverted_at && r.source !== 'revert' && (
+              <button className="btn btn-secondary btn-small" onClick={() => revert(r.id)}>Revert</button>
+            )}
+          </li>
+        ))}
+      </ul>
+    </details>
+  );
+}
@@ -1,15 +1,27 @@
-import React, { useEffect, useCallback, useRef } from 'react';
-import { getBasePath, getTranscript } from '../api';
+import React, { useEffect, useCallback, useRef, useState } from 'react';
+import { exportURL, getBasePath, getTranscript, setVisibility } from '../api';
+import type { ExportFormat } from '../api';
+import type { TranscriptAccess, Visibility } from '../types';
 import { useSession } from '../context/SessionContext';
 import { useSpeakers } from '../context/SpeakerContext';
 import { useHighlight } from '../hooks/useHighlight';
 import { useRecording } from '../hooks/useRecording';
+import { useTranscriptEvents } from '../hooks/useTranscriptEvents';
 import { assignWordBasedTimestamps } from '../utils/timestamps';
 import AppHeader from './AppHeader';
 import SessionHeader from './SessionHeader';
 import TranscriptPanel from './TranscriptPanel';
 import ArgumentTree from './ArgumentTree';
 import YouTubeEmbed from './YouTubeEmbed';
+import RevisionHistory from './RevisionHistory';
+import ConversationAnalyticsPanel from './ConversationAnalyticsPanel';
+
+const EXPORT_FORMATS: [ExportFormat, string][] = [
+  ['argdown', 'Argdown'],
+  ['aif', 'AIF'],
+  ['dot', 'DOT'],
+  ['markdown', 'Markdown'],
+];
 
 export default function SessionPage() {
   const {
@@ -46,6 +58,23 @@ export default function SessionPage() {
   const { highlightIdx, pinnedIdx, onHover, onPin } = useHighlight();
   const { stopRecording, recordTime, startYouTubeRecording } = useRecording();
 
+  // The recording tab applies its own results; other viewers follow the server
+  const [recordedHere, setRecordedHere] = useState(false);
+  useEffect(() => setRecordedHere(false), [slug]);
+  useEffect(() => {
+    if (isRecording) setRecordedHere(true);
+  }, [isRecording]);
+  useTranscriptEvents(slug, !isRecording && !recordedHere);
+
+  const [access, setAccess] = useState<TranscriptAccess | null>(null);
+  useEffect(() => setAccess(null), [slug]);
+  const changeVisibility = (visibility: Visibility) => {
+    if (!slug) return;
+    setVisibility(slug, visibility)
+      .then(setAccess)
+      .catch((err) => alert(err.message));
+  };
+
   // Start YouTube recording only when explicitly requested from HomePage
   useEffect(() => {
     if (!pendingYouTubeRecord.current || isRecording || !sourceURL) return;
@@ -71,6 +100,7 @@ export default function SessionPage() {
     getTranscript(slug)
       .then((data) => {
         const t = data.transcript;
+        if (data.access) setAccess(data.access);
         if (t.source_url) setSourceURL(t.source_url);
         if (t.title) {
           setSourceTitle(t.title);
@@ -102,6 +132,15 @@ export default function SessionPage() {
           setFullTranscript(
             data.messages.map((m) => `${names[m.speaker] || m.speaker}: ${m.text}`).join('\n')
           );
+
+          // Search results deep-link to /convo/{slug}#msg-{n}
+          const target = window.location.hash.match(/^#msg-(\d+)$/)?.[1];
+          if (target) {
+            onPin(target);
+            setTimeout(() => {
+              document.querySelector(`[data-msg-idx="${target}"]`)?.scrollIntoView({ block: 'center' });
+            });
+          }
         }
 
         if (data.statements?.length > 0) {
@@ -170,7 +209,30 @@ export default function SessionPage() {
             <div className="action-row">
               <button className="btn" onClick={handleReanalyze}>Re-analyze</button>
               <button className="btn btn-secondary" onClick={goHome}>New</button>
+              {slug && analyzedStatements.length > 0 && (
+                <span className="export-links">
+                  Export:
+                  {EXPORT_FORMATS.map(([format, label]) => (
+                    <a key={format} href={exportURL(slug, format)} target="_blank" rel="noreferrer">{label}</a>
+                  ))}
+                  <a href={getBasePath() + '/convo/' + slug + '/report'} target="_blank" rel="noreferrer">Report</a>
+                </span>
+              )}
+              {access?.is_owner && (
+                <label className="visibility-select" title="Unlisted conversations are readable by anyone with the link">
+                  Visibility:
+                  <select value={access.visibility} onChange={(e) => changeVisibility(e.target.value as Visibility)}>
+                    <option value="private">Private</option>
+                    <option value="unlisted">Unlisted</option>
+                    <option value="public">Public</option>
+                  </select>
+                </label>
+              )}
             </div>
+            {slug && (
+              <RevisionHistory slug={slug} statements={analyzedStatements} onReverted={setAnalyzedStatements} />
+            )}
+            {slug && diarizeData && <ConversationAnalyticsPanel key={slug} slug={slug} />}
           </div>
         )}
       </div>
@@ -1,20 +1,28 @@
 import React, { useEffect, useState } from 'react';
-import { getBasePath, getSpeaker } from '../api';
+import { addSpeakerAlias, getBasePath, getSpeaker, mergeSpeakers, removeSpeakerAlias, splitSpeaker } from '../api';
 import { useSession } from '../context/SessionContext';
-import type { SpeakerConversation } from '../types';
+import type { SpeakerAppearance, SpeakerDetail } from '../types';
 import { getConversationDisplayTitle } from '../utils/format';
 import AppHeader from './AppHeader';
+import SpeakerProfilePanel from './SpeakerProfilePanel';
+
+const appearanceKey = (a: SpeakerAppearance) => a.slug + '/' + a.speaker;
 
 export default function SpeakerDetailPage() {
   const { speakerPageName, setView, setSlug } = useSession();
-  const [convos, setConvos] = useState<SpeakerConversation[] | null>(null);
+  const [detail, setDetail] = useState<SpeakerDetail | null>(null);
+  const [aliasInput, setAliasInput] = useState('');
+  const [mergeInput, setMergeInput] = useState('');
+  const [splitName, setSplitName] = useState('');
+  const [splitSelected, setSplitSelected] = useState<Set<string>>(new Set());
+  const [error, setError] = useState('');
   const bp = getBasePath();
 
   useEffect(() => {
     if (!speakerPageName) return;
     getSpeaker(speakerPageName)
-      .then((data) => setConvos(data.conversations || []))
-      .catch(() => setConvos([]));
+      .then((data) => setDetail({ ...data, conversations: data.conversations || [] }))
+      .catch(() => setDetail({ name: speakerPageName, conversations: [] }));
   }, [speakerPageName]);
 
   const loadConvo = (slug: string, e: React.MouseEvent) => {
@@ -24,6 +32,65 @@ export default function SpeakerDetailPage() {
     history.pushState({ slug }, '', bp + '/convo/' + slug);
   };
 
+  const run = async (action: () => Promise<void>) => {
+    setError('');
+    try {
+      await action();
+    } catch (err) {
+      setError((err as Error).message);
+    }
+  };
+
+  const addAlias = (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!aliasInput.trim()) return;
+    run(async () => {
+      const aliases = await addSpeakerAlias(speakerPageName, aliasInput.trim());
+      setDetail((d) => d && { ...d, aliases });
+      setAliasInput('');
+    });
+  };
+
+  const removeAlias = (alias: string) =>
+    run(async () => {
+      const aliases = await removeSpeakerAlias(speakerPageName, alias);
+      setDetail((d) => d && { ...d, aliases });
+    });
+
+  const merge = (e: React.FormEvent) => {
+    e.preventDefault();
+    const from = mergeInput.trim();
+    if (!from || !confirm(`Merge "${from}" into ${speakerPageName}? This can't be undone.`)) return;
+    run(async () => {
+      setDetail(await mergeSpeakers(speakerPageName, from));
+      setMergeInput('');
+    });
+  };
+
+  const split = (e: React.FormEvent) => {
+    e.preventDefault();
+    const to = splitName.trim();
+    const appearances = (detail?.appearances || []).filter((a) => splitSelected.has(appearanceKey(a)));
+    if (!to || appearances.length === 0) return;
+    run(async () => {
+      const result = await splitSpeaker(speakerPageName, to, appearances);
+      setDetail(result.from);
+      setSplitSelected(new Set());
+      setSplitName('');
+    });
+  };
+
+  const toggleSplit = (a: SpeakerAppearance) => {
+    const next = new Set(splitSelected);
+    const key = appearanceKey(a);
+    if (next.has(key)) next.delete(key);
+    else next.add(key);
+    setSplitSelected(next);
+  };
+
+  const convos = detail?.conversations ?? null;
+  const appearances = detail?.appearances || [];
+
   return (
     <div className="container">
       <AppHeader />
@@ -34,6 +101,7 @@ export default function SpeakerDetailPage() {
         ) : (
           <>
             <p className="text-dim">{convos.length} conversation{convos.length !== 1 ? 's' : ''}</p>
+            <SpeakerProfilePanel name={speakerPageName} />
             {convos.length > 0 && (
               <div className="speaker-convos">
                 {convos.map((c) => {
@@ -55,6 +123,48 @@ export default function SpeakerDetailPage() {
                 })}
               </div>
             )}
+
+            {detail?.id != null && (
+              <div className="speaker-identity">
+                <h3>Identity</h3>
+                {error && <p className="speaker-identity-error">{error}</p>}
+
+                <div className="speaker-identity-row">
+                  <span className="text-dim">Also known as:</span>
+                  {(detail.aliases || []).map((alias) => (
+                    <span key={alias} className="speaker-alias">
+                      {alias}
+                      <button title="Remove alias" onClick={() => removeAlias(alias)}>×</button>
+                    </span>
+                  ))}
+                  <form onSubmit={addAlias}>
+                    <input value={aliasInput} onChange={(e) => setAliasInput(e.target.value)} placeholder="add alias" />
+                  </form>
+                </div>
+
+                <form className="speaker-identity-row" onSubmit={merge}>
+                  <span className="text-dim">Same person as:</span>
+                  <input value={mergeInput} onChange={(e) => setMergeInput(e.target.value)} placeholder="speaker name" />
+                  <button className="btn btn-secondary" type="submit">Merge into {speakerPageName}</button>
+                </form>
+
+                {appearances.length > 1 && (
+                  <form className="speaker-split" onSubmit={split}>
+                    <span className="text-dim">Different people? Move these appearances to another speaker:</span>
+                    {appearances.map((a) => (
+                      <label key={appearanceKey(a)}>
+                        <input type="checkbox" checked={splitSelected.has(appearanceKey(a))} onChange={() => toggleSplit(a)} />
+                        {getConversationDisplayTitle(a.title, a.slug)} <span className="text-dim">({a.speaker})</span>
+                      </label>
+                    ))}
+                    <div className="speaker-identity-row">
+                      <input value={splitName} onChange={(e) => setSplitName(e.target.value)} placeholder="new speaker name" />
+                      <button className="btn btn-secondary" type="submit" disabled={splitSelected.size === 0}>Split</button>
+                    </div>
+                  </form>
+                )}
+              </div>
+            )}
           </>
         )}
       </div>
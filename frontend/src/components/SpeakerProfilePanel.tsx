@@ -0,0 +1,51 @@
+import React, { useEffect, useState } from 'react';
+import { getSpeakerProfile } from '../api';
+import { TYPE_EMOJIS } from '../types';
+import type { SpeakerProfile } from '../types';
+import { formatMs } from '../utils/format';
+
+const sortedEntries = (m: Record<string, number>) => Object.entries(m).sort((a, b) => b[1] - a[1]);
+
+// Cross-conversation statistics shown on a speaker's page.
+export default function SpeakerProfilePanel({ name }: { name: string }) {
+  const [profile, setProfile] = useState<SpeakerProfile | null>(null);
+
+  useEffect(() => {
+    setProfile(null);
+    getSpeakerProfile(name).then(setProfile).catch(() => {});
+  }, [name]);
+
+  if (!profile || profile.conversations === 0) return null;
+
+  const verdicts = sortedEntries(profile.fact_check_verdicts);
+  const fallacies = sortedEntries(profile.fallacies);
+
+  return (
+    <div className="speaker-profile">
+      <div className="speaker-profile-stats">
+        <span><strong>{profile.statements}</strong> statements</span>
+        <span><strong>{profile.words}</strong> words</span>
+        {profile.avg_speaking_ms > 0 && <span><strong>{formatMs(profile.avg_speaking_ms)}</strong> avg talk time</span>}
+        <span><strong>{profile.rebuttals_given}</strong> rebuttals given</span>
+        <span><strong>{profile.rebuttals_received}</strong> received</span>
+      </div>
+      <div className="speaker-profile-types">
+        {sortedEntries(profile.by_type).map(([type, n]) => (
+          <span key={type} className="speaker-profile-type" style={{ color: `var(--${type}, var(--text))` }}>{TYPE_EMOJIS[type] || ''} {type} {n}</span>
+        ))}
+      </div>
+      {(verdicts.length > 0 || fallacies.length > 0) && (
+        <div className="speaker-profile-flags text-dim">
+          {verdicts.length > 0 && <div>Fact checks: {verdicts.map(([v, n]) => `${v} ${n}`).join(' · ')}</div>}
+          {fallacies.length > 0 && <div>Fallacies: {fallacies.map(([f, n]) => `${f} ${n}`).join(' · ')}</div>}
+        </div>
+      )}
+      {profile.opponents.length > 0 && (
+        <div className="speaker-profile-opponents text-dim">
+          Most frequent opponents:{' '}
+          {profile.opponents.map((o) => `${o.name} (${o.rebutted}↔${o.rebutted_by})`).join(', ')}
+        </div>
+      )}
+    </div>
+  );
+}
@@ -6,13 +6,29 @@ import AppHeader from './AppHeader';
 
 export default function SpeakersListPage() {
   const [speakers, setSpeakers] = useState<SpeakerSummary[] | null>(null);
+  const [total, setTotal] = useState(0);
+  const [nextCursor, setNextCursor] = useState<string | undefined>();
   const { setView, setSpeakerPageName } = useSession();
   const bp = getBasePath();
 
   useEffect(() => {
-    listSpeakers().then(setSpeakers).catch(() => setSpeakers([]));
+    listSpeakers()
+      .then((p) => {
+        setSpeakers(p.items);
+        setTotal(p.total);
+        setNextCursor(p.nextCursor);
+      })
+      .catch(() => setSpeakers([]));
   }, []);
 
+  const loadMore = () => {
+    if (!nextCursor) return;
+    listSpeakers({ cursor: nextCursor }).then((p) => {
+      setSpeakers((prev) => [...(prev || []), ...p.items]);
+      setNextCursor(p.nextCursor);
+    });
+  };
+
   const goSpeaker = (name: string, e: React.MouseEvent) => {
     e.preventDefault();
     setSpeakerPageName(name);
@@ -24,7 +40,7 @@ export default function SpeakersListPage() {
     <div className="container">
       <AppHeader />
       <div className="list-page">
-        <h2>Speakers</h2>
+        <h2>Speakers{total > 0 && <span className="list-count">{total}</span>}</h2>
         {speakers === null ? (
           <p className="text-dim">Loading…</p>
         ) : speakers.length === 0 ? (
@@ -44,6 +60,7 @@ export default function SpeakersListPage() {
                 </span>
               </a>
             ))}
+            {nextCursor && <button className="btn btn-secondary" onClick={loadMore}>Load more</button>}
           </div>
         )}
       </div>
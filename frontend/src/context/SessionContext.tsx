@@ -1,12 +1,14 @@
 import React, { createContext, useContext, useState, useCallback, useRef } from 'react';
-import type { DiarizeData, Statement } from '../types';
+import type { DiarizeData, Statement, TimedSegment } from '../types';
 import * as api from '../api';
 import { assignWordBasedTimestamps } from '../utils/timestamps';
+import { applyStatementUpdates, mergeStatements } from '../utils/statements';
 import { useSpeakers } from './SpeakerContext';
 
 interface SessionContextValue {
   slug: string | null;
   setSlug: (s: string | null) => void;
+  slugRef: React.MutableRefObject<string | null>;
   isRecording: boolean;
   setIsRecording: (v: boolean) => void;
   diarizeData: DiarizeData | null;
@@ -22,9 +24,8 @@ interface SessionContextValue {
   setSourceTitle: (t: string) => void;
   pendingAnalyze: React.MutableRefObject<boolean>;
   pendingDiarize: React.MutableRefObject<boolean>;
-  pendingTranscribe: React.MutableRefObject<boolean>;
   pendingYouTubeRecord: React.MutableRefObject<boolean>;
-  diarizeAsync: (transcript: string) => Promise<void>;
+  diarizeAsync: (transcript: string, segments?: TimedSegment[]) => Promise<void>;
   analyzeAsync: (transcript: string, forceFullReanalysis?: boolean) => Promise<void>;
   buildTranscriptText: () => string;
   createNewSession: () => Promise<string | null>;
@@ -51,7 +52,6 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
   const [sourceTitle, setSourceTitle] = useState('');
   const pendingAnalyze = useRef(false);
   const pendingDiarize = useRef(false);
-  const pendingTranscribe = useRef(false);
   const pendingYouTubeRecord = useRef(false);
   const lastDiarizedText = useRef('');
   const diarizeCallCount = useRef(0);
@@ -113,65 +113,15 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
           const fullReview = analyzeCallCount.current % ANALYZE_FULL_REVIEW_EVERY === 0;
 
           // newText is already pre-numbered with [N] positions, no offset needed
-          const data = await api.analyzeIncremental(newText, existing, 0, contextText, fullReview);
+          const data = await api.analyzeIncremental(newText, existing, 0, contextText, fullReview, slugRef.current);
 
           lastAnalyzedTranscript.current = transcript;
 
-          // Apply updates to existing statements
-          if (data.updates?.length) {
-            setAnalyzedStatements((prev) => {
-              const applyUpdates = (stmts: Statement[]): Statement[] =>
-                stmts.map((s) => {
-                  const update = data.updates!.find((u) => u.msg_index === s.msg_index);
-                  if (update) {
-                    const updated = { ...s };
-                    if (update.text) updated.text = update.text;
-                    if (update.type) updated.type = update.type;
-                    return updated;
-                  }
-                  if (s.children?.length) {
-                    return { ...s, children: applyUpdates(s.children) };
-                  }
-                  return s;
-                });
-
-              const next = applyUpdates(prev);
-
-              // Add new statements
-              for (const ns of data.statements || []) {
-                if (ns.parent_text) {
-                  const parent = findByText(next, ns.parent_text);
-                  if (parent) {
-                    if (!parent.children) parent.children = [];
-                    parent.children.push(ns);
-                    continue;
-                  }
-                }
-                next.push(ns);
-              }
-              return next;
-            });
-          } else {
-            // Just add new statements
-            const newStmts = data.statements || [];
-            if (newStmts.length > 0) {
-              setAnalyzedStatements((prev) => {
-                const next = [...prev];
-                for (const s of newStmts) {
-                  if (s.parent_text) {
-                    const parent = findByText(next, s.parent_text);
-                    if (parent) {
-                      if (!parent.children) parent.children = [];
-                      parent.children.push(s);
-                      continue;
-                    }
-                  }
-                  next.push(s);
-                }
-                return next;
-              });
-            }
-          }
+          // Apply updates to existing statements, then add new ones
+          setAnalyzedStatements((prev) => {
+            const next = data.updates?.length ? applyStatementUpdates(prev, data.updates) : prev;
+            return mergeStatements(next, data.statements || []);
+          });
         } else {
           // Full analysis
           const dd = diarizeDataRef.current;
@@ -246,7 +196,7 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
   const CONTEXT_LINES = 4; // lines of context to include with incremental chunk
 
   const diarizeAsync = useCallback(
-    async (transcript: string) => {
+    async (transcript: string, segments?: TimedSegment[]) => {
       try {
         diarizeCallCount.current++;
         const lastText = lastDiarizedText.current;
@@ -294,7 +244,7 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
           applyDiarizeResult(merged);
         } else {
           // Full diarize
-          const data = await api.diarize(transcript);
+          const data = await api.diarize(transcript, segments);
           if ((data as any).error) return;
           lastDiarizedText.current = transcript;
           applyDiarizeResult(data);
@@ -350,6 +300,7 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
       value={{
         slug,
         setSlug,
+        slugRef,
         isRecording,
         setIsRecording,
         diarizeData,
@@ -365,7 +316,6 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
         setSourceTitle,
         pendingAnalyze,
         pendingDiarize,
-        pendingTranscribe,
         pendingYouTubeRecord,
         diarizeAsync,
         analyzeAsync,
@@ -384,15 +334,3 @@ export function SessionProvider({ children }: { children: React.ReactNode }) {
     </SessionContext.Provider>
   );
 }
-
-function findByText(statements: Statement[], text: string): Statement | null {
-  const needle = text.toLowerCase().trim();
-  for (const s of statements) {
-    if (s.text?.toLowerCase().trim() === needle) return s;
-    if (s.children) {
-      const found = findByText(s.children, text);
-      if (found) return found;
-    }
-  }
-  return null;
-}
@@ -1,22 +1,43 @@
 import { useRef, useCallback, useState, useEffect } from 'react';
 import * as api from '../api';
+import type { TimedSegment } from '../types';
 import { useSession } from '../context/SessionContext';
 
-const CHUNK_INTERVAL_MS = 10000;
-const OVERLAP_MS = 5000; // 5s overlap for continuity at boundaries
+const SAMPLE_RATE = 16000;
+const SEND_INTERVAL_MS = 250;
+const STOP_TIMEOUT_MS = 60000; // wait this long for the server to finish queued segments
 
-interface TimedChunk {
-  blob: Blob;
-  timestampMs: number; // ms since recording started
+// Hands each 128-sample input block to the main thread
+const PCM_TAP_WORKLET = `
+class PcmTap extends AudioWorkletProcessor {
+  process(inputs) {
+    const ch = inputs[0] && inputs[0][0];
+    if (ch) this.port.postMessage(ch.slice(0));
+    return true;
+  }
+}
+registerProcessor('pcm-tap', PcmTap);
+`;
+
+function toPCM16(chunks: Float32Array[]): ArrayBuffer {
+  const total = chunks.reduce((n, c) => n + c.length, 0);
+  const out = new DataView(new ArrayBuffer(total * 2));
+  let offset = 0;
+  for (const chunk of chunks) {
+    for (let i = 0; i < chunk.length; i++, offset += 2) {
+      const v = Math.max(-1, Math.min(1, chunk[i]));
+      out.setInt16(offset, v < 0 ? v * 0x8000 : v * 0x7fff, true);
+    }
+  }
+  return out.buffer;
 }
 
 export function useRecording() {
   const {
+    slugRef,
     setIsRecording,
     setFullTranscript,
-    fullTranscript,
     diarizeAsync,
-    pendingTranscribe,
     pendingDiarize,
     createNewSession,
     setSourceURL,
@@ -26,21 +47,21 @@ export function useRecording() {
     analyzeAsync,
     pendingAnalyze,
     lastAnalyzedTranscript,
-    setAnalyzedStatements,
   } = useSession();
 
-  const mediaRecorderRef = useRef<MediaRecorder | null>(null);
-  const timedChunksRef = useRef<TimedChunk[]>([]);
-  const chunkIntervalRef = useRef<number | null>(null);
+  const wsRef = useRef<WebSocket | null>(null);
+  const audioCtxRef = useRef<AudioContext | null>(null);
+  const streamRef = useRef<MediaStream | null>(null);
+  const pcmQueueRef = useRef<Float32Array[]>([]);
+  const sendIntervalRef = useRef<number | null>(null);
   const recordStartRef = useRef<number>(0);
   const [recordTime, setRecordTime] = useState('00:00');
   const recordTimerRef = useRef<number | null>(null);
-  const fullTranscriptRef = useRef(fullTranscript);
-  fullTranscriptRef.current = fullTranscript;
 
-  // Locked transcript: text from audio that's been finalized (won't be re-sent)
-  const lockedTextRef = useRef('');
-  const lockedUpToMsRef = useRef(0); // audio ms up to which text is locked
+  // Transcribed segments, timed from the start of the recording. The server
+  // transcribes each stretch of audio once, so these only ever grow.
+  const segmentsRef = useRef<TimedSegment[]>([]);
+  const ingestDoneRef = useRef<(() => void) | null>(null);
 
   const updateTime = useCallback(() => {
     recordTimerRef.current = window.setInterval(() => {
@@ -51,70 +72,75 @@ export function useRecording() {
     }, 1000);
   }, []);
 
-  const processChunk = useCallback(async () => {
-    if (pendingTranscribe.current || timedChunksRef.current.length === 0) return;
-    pendingTranscribe.current = true;
-
-    try {
-      const allChunks = timedChunksRef.current;
-      const lockedMs = lockedUpToMsRef.current;
-
-      // Send all audio chunks — webm requires contiguous stream from start
-      const blob = new Blob(allChunks.map((c) => c.blob), { type: 'audio/webm' });
-      console.log(`[Recording] Sending ${allChunks.length} chunks, ${(blob.size / 1024).toFixed(0)}KB`);
-      const form = new FormData();
-      form.append('audio', blob, 'chunk.webm');
-
-      const data = await api.transcribeAudio(form);
-      const fullText = (data.text || '').trim();
-      if (!fullText) return;
-      if (fullText && fullText !== fullTranscriptRef.current) {
-        setFullTranscript(fullText);
-        fullTranscriptRef.current = fullText;
-
-        if (!pendingDiarize.current) {
-          pendingDiarize.current = true;
-          diarizeAsync(fullText).finally(() => {
-            pendingDiarize.current = false;
-          });
-        }
+  const transcriptText = () => segmentsRef.current.map((s) => s.text).join(' ');
+
+  const handleSegment = useCallback(
+    (msg: api.IngestMessage) => {
+      if (!msg.text) return;
+      segmentsRef.current.push({ start_ms: msg.start_ms || 0, end_ms: msg.end_ms, text: msg.text });
+      const fullText = transcriptText();
+      setFullTranscript(fullText);
+
+      if (!pendingDiarize.current) {
+        pendingDiarize.current = true;
+        diarizeAsync(fullText, segmentsRef.current).finally(() => {
+          pendingDiarize.current = false;
+        });
       }
+    },
+    [setFullTranscript, diarizeAsync, pendingDiarize]
+  );
 
-      // Lock the current text — next call will still send all audio
-      // (webm requires contiguous stream) but diarize/analyze only process new text
-      lockedTextRef.current = fullText;
-      lockedUpToMsRef.current = allChunks[allChunks.length - 1].timestampMs;
-    } catch (e) {
-      console.warn('Chunk failed:', e);
-    } finally {
-      pendingTranscribe.current = false;
-    }
-  }, [setFullTranscript, diarizeAsync, pendingTranscribe, pendingDiarize]);
+  const sendPending = useCallback(() => {
+    const ws = wsRef.current;
+    if (!ws || ws.readyState !== WebSocket.OPEN || pcmQueueRef.current.length === 0) return;
+    ws.send(toPCM16(pcmQueueRef.current));
+    pcmQueueRef.current = [];
+  }, []);
 
   const initRecorder = useCallback(
-    (stream: MediaStream) => {
-      timedChunksRef.current = [];
-      lockedTextRef.current = '';
-      lockedUpToMsRef.current = 0;
-
-      const mr = new MediaRecorder(stream, { mimeType: 'audio/webm;codecs=opus' });
-      mr.ondataavailable = (e) => {
-        if (e.data.size > 0) {
-          timedChunksRef.current.push({
-            blob: e.data,
-            timestampMs: Date.now() - recordStartRef.current,
-          });
-        }
+    async (stream: MediaStream): Promise<boolean> => {
+      const slug = slugRef.current || (await createNewSession());
+      if (!slug) {
+        stream.getTracks().forEach((t) => t.stop());
+        return false;
+      }
+
+      segmentsRef.current = [];
+      pcmQueueRef.current = [];
+
+      const ws = new WebSocket(api.ingestURL(slug, SAMPLE_RATE));
+      ws.binaryType = 'arraybuffer';
+      ws.onmessage = (ev) => {
+        const msg: api.IngestMessage = JSON.parse(ev.data);
+        if (msg.type === 'segment') handleSegment(msg);
+        else if (msg.type === 'error') console.warn('[Recording] Segment failed:', msg.error);
+        else if (msg.type === 'done') ingestDoneRef.current?.();
       };
-      mr.onstop = () => stream.getTracks().forEach((t) => t.stop());
-      mr.start(1000);
-      mediaRecorderRef.current = mr;
+      ws.onclose = () => ingestDoneRef.current?.();
+      wsRef.current = ws;
+
+      const ctx = new AudioContext({ sampleRate: SAMPLE_RATE });
+      const moduleURL = URL.createObjectURL(new Blob([PCM_TAP_WORKLET], { type: 'application/javascript' }));
+      try {
+        await ctx.audioWorklet.addModule(moduleURL);
+      } finally {
+        URL.revokeObjectURL(moduleURL);
+      }
+      const tap = new AudioWorkletNode(ctx, 'pcm-tap');
+      tap.port.onmessage = (e) => pcmQueueRef.current.push(e.data);
+      ctx.createMediaStreamSource(stream).connect(tap);
+      tap.connect(ctx.destination); // the tap outputs silence; connecting keeps it running
+      audioCtxRef.current = ctx;
+      streamRef.current = stream;
+
       recordStartRef.current = Date.now();
       updateTime();
-      chunkIntervalRef.current = window.setInterval(processChunk, CHUNK_INTERVAL_MS);
+      sendIntervalRef.current = window.setInterval(sendPending, SEND_INTERVAL_MS);
       setIsRecording(true);
+      return true;
     },
-    [updateTime, processChunk, setIsRecording]
+    [slugRef, createNewSession, handleSegment, sendPending, updateTime, setIsRecording]
   );
 
   const startRecording = useCallback(
@@ -133,8 +159,7 @@ export function useRecording() {
         } else {
           stream = await navigator.mediaDevices.getUserMedia({ audio: true });
         }
-        initRecorder(stream);
-        return true;
+        return await initRecorder(stream);
       } catch {
         return false;
       }
@@ -144,27 +169,35 @@ export function useRecording() {
 
   const stopRecording = useCallback(async () => {
     setIsRecording(false);
-    if (chunkIntervalRef.current) clearInterval(chunkIntervalRef.current);
+    if (sendIntervalRef.current) clearInterval(sendIntervalRef.current);
     if (recordTimerRef.current) clearInterval(recordTimerRef.current);
 
-    const mr = mediaRecorderRef.current;
-    if (mr) {
-      mr.stop();
-      mediaRecorderRef.current = null;
+    streamRef.current?.getTracks().forEach((t) => t.stop());
+    streamRef.current = null;
+    await audioCtxRef.current?.close();
+    audioCtxRef.current = null;
+
+    // Send the tail, then wait for the server to transcribe what's queued
+    const ws = wsRef.current;
+    if (ws && ws.readyState === WebSocket.OPEN) {
+      sendPending();
+      const done = new Promise<void>((resolve) => {
+        ingestDoneRef.current = resolve;
+        setTimeout(resolve, STOP_TIMEOUT_MS);
+      });
+      ws.send(JSON.stringify({ type: 'stop' }));
+      await done;
+      ingestDoneRef.current = null;
+      ws.close();
     }
+    wsRef.current = null;
 
-    // Final transcription
-    const allChunks = timedChunksRef.current;
-    if (allChunks.length > 0) {
-      const blob = new Blob(allChunks.map((c) => c.blob), { type: 'audio/webm' });
-      const form = new FormData();
-      form.append('audio', blob, 'recording.webm');
+    // Final full diarization over everything transcribed
+    const fullText = transcriptText();
+    if (fullText) {
+      setFullTranscript(fullText);
       try {
-        const data = await api.transcribeAudio(form);
-        const fullText = (data.text || '').trim() || fullTranscriptRef.current;
-        setFullTranscript(fullText);
-        fullTranscriptRef.current = fullText;
-        await diarizeAsync(fullText);
+        await diarizeAsync(fullText, segmentsRef.current);
       } catch {}
     }
 
@@ -181,6 +214,7 @@ export function useRecording() {
     }, 100);
   }, [
     setIsRecording,
+    sendPending,
     setFullTranscript,
     diarizeAsync,
     setShowFinal,
@@ -203,7 +237,7 @@ export function useRecording() {
         stream.getVideoTracks().forEach((t) => t.stop());
         if (stream.getAudioTracks().length === 0) return false;
 
-        initRecorder(stream);
+        if (!(await initRecorder(stream))) return false;
 
         api.importYouTubeTitleOnly(url).then((data) => {
           if (data.title) setSourceTitle(data.title);
@@ -219,7 +253,7 @@ export function useRecording() {
 
   useEffect(() => {
     return () => {
-      if (chunkIntervalRef.current) clearInterval(chunkIntervalRef.current);
+      if (sendIntervalRef.current) clearInterval(sendIntervalRef.current);
       if (recordTimerRef.current) clearInterval(recordTimerRef.current);
     };
   }, []);
@@ -0,0 +1,59 @@
+import { useEffect, useRef } from 'react';
+import { subscribeTranscriptEvents } from '../api';
+import { useSession } from '../context/SessionContext';
+import { useSpeakers } from '../context/SpeakerContext';
+import { assignWordBasedTimestamps } from '../utils/timestamps';
+import { applyStatementUpdates, mergeStatements } from '../utils/statements';
+
+const defaultSpeakerName = (sid: string) =>
+  sid.replace('_', ' ').replace(/\b\w/g, (c) => c.toUpperCase());
+
+// Keeps the session view in sync with changes other clients persist, so a
+// second screen can watch a recording's argument tree grow.
+export function useTranscriptEvents(slug: string | null, enabled: boolean) {
+  const { diarizeData, setDiarizeData, setAnalyzedStatements, setSourceTitle } = useSession();
+  const { setSpeakerNames } = useSpeakers();
+
+  const diarizeDataRef = useRef(diarizeData);
+  diarizeDataRef.current = diarizeData;
+
+  useEffect(() => {
+    if (!slug || !enabled) return;
+
+    const mergeSpeakerNames = (speakers: Record<string, string>) =>
+      setSpeakerNames((prev) => {
+        const next = { ...prev };
+        for (const [sid, name] of Object.entries(speakers)) {
+          next[sid] = name || next[sid] || defaultSpeakerName(sid);
+        }
+        return next;
+      });
+
+    return subscribeTranscriptEvents(slug, {
+      transcript: (t) => {
+        if (t.title) {
+          setSourceTitle(t.title);
+          document.title = t.title + ' — argraphments';
+        }
+      },
+      utterances: ({ offset, speakers, messages }) => {
+        const prev = diarizeDataRef.current;
+        if (!prev && messages.length === 0) return;
+        const merged = {
+          speakers: { ...prev?.speakers, ...speakers },
+          messages: [...(prev?.messages || []).slice(0, offset), ...messages],
+        };
+        assignWordBasedTimestamps(merged.messages);
+        setDiarizeData(merged);
+        mergeSpeakerNames(merged.speakers);
+      },
+      statements: ({ statements, replace }) => {
+        setAnalyzedStatements((prev) => (replace ? statements : mergeStatements(prev, statements)));
+      },
+      updates: ({ updates }) => {
+        setAnalyzedStatements((prev) => applyStatementUpdates(prev, updates));
+      },
+      speakers: ({ speakers }) => mergeSpeakerNames(speakers),
+    });
+  }, [slug, enabled]);
+}
@@ -30,6 +30,12 @@ export interface DiarizeMessage {
   end_ms?: number;
 }
 
+export interface TimedSegment {
+  start_ms: number;
+  end_ms?: number;
+  text: string;
+}
+
 export interface DiarizeData {
   speakers: Record<string, string>;
   messages: DiarizeMessage[];
@@ -40,6 +46,16 @@ export interface TranscriptListItem {
   slug: string;
   title: string;
   created_at: string;
+  claim_count: number;
+  fact_checks: number;
+  source_type: 'youtube' | 'web' | 'direct';
+}
+
+// One page of a list endpoint; pass nextCursor back to get the next page.
+export interface Page<T> {
+  items: T[];
+  total: number;
+  nextCursor?: string;
 }
 
 export interface SpeakerSummary {
@@ -67,6 +83,47 @@ export interface TranscriptDetail {
   speaker_info: Record<string, SpeakerInfo>;
   messages: DiarizeMessage[];
   statements: Statement[];
+  access?: TranscriptAccess;
+}
+
+export interface User {
+  id: number;
+  username: string;
+  created_at: string;
+}
+
+export type Visibility = 'private' | 'unlisted' | 'public';
+
+export interface TranscriptAccess {
+  visibility: Visibility;
+  can_edit: boolean;
+  is_owner: boolean;
+  owner?: string;
+}
+
+export interface ValidationIssue {
+  text: string;
+  msg_index?: number;
+  field: string;
+  problem: string;
+}
+
+export interface ValidationReport {
+  repairs?: string[];
+  dropped?: ValidationIssue[];
+  corrected?: ValidationIssue[];
+}
+
+export interface Revision {
+  id: number;
+  msg_index: number;
+  field: 'text' | 'type' | 'parent';
+  old_value: string;
+  new_value: string;
+  source: string;
+  reverts_id?: number;
+  reverted_at?: string;
+  created_at: string;
 }
 
 export interface AnalyzeResponse {
@@ -74,6 +131,7 @@ export interface AnalyzeResponse {
   transcript_id: number;
   slug: string;
   title: string;
+  validation?: ValidationReport;
 }
 
 export interface SampleResponse {
@@ -84,6 +142,32 @@ export interface SampleResponse {
   url: string;
 }
 
+export interface ImportResponse {
+  format: 'srt' | 'vtt' | 'otter' | 'json';
+  speakers: Record<string, string>;
+  messages: DiarizeMessage[];
+  text: string;
+  title: string;
+  url?: string;
+}
+
+export interface SearchHit {
+  kind: 'utterance' | 'claim' | 'title';
+  transcript_id: number;
+  slug: string;
+  title: string;
+  created_at: string;
+  claim_id?: number;
+  speaker_id?: string;
+  speaker?: string;
+  msg_index?: number;
+  start_ms?: number;
+  type?: string;
+  text: string;
+  snippet: string;
+  score: number;
+}
+
 export interface SpeakerConversation {
   slug: string;
   title: string;
@@ -91,9 +175,40 @@ export interface SpeakerConversation {
   claim_count: number;
 }
 
+export interface SpeakerAppearance {
+  slug: string;
+  title: string;
+  speaker: string;
+}
+
+export interface SpeakerOpponent {
+  name: string;
+  rebutted: number;
+  rebutted_by: number;
+}
+
+export interface SpeakerProfile {
+  name: string;
+  conversations: number;
+  messages: number;
+  words: number;
+  speaking_ms: number;
+  avg_speaking_ms: number;
+  statements: number;
+  by_type: Record<string, number>;
+  rebuttals_given: number;
+  rebuttals_received: number;
+  fact_check_verdicts: Record<string, number>;
+  fallacies: Record<string, number>;
+  opponents: SpeakerOpponent[];
+}
+
 export interface SpeakerDetail {
+  id?: number;
   name: string;
   conversations: SpeakerConversation[];
+  appearances?: SpeakerAppearance[];
+  aliases?: string[];
 }
 
 export const TYPE_EMOJIS: Record<string, string> = {
@@ -106,3 +221,42 @@ export const TYPE_EMOJIS: Record<string, string> = {
   clarification: '🔍',
   evidence: '📎',
 };
+
+export interface SpeakerAnalytics {
+  speaker_id: string;
+  name: string;
+  messages: number;
+  words: number;
+  turns: number;
+  talk_ms: number;
+  talk_share: number;
+  longest_turn_ms: number;
+  interruptions: number;
+  interrupted: number;
+  avg_response_latency_ms: number;
+}
+
+export interface ConversationAnalytics {
+  timed: boolean;
+  duration_ms: number;
+  turns: number;
+  speakers: SpeakerAnalytics[];
+  overlaps: { at_ms: number; msg_index: number; by: string; of: string; overlap_ms: number; interruption: boolean }[];
+  longest_monologues: {
+    speaker_id: string;
+    name: string;
+    msg_index: number;
+    start_ms: number;
+    duration_ms: number;
+    words: number;
+  }[];
+  response_latency: {
+    count: number;
+    mean_ms: number;
+    median_ms: number;
+    p90_ms: number;
+    buckets: { label: string; count: number }[];
+  };
+  timeline_bucket_ms?: number;
+  timeline: { start_ms: number; talk_ms: Record<string, number> }[];
+}
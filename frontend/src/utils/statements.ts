@@ -0,0 +1,91 @@
+import type { Statement } from '../types';
+import type { StatementUpdate } from '../api';
+
+export function findByText(statements: Statement[], text: string): Statement | null {
+  const needle = text.toLowerCase().trim();
+  for (const s of statements) {
+    if (s.text?.toLowerCase().trim() === needle) return s;
+    if (s.children) {
+      const found = findByText(s.children, text);
+      if (found) return found;
+    }
+  }
+  return null;
+}
+
+function hasStatement(statements: Statement[], s: Statement): boolean {
+  const found = findByText(statements, s.text || '');
+  return !!found && found.msg_index === s.msg_index;
+}
+
+// Nest new statements under their parent_text, or append them top-level.
+// Statements already in the tree (same text and msg_index) are skipped.
+export function mergeStatements(prev: Statement[], added: Statement[]): Statement[] {
+  const next = [...prev];
+  for (const s of added) {
+    if (hasStatement(next, s)) continue;
+    if (s.parent_text) {
+      const parent = findByText(next, s.parent_text);
+      if (parent) {
+        if (!parent.children) parent.children = [];
+        parent.children.push(s);
+        continue;
+      }
+    }
+    next.push(s);
+  }
+  return next;
+}
+
+// Apply text and type corrections, then parent_text moves: the statement
+// (with its children) goes under the statement with that text, or to the top
+// level when it is empty. Moves into its own subtree or to an unknown parent
+// are ignored, as on the server.
+export function applyStatementUpdates(stmts: Statement[], updates: StatementUpdate[]): Statement[] {
+  let next = updateFields(stmts, updates);
+  for (const u of updates) {
+    if (u.parent_text === undefined) continue;
+    next = moveStatement(next, u.msg_index, u.parent_text);
+  }
+  return next;
+}
+
+// Copies every statement, so moveStatement can modify the result freely.
+function updateFields(stmts: Statement[], updates: StatementUpdate[]): Statement[] {
+  return stmts.map((s) => {
+    const updated = { ...s };
+    for (const u of updates) {
+      if (u.msg_index !== s.msg_index) continue;
+      if (u.text) updated.text = u.text;
+      if (u.type) updated.type = u.type;
+    }
+    if (s.children?.length) updated.children = updateFields(s.children, updates);
+    return updated;
+  });
+}
+
+function findByMsgIndex(stmts: Statement[], msgIndex: number): Statement | null {
+  for (const s of stmts) {
+    if (s.msg_index === msgIndex) return s;
+    const found = s.children ? findByMsgIndex(s.children, msgIndex) : null;
+    if (found) return found;
+  }
+  return null;
+}
+
+function without(stmts: Statement[], target: Statement): Statement[] {
+  return stmts
+    .filter((s) => s !== target)
+    .map((s) => (s.children?.length ? { ...s, children: without(s.children, target) } : s));
+}
+
+function moveStatement(stmts: Statement[], msgIndex: number, parentText: string): Statement[] {
+  const target = findByMsgIndex(stmts, msgIndex);
+  if (!target) return stmts;
+  if (parentText && (findByText([target], parentText) || !findByText(stmts, parentText))) return stmts;
+  const rest = without(stmts, target);
+  if (!parentText) return [...rest, target];
+  const parent = findByText(rest, parentText)!;
+  parent.children = [...(parent.children || []), target];
+  return rest;
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// transcriptLocks serializes writes to one session's utterances and claim
+// tree, which are read-modify-write through the store.
+var transcriptLocks sync.Map // int64 → *sync.Mutex
+
+func lockTranscript(tid int64) func() {
+	mu, _ := transcriptLocks.LoadOrStore(tid, &sync.Mutex{})
+	m := mu.(*sync.Mutex)
+	m.Lock()
+	return m.Unlock
+}
+
+// persistIncremental folds an incremental result into the session's stored
+// tree: updates are applied first, then new statements are nested under
+// their parent_text, and each applied correction is logged as a revision.
+// Only the difference is written, in one transaction: corrected statements
+// are updated in place and new ones inserted.
+func persistIncremental(tid int64, result *IncrementalResult) []Statement {
+	canonicalizeStatements(result.Statements)
+	canonicalizeUpdates(result.Updates)
+	unlock := lockTranscript(tid)
+	defer unlock()
+
+	tree := transcriptStatements(tid)
+	stored := storedPlacements(tree, 0, map[int64]claimPlacement{})
+	tree, revisions := applyStatementUpdates(tree, result.Updates)
+	tree, merged := mergeIncrementalStatements(tree, result.Statements)
+
+	edits, added := claimTreeChanges(tid, tree, stored)
+	if len(edits) == 0 && len(added) == 0 {
+		return tree
+	}
+	if _, err := store.ApplyClaimTreeChanges(tid, edits, added, stampRevisions(tid, revisionSourceReview, nil, revisions)); err != nil {
+		log.Printf("persistIncremental: transcript %d: %v", tid, err)
+		return transcriptStatements(tid)
+	}
+	// Viewers replay the same steps: corrections first, then new statements
+	// nested by parent_text.
+	publishUpdates(tid, revisionUpdates(revisions))
+	if len(merged) > 0 {
+		publishStatements(tid, merged, false)
+	}
+	return transcriptStatements(tid)
+}
+
+// claimPlacement is a stored claim's text, type and parent claim (0 at the
+// top level).
+type claimPlacement struct {
+	text, typ string
+	parent    int64
+}
+
+func storedPlacements(stmts []Statement, parent int64, out map[int64]claimPlacement) map[int64]claimPlacement {
+	for _, s := range stmts {
+		if s.claimID > 0 {
+			out[s.claimID] = claimPlacement{text: s.Text, typ: s.Type, parent: parent}
+			storedPlacements(s.Children, s.claimID, out)
+		}
+	}
+	return out
+}
+
+// claimTreeChanges compares tree with the stored placements and returns
+// edits for stored statements whose text, type or parent changed, and the
+// statements without a stored claim, parents before children. New
+// statements are canonicalized and resolved for the search index here so
+// the store can write everything in one transaction.
+func claimTreeChanges(tid int64, tree []Statement, stored map[int64]claimPlacement) ([]storage.ClaimEdit, []storage.NewClaim) {
+	var edits []storage.ClaimEdit
+	var added []storage.NewClaim
+	speakers, messages, _ := store.GetDiarization(tid)
+	canonicalOf := func(claimID int64) *int64 {
+		if claimID == 0 {
+			return nil
+		}
+		id, err := store.CanonicalIDForClaim(claimID)
+		if err != nil {
+			return nil
+		}
+		return &id
+	}
+
+	// A statement's parent is either a stored claim (parentID) or one added
+	// in this pass (parentNew, 1-based into added).
+	var walk func(stmts []Statement, parentID int64, parentNew int, parentCanonical *int64)
+	walk = func(stmts []Statement, parentID int64, parentNew int, parentCanonical *int64) {
+		for _, s := range stmts {
+			if s.claimID > 0 {
+				old := stored[s.claimID]
+				moved := old.parent != parentID
+				var canonical *int64
+				if old.text != s.Text {
+					if id, err := statementCanonicalID(s); err != nil {
+						log.Printf("persistIncremental: canonicalize claim: %v", err)
+					} else {
+						canonical = &id
+					}
+				}
+				if moved || old.text != s.Text || old.typ != s.Type {
+					e := storage.ClaimEdit{ClaimID: s.claimID, Text: s.Text, Type: s.Type, CanonicalID: canonical, Reparent: moved, ParentID: parentID}
+					if moved {
+						e.ParentCanonicalID = parentCanonical
+					}
+					edits = append(edits, e)
+				}
+				if canonical == nil {
+					canonical = canonicalOf(s.claimID)
+				}
+				if len(s.Children) > 0 {
+					walk(s.Children, s.claimID, 0, canonical)
+				}
+				continue
+			}
+
+			speakerKey := s.SpeakerID
+			if speakerKey == "" {
+				speakerKey = s.Speaker
+			}
+			c := storage.NewClaim{Speaker: speakerKey, Text: s.Text, Type: s.Type, MsgIndex: s.MsgIndex, ParentID: parentID, Parent: parentNew}
+			if s.FactCheck != nil {
+				fc := storage.FactCheck(*s.FactCheck)
+				c.FactCheck = &fc
+			}
+			if s.Fallacy != nil {
+				f := storage.Fallacy(*s.Fallacy)
+				c.Fallacy = &f
+			}
+			var canonical *int64
+			if id, err := statementCanonicalID(s); err != nil {
+				log.Printf("persistIncremental: canonicalize claim: %v", err)
+			} else {
+				canonical = &id
+				c.Mention = &storage.ClaimMention{CanonicalID: id, ParentCanonicalID: parentCanonical}
+			}
+			indexed := storage.IndexedClaim{SpeakerID: speakerKey, MsgIndex: s.MsgIndex}
+			resolveIndexedClaim(&indexed, speakers, messages)
+			c.Indexed = &indexed
+			added = append(added, c)
+			if len(s.Children) > 0 {
+				walk(s.Children, 0, len(added), canonical)
+			}
+		}
+	}
+	walk(tree, 0, 0, nil)
+	return edits, added
+}
+
+// mergeIncrementalStatements nests new statements under their parent_text,
+// or appends them top-level, skipping any already in the tree. It also
+// returns the statements it merged, as given.
+func mergeIncrementalStatements(tree, added []Statement) ([]Statement, []Statement) {
+	var merged []Statement
+	for _, s := range added {
+		if existing := findStatementByText(tree, s.Text); existing != nil && sameMsgIndex(existing.MsgIndex, s.MsgIndex) {
+			continue
+		}
+		merged = append(merged, s)
+		tree = nestStatement(tree, s)
+	}
+	return tree, merged
+}
+
+// nestStatement puts s under the statement matching its parent_text, or at
+// the top level when there is none.
+func nestStatement(tree []Statement, s Statement) []Statement {
+	parentText := s.ParentText
+	s.ParentText = ""
+	if parentText != "" {
+		if parent := findStatementByText(tree, parentText); parent != nil {
+			parent.Children = append(parent.Children, s)
+			return tree
+		}
+	}
+	return append(tree, s)
+}
+
+func sameMsgIndex(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func findStatementByMsgIndex(stmts []Statement, msgIndex int) *Statement {
+	for i := range stmts {
+		if stmts[i].MsgIndex != nil && *stmts[i].MsgIndex == msgIndex {
+			return &stmts[i]
+		}
+		if found := findStatementByMsgIndex(stmts[i].Children, msgIndex); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findStatementByClaimID(stmts []Statement, claimID int64) *Statement {
+	for i := range stmts {
+		if stmts[i].claimID == claimID {
+			return &stmts[i]
+		}
+		if found := findStatementByClaimID(stmts[i].Children, claimID); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// removeStatement detaches target (a pointer into stmts) and returns the
+// remaining tree with the removed statement.
+func removeStatement(stmts []Statement, target *Statement) ([]Statement, Statement, bool) {
+	for i := range stmts {
+		if &stmts[i] == target {
+			removed := stmts[i]
+			return append(stmts[:i:i], stmts[i+1:]...), removed, true
+		}
+		if children, removed, ok := removeStatement(stmts[i].Children, target); ok {
+			stmts[i].Children = children
+			return stmts, removed, true
+		}
+	}
+	return stmts, Statement{}, false
+}
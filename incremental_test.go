@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func intp(n int) *int { return &n }
+
+func TestMergeIncrementalStatementsSkipsDuplicates(t *testing.T) {
+	tree := []Statement{{Text: "Go is simpler", Type: "claim", MsgIndex: intp(1)}}
+	tree, merged := mergeIncrementalStatements(tree, []Statement{
+		{Text: "Go is simpler", Type: "claim", MsgIndex: intp(1)},
+		{Text: "Not for GUIs", Type: "response", MsgIndex: intp(2), ParentText: "Go is simpler"},
+		{Text: "Orphan", Type: "response", MsgIndex: intp(3), ParentText: "Missing"},
+	})
+	if len(tree) != 2 || len(tree[0].Children) != 1 || tree[0].Children[0].ParentText != "" || tree[1].Text != "Orphan" {
+		t.Fatalf("unexpected merge: %+v", tree)
+	}
+	if len(merged) != 2 || merged[0].Text != "Not for GUIs" || merged[0].ParentText != "Go is simpler" {
+		t.Fatalf("unexpected merged statements: %+v", merged)
+	}
+}
+
+func TestAnalyzeIncrementalPersistsToSession(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+
+	req := httptest.NewRequest("POST", "/api/session/new", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var session struct {
+		Slug string `json:"slug"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &session)
+
+	post := func(path string, body map[string]any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	history := "[1] (speaker_1) Ada: Go is simpler to deploy\n[2] (speaker_2) Ben: Python has more libraries"
+	post("/api/analyze-incremental", map[string]any{"new_text": history, "slug": session.Slug})
+	tr, _ := store.GetTranscriptBySlug(session.Slug)
+	before, _ := store.GetClaimTree(tr.ID)
+
+	prev := llm
+	fake := newFakeLLM()
+	fake.Respond = func(string) (string, error) {
+		return `{"statements":[{"speaker":"Ada","speaker_id":"speaker_1","text":"Go has enough libraries","type":"response","msg_index":3,"parent_text":"Python has more libraries"}],` +
+			`"updates":[{"msg_index":2,"type":"rebuttal","parent_text":"Go is simpler to deploy"}]}`, nil
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	post("/api/analyze-incremental", map[string]any{
+		"new_text":     "[3] (speaker_1) Ada: Go has enough libraries",
+		"context_text": history,
+		"slug":         session.Slug,
+	})
+
+	req = httptest.NewRequest("GET", "/api/transcripts/"+session.Slug, nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var detail struct {
+		Statements []Statement `json:"statements"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &detail)
+
+	// The first call stored both lines top-level; the update re-nests msg 2
+	// under msg 1 and the new statement lands under msg 2.
+	tree := detail.Statements
+	if len(tree) != 1 || tree[0].Text != "Go is simpler to deploy" || len(tree[0].Children) != 1 {
+		t.Fatalf("unexpected stored tree: %+v", tree)
+	}
+	reply := tree[0].Children[0]
+	if reply.Type != "rebuttal" || len(reply.Children) != 1 || reply.Children[0].Text != "Go has enough libraries" {
+		t.Fatalf("unexpected stored reply: %+v", reply)
+	}
+
+	// Stored statements are updated in place rather than re-inserted
+	after, _ := store.GetClaimTree(tr.ID)
+	if len(before) != 2 || after[0].ClaimID != before[0].ClaimID || after[0].Children[0].ClaimID != before[1].ClaimID {
+		t.Fatalf("claims were re-created: before %+v, after %+v", before, after)
+	}
+	if g, _ := store.GetFullGraph(); len(g.Nodes) != 3 {
+		t.Fatalf("want 3 claims in the store, got %d", len(g.Nodes))
+	}
+}
+
+func TestIncrementalTextCorrectionRelinksCanonicalClaim(t *testing.T) {
+	setupTestStore(t)
+	tid := persistClaimConversation(t, "Tea", []Statement{
+		{Speaker: "speaker_1", Text: "Coffee beats tea every morning", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_2", Text: "Tea has less caffeine", Type: "rebuttal", MsgIndex: intp(2)},
+		}},
+	})
+	oldID, _ := store.FindCanonicalClaim(normalizeClaimText("Coffee beats tea every morning"))
+
+	persistIncremental(tid, &IncrementalResult{Updates: []StatementUpdate{
+		{MsgIndex: 1, Text: strp("Green tea is healthier than coffee")},
+	}})
+	newID, err := store.FindCanonicalClaim(normalizeClaimText("Green tea is healthier than coffee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mentions, _ := store.GetClaimMentions(oldID); len(mentions) != 0 {
+		t.Errorf("corrected statement still mentions the old claim: %+v", mentions)
+	}
+	if mentions, _ := store.GetClaimMentions(newID); len(mentions) != 1 || mentions[0].TranscriptID != tid {
+		t.Errorf("corrected statement not linked to its new claim: %+v", mentions)
+	}
+	if replies, _ := store.GetClaimReplies(newID); len(replies) != 1 || replies[0].Text != "Tea has less caffeine" {
+		t.Errorf("reply not relinked: %+v", replies)
+	}
+}
+
+func TestAnalyzeIncrementalUsesSessionSpeakers(t *testing.T) {
+	setupTestStore(t)
+	tid, _ := store.SaveTranscript("", "")
+	store.SaveDiarization(tid, map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}, []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "Go is simpler to deploy"},
+		{Speaker: "speaker_2", Text: "Python has more libraries"},
+	})
+	tr, _ := store.GetTranscript(tid)
+
+	prev := llm
+	fake := newFakeLLM()
+	// Ben hasn't spoken in this window, but is one of the session's speakers
+	fake.Respond = func(string) (string, error) {
+		return `{"statements":[{"speaker":"Ben","speaker_id":"speaker_2","text":"Deploys are a solved problem","type":"claim","msg_index":3}]}`, nil
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	data, _ := json.Marshal(map[string]any{"new_text": "[3] (speaker_1) Ada: Go builds one binary", "slug": tr.Slug})
+	req := httptest.NewRequest("POST", "/api/analyze-incremental", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, req)
+	var result IncrementalResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+	if len(result.Statements) != 1 || result.Statements[0].SpeakerID != "speaker_2" {
+		t.Fatalf("session speaker not recognized: %+v", result.Statements)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Streaming ingest: the recorder sends raw PCM over a WebSocket, the server
+// cuts it at pauses and transcribes each segment exactly once, so cost grows
+// linearly with meeting length instead of resending the whole recording.
+var (
+	ingestVADThreshold = getEnvInt("INGEST_VAD_THRESHOLD", 500) // frame RMS, int16 scale
+	ingestMinSilenceMs = getEnvInt("INGEST_MIN_SILENCE_MS", 700)
+	ingestMaxSegmentMs = getEnvInt("INGEST_MAX_SEGMENT_MS", 20000)
+)
+
+const (
+	ingestFrameMs   = 30
+	ingestPrerollMs = 300
+	// Ingested utterances have no speaker until diarization assigns one
+	ingestSpeaker = "speaker_1"
+)
+
+// audioSegment is a voiced stretch of the stream, timed from stream start.
+type audioSegment struct {
+	StartMs int64
+	EndMs   int64
+	Samples []int16
+}
+
+// segmenter cuts a mono PCM stream into voiced segments using frame energy.
+// A segment ends after ingestMinSilenceMs of quiet or at ingestMaxSegmentMs;
+// silence between segments is discarded except for a short pre-roll.
+type segmenter struct {
+	sampleRate   int
+	pending      []int16 // partial frame carried between writes
+	buf          []int16
+	bufStart     int64 // stream offset of buf[0], in samples
+	voiced       bool
+	silentFrames int
+}
+
+func newSegmenter(sampleRate int) *segmenter {
+	return &segmenter{sampleRate: sampleRate}
+}
+
+func (s *segmenter) samplesToMs(n int64) int64 {
+	return n * 1000 / int64(s.sampleRate)
+}
+
+// write feeds samples in and returns any segments they completed.
+func (s *segmenter) write(samples []int16) []audioSegment {
+	var out []audioSegment
+	frame := s.sampleRate * ingestFrameMs / 1000
+	s.pending = append(s.pending, samples...)
+	i := 0
+	for ; len(s.pending)-i >= frame; i += frame {
+		if seg := s.addFrame(s.pending[i : i+frame]); seg != nil {
+			out = append(out, *seg)
+		}
+	}
+	s.pending = append(s.pending[:0], s.pending[i:]...)
+	return out
+}
+
+func (s *segmenter) addFrame(frame []int16) *audioSegment {
+	s.buf = append(s.buf, frame...)
+	if frameRMS(frame) >= float64(ingestVADThreshold) {
+		s.voiced = true
+		s.silentFrames = 0
+	} else {
+		s.silentFrames++
+	}
+
+	if !s.voiced {
+		keep := s.sampleRate * ingestPrerollMs / 1000
+		if drop := len(s.buf) - keep; drop > 0 {
+			s.buf = append(s.buf[:0], s.buf[drop:]...)
+			s.bufStart += int64(drop)
+		}
+		return nil
+	}
+	if s.silentFrames*ingestFrameMs >= ingestMinSilenceMs || s.samplesToMs(int64(len(s.buf))) >= int64(ingestMaxSegmentMs) {
+		return s.cut()
+	}
+	return nil
+}
+
+// flush returns whatever voiced audio is buffered at the end of the stream.
+func (s *segmenter) flush() *audioSegment {
+	s.buf = append(s.buf, s.pending...)
+	s.pending = nil
+	if !s.voiced {
+		return nil
+	}
+	return s.cut()
+}
+
+func (s *segmenter) cut() *audioSegment {
+	end := s.bufStart + int64(len(s.buf))
+	seg := &audioSegment{StartMs: s.samplesToMs(s.bufStart), EndMs: s.samplesToMs(end), Samples: s.buf}
+	s.buf = nil
+	s.bufStart = end
+	s.voiced = false
+	s.silentFrames = 0
+	return seg
+}
+
+func frameRMS(frame []int16) float64 {
+	if len(frame) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range frame {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
+
+// pcmSamples decodes little-endian 16-bit PCM, dropping a trailing odd byte.
+func pcmSamples(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return samples
+}
+
+func writeWAV(path string, samples []int16, sampleRate int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	dataSize := uint32(len(samples) * 2)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(1), uint16(1),
+		uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(f, binary.LittleEndian, v); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := binary.Write(f, binary.LittleEndian, samples); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ingestMessage is sent to the recorder: "segment" per transcribed segment,
+// "error" when one fails, and "done" once the stream is fully transcribed.
+type ingestMessage struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	StartMs  int64  `json:"start_ms,omitempty"`
+	EndMs    int64  `json:"end_ms,omitempty"`
+	MsgIndex int    `json:"msg_index,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var ingestUpgrader = websocket.Upgrader{ReadBufferSize: 32 << 10, WriteBufferSize: 4 << 10}
+
+const ingestSegmentTimeout = 2 * time.Minute
+
+// GET /api/transcripts/{slug}/ingest?sample_rate=16000 (WebSocket). Binary
+// messages carry 16-bit little-endian mono PCM; a {"type":"stop"} text
+// message flushes the last segment. Segments still queued when the client
+// disconnects are transcribed and saved anyway. Segment times continue from
+// the session's last utterance, so recording again into a session keeps its
+// timeline increasing.
+func handleIngest(w http.ResponseWriter, r *http.Request, t *storage.Transcript) {
+	sampleRate := 16000
+	if v := r.URL.Query().Get("sample_rate"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 8000 || n > 48000 {
+			jsonError(w, "invalid sample_rate", 400)
+			return
+		}
+		sampleRate = n
+	}
+
+	offsetMs, err := store.LastUtteranceEndMs(t.ID)
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+
+	conn, err := ingestUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has already replied
+	}
+	defer conn.Close()
+	conn.SetReadLimit(1 << 20)
+
+	segments := make(chan audioSegment, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		transcribeSegments(context.WithoutCancel(r.Context()), t.ID, sampleRate, offsetMs, segments, conn)
+	}()
+
+	seg := newSegmenter(sampleRate)
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if kind == websocket.BinaryMessage {
+			for _, s := range seg.write(pcmSamples(data)) {
+				segments <- s
+			}
+			continue
+		}
+		var msg struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(data, &msg) == nil && msg.Type == "stop" {
+			break
+		}
+	}
+	if s := seg.flush(); s != nil {
+		segments <- *s
+	}
+	close(segments)
+	<-done
+
+	conn.WriteJSON(ingestMessage{Type: "done"})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// transcribeSegments is the connection's only writer until it returns.
+// Write errors are ignored so a departed client doesn't stop persistence.
+// offsetMs is added to segment times, which count from the stream's start.
+func transcribeSegments(ctx context.Context, tid int64, sampleRate int, offsetMs int64, segments <-chan audioSegment, conn *websocket.Conn) {
+	for seg := range segments {
+		start, end := offsetMs+seg.StartMs, offsetMs+seg.EndMs
+		text, err := transcribeSegment(ctx, seg, sampleRate)
+		if err != nil {
+			log.Printf("ingest: transcript %d segment at %dms: %v", tid, start, err)
+			conn.WriteJSON(ingestMessage{Type: "error", StartMs: start, EndMs: end, Error: err.Error()})
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		idx, err := appendUtterance(tid, storage.DiarizeMessage{Speaker: ingestSpeaker, Text: text, StartMs: &start, EndMs: &end})
+		if err != nil {
+			log.Printf("ingest: transcript %d: save utterance: %v", tid, err)
+		}
+		conn.WriteJSON(ingestMessage{Type: "segment", Text: text, StartMs: start, EndMs: end, MsgIndex: idx})
+	}
+}
+
+func transcribeSegment(ctx context.Context, seg audioSegment, sampleRate int) (string, error) {
+	path := fmt.Sprintf("uploads/ingest-%d.wav", time.Now().UnixNano())
+	if err := writeWAV(path, seg.Samples, sampleRate); err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+
+	ctx, cancel := context.WithTimeout(ctx, ingestSegmentTimeout)
+	defer cancel()
+	timed, err := transcriber.Transcribe(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(segmentsText(timed)), nil
+}
+
+// appendUtterance adds m to the end of the session's utterances and returns
+// its 1-based msg_index. Only the new row is written and indexed, so each
+// segment costs the same however long the recording runs.
+func appendUtterance(tid int64, m storage.DiarizeMessage) (int, error) {
+	unlock := lockTranscript(tid)
+	defer unlock()
+
+	var name string
+	if sp, err := store.GetTranscriptSpeakers(tid); err == nil {
+		name = sp[m.Speaker].Name
+	}
+	idx, err := store.AppendUtterance(tid, m, name)
+	if err != nil {
+		return 0, err
+	}
+	if idx == 1 {
+		indexTranscriptSearch(tid)
+	}
+	m.Position = idx
+	publishUtterances(tid, idx-1, map[string]string{m.Speaker: name}, []storage.DiarizeMessage{m})
+	return idx, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// tone returns ms of a 440Hz sine at amplitude amp.
+func tone(ms, sampleRate int, amp float64) []int16 {
+	out := make([]int16, ms*sampleRate/1000)
+	for i := range out {
+		out[i] = int16(amp * math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate)))
+	}
+	return out
+}
+
+func pcmBytes(samples []int16) []byte {
+	out := make([]byte, len(samples)*2)
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(v))
+	}
+	return out
+}
+
+func TestSegmenterCutsAtPauses(t *testing.T) {
+	const rate = 16000
+	var stream []int16
+	stream = append(stream, tone(1000, rate, 0)...)    // leading silence
+	stream = append(stream, tone(1500, rate, 3000)...) // speech
+	stream = append(stream, tone(1000, rate, 0)...)    // pause
+	stream = append(stream, tone(600, rate, 3000)...)  // speech, no trailing pause
+
+	seg := newSegmenter(rate)
+	var got []audioSegment
+	// Feed in uneven chunks, as the browser would
+	for len(stream) > 0 {
+		n := min(777, len(stream))
+		got = append(got, seg.write(stream[:n])...)
+		stream = stream[n:]
+	}
+	if last := seg.flush(); last != nil {
+		got = append(got, *last)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(got))
+	}
+	// Leading silence is trimmed to the pre-roll
+	if got[0].StartMs < 1000-ingestPrerollMs-ingestFrameMs || got[0].StartMs > 1000 {
+		t.Fatalf("first segment starts at %dms", got[0].StartMs)
+	}
+	if got[0].EndMs < 2500 || got[0].EndMs > 3500 {
+		t.Fatalf("first segment ends at %dms", got[0].EndMs)
+	}
+	if got[1].EndMs != 4100 {
+		t.Fatalf("second segment ends at %dms, want 4100", got[1].EndMs)
+	}
+	for _, s := range got {
+		if int64(len(s.Samples)) != (s.EndMs-s.StartMs)*rate/1000 {
+			t.Fatalf("segment %d-%dms has %d samples", s.StartMs, s.EndMs, len(s.Samples))
+		}
+	}
+}
+
+func TestSegmenterCapsSegmentLength(t *testing.T) {
+	prev := ingestMaxSegmentMs
+	t.Cleanup(func() { ingestMaxSegmentMs = prev })
+	ingestMaxSegmentMs = 1000
+
+	seg := newSegmenter(8000)
+	got := seg.write(tone(3500, 8000, 3000))
+	if len(got) != 3 {
+		t.Fatalf("expected 3 capped segments, got %d", len(got))
+	}
+}
+
+func TestIngestWebSocket(t *testing.T) {
+	setupTestStore(t)
+	srv := httptest.NewServer(setupMux())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/session/new", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session struct {
+		Slug string `json:"slug"`
+	}
+	json.NewDecoder(resp.Body).Decode(&session)
+	resp.Body.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/transcripts/" + session.Slug + "/ingest?sample_rate=16000"
+	segments := recordIngest(t, wsURL)
+	if len(segments) != 2 || segments[0].Text != "Testing one two." || segments[1].MsgIndex != 2 {
+		t.Fatalf("unexpected segments: %+v", segments)
+	}
+	if segments[1].StartMs < segments[0].EndMs {
+		t.Fatalf("segments overlap: %+v", segments)
+	}
+
+	tr, _ := store.GetTranscriptBySlug(session.Slug)
+	_, messages, _ := store.GetDiarization(tr.ID)
+	if len(messages) != 2 || messages[0].Speaker != ingestSpeaker || messages[0].StartMs == nil || *messages[1].StartMs != segments[1].StartMs {
+		t.Fatalf("unexpected stored utterances: %+v", messages)
+	}
+	hits, err := store.Search(storage.SearchQuery{Text: "testing", Kind: storage.SearchUtterance, Limit: 10})
+	if err != nil || len(hits) != 2 || *hits[0].MsgIndex == *hits[1].MsgIndex {
+		t.Fatalf("utterances not each indexed once: %+v %v", hits, err)
+	}
+}
+
+// recordIngest streams two utterances separated by a pause over one
+// connection and returns the segments sent back.
+func recordIngest(t *testing.T, wsURL string) []ingestMessage {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var audio []int16
+	audio = append(audio, tone(1200, 16000, 3000)...)
+	audio = append(audio, tone(1000, 16000, 0)...)
+	audio = append(audio, tone(800, 16000, 3000)...)
+	for chunk := pcmBytes(audio); len(chunk) > 0; {
+		n := min(8000, len(chunk))
+		if err := conn.WriteMessage(websocket.BinaryMessage, chunk[:n]); err != nil {
+			t.Fatal(err)
+		}
+		chunk = chunk[n:]
+	}
+	conn.WriteJSON(map[string]string{"type": "stop"})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var segments []ingestMessage
+	for {
+		var msg ingestMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if msg.Type == "done" {
+			return segments
+		}
+		if msg.Type != "segment" {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+		segments = append(segments, msg)
+	}
+}
+
+func TestIngestReconnectContinuesTimeline(t *testing.T) {
+	setupTestStore(t)
+	srv := httptest.NewServer(setupMux())
+	defer srv.Close()
+
+	tid, _ := store.SaveTranscript("", "")
+	tr, _ := store.GetTranscript(tid)
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/transcripts/" + tr.Slug + "/ingest?sample_rate=16000"
+	first := recordIngest(t, wsURL)
+	second := recordIngest(t, wsURL)
+	if len(first) != 2 || len(second) != 2 {
+		t.Fatalf("unexpected segments: %+v, %+v", first, second)
+	}
+	if second[0].StartMs < first[1].EndMs || second[0].MsgIndex != 3 {
+		t.Fatalf("second recording restarted the timeline: %+v after %+v", second, first)
+	}
+
+	_, messages, _ := store.GetDiarization(tid)
+	for i := 1; i < len(messages); i++ {
+		if *messages[i].StartMs < *messages[i-1].EndMs {
+			t.Fatalf("stored times go backwards at %d: %+v", i, messages)
+		}
+	}
+}
+
+func TestIngestRejectsBadSampleRate(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+
+	req := httptest.NewRequest("POST", "/api/session/new", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var session struct {
+		Slug string `json:"slug"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &session)
+
+	req = httptest.NewRequest("GET", "/api/transcripts/"+session.Slug+"/ingest?sample_rate=99", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// progressFunc receives coarse stage names ("diarizing", "analyzing", ...)
+// from long-running pipeline steps. A nil progressFunc discards them.
+type progressFunc func(stage string)
+
+func (p progressFunc) report(stage string) {
+	if p != nil {
+		p(stage)
+	}
+}
+
+// jobKind describes how to validate, run and clean up one kind of job.
+// Payloads are the same request bodies the synchronous endpoints accept.
+// authorize, if set, checks the requester may run the job and returns the
+// payload to store.
+type jobKind struct {
+	validate  func(payload json.RawMessage) error
+	authorize func(u *storage.User, payload json.RawMessage) (json.RawMessage, error)
+	run       func(ctx context.Context, payload json.RawMessage, progress progressFunc) (any, error)
+	cleanup   func(payload json.RawMessage)
+}
+
+var jobKinds = map[string]jobKind{
+	"analyze": {
+		validate: func(payload json.RawMessage) error {
+			var req analyzeRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return fmt.Errorf("invalid payload")
+			}
+			if strings.TrimSpace(req.Transcript) == "" {
+				return fmt.Errorf("no transcript")
+			}
+			return nil
+		},
+		authorize: func(u *storage.User, payload json.RawMessage) (json.RawMessage, error) {
+			var req analyzeRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			if err := authorizeAnalyze(u, &req); err != nil {
+				return nil, err
+			}
+			return json.Marshal(req)
+		},
+		run: func(ctx context.Context, payload json.RawMessage, progress progressFunc) (any, error) {
+			var req analyzeRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			return runAnalyze(ctx, req, progress)
+		},
+	},
+	"diarize": {
+		validate: func(payload json.RawMessage) error {
+			var req diarizeRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return fmt.Errorf("invalid payload")
+			}
+			if strings.TrimSpace(req.Transcript) == "" {
+				return fmt.Errorf("no transcript")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, payload json.RawMessage, progress progressFunc) (any, error) {
+			var req diarizeRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			return runDiarize(ctx, req, progress)
+		},
+	},
+	"transcribe": {
+		validate: func(payload json.RawMessage) error {
+			var req transcribeRequest
+			if err := json.Unmarshal(payload, &req); err != nil || req.AudioPath == "" {
+				return fmt.Errorf("no audio file")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, payload json.RawMessage, progress progressFunc) (any, error) {
+			var req transcribeRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			return runTranscribe(ctx, req, progress)
+		},
+		cleanup: func(payload json.RawMessage) {
+			var req transcribeRequest
+			if json.Unmarshal(payload, &req) == nil && req.AudioPath != "" {
+				os.Remove(req.AudioPath)
+			}
+		},
+	},
+}
+
+const jobPollInterval = 2 * time.Second
+
+// jobQueue runs queued jobs from the jobs table on a fixed pool of workers.
+// The table is the source of truth; wake only shortens the poll delay.
+type jobQueue struct {
+	wake        chan struct{}
+	maxAttempts int
+	timeout     time.Duration
+	wg          sync.WaitGroup
+}
+
+var queue *jobQueue
+
+// startJobWorkers requeues jobs left running by a previous process and
+// starts n workers that run until ctx is cancelled.
+func startJobWorkers(ctx context.Context, n, maxAttempts int, timeout time.Duration) *jobQueue {
+	if n < 1 {
+		n = 1
+	}
+	if requeued, failed, err := store.RequeueRunningJobs(); err != nil {
+		log.Printf("jobs: requeue: %v", err)
+	} else if requeued > 0 || failed > 0 {
+		log.Printf("jobs: requeued %d interrupted jobs, %d out of attempts failed", requeued, failed)
+	}
+	q := &jobQueue{wake: make(chan struct{}, 1), maxAttempts: maxAttempts, timeout: timeout}
+	for i := 0; i < n; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	return q
+}
+
+// wait blocks until every worker has exited after ctx cancellation.
+func (q *jobQueue) wait() {
+	q.wg.Wait()
+}
+
+func (q *jobQueue) enqueue(kind string, payload json.RawMessage, ownerID int64, handleHash string) (*storage.Job, error) {
+	id, err := store.CreateJob(kind, payload, q.maxAttempts, ownerID, handleHash)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return store.GetJob(id)
+}
+
+func (q *jobQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := store.ClaimNextJob()
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("jobs: claim: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		q.run(ctx, job)
+	}
+}
+
+func (q *jobQueue) run(ctx context.Context, job *storage.Job) {
+	publishJob(job.ID)
+	kind, ok := jobKinds[job.Kind]
+	if !ok {
+		store.FailJob(job.ID, "unknown job kind: "+job.Kind)
+		publishJob(job.ID)
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	progress := func(stage string) {
+		store.UpdateJobProgress(job.ID, stage)
+		publishJob(job.ID)
+	}
+	result, err := kind.run(runCtx, job.Payload, progress)
+
+	// Shutting down: hand the job back for the next start to pick up
+	if ctx.Err() != nil {
+		if err := store.ReleaseJob(job.ID); err != nil {
+			log.Printf("jobs: release %d: %v", job.ID, err)
+		}
+		return
+	}
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(result); err == nil {
+			err = store.CompleteJob(job.ID, data)
+		}
+	}
+	if err != nil {
+		log.Printf("jobs: %s job %d attempt %d: %v", job.Kind, job.ID, job.Attempts, err)
+		store.FailJob(job.ID, err.Error())
+	}
+
+	if final, ferr := store.GetJob(job.ID); ferr == nil {
+		if final.Done() && kind.cleanup != nil {
+			kind.cleanup(job.Payload)
+		}
+		events.publish(jobTopic(job.ID), sseEvent{Name: "job", Data: final})
+	}
+}
+
+func jobTopic(id int64) string {
+	return "job:" + strconv.FormatInt(id, 10)
+}
+
+func publishJob(id int64) {
+	if j, err := store.GetJob(id); err == nil {
+		events.publish(jobTopic(id), sseEvent{Name: "job", Data: j})
+	}
+}
+
+// POST /api/jobs, GET /api/jobs/{id} and GET /api/jobs/{id}/events
+func handleAPIJobs(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	path = strings.TrimPrefix(path, "/argraphments")
+	path = strings.TrimPrefix(path, "/api/jobs")
+	path = strings.TrimPrefix(path, "/")
+
+	if path == "" {
+		if r.Method != http.MethodPost {
+			jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleCreateJob(w, r)
+		return
+	}
+
+	idStr, subResource, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		jsonError(w, "invalid id", 400)
+		return
+	}
+	job, err := store.GetJob(id)
+	if err != nil {
+		jsonError(w, "not found", 404)
+		return
+	}
+	if !canReadJob(r, id) {
+		jsonError(w, "not found", 404)
+		return
+	}
+
+	switch subResource {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	case "events":
+		streamJob(w, r, job)
+	default:
+		jsonError(w, "not found", 404)
+	}
+}
+
+// canReadJob: a job queued by a signed-in user is theirs alone; any other
+// job is read with the handle returned when it was queued, passed as
+// ?handle=, since job ids are sequential and easy to walk.
+func canReadJob(r *http.Request, id int64) bool {
+	owner, err := store.JobOwner(id)
+	if err != nil {
+		return false
+	}
+	if owner != 0 {
+		return owner == userID(requestUser(r))
+	}
+	handle := r.URL.Query().Get("handle")
+	if handle == "" {
+		return false
+	}
+	ok, err := store.JobHandleMatches(id, hashToken(handle))
+	return err == nil && ok
+}
+
+// handleCreateJob accepts {"kind": "...", "payload": {...}} as JSON, or a
+// multipart form with kind=transcribe and an "audio" file.
+func handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	if queue == nil {
+		jsonError(w, "job queue not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	u := requestUser(r)
+	var kind string
+	var payload json.RawMessage
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		tmpPath, status, err := saveAudioUpload(r)
+		if err != nil {
+			jsonError(w, err.Error(), status)
+			return
+		}
+		kind = r.FormValue("kind")
+		if kind == "" {
+			kind = "transcribe"
+		}
+		if kind != "transcribe" {
+			os.Remove(tmpPath)
+			jsonError(w, "only transcribe jobs accept audio uploads", 400)
+			return
+		}
+		payload, _ = json.Marshal(transcribeRequest{AudioPath: tmpPath})
+	} else {
+		var req struct {
+			Kind    string          `json:"kind"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid JSON", 400)
+			return
+		}
+		if req.Kind == "transcribe" {
+			// Paths are server-internal; audio must come through an upload
+			jsonError(w, "transcribe jobs require a multipart audio upload", 400)
+			return
+		}
+		kind, payload = req.Kind, req.Payload
+	}
+
+	k, ok := jobKinds[kind]
+	if !ok {
+		jsonError(w, fmt.Sprintf("unknown job kind %q", kind), 400)
+		return
+	}
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	if err := k.validate(payload); err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+	if k.authorize != nil {
+		var err error
+		if payload, err = k.authorize(u, payload); err != nil {
+			jsonError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	var handle, handleHash string
+	if u == nil {
+		handle, handleHash = newToken()
+	}
+	job, err := queue.enqueue(kind, payload, userID(u), handleHash)
+	if err != nil {
+		jsonError(w, "failed to create job", 500)
+		return
+	}
+	job.Handle = handle
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// streamJob sends the job's current state, then every update, as SSE
+// "job" events until it finishes or the client goes away.
+func streamJob(w http.ResponseWriter, r *http.Request, job *storage.Job) {
+	ch, unsubscribe := events.subscribe(jobTopic(job.ID))
+	defer unsubscribe()
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	// Re-read after subscribing so an update between the two isn't lost
+	if fresh, err := store.GetJob(job.ID); err == nil {
+		job = fresh
+	}
+	if err := writeSSE(w, flusher, sseEvent{Name: "job", Data: job}); err != nil || job.Done() {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case ev := <-ch:
+			if err := writeSSE(w, flusher, ev); err != nil {
+				return
+			}
+			if j, ok := ev.Data.(*storage.Job); ok && j.Done() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func startTestJobWorkers(t *testing.T, maxAttempts int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	queue = startJobWorkers(ctx, 2, maxAttempts, 10*time.Second)
+	q := queue
+	t.Cleanup(func() { cancel(); q.wait(); queue = nil })
+}
+
+func createJob(t *testing.T, mux *http.ServeMux, kind string, payload any) storage.Job {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"kind": kind, "payload": payload})
+	req := httptest.NewRequest("POST", "/api/jobs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create job: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job storage.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	return job
+}
+
+func waitForJob(t *testing.T, mux *http.ServeMux, created storage.Job) storage.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/jobs/%d?handle=%s", created.ID, created.Handle), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		var job storage.Job
+		json.Unmarshal(w.Body.Bytes(), &job)
+		if job.Done() {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %d did not finish", created.ID)
+	return storage.Job{}
+}
+
+func TestJobAnalyzeLifecycle(t *testing.T) {
+	setupTestStore(t)
+	startTestJobWorkers(t, 1)
+	mux := setupMux()
+
+	job := createJob(t, mux, "analyze", map[string]any{
+		"transcript": "Alice: Cats are better than dogs.\nBob: Dogs are more loyal.",
+	})
+	if job.ID == 0 || job.Kind != "analyze" || job.Handle == "" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	// Anonymous jobs are only readable with their handle
+	for _, query := range []string{"", "?handle=arg_wrong"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/jobs/%d%s", job.ID, query), nil))
+		if w.Code != 404 {
+			t.Fatalf("job read with %q: status %d", query, w.Code)
+		}
+	}
+
+	done := waitForJob(t, mux, job)
+	if done.Status != storage.JobSucceeded || done.Attempts != 1 {
+		t.Fatalf("expected succeeded after 1 attempt, got %+v", done)
+	}
+	var result analyzeResponse
+	if err := json.Unmarshal(done.Result, &result); err != nil {
+		t.Fatalf("bad result: %v", err)
+	}
+	if result.Slug == "" || len(result.Statements) == 0 {
+		t.Fatalf("unexpected result: %s", done.Result)
+	}
+}
+
+func TestJobRetriesThenFails(t *testing.T) {
+	setupTestStore(t)
+	prev := llm
+	fake := newFakeLLM()
+	fake.Respond = func(string) (string, error) { return "", fmt.Errorf("upstream overloaded") }
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+	startTestJobWorkers(t, 2)
+	mux := setupMux()
+
+	job := createJob(t, mux, "diarize", map[string]any{"transcript": "hello there"})
+	done := waitForJob(t, mux, job)
+	if done.Status != storage.JobFailed || done.Attempts != 2 {
+		t.Fatalf("expected failed after 2 attempts, got %+v", done)
+	}
+	if !strings.Contains(done.Error, "upstream overloaded") {
+		t.Fatalf("expected error recorded, got %q", done.Error)
+	}
+	if n := len(fake.Prompts()); n != 2 {
+		t.Fatalf("expected 2 LLM calls, got %d", n)
+	}
+}
+
+func TestRequeueRunningJobs(t *testing.T) {
+	setupTestStore(t)
+	last, _ := store.CreateJob("diarize", json.RawMessage(`{}`), 1, 0, "")
+	retry, _ := store.CreateJob("diarize", json.RawMessage(`{}`), 2, 0, "")
+	// Both are claimed once, then the process dies
+	for i := 0; i < 2; i++ {
+		if _, err := store.ClaimNextJob(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requeued, failed, err := store.RequeueRunningJobs()
+	if err != nil || requeued != 1 || failed != 1 {
+		t.Fatalf("requeued %d, failed %d, err %v", requeued, failed, err)
+	}
+	if j, _ := store.GetJob(last); j.Status != storage.JobFailed || j.Error == "" {
+		t.Errorf("job out of attempts should fail, got %+v", j)
+	}
+	if j, _ := store.GetJob(retry); j.Status != storage.JobQueued {
+		t.Errorf("job with attempts left should be queued, got %+v", j)
+	}
+}
+
+func TestShutdownReleasesRunningJob(t *testing.T) {
+	setupTestStore(t)
+	prev := llm
+	started, release := make(chan struct{}), make(chan struct{})
+	fake := newFakeLLM()
+	fake.Respond = func(string) (string, error) {
+		close(started)
+		<-release
+		return "", fmt.Errorf("interrupted")
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+	ctx, cancel := context.WithCancel(context.Background())
+	queue = startJobWorkers(ctx, 1, 1, 10*time.Second)
+	q := queue
+	t.Cleanup(func() { queue = nil })
+
+	job, err := q.enqueue("diarize", json.RawMessage(`{"transcript":"hello there"}`), 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	cancel()
+	close(release)
+	q.wait()
+
+	if j, _ := store.GetJob(job.ID); j.Status != storage.JobQueued || j.Attempts != 0 {
+		t.Fatalf("interrupted job should be queued with its attempt unspent, got %+v", j)
+	}
+}
+
+func TestJobEventsStream(t *testing.T) {
+	setupTestStore(t)
+	startTestJobWorkers(t, 1)
+	srv := httptest.NewServer(setupMux())
+	defer srv.Close()
+
+	body, _ := json.Marshal(map[string]any{"kind": "diarize", "payload": map[string]string{"transcript": "Sam: hi\nAlex: hello"}})
+	resp, err := http.Post(srv.URL+"/api/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job storage.Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+
+	resp, err = http.Get(fmt.Sprintf("%s/api/jobs/%d/events?handle=%s", srv.URL, job.ID, job.Handle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+
+	// The stream ends itself once the job reaches a terminal status
+	var last storage.Job
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			json.Unmarshal([]byte(data), &last)
+		}
+	}
+	if last.Status != storage.JobSucceeded {
+		t.Fatalf("expected final event to be succeeded, got %+v", last)
+	}
+}
+
+func TestCreateJobValidation(t *testing.T) {
+	setupTestStore(t)
+	startTestJobWorkers(t, 1)
+	mux := setupMux()
+
+	for _, body := range []string{
+		`{"kind":"bogus","payload":{}}`,
+		`{"kind":"analyze","payload":{"transcript":"  "}}`,
+		`{"kind":"transcribe","payload":{"audio_path":"/etc/passwd"}}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs/999", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Fatalf("expected 404 for missing job, got %d", w.Code)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// List endpoints return one page as a JSON array, with the number of
+// matching items in X-Total-Count and, when there are more, an opaque
+// cursor for the next page in X-Next-Cursor. Lists are sorted and filtered
+// in memory: the core store only lists everything.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// listKey orders one item of a list. Only the field the list is sorted by
+// is set; ID breaks ties so cursors stay stable as items are added.
+type listKey struct {
+	N  int64  `json:"n,omitempty"`
+	S  string `json:"s,omitempty"`
+	ID int64  `json:"id"`
+}
+
+func compareListKeys(a, b listKey) int {
+	if c := cmp.Compare(a.N, b.N); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.S, b.S); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// listCursor is the decoded X-Next-Cursor: the page continues after After
+// in the same order.
+type listCursor struct {
+	Sort  string  `json:"sort"`
+	Desc  bool    `json:"desc"`
+	After listKey `json:"after"`
+}
+
+type listParams struct {
+	Sort  string
+	Desc  bool
+	Limit int
+	After *listKey
+}
+
+// parseListParams reads limit, sort, order and cursor. sorts maps each
+// accepted sort to whether it defaults to descending; a cursor carries its
+// own sort and order.
+func parseListParams(r *http.Request, sorts map[string]bool, defaultSort string) (listParams, error) {
+	query := r.URL.Query()
+	p := listParams{Sort: defaultSort, Limit: defaultPageSize}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid limit")
+		}
+		p.Limit = min(n, maxPageSize)
+	}
+	if v := query.Get("cursor"); v != "" {
+		var c listCursor
+		data, err := base64.RawURLEncoding.DecodeString(v)
+		if err == nil {
+			err = json.Unmarshal(data, &c)
+		}
+		if _, ok := sorts[c.Sort]; err != nil || !ok {
+			return p, fmt.Errorf("invalid cursor")
+		}
+		p.Sort, p.Desc, p.After = c.Sort, c.Desc, &c.After
+		return p, nil
+	}
+	if v := query.Get("sort"); v != "" {
+		if _, ok := sorts[v]; !ok {
+			names := make([]string, 0, len(sorts))
+			for name := range sorts {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return p, fmt.Errorf("sort must be one of %s", strings.Join(names, ", "))
+		}
+		p.Sort = v
+	}
+	p.Desc = sorts[p.Sort]
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		p.Desc = false
+	case "desc":
+		p.Desc = true
+	default:
+		return p, fmt.Errorf("order must be asc or desc")
+	}
+	return p, nil
+}
+
+// paginate sorts items, sets the pagination headers and returns the
+// requested page.
+func paginate[T any](w http.ResponseWriter, items []T, key func(T) listKey, p listParams) []T {
+	keys := make(map[int]listKey, len(items))
+	idx := make([]int, len(items))
+	for i, item := range items {
+		idx[i] = i
+		keys[i] = key(item)
+	}
+	order := func(a, b listKey) int {
+		if p.Desc {
+			return compareListKeys(b, a)
+		}
+		return compareListKeys(a, b)
+	}
+	slices.SortFunc(idx, func(a, b int) int { return order(keys[a], keys[b]) })
+
+	start := 0
+	if p.After != nil {
+		start, _ = slices.BinarySearchFunc(idx, *p.After, func(i int, after listKey) int {
+			if order(keys[i], after) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+	end := min(start+p.Limit, len(idx))
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+	if end < len(idx) {
+		data, _ := json.Marshal(listCursor{Sort: p.Sort, Desc: p.Desc, After: keys[idx[end-1]]})
+		w.Header().Set("X-Next-Cursor", base64.RawURLEncoding.EncodeToString(data))
+	}
+	page := make([]T, 0, end-start)
+	for _, i := range idx[start:end] {
+		page = append(page, items[i])
+	}
+	return page
+}
+
+// transcriptListItem is a transcript as listed by GET /api/transcripts.
+type transcriptListItem struct {
+	*storage.Transcript
+	ClaimCount int    `json:"claim_count"`
+	FactChecks int    `json:"fact_checks"`
+	SourceType string `json:"source_type"`
+}
+
+// Source types: where a conversation's transcript came from.
+const (
+	sourceYouTube = "youtube"
+	sourceWeb     = "web"
+	sourceDirect  = "direct" // recorded, uploaded or pasted
+)
+
+func transcriptSourceType(sourceURL string) string {
+	switch {
+	case sourceURL == "":
+		return sourceDirect
+	case strings.Contains(sourceURL, "youtube.com/") || strings.Contains(sourceURL, "youtu.be/"):
+		return sourceYouTube
+	}
+	return sourceWeb
+}
+
+var transcriptSorts = map[string]bool{"created_at": true, "claims": true, "title": false}
+
+// listTranscripts serves GET /api/transcripts?sort=&order=&limit=&cursor=
+// with optional speaker (name), source (youtube, web, direct) and
+// has_fact_check (true, false) filters.
+func listTranscripts(w http.ResponseWriter, r *http.Request) {
+	p, err := parseListParams(r, transcriptSorts, "created_at")
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+	query := r.URL.Query()
+	source := query.Get("source")
+	switch source {
+	case "", sourceYouTube, sourceWeb, sourceDirect:
+	default:
+		jsonError(w, "source must be youtube, web or direct", 400)
+		return
+	}
+	var hasFactCheck *bool
+	if v := query.Get("has_fact_check"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			jsonError(w, "invalid has_fact_check", 400)
+			return
+		}
+		hasFactCheck = &b
+	}
+	var speakerSlugs map[string]bool
+	if name := query.Get("speaker"); name != "" {
+		speakerSlugs = map[string]bool{}
+		convos, _ := store.GetSpeakerConversations(name)
+		for _, c := range convos {
+			speakerSlugs[c.Slug] = true
+		}
+	}
+
+	list, err := store.ListTranscripts()
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	claims, err := store.TranscriptClaimCounts()
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	factChecks, err := store.TranscriptFactCheckCounts()
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+
+	hidden := hiddenTranscripts(requestUser(r))
+	items := []transcriptListItem{}
+	for i := range list {
+		t := &list[i]
+		if hidden[t.ID] {
+			continue
+		}
+		item := transcriptListItem{Transcript: t, ClaimCount: claims[t.ID], FactChecks: factChecks[t.ID], SourceType: transcriptSourceType(t.SourceURL)}
+		if source != "" && item.SourceType != source {
+			continue
+		}
+		if hasFactCheck != nil && (item.FactChecks > 0) != *hasFactCheck {
+			continue
+		}
+		if speakerSlugs != nil && !speakerSlugs[t.Slug] {
+			continue
+		}
+		items = append(items, item)
+	}
+	page := paginate(w, items, func(t transcriptListItem) listKey {
+		switch p.Sort {
+		case "claims":
+			return listKey{N: int64(t.ClaimCount), ID: t.ID}
+		case "title":
+			return listKey{S: strings.ToLower(t.Title), ID: t.ID}
+		}
+		return listKey{N: t.CreatedAt.UnixNano(), ID: t.ID}
+	}, p)
+	json.NewEncoder(w).Encode(page)
+}
+
+var speakerSorts = map[string]bool{"name": false, "conversations": true, "claims": true}
+
+// listSpeakers serves GET /api/speakers?sort=&order=&limit=&cursor=, with q
+// matching part of a name.
+func listSpeakers(w http.ResponseWriter, r *http.Request) {
+	p, err := parseListParams(r, speakerSorts, "name")
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+	list, err := store.ListListedSpeakers(userID(requestUser(r)))
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	items := []storage.SpeakerSummary{}
+	for _, sp := range list {
+		if q == "" || strings.Contains(strings.ToLower(sp.Name), q) {
+			items = append(items, sp)
+		}
+	}
+	page := paginate(w, items, func(sp storage.SpeakerSummary) listKey {
+		switch p.Sort {
+		case "conversations":
+			return listKey{N: int64(sp.ConversationCount), ID: sp.ID}
+		case "claims":
+			return listKey{N: int64(sp.ClaimCount), ID: sp.ID}
+		}
+		return listKey{S: strings.ToLower(sp.Name), ID: sp.ID}
+	}, p)
+	json.NewEncoder(w).Encode(page)
+}
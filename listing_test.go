@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func listPage(t *testing.T, path string) ([]map[string]any, string, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != 200 {
+		t.Fatalf("%s: status %d: %s", path, w.Code, w.Body.String())
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	return items, w.Header().Get("X-Total-Count"), w.Header().Get("X-Next-Cursor")
+}
+
+func setupListing(t *testing.T) {
+	t.Helper()
+	setupTestStore(t)
+	for i, title := range []string{"Delta", "alpha", "Charlie", "bravo", "Echo"} {
+		tid, _ := store.SaveTranscript("", "")
+		store.UpdateTitle(tid, title)
+		if i%2 == 0 {
+			store.SetSourceURL(tid, "https://www.youtube.com/watch?v=abcdefghijk")
+		}
+		var stmts []Statement
+		for j := 0; j <= i; j++ {
+			stmts = append(stmts, Statement{Speaker: "speaker_1", Text: fmt.Sprintf("%s point %d", title, j), Type: "claim", MsgIndex: intp(1)})
+		}
+		if title == "Charlie" {
+			stmts[0].FactCheck = &FactCheck{Verdict: "false"}
+		}
+		speakers := map[string]string{"speaker_1": "Ada"}
+		if title == "bravo" {
+			speakers["speaker_1"] = "Ben"
+		}
+		persistStatements("", stmts, speakers, []storage.DiarizeMessage{{Speaker: "speaker_1", Text: "hi"}}, nil, tid)
+	}
+}
+
+func TestListTranscriptsCursorPagination(t *testing.T) {
+	setupListing(t)
+	var titles []any
+	path := "/api/transcripts?sort=title&limit=2"
+	for pages := 0; ; pages++ {
+		items, total, next := listPage(t, path)
+		if total != "5" {
+			t.Fatalf("total %q", total)
+		}
+		for _, item := range items {
+			titles = append(titles, item["title"])
+		}
+		if next == "" {
+			if pages != 2 {
+				t.Fatalf("want 3 pages, got %d", pages+1)
+			}
+			break
+		}
+		path = "/api/transcripts?limit=2&cursor=" + url.QueryEscape(next)
+	}
+	if fmt.Sprint(titles) != "[alpha bravo Charlie Delta Echo]" {
+		t.Fatalf("titles %v", titles)
+	}
+}
+
+func TestListTranscriptsSortAndFilter(t *testing.T) {
+	setupListing(t)
+	items, _, _ := listPage(t, "/api/transcripts?sort=claims")
+	if items[0]["title"] != "Echo" || items[0]["claim_count"] != float64(5) {
+		t.Fatalf("claims sort: %v", items[0])
+	}
+	items, total, _ := listPage(t, "/api/transcripts?source=youtube")
+	if total != "3" || items[0]["source_type"] != "youtube" {
+		t.Fatalf("source filter: %s %v", total, items)
+	}
+	if items, _, _ := listPage(t, "/api/transcripts?has_fact_check=true"); len(items) != 1 || items[0]["title"] != "Charlie" {
+		t.Fatalf("fact check filter: %v", items)
+	}
+	if items, _, _ := listPage(t, "/api/transcripts?speaker=Ben"); len(items) != 1 || items[0]["title"] != "bravo" {
+		t.Fatalf("speaker filter: %v", items)
+	}
+
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", "/api/transcripts?sort=size", nil))
+	if w.Code != 400 {
+		t.Fatalf("bad sort: status %d", w.Code)
+	}
+}
+
+func TestListSpeakersPagination(t *testing.T) {
+	setupListing(t)
+	items, total, next := listPage(t, "/api/speakers?sort=conversations&limit=1")
+	if total != "2" || next == "" || items[0]["name"] != "Ada" {
+		t.Fatalf("first page: %s %q %v", total, next, items)
+	}
+	items, _, next = listPage(t, "/api/speakers?cursor="+url.QueryEscape(next))
+	if len(items) != 1 || items[0]["name"] != "Ben" || next != "" {
+		t.Fatalf("second page: %q %v", next, items)
+	}
+	if items, total, _ := listPage(t, "/api/speakers?q=be"); total != "1" || items[0]["name"] != "Ben" {
+		t.Fatalf("name filter: %v", items)
+	}
+}
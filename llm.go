@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// LLM is a text-completion backend. Every extractor goes through the
+// package-level llm so the pipeline can run against Anthropic, a local
+// OpenAI-compatible server, or the offline fake.
+type LLM interface {
+	Complete(ctx context.Context, prompt string, opts CompletionOptions) (string, error)
+}
+
+type CompletionOptions struct {
+	MaxTokens int
+}
+
+// modelDescriber is implemented by LLMs that can name their provider and
+// model for prompt provenance.
+type modelDescriber interface {
+	describeModel() (provider, model string)
+}
+
+func describeLLM() (provider, model string) {
+	if d, ok := llm.(modelDescriber); ok {
+		return d.describeModel()
+	}
+	return fmt.Sprintf("%T", llm), ""
+}
+
+var llm LLM
+
+// httpClient sends every provider API request. Tests swap it to record and
+// replay fixtures.
+var httpClient = http.DefaultClient
+
+const defaultAnthropicModel = "claude-sonnet-4-20250514"
+
+// newLLMFromEnv selects a provider from LLM_PROVIDER:
+//   - "anthropic" (default): ANTHROPIC_API_KEY, optional LLM_MODEL
+//   - "openai": any OpenAI-compatible /chat/completions server (OpenAI,
+//     llama.cpp, Ollama). LLM_BASE_URL, LLM_MODEL, LLM_API_KEY
+//     (falls back to OPENAI_API_KEY; local servers usually need none)
+//   - "fake": deterministic offline responses
+func newLLMFromEnv() (LLM, error) {
+	provider := strings.ToLower(getEnv("LLM_PROVIDER", "anthropic"))
+	switch provider {
+	case "anthropic":
+		if anthropicKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY required for LLM_PROVIDER=anthropic")
+		}
+		return &anthropicLLM{
+			apiKey:  anthropicKey,
+			model:   getEnv("LLM_MODEL", defaultAnthropicModel),
+			baseURL: getEnv("LLM_BASE_URL", "https://api.anthropic.com"),
+		}, nil
+	case "openai":
+		return &openAILLM{
+			apiKey:  getEnv("LLM_API_KEY", os.Getenv("OPENAI_API_KEY")),
+			model:   getEnv("LLM_MODEL", "gpt-4o-mini"),
+			baseURL: strings.TrimSuffix(getEnv("LLM_BASE_URL", "https://api.openai.com/v1"), "/"),
+		}, nil
+	case "fake":
+		return newFakeLLM(), nil
+	}
+	return nil, fmt.Errorf("unknown LLM_PROVIDER %q (want anthropic, openai or fake)", provider)
+}
+
+// stripCodeFences removes the ```json fences models add despite being told not to.
+func stripCodeFences(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+	return strings.TrimSpace(text)
+}
+
+// --- Anthropic ---
+
+type anthropicLLM struct {
+	apiKey  string
+	model   string
+	baseURL string
+}
+
+func (a *anthropicLLM) describeModel() (string, string) { return "anthropic", a.model }
+
+func (a *anthropicLLM) Complete(ctx context.Context, prompt string, opts CompletionOptions) (string, error) {
+	reqBody, _ := json.Marshal(map[string]any{
+		"model":      a.model,
+		"max_tokens": opts.MaxTokens,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/v1/messages", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("claude API %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	if len(result.Content) == 0 {
+		return "", fmt.Errorf("empty response from Claude")
+	}
+	return result.Content[0].Text, nil
+}
+
+// --- OpenAI-compatible ---
+
+type openAILLM struct {
+	apiKey  string
+	model   string
+	baseURL string
+}
+
+func (o *openAILLM) describeModel() (string, string) { return "openai", o.model }
+
+func (o *openAILLM) Complete(ctx context.Context, prompt string, opts CompletionOptions) (string, error) {
+	reqBody, _ := json.Marshal(map[string]any{
+		"model":      o.model,
+		"max_tokens": opts.MaxTokens,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("llm API %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("empty response from LLM")
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// --- Fake ---
+
+// fakeLLM answers the pipeline's prompts deterministically from the
+// transcript embedded in them: diarization splits "Name: text" lines,
+// analysis makes the first message a claim with every later message nested
+// under it. Set Respond to script specific replies.
+type fakeLLM struct {
+	Respond func(prompt string) (string, error)
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func newFakeLLM() *fakeLLM {
+	return &fakeLLM{}
+}
+
+// Prompts returns every prompt the fake has received, in order.
+func (f *fakeLLM) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prompts...)
+}
+
+func (f *fakeLLM) describeModel() (string, string) { return "fake", "" }
+
+func (f *fakeLLM) Complete(ctx context.Context, prompt string, opts CompletionOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	f.prompts = append(f.prompts, prompt)
+	f.mu.Unlock()
+
+	if f.Respond != nil {
+		return f.Respond(prompt)
+	}
+	switch {
+	case strings.HasPrefix(prompt, "You are a conversation diarization system"):
+		return fakeDiarize(sectionAfter(prompt, "Transcript:\n")), nil
+	case strings.HasPrefix(prompt, "Analyze this conversation transcript"):
+		return fakeAnalyze(sectionAfter(prompt, "Transcript:\n")), nil
+	case strings.HasPrefix(prompt, "You are analyzing a LIVE conversation"):
+		return fakeIncremental(sectionBetween(prompt, "NEW PORTION to analyze", "Return a JSON object")), nil
+	case strings.HasPrefix(prompt, "Generate a realistic"):
+		return fakeConversation(), nil
+	case strings.HasPrefix(prompt, sameClaimPrompt):
+		return fakeSameClaim(sectionAfter(prompt, "A: ")), nil
+	}
+	return "", fmt.Errorf("fake LLM: unrecognized prompt")
+}
+
+// fakeSameClaim says "yes" when the two texts share at least half their
+// content words.
+func fakeSameClaim(pair string) string {
+	a, b, _ := strings.Cut(pair, "\nB: ")
+	if tokenJaccard(claimTokens(normalizeClaimText(a)), claimTokens(normalizeClaimText(b))) >= 0.5 {
+		return "yes"
+	}
+	return "no"
+}
+
+func sectionAfter(s, marker string) string {
+	if i := strings.Index(s, marker); i != -1 {
+		return s[i+len(marker):]
+	}
+	return ""
+}
+
+func sectionBetween(s, start, end string) string {
+	s = sectionAfter(s, start)
+	if i := strings.Index(s, "\n"); i != -1 {
+		s = s[i+1:] // skip the rest of the marker line
+	}
+	if i := strings.Index(s, end); i != -1 {
+		s = s[:i]
+	}
+	return s
+}
+
+// fakeLinePattern matches "[N] (speaker_id) Name: text" with every part but
+// the text optional.
+var fakeLinePattern = regexp.MustCompile(`^(?:\[(\d+)\]\s*)?(?:\((speaker_\d+)\)\s*)?(?:([^:\[\]()]{1,40}):\s+)?(.*)$`)
+
+type fakeLine struct {
+	index     int
+	speakerID string
+	name      string
+	text      string
+}
+
+func parseFakeLines(transcript string) []fakeLine {
+	var lines []fakeLine
+	ids := map[string]string{}
+	for _, raw := range strings.Split(transcript, "\n") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		m := fakeLinePattern.FindStringSubmatch(raw)
+		l := fakeLine{index: len(lines) + 1, speakerID: m[2], name: strings.TrimSpace(m[3]), text: strings.TrimSpace(m[4])}
+		if m[1] != "" {
+			fmt.Sscanf(m[1], "%d", &l.index)
+		}
+		if l.speakerID == "" {
+			if id, ok := ids[l.name]; ok {
+				l.speakerID = id
+			} else {
+				l.speakerID = fmt.Sprintf("speaker_%d", len(ids)+1)
+				ids[l.name] = l.speakerID
+			}
+		}
+		if l.name == "" {
+			l.name = l.speakerID
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func fakeDiarize(transcript string) string {
+	result := DiarizeResult{Speakers: map[string]string{}}
+	for _, l := range parseFakeLines(transcript) {
+		name := l.name
+		if name == l.speakerID {
+			name = ""
+		}
+		result.Speakers[l.speakerID] = name
+		result.Messages = append(result.Messages, storage.DiarizeMessage{Speaker: l.speakerID, Text: l.text})
+	}
+	out, _ := json.Marshal(result)
+	return string(out)
+}
+
+func fakeStatement(l fakeLine, typ string) Statement {
+	idx := l.index
+	return Statement{Speaker: l.name, SpeakerID: l.speakerID, Text: l.text, Type: typ, MsgIndex: &idx, Children: []Statement{}}
+}
+
+func fakeAnalyze(transcript string) string {
+	lines := parseFakeLines(transcript)
+	result := AnalysisResult{Title: fmt.Sprintf("Conversation in %d messages", len(lines))}
+	if len(lines) > 0 {
+		root := fakeStatement(lines[0], "claim")
+		for _, l := range lines[1:] {
+			root.Children = append(root.Children, fakeStatement(l, "response"))
+		}
+		result.Statements = []Statement{root}
+	}
+	out, _ := json.Marshal(result)
+	return string(out)
+}
+
+func fakeIncremental(newText string) string {
+	result := IncrementalResult{Statements: []Statement{}}
+	for _, l := range parseFakeLines(newText) {
+		result.Statements = append(result.Statements, fakeStatement(l, "response"))
+	}
+	out, _ := json.Marshal(result)
+	return string(out)
+}
+
+func fakeConversation() string {
+	return `{"speakers":{"speaker_1":"Ada","speaker_2":"Ben"},"messages":[` +
+		`{"speaker":"speaker_1","text":"I think this is mostly a good idea."},` +
+		`{"speaker":"speaker_2","text":"I disagree, the evidence points the other way."},` +
+		`{"speaker":"speaker_1","text":"Which evidence? The studies I have seen are mixed at worst."},` +
+		`{"speaker":"speaker_2","text":"Fair, mixed is closer to the truth than I admitted."}]}`
+}
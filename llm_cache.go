@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// cachedLLM answers repeated prompts from the llm_cache table so
+// re-analyzing a transcript, or generating a sample about a title seen
+// before, doesn't pay for the same call twice. Entries are keyed by a hash
+// of provider, model, max tokens and prompt. A reply is only cached once
+// its caller accepts it (see acceptLLMReply), so a malformed reply is asked
+// for again rather than replayed. It is a no-op until the store is open.
+type cachedLLM struct {
+	next     LLM
+	ttl      time.Duration
+	maxBytes int64
+
+	hits, misses, bypassed atomic.Int64
+}
+
+// newCachedLLMFromEnv wraps next per LLM_CACHE_TTL_HOURS (default a week;
+// 0 disables the cache) and LLM_CACHE_MAX_MB (default 256).
+func newCachedLLMFromEnv(next LLM) LLM {
+	ttl := time.Duration(getEnvFloat("LLM_CACHE_TTL_HOURS", 168) * float64(time.Hour))
+	if ttl <= 0 {
+		return next
+	}
+	return &cachedLLM{next: next, ttl: ttl, maxBytes: int64(getEnvInt("LLM_CACHE_MAX_MB", 256)) << 20}
+}
+
+type noLLMCacheKey struct{}
+
+// withoutLLMCache makes LLM calls under ctx skip the cache, both reading
+// and writing it.
+func withoutLLMCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noLLMCacheKey{}, true)
+}
+
+func llmCacheBypassed(ctx context.Context) bool {
+	v, _ := ctx.Value(noLLMCacheKey{}).(bool)
+	return v
+}
+
+type llmCacheHitKey struct{}
+
+// trackLLMCacheHit returns a context for one LLM call that remembers whether
+// the reply came from the cache, so acceptLLMReply doesn't store it again.
+func trackLLMCacheHit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, llmCacheHitKey{}, new(bool))
+}
+
+func llmCacheHit(ctx context.Context) bool {
+	hit, _ := ctx.Value(llmCacheHitKey{}).(*bool)
+	return hit != nil && *hit
+}
+
+func (c *cachedLLM) describeModel() (string, string) {
+	if d, ok := c.next.(modelDescriber); ok {
+		return d.describeModel()
+	}
+	return fmt.Sprintf("%T", c.next), ""
+}
+
+func (c *cachedLLM) key(provider, model, prompt string, opts CompletionOptions) string {
+	h := sha256.New()
+	for _, part := range []string{provider, model, fmt.Sprint(opts.MaxTokens), prompt} {
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *cachedLLM) Complete(ctx context.Context, prompt string, opts CompletionOptions) (string, error) {
+	if store == nil {
+		return c.next.Complete(ctx, prompt, opts)
+	}
+	if llmCacheBypassed(ctx) {
+		c.bypassed.Add(1)
+		return c.next.Complete(ctx, prompt, opts)
+	}
+	provider, model := c.describeModel()
+	key := c.key(provider, model, prompt, opts)
+	notBefore := time.Now().Add(-c.ttl)
+	if text, ok, err := store.GetLLMCache(key, notBefore); err != nil {
+		log.Printf("llm cache: get: %v", err)
+	} else if ok {
+		c.hits.Add(1)
+		if hit, _ := ctx.Value(llmCacheHitKey{}).(*bool); hit != nil {
+			*hit = true
+		}
+		return text, nil
+	}
+	c.misses.Add(1)
+	return c.next.Complete(ctx, prompt, opts)
+}
+
+// accept caches text as the reply to prompt.
+func (c *cachedLLM) accept(ctx context.Context, prompt string, opts CompletionOptions, text string) {
+	if store == nil || llmCacheBypassed(ctx) {
+		return
+	}
+	notBefore := time.Now().Add(-c.ttl)
+	provider, model := c.describeModel()
+	key := c.key(provider, model, prompt, opts)
+	if err := store.PutLLMCache(storage.LLMCacheEntry{Key: key, Provider: provider, Model: model, Response: text}); err != nil {
+		log.Printf("llm cache: put: %v", err)
+	} else if err := store.PruneLLMCache(notBefore, c.maxBytes); err != nil {
+		log.Printf("llm cache: prune: %v", err)
+	}
+}
+
+// acceptLLMReply marks text, returned by llm for prompt and opts, as usable
+// so later identical calls can be answered from the cache. Callers make it
+// after validating the reply, with the ctx from trackLLMCacheHit they made
+// the call with; replies that came from the cache are left as they are.
+func acceptLLMReply(ctx context.Context, prompt string, opts CompletionOptions, text string) {
+	if llmCacheHit(ctx) {
+		return
+	}
+	if c, ok := llm.(*cachedLLM); ok {
+		c.accept(ctx, prompt, opts, text)
+	}
+}
+
+// GET /api/llm-cache reports hit/miss counts since startup and the cache's
+// size.
+func handleAPILLMCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := llm.(*cachedLLM)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"enabled": false})
+		return
+	}
+	entries, bytes, err := store.LLMCacheSize()
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"enabled":     true,
+		"hits":        c.hits.Load(),
+		"misses":      c.misses.Load(),
+		"bypassed":    c.bypassed.Load(),
+		"entries":     entries,
+		"bytes":       bytes,
+		"max_bytes":   c.maxBytes,
+		"ttl_seconds": int64(c.ttl.Seconds()),
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func TestCachedLLM(t *testing.T) {
+	setupTestStore(t)
+	fake := newFakeLLM()
+	fail := true
+	fake.Respond = func(prompt string) (string, error) {
+		if fail {
+			return "", fmt.Errorf("upstream overloaded")
+		}
+		return "reply to " + prompt, nil
+	}
+	c := &cachedLLM{next: fake, ttl: time.Hour}
+	ctx := context.Background()
+
+	if _, err := c.Complete(ctx, "a", CompletionOptions{MaxTokens: 10}); err == nil {
+		t.Fatal("expected the upstream error")
+	}
+	fail = false
+	complete := func(ctx context.Context, opts CompletionOptions) string {
+		text, err := c.Complete(ctx, "a", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.accept(ctx, "a", opts, text)
+		return text
+	}
+	// Replies aren't cached until accepted
+	c.Complete(ctx, "a", CompletionOptions{MaxTokens: 10})
+	for i := 0; i < 2; i++ {
+		if text := complete(ctx, CompletionOptions{MaxTokens: 10}); text != "reply to a" {
+			t.Fatalf("call %d: %q", i, text)
+		}
+	}
+	// Different parameters are a different entry
+	complete(ctx, CompletionOptions{MaxTokens: 20})
+	complete(withoutLLMCache(ctx), CompletionOptions{MaxTokens: 10})
+
+	if got := len(fake.Prompts()); got != 5 {
+		t.Errorf("upstream calls = %d, want 5 (error, unaccepted, miss, miss, bypass)", got)
+	}
+	if h, m, b := c.hits.Load(), c.misses.Load(), c.bypassed.Load(); h != 1 || m != 4 || b != 1 {
+		t.Errorf("hits/misses/bypassed = %d/%d/%d, want 1/4/1", h, m, b)
+	}
+	if entries, _, _ := store.LLMCacheSize(); entries != 2 {
+		t.Errorf("entries = %d, want 2", entries)
+	}
+
+	c.ttl = time.Nanosecond
+	complete(ctx, CompletionOptions{MaxTokens: 10})
+	if got := len(fake.Prompts()); got != 6 {
+		t.Errorf("an expired entry should be refetched, upstream calls = %d", got)
+	}
+	if entries, _, _ := store.LLMCacheSize(); entries != 1 {
+		t.Errorf("expired entries should be pruned, %d left", entries)
+	}
+}
+
+func TestCompleteJSONCachesAcceptedReplies(t *testing.T) {
+	setupTestStore(t)
+	fake := newFakeLLM()
+	reply := "not json"
+	fake.Respond = func(string) (string, error) { return reply, nil }
+	prevLLM, prevAttempts := llm, llmRepairAttempts
+	llm, llmRepairAttempts = &cachedLLM{next: fake, ttl: time.Hour}, 0
+	t.Cleanup(func() { llm, llmRepairAttempts = prevLLM, prevAttempts })
+
+	decode := func(text string) ([]string, error) {
+		var v struct {
+			OK bool `json:"ok"`
+		}
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, err
+		}
+		if !v.OK {
+			return []string{"not ok"}, nil
+		}
+		return nil, nil
+	}
+	ctx := context.Background()
+	for _, r := range []string{"not json", `{"ok":false}`, `{"ok":true}`} {
+		reply = r
+		completeJSON(ctx, "p", CompletionOptions{}, decode)
+	}
+	if entries, _, _ := store.LLMCacheSize(); entries != 1 {
+		t.Fatalf("entries = %d, want only the accepted reply", entries)
+	}
+	c := llm.(*cachedLLM)
+	provider, model := c.describeModel()
+	key := c.key(provider, model, "p", CompletionOptions{})
+	before, err := store.GetLLMCacheEntry(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	reply = "changed"
+	if _, err := completeJSON(ctx, "p", CompletionOptions{}, decode); err != nil {
+		t.Fatalf("accepted reply should be replayed from the cache: %v", err)
+	}
+	if got := len(fake.Prompts()); got != 3 {
+		t.Errorf("upstream calls = %d, want 3", got)
+	}
+	// A hit counts, but isn't stored again as a new reply
+	after, _ := store.GetLLMCacheEntry(key)
+	if after.Hits != 1 || !after.CreatedAt.Equal(before.CreatedAt) || after.Response != `{"ok":true}` {
+		t.Errorf("entry after hit = %+v, was %+v", after, before)
+	}
+}
+
+func TestPruneLLMCache(t *testing.T) {
+	setupTestStore(t)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.PutLLMCache(storage.LLMCacheEntry{Key: key, Response: "0123456789"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := store.GetLLMCache("a", time.Now().Add(-time.Hour)); !ok {
+		t.Fatal("a should be cached")
+	}
+
+	if err := store.PruneLLMCache(time.Now().Add(-time.Hour), 20); err != nil {
+		t.Fatal(err)
+	}
+	entries, size, _ := store.LLMCacheSize()
+	if entries != 2 || size != 20 {
+		t.Fatalf("after prune: %d entries, %d bytes", entries, size)
+	}
+	if _, ok, _ := store.GetLLMCache("b", time.Now().Add(-time.Hour)); ok {
+		t.Error("b was least recently used and should be evicted")
+	}
+}
+
+func TestLLMCacheAPI(t *testing.T) {
+	setupTestStore(t)
+	fake := newFakeLLM()
+	c := &cachedLLM{next: fake, ttl: time.Hour, maxBytes: 1 << 20}
+	prevLLM := llm
+	llm = c
+	t.Cleanup(func() { llm = prevLLM })
+	mux := setupMux()
+
+	if provider, _ := describeLLM(); provider != "fake" {
+		t.Errorf("provider through the cache = %q", provider)
+	}
+
+	analyze := func(noCache bool) {
+		body, _ := json.Marshal(map[string]any{"transcript": "[1] (speaker_1) Ada: Go is simpler", "no_cache": noCache})
+		req := httptest.NewRequest("POST", "/api/analyze", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("analyze: %d %s", w.Code, w.Body.String())
+		}
+	}
+	analyze(false)
+	calls := len(fake.Prompts())
+	analyze(false)
+	if got := len(fake.Prompts()); got != calls {
+		t.Errorf("re-analysis made %d upstream calls, want 0", got-calls)
+	}
+	analyze(true)
+	if got := len(fake.Prompts()); got == calls {
+		t.Error("no_cache should reach the LLM")
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/llm-cache", nil))
+	var stats struct {
+		Enabled  bool  `json:"enabled"`
+		Hits     int64 `json:"hits"`
+		Misses   int64 `json:"misses"`
+		Bypassed int64 `json:"bypassed"`
+		Entries  int   `json:"entries"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if !stats.Enabled || stats.Hits == 0 || stats.Misses == 0 || stats.Bypassed == 0 || stats.Entries == 0 {
+		t.Errorf("stats = %s", w.Body.String())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripCodeFences(t *testing.T) {
+	cases := map[string]string{
+		"```json\n{\"a\":1}\n```": `{"a":1}`,
+		"```\n[1]\n```":           `[1]`,
+		"  {\"a\":1}  ":           `{"a":1}`,
+	}
+	for in, want := range cases {
+		if got := stripCodeFences(in); got != want {
+			t.Errorf("stripCodeFences(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnthropicLLM(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("unexpected request: %s key=%q", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "test-model" || body["max_tokens"] != float64(100) {
+			t.Errorf("unexpected body: %v", body)
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"hello"}]}`))
+	}))
+	defer srv.Close()
+
+	a := &anthropicLLM{apiKey: "test-key", model: "test-model", baseURL: srv.URL}
+	got, err := a.Complete(context.Background(), "hi", CompletionOptions{MaxTokens: 100})
+	if err != nil || got != "hello" {
+		t.Fatalf("Complete = %q, %v", got, err)
+	}
+}
+
+func TestOpenAILLM(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("local server should get no auth header, got %q", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hello"}}]}`))
+	}))
+	defer srv.Close()
+
+	o := &openAILLM{model: "llama", baseURL: srv.URL + "/v1"}
+	got, err := o.Complete(context.Background(), "hi", CompletionOptions{MaxTokens: 100})
+	if err != nil || got != "hello" {
+		t.Fatalf("Complete = %q, %v", got, err)
+	}
+}
+
+func TestNewLLMFromEnv(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "openai")
+	t.Setenv("LLM_BASE_URL", "http://localhost:11434/v1/")
+	l, err := newLLMFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := l.(*openAILLM); !ok || o.baseURL != "http://localhost:11434/v1" {
+		t.Fatalf("expected openai provider with trimmed base URL, got %#v", l)
+	}
+
+	t.Setenv("LLM_PROVIDER", "bogus")
+	if _, err := newLLMFromEnv(); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestFakeLLMAnalyze(t *testing.T) {
+	result, err := extractStructure(context.Background(), "[1] (speaker_1) Alice: Go is great.\n[2] (speaker_2) Bob: Rust is better.", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Statements) != 1 || len(result.Statements[0].Children) != 1 {
+		t.Fatalf("unexpected tree: %+v", result.Statements)
+	}
+	child := result.Statements[0].Children[0]
+	if child.SpeakerID != "speaker_2" || child.Speaker != "Bob" || child.MsgIndex == nil || *child.MsgIndex != 2 {
+		t.Fatalf("unexpected child: %+v", child)
+	}
+}
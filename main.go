@@ -1,19 +1,21 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/kayushkin/argraphments/storage"
@@ -29,18 +31,26 @@ var (
 func main() {
 	anthropicKey = os.Getenv("ANTHROPIC_API_KEY")
 	openaiKey = os.Getenv("OPENAI_API_KEY")
-	if anthropicKey == "" {
-		log.Fatal("ANTHROPIC_API_KEY required")
+
+	var err error
+	llm, err = newLLMFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
-	if openaiKey == "" {
-		log.Fatal("OPENAI_API_KEY required")
+	llm = newCachedLLMFromEnv(llm)
+	transcriber, err = newTranscriberFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	var err error
 	templates, err = loadTemplates()
 	if err != nil {
 		log.Fatal(err)
 	}
+	prompts, err = loadPrompts(getEnv("PROMPTS_DIR", "prompts"), os.Getenv("PROMPT_VERSIONS"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	os.MkdirAll("uploads", 0755)
 
@@ -50,6 +60,18 @@ func main() {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 	defer store.Close()
+	if err := store.Migrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	go backfillSearchIndex()
+	go backfillClaimMentions()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	queue = startJobWorkers(ctx,
+		getEnvInt("JOB_WORKERS", 2),
+		getEnvInt("JOB_MAX_ATTEMPTS", 2),
+		time.Duration(getEnvInt("JOB_TIMEOUT_SECONDS", 600))*time.Second)
 
 	mux := http.NewServeMux()
 	staticFS := http.FileServer(http.Dir("static"))
@@ -59,7 +81,7 @@ func main() {
 	for _, prefix := range []string{"/argraphments", ""} {
 		p := prefix
 		mux.HandleFunc(p+"/", handleIndex)
-		mux.HandleFunc(p+"/convo/", handleIndex) // conversation URLs
+		mux.HandleFunc(p+"/convo/", handleConvo) // conversation URLs and reports
 		mux.Handle(p+"/static/", http.StripPrefix(p+"/static/", staticFS))
 		mux.Handle(p+"/assets/", http.StripPrefix(p, distAssetsFS))
 		mux.HandleFunc(p+"/api/transcribe", handleAPITranscribe)
@@ -73,14 +95,37 @@ func main() {
 		mux.HandleFunc(p+"/api/speakers", handleAPISpeakers)
 		mux.HandleFunc(p+"/api/speakers/", handleAPISpeakers)
 		mux.HandleFunc(p+"/api/import/youtube", handleAPIImportYouTube)
+		mux.HandleFunc(p+"/api/import/transcript", handleAPIImportTranscript)
+		mux.HandleFunc(p+"/api/search", handleAPISearch)
+		mux.HandleFunc(p+"/api/auth/", handleAPIAuth)
 		mux.HandleFunc(p+"/api/graph", handleAPIGraph)
 		mux.HandleFunc(p+"/api/sample", handleAPISample)
+		mux.HandleFunc(p+"/api/jobs", handleAPIJobs)
+		mux.HandleFunc(p+"/api/jobs/", handleAPIJobs)
+		mux.HandleFunc(p+"/api/prompts", handleAPIPrompts)
+		mux.HandleFunc(p+"/api/llm-cache", handleAPILLMCache)
 	}
 
 	port := getEnv("PORT", "8086")
 	addr := "127.0.0.1:" + port
-	log.Printf("argraphments listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("argraphments listening on %s", addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGINT/SIGTERM stop taking requests, then let the job workers hand
+	// back whatever they were running before the store closes.
+	<-ctx.Done()
+	log.Printf("argraphments shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	queue.wait()
 }
 
 func loadTemplates() (*template.Template, error) {
@@ -94,6 +139,20 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return fallback
+}
+
 func handleIndex(w http.ResponseWriter, r *http.Request) {
 	// Serve React SPA, rewriting asset paths for /argraphments prefix
 	data, err := os.ReadFile("static/dist/index.html")
@@ -124,6 +183,7 @@ func handleAPINewSession(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "failed to create session", 500)
 		return
 	}
+	claimTranscript(id, userID(requestUser(r)))
 	t, err := store.GetTranscript(id)
 	if err != nil {
 		jsonError(w, "failed to get session", 500)
@@ -136,19 +196,38 @@ func handleAPINewSession(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// POST /api/transcribe — accepts audio file, returns {"text": "..."}
+// POST /api/transcribe — accepts audio file, returns {"text": "...", "segments": [...]}
 func handleAPITranscribe(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
 		return
 	}
 
+	tmpPath, status, err := saveAudioUpload(r)
+	if err != nil {
+		jsonError(w, err.Error(), status)
+		return
+	}
+	defer os.Remove(tmpPath)
+
+	result, err := runTranscribe(r.Context(), transcribeRequest{AudioPath: tmpPath}, nil)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// saveAudioUpload stores the multipart "audio" field under uploads/ and
+// returns its path, or an HTTP status and error for the client.
+func saveAudioUpload(r *http.Request) (string, int, error) {
 	r.ParseMultipartForm(50 << 20)
 
 	file, header, err := r.FormFile("audio")
 	if err != nil {
-		jsonError(w, "no audio file", 400)
-		return
+		return "", 400, fmt.Errorf("no audio file")
 	}
 	defer file.Close()
 
@@ -159,28 +238,45 @@ func handleAPITranscribe(w http.ResponseWriter, r *http.Request) {
 	tmpPath := fmt.Sprintf("uploads/%d%s", time.Now().UnixNano(), ext)
 	dst, err := os.Create(tmpPath)
 	if err != nil {
-		jsonError(w, "failed to save", 500)
-		return
+		return "", 500, fmt.Errorf("failed to save")
 	}
 	n, _ := io.Copy(dst, file)
 	dst.Close()
-	defer os.Remove(tmpPath)
 
 	if n == 0 {
-		jsonError(w, "empty audio file", 400)
-		return
+		os.Remove(tmpPath)
+		return "", 400, fmt.Errorf("empty audio file")
 	}
 
 	log.Printf("Transcribe: saved %d bytes to %s", n, tmpPath)
+	return tmpPath, 0, nil
+}
+
+type transcribeRequest struct {
+	AudioPath string `json:"audio_path"`
+}
 
-	transcript, err := whisperTranscribe(tmpPath)
+type transcribeResponse struct {
+	Text     string         `json:"text"`
+	Segments []TimedSegment `json:"segments"`
+}
+
+func runTranscribe(ctx context.Context, req transcribeRequest, progress progressFunc) (*transcribeResponse, error) {
+	progress.report("transcribing")
+	segments, err := transcriber.Transcribe(ctx, req.AudioPath)
 	if err != nil {
-		jsonError(w, fmt.Sprintf("transcription failed: %v", err), 500)
-		return
+		return nil, fmt.Errorf("transcription failed: %v", err)
+	}
+	if segments == nil {
+		segments = []TimedSegment{}
 	}
+	return &transcribeResponse{Text: segmentsText(segments), Segments: segments}, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"text": transcript})
+type diarizeRequest struct {
+	Transcript string         `json:"transcript"`
+	Segments   []TimedSegment `json:"segments,omitempty"`
+	NoCache    bool           `json:"no_cache,omitempty"` // skip the LLM response cache
 }
 
 // POST /api/diarize — accepts {"transcript": "..."}, returns diarize result
@@ -191,45 +287,73 @@ func handleAPIDiarize(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Accept both JSON body and form data
-	var transcript string
-	var segments []TimedSegment
+	var req diarizeRequest
 	ct := r.Header.Get("Content-Type")
 	if strings.Contains(ct, "application/json") {
-		var req struct {
-			Transcript string         `json:"transcript"`
-			Segments   []TimedSegment `json:"segments,omitempty"`
-		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			jsonError(w, "invalid JSON", 400)
 			return
 		}
-		transcript = req.Transcript
-		segments = req.Segments
 	} else {
 		r.ParseMultipartForm(10 << 20)
-		transcript = strings.TrimSpace(r.FormValue("transcript"))
+		req.Transcript = strings.TrimSpace(r.FormValue("transcript"))
 	}
 
-	if strings.TrimSpace(transcript) == "" {
+	if strings.TrimSpace(req.Transcript) == "" {
 		jsonError(w, "no transcript", 400)
 		return
 	}
 
-	result, err := diarizeTranscript(transcript)
+	result, err := runDiarize(r.Context(), req, nil)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(500)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		jsonError(w, err.Error(), 500)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func runDiarize(ctx context.Context, req diarizeRequest, progress progressFunc) (*DiarizeResult, error) {
+	if req.NoCache {
+		ctx = withoutLLMCache(ctx)
+	}
+	progress.report("diarizing")
+	result, err := diarizeTranscript(ctx, req.Transcript)
+	if err != nil {
+		return nil, err
+	}
+
 	// Assign timestamps from segments if available
-	if len(segments) > 0 && len(result.Messages) > 0 {
-		assignTimestamps(result.Messages, segments)
+	if len(req.Segments) > 0 && len(result.Messages) > 0 {
+		assignTimestamps(result.Messages, req.Segments)
 	}
+	return result, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+type analyzeRequest struct {
+	Transcript     string                   `json:"transcript"`
+	Slug           string                   `json:"slug,omitempty"`
+	Speakers       map[string]string        `json:"speakers,omitempty"`
+	Messages       []storage.DiarizeMessage `json:"messages,omitempty"`
+	SpeakerAutoGen map[string]bool          `json:"speaker_auto_gen,omitempty"`
+	SourceURL      string                   `json:"source_url,omitempty"`
+	NoCache        bool                     `json:"no_cache,omitempty"` // skip the LLM response cache
+	// Provenance carries the prompt runs of earlier steps (diarize, sample)
+	// so they are saved with the transcript. Runs naming a prompt version
+	// this server doesn't have are ignored.
+	Provenance []storage.PromptRun `json:"provenance,omitempty"`
+	// OwnerID is set from the requester, never taken from the client.
+	OwnerID int64 `json:"owner_id,omitempty"`
+}
+
+type analyzeResponse struct {
+	Statements   []Statement         `json:"statements"`
+	TranscriptID int64               `json:"transcript_id"`
+	Slug         string              `json:"slug"`
+	Title        string              `json:"title"`
+	Validation   *ValidationReport   `json:"validation,omitempty"`
+	Provenance   []storage.PromptRun `json:"provenance,omitempty"`
 }
 
 // POST /api/analyze — full analysis, returns {"statements": [...], "transcript_id": N}
@@ -239,14 +363,7 @@ func handleAPIAnalyze(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Transcript     string                    `json:"transcript"`
-		Slug           string                    `json:"slug,omitempty"`
-		Speakers       map[string]string         `json:"speakers,omitempty"`
-		Messages       []storage.DiarizeMessage  `json:"messages,omitempty"`
-		SpeakerAutoGen map[string]bool           `json:"speaker_auto_gen,omitempty"`
-		SourceURL      string                    `json:"source_url,omitempty"`
-	}
+	var req analyzeRequest
 
 	ct := r.Header.Get("Content-Type")
 	if strings.Contains(ct, "application/json") {
@@ -270,29 +387,63 @@ func handleAPIAnalyze(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "no transcript", 400)
 		return
 	}
+	if err := authorizeAnalyze(requestUser(r), &req); err != nil {
+		jsonError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
-	analysis, err := extractStructure(req.Transcript)
+	result, err := runAnalyze(r.Context(), req, nil)
 	if err != nil {
-		jsonError(w, fmt.Sprintf("analysis failed: %v", err), 500)
+		jsonError(w, err.Error(), 500)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func runAnalyze(ctx context.Context, req analyzeRequest, progress progressFunc) (*analyzeResponse, error) {
+	if req.NoCache {
+		ctx = withoutLLMCache(ctx)
+	}
+	analysis, err := analyzeTranscript(ctx, req.Transcript, req.Speakers, progress)
+	if err != nil {
+		return nil, fmt.Errorf("analysis failed: %v", err)
+	}
 
+	progress.report("saving")
+	canonicalizeStatements(analysis.Statements)
 	var existingID int64
 	if req.Slug != "" {
 		if t, err := store.GetTranscriptBySlug(req.Slug); err == nil {
 			existingID = t.ID
 		}
 	}
+	if existingID > 0 {
+		unlock := lockTranscript(existingID)
+		defer unlock()
+		snapshotLiveTree(existingID)
+	}
 	tid := persistStatements("", analysis.Statements, req.Speakers, req.Messages, req.SpeakerAutoGen, existingID)
+	if existingID == 0 {
+		claimTranscript(tid, req.OwnerID)
+	}
+	savePromptRuns(tid, mergePromptRuns(knownPromptRuns(req.Provenance), analysis.Provenance...))
+	if tid > 0 {
+		recordAnalysisRun(tid, analysis.Statements, analysis.Provenance)
+	}
 
 	// Update title if Claude generated one
 	if analysis.Title != "" && tid > 0 {
 		store.UpdateTitle(tid, analysis.Title)
+		indexTranscriptSearch(tid)
 	}
 	// Save source URL if provided
 	if req.SourceURL != "" && tid > 0 {
 		store.SetSourceURL(tid, req.SourceURL)
 	}
+	if tid > 0 {
+		publishTranscriptMeta(tid)
+	}
 
 	// Get slug for response
 	slug := req.Slug
@@ -301,13 +452,14 @@ func handleAPIAnalyze(w http.ResponseWriter, r *http.Request) {
 			slug = t.Slug
 		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"statements":    analysis.Statements,
-		"transcript_id": tid,
-		"slug":          slug,
-		"title":         analysis.Title,
-	})
+	return &analyzeResponse{
+		Statements:   analysis.Statements,
+		TranscriptID: tid,
+		Slug:         slug,
+		Title:        analysis.Title,
+		Validation:   analysis.Validation,
+		Provenance:   analysis.Provenance,
+	}, nil
 }
 
 // POST /api/analyze-incremental — incremental analysis
@@ -323,6 +475,8 @@ func handleAPIAnalyzeIncremental(w http.ResponseWriter, r *http.Request) {
 		Existing    []Statement `json:"existing"`
 		MsgOffset   int         `json:"msg_offset"`
 		FullReview  bool        `json:"full_review"`
+		Slug        string      `json:"slug"`
+		NoCache     bool        `json:"no_cache"`
 	}
 
 	ct := r.Header.Get("Content-Type")
@@ -343,13 +497,36 @@ func handleAPIAnalyzeIncremental(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "no new_text", 400)
 		return
 	}
+	var sessionID int64
+	var speakers map[string]string
+	if req.Slug != "" && store != nil {
+		if t, err := store.GetTranscriptBySlug(req.Slug); err == nil {
+			if !canEdit(requestUser(r), transcriptAccess(t.ID)) {
+				jsonError(w, "not allowed to edit this conversation", http.StatusForbidden)
+				return
+			}
+			sessionID = t.ID
+			// Validate speaker ids against the session's speakers
+			speakers, _, _ = store.GetDiarization(sessionID)
+		}
+	}
 
-	result, err := extractIncremental(req.NewText, req.ContextText, req.Existing, req.MsgOffset, req.FullReview)
+	ctx := r.Context()
+	if req.NoCache {
+		ctx = withoutLLMCache(ctx)
+	}
+	result, err := extractIncremental(ctx, req.NewText, req.ContextText, req.Existing, req.MsgOffset, req.FullReview, speakers)
 	if err != nil {
 		jsonError(w, err.Error(), 500)
 		return
 	}
 
+	// Fold the result into the stored session so a lost tab loses nothing
+	if sessionID > 0 {
+		persistIncremental(sessionID, result)
+		savePromptRuns(sessionID, result.Provenance)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
@@ -385,6 +562,22 @@ func handleAPITranscripts(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error":"not found"}`, 404)
 			return
 		}
+		u := requestUser(r)
+		access := transcriptAccess(t.ID)
+		// Numeric IDs can be counted up, so they only reach conversations
+		// the user could list anyway; unlisted ones need their slug.
+		if !canView(u, access) || (parseErr == nil && !isListed(u, access)) {
+			http.Error(w, `{"error":"not found"}`, 404)
+			return
+		}
+		if subResource == "access" {
+			handleTranscriptAccess(w, r, u, access)
+			return
+		}
+		if (r.Method != http.MethodGet || subResource == "ingest") && !canEdit(u, access) {
+			jsonError(w, "not allowed to edit this conversation", http.StatusForbidden)
+			return
+		}
 
 		// Handle PUT /api/transcripts/{slug}/speakers
 		if subResource == "speakers" && r.Method == http.MethodPut {
@@ -396,72 +589,92 @@ func handleAPITranscripts(w http.ResponseWriter, r *http.Request) {
 				jsonError(w, "invalid request", 400)
 				return
 			}
+			req.Speakers = resolveSpeakerAliases(req.Speakers)
 			// Update speakers in utterances
 			_, messages, _ := store.GetDiarization(t.ID)
 			if messages == nil {
 				messages = []storage.DiarizeMessage{}
 			}
 			store.SaveDiarization(t.ID, req.Speakers, messages)
+			indexUtterancesSearch(t.ID, req.Speakers, messages)
 			if req.SpeakerAutoGen != nil {
 				store.SaveSpeakersWithFlags(t.ID, req.Speakers, req.SpeakerAutoGen)
 			}
+			publishSpeakers(t.ID, req.Speakers)
 			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 			return
 		}
 
-		// Get diarization data
-		speakers, messages, _ := store.GetDiarization(t.ID)
-
-		// Build speaker_info with auto_generated flags
-		speakerInfo := map[string]any{}
-		tsSpeakers, _ := store.GetTranscriptSpeakers(t.ID)
-		for localID, name := range speakers {
-			info := map[string]any{"name": name}
-			if sp, ok := tsSpeakers[localID]; ok {
-				info["auto_generated"] = sp.AutoGenerated
-				info["id"] = sp.ID
-			}
-			speakerInfo[localID] = info
+		if subResource == "events" && r.Method == http.MethodGet {
+			streamTranscript(w, r, t)
+			return
+		}
+		if subResource == "ingest" {
+			handleIngest(w, r, t)
+			return
+		}
+		if subResource == "export" {
+			handleExport(w, r, t)
+			return
+		}
+		if subResource == "analytics" {
+			handleAnalytics(w, r, t)
+			return
+		}
+		if rest, ok := strings.CutPrefix(subResource, "revisions"); ok && (rest == "" || rest[0] == '/') {
+			handleRevisions(w, r, t, strings.TrimPrefix(rest, "/"))
+			return
+		}
+		if rest, ok := strings.CutPrefix(subResource, "analyses"); ok && (rest == "" || rest[0] == '/') {
+			handleAnalyses(w, r, t, strings.TrimPrefix(rest, "/"))
+			return
 		}
 
-		// Get claim tree and convert to Statement format
-		tree, _ := store.GetClaimTree(t.ID)
-		statements := claimTreeToStatements(tree)
-
-		json.NewEncoder(w).Encode(map[string]any{
-			"transcript":   t,
-			"speakers":     speakers,
-			"speaker_info": speakerInfo,
-			"messages":     messages,
-			"statements":   statements,
-		})
+		detail := transcriptDetail(t)
+		detail["access"] = accessInfo(u, access)
+		json.NewEncoder(w).Encode(detail)
 		return
 	}
 
-	list, err := store.ListTranscripts()
-	if err != nil {
-		http.Error(w, `{"error":"db error"}`, 500)
-		return
-	}
-	json.NewEncoder(w).Encode(list)
+	listTranscripts(w, r)
 }
 
-func handleAPIClaim(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	path := r.URL.Path
-	path = strings.TrimPrefix(path, "/argraphments")
-	path = strings.TrimPrefix(path, "/api/claims/")
-	id, err := strconv.ParseInt(path, 10, 64)
-	if err != nil {
-		http.Error(w, `{"error":"invalid id"}`, 400)
-		return
+// transcriptDetail is the full GET /api/transcripts/{slug} body.
+func transcriptDetail(t *storage.Transcript) map[string]any {
+	// Get diarization data
+	speakers, messages, _ := store.GetDiarization(t.ID)
+
+	// Build speaker_info with auto_generated flags
+	speakerInfo := map[string]any{}
+	tsSpeakers, _ := store.GetTranscriptSpeakers(t.ID)
+	for localID, name := range speakers {
+		info := map[string]any{"name": name}
+		if sp, ok := tsSpeakers[localID]; ok {
+			info["auto_generated"] = sp.AutoGenerated
+			info["id"] = sp.ID
+		}
+		speakerInfo[localID] = info
 	}
-	g, err := store.GetClaimGraph(id)
-	if err != nil {
-		http.Error(w, `{"error":"not found"}`, 404)
-		return
+
+	return map[string]any{
+		"transcript":   t,
+		"speakers":     speakers,
+		"speaker_info": speakerInfo,
+		"messages":     messages,
+		"statements":   transcriptStatements(t.ID),
+		"provenance":   transcriptPromptRuns(t.ID),
+	}
+}
+
+// transcriptStatements loads the claim tree with its annotations.
+func transcriptStatements(tid int64) []Statement {
+	// Get claim tree and convert to Statement format
+	tree, _ := store.GetClaimTree(tid)
+	statements := claimTreeToStatements(tree)
+	if annotations, err := store.GetAnnotations(tid); err == nil {
+		attachAnnotations(statements, annotations)
 	}
-	json.NewEncoder(w).Encode(g)
+	return statements
 }
 
 func handleAPISpeakers(w http.ResponseWriter, r *http.Request) {
@@ -473,8 +686,23 @@ func handleAPISpeakers(w http.ResponseWriter, r *http.Request) {
 	path = strings.TrimPrefix(path, "/")
 
 	if path != "" {
+		path, sub := splitSpeakerPath(path)
 		name, _ := url.PathUnescape(path)
 
+		if sub != "" {
+			sp, err := store.GetSpeakerByName(name)
+			if err != nil {
+				jsonError(w, "speaker not found", 404)
+				return
+			}
+			if sub == "profile" {
+				handleSpeakerProfile(w, r, sp)
+				return
+			}
+			handleSpeakerIdentity(w, r, sp, sub)
+			return
+		}
+
 		// PUT = rename speaker
 		if r.Method == http.MethodPut {
 			var req struct {
@@ -489,39 +717,33 @@ func handleAPISpeakers(w http.ResponseWriter, r *http.Request) {
 				jsonError(w, "speaker not found", 404)
 				return
 			}
+			if !canEditSpeaker(requestUser(r), name) {
+				jsonError(w, "not allowed to rename a speaker in conversations you don't own", http.StatusForbidden)
+				return
+			}
 			if err := store.RenameSpeaker(sp.ID, req.Name); err != nil {
 				jsonError(w, "rename failed: "+err.Error(), 500)
 				return
 			}
+			reindexSpeakerConversations(req.Name)
 			json.NewEncoder(w).Encode(map[string]string{"name": req.Name})
 			return
 		}
 
 		// GET = conversations for speaker
-		convos, err := store.GetSpeakerConversations(name)
-		if err != nil || convos == nil {
+		sp, err := store.GetSpeakerByName(name)
+		if err != nil {
 			json.NewEncoder(w).Encode(map[string]any{
 				"name":          name,
 				"conversations": []any{},
 			})
 			return
 		}
-		json.NewEncoder(w).Encode(map[string]any{
-			"name":          name,
-			"conversations": convos,
-		})
+		json.NewEncoder(w).Encode(speakerDetail(sp, requestUser(r)))
 		return
 	}
 
-	speakers, err := store.ListSpeakers()
-	if err != nil {
-		jsonError(w, "db error", 500)
-		return
-	}
-	if speakers == nil {
-		speakers = []storage.SpeakerSummary{}
-	}
-	json.NewEncoder(w).Encode(speakers)
+	listSpeakers(w, r)
 }
 
 func handleAPIGraph(w http.ResponseWriter, r *http.Request) {
@@ -531,7 +753,7 @@ func handleAPIGraph(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"db error"}`, 500)
 		return
 	}
-	json.NewEncoder(w).Encode(g)
+	json.NewEncoder(w).Encode(filterGraph(g, hiddenClaims(hiddenTranscripts(requestUser(r)))))
 }
 
 // --- Helpers ---
@@ -556,66 +778,64 @@ func claimTreeToStatements(nodes []storage.ClaimTreeNode) []Statement {
 			Type:      n.Type,
 			MsgIndex:  n.MsgIndex,
 			Children:  claimTreeToStatements(n.Children),
+			claimID:   n.ClaimID,
 		}
 		result = append(result, s)
 	}
 	return result
 }
 
-// --- Whisper API ---
-
-func whisperTranscribe(filePath string) (string, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return "", err
+func annotationKey(msgIndex *int, text string) string {
+	if msgIndex == nil {
+		return "-|" + text
 	}
-	defer f.Close()
-
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
-	if err != nil {
-		return "", err
-	}
-	io.Copy(part, f)
-
-	writer.WriteField("model", "whisper-1")
-	writer.WriteField("response_format", "text")
-	writer.Close()
-
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/audio/transcriptions", &buf)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Authorization", "Bearer "+openaiKey)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return strconv.Itoa(*msgIndex) + "|" + text
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
+// attachAnnotations restores persisted fact checks and fallacies onto the
+// statements rebuilt from the claim tree, matching on msg_index and text.
+func attachAnnotations(statements []Statement, annotations []storage.Annotation) {
+	if len(annotations) == 0 {
+		return
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("whisper API %d: %s", resp.StatusCode, string(body))
+	byKey := make(map[string]storage.Annotation, len(annotations))
+	for _, a := range annotations {
+		byKey[annotationKey(a.MsgIndex, a.Text)] = a
+	}
+	var walk func(stmts []Statement)
+	walk = func(stmts []Statement) {
+		for i := range stmts {
+			if a, ok := byKey[annotationKey(stmts[i].MsgIndex, stmts[i].Text)]; ok {
+				if a.FactCheck != nil {
+					fc := FactCheck(*a.FactCheck)
+					stmts[i].FactCheck = &fc
+				}
+				if a.Fallacy != nil {
+					f := Fallacy(*a.Fallacy)
+					stmts[i].Fallacy = &f
+				}
+			}
+			walk(stmts[i].Children)
+		}
 	}
-
-	return strings.TrimSpace(string(body)), nil
+	walk(statements)
 }
 
 // --- Claude API for structure extraction ---
 
 type Statement struct {
-	Speaker   string      `json:"speaker"`
-	SpeakerID string      `json:"speaker_id,omitempty"`
-	Text      string      `json:"text"`
-	Type      string      `json:"type"`
-	MsgIndex  *int        `json:"msg_index,omitempty"`
-	Children  []Statement `json:"children"`
-	FactCheck *FactCheck  `json:"fact_check,omitempty"`
-	Fallacy   *Fallacy    `json:"fallacy,omitempty"`
+	Speaker    string      `json:"speaker"`
+	SpeakerID  string      `json:"speaker_id,omitempty"`
+	Text       string      `json:"text"`
+	Type       string      `json:"type"`
+	MsgIndex   *int        `json:"msg_index,omitempty"`
+	Children   []Statement `json:"children"`
+	FactCheck  *FactCheck  `json:"fact_check,omitempty"`
+	Fallacy    *Fallacy    `json:"fallacy,omitempty"`
+	ParentText string      `json:"parent_text,omitempty"` // incremental results only
+
+	claimID     int64 // stored claim, set when loaded from the claim tree
+	canonicalID int64 // canonical claim, set by canonicalizeStatements
 }
 
 type FactCheck struct {
@@ -630,8 +850,10 @@ type Fallacy struct {
 }
 
 type AnalysisResult struct {
-	Title      string      `json:"title"`
-	Statements []Statement `json:"statements"`
+	Title      string              `json:"title"`
+	Statements []Statement         `json:"statements"`
+	Validation *ValidationReport   `json:"validation,omitempty"`
+	Provenance []storage.PromptRun `json:"provenance,omitempty"`
 }
 
 func numberTranscriptLines(transcript string) string {
@@ -653,104 +875,38 @@ func numberTranscriptLinesOffset(transcript string, offset int) string {
 	return sb.String()
 }
 
-func extractStructure(transcript string) (*AnalysisResult, error) {
-	prompt := `Analyze this conversation transcript and extract a nested argument/discussion structure.
-
-IMPORTANT — Speaker identification:
-Each transcript line is pre-numbered and formatted as: [N] (speaker_id) Name: text
-The number in square brackets [N] is the msg_index. The speaker_id in parentheses (e.g. "speaker_1") is the stable identifier.
-Use the speaker_id for the "speaker_id" field and the display name for the "speaker" field.
-
-Return a JSON array of top-level statements. Each statement has:
-- "speaker": the display name of who said it
-- "speaker_id": the speaker identifier (e.g. "speaker_1")
-- "text": the core claim or statement (paraphrased concisely)
-- "type": one of "claim", "response", "question", "agreement", "rebuttal", "tangent", "clarification", "evidence"
-- "msg_index": the message number this statement comes from (1-based, matching the [N] labels in the transcript)
-- "children": array of statements that are direct responses/follow-ups to this one
-- "fact_check": ONLY include this field if the statement contains a factual claim that is false, misleading, or dubiously inaccurate based on your knowledge. Object with:
-  - "verdict": one of "false", "misleading", "unverified", "mostly-true"
-  - "correction": brief explanation of what's actually true
-  - "search_query": a Google search query the user can use to verify
-- "fallacy": ONLY include this field if the statement contains a logical fallacy. Object with:
-  - "name": the name of the fallacy (e.g. "Straw Man", "Ad Hominem", "False Dichotomy", "Slippery Slope", "Appeal to Authority", "Red Herring", "Tu Quoque", "Hasty Generalization", "Circular Reasoning", "Equivocation", "Appeal to Emotion", "Anecdotal Evidence", "Cherry Picking", "Moving the Goalposts", "No True Scotsman")
-  - "explanation": brief explanation of why this is a fallacy in this context
-
-Nest responses under the statement they're responding to. A rebuttal to a claim goes as a child of that claim.
-
-FACT-CHECKING RULES:
-- Only flag objective factual claims, NOT opinions or subjective statements
-- "I think X is better" = opinion, don't flag
-- "X was invented in 1990" = factual, flag if wrong
-- Be conservative — only flag things you're confident about
-- Include fact_check field ONLY on flagged statements, omit it otherwise
-
-FALLACY DETECTION RULES:
-- Only flag clear logical fallacies, not weak arguments or disagreements
-- The fallacy must be identifiable by name (not just "bad logic")
-- Be conservative — only flag when the reasoning error is clear
-- Include fallacy field ONLY on flagged statements, omit it otherwise
-
-IMPORTANT RULES:
-- Be CONCISE: extract the key argument from each message in 1-2 statements max, not every sentence
-- NEST aggressively: responses, rebuttals, and follow-ups go as children of what they're responding to
-- The msg_index MUST exactly match the [N] number from the transcript — do NOT guess or shift
-- Use the speaker_id from the parentheses (e.g. "speaker_1") — do NOT confuse it with [N]
-
-Return a JSON object with two fields:
-- "title": a short, descriptive title for this conversation (5-10 words, no quotes)
-- "statements": the array of top-level statements as described above
-
-Return ONLY valid JSON, no markdown fences.
-
-Transcript:
-` + transcript
-
-	reqBody, _ := json.Marshal(map[string]any{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 4096,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	})
-
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(reqBody))
+func extractStructure(ctx context.Context, transcript string, speakers map[string]string) (*AnalysisResult, error) {
+	opts := CompletionOptions{MaxTokens: 4096}
+	prompt, run, err := renderPrompt(promptExtractStructure, struct{ Transcript string }{transcript}, opts)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("x-api-key", anthropicKey)
-	req.Header.Set("content-type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
+	bounds := transcriptBounds(transcript, speakers)
+	var result *AnalysisResult
+	repairs, err := completeJSON(ctx, prompt, opts, func(text string) ([]string, error) {
+		parsed, err := parseAnalysis(text)
+		if err != nil {
+			return nil, err
+		}
+		report := &ValidationReport{}
+		parsed.Statements = validateStatements(parsed.Statements, bounds, report)
+		parsed.Validation = report
+		result = parsed
+		return report.problems(), nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("claude API %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-	if len(result.Content) == 0 {
-		return nil, fmt.Errorf("empty response from Claude")
+	result.Validation.Repairs = repairs
+	if result.Validation.empty() {
+		result.Validation = nil
 	}
+	result.Provenance = []storage.PromptRun{run}
+	return result, nil
+}
 
-	text := strings.TrimSpace(result.Content[0].Text)
-	text = strings.TrimPrefix(text, "```json")
-	text = strings.TrimPrefix(text, "```")
-	text = strings.TrimSuffix(text, "```")
-	text = strings.TrimSpace(text)
-
+func parseAnalysis(text string) (*AnalysisResult, error) {
 	// Try parsing as wrapper object {title, statements}
 	var analysisResult AnalysisResult
 	if err := json.Unmarshal([]byte(text), &analysisResult); err == nil && len(analysisResult.Statements) > 0 {
@@ -760,15 +916,16 @@ Transcript:
 	// Fallback: bare array of statements
 	var statements []Statement
 	if err := json.Unmarshal([]byte(text), &statements); err != nil {
-		return nil, fmt.Errorf("failed to parse structure: %v\nraw: %s", err, text)
+		return nil, err
 	}
-
 	return &AnalysisResult{Statements: statements}, nil
 }
 
 type IncrementalResult struct {
-	Statements []Statement          `json:"statements"`
-	Updates    []StatementUpdate    `json:"updates,omitempty"`
+	Statements []Statement         `json:"statements"`
+	Updates    []StatementUpdate   `json:"updates,omitempty"`
+	Validation *ValidationReport   `json:"validation,omitempty"`
+	Provenance []storage.PromptRun `json:"provenance,omitempty"`
 }
 
 type StatementUpdate struct {
@@ -776,115 +933,54 @@ type StatementUpdate struct {
 	Text        *string `json:"text,omitempty"`
 	Type        *string `json:"type,omitempty"`
 	ParentText  *string `json:"parent_text,omitempty"`
+
+	canonicalID int64 // canonical claim of Text, set by canonicalizeUpdates
+	claimID     int64 // stored claim to correct instead of the msg_index match, set by reverts
 }
 
-func extractIncremental(newText string, contextText string, existing []Statement, msgOffset int, fullReview bool) (*IncrementalResult, error) {
+func extractIncremental(ctx context.Context, newText string, contextText string, existing []Statement, msgOffset int, fullReview bool, speakers map[string]string) (*IncrementalResult, error) {
 	existingSummary := summarizeStatements(existing, 0)
 
-	contextSection := ""
-	if contextText != "" {
-		contextSection = `
-RECENT CONVERSATION CONTEXT (for understanding flow — already analyzed):
-` + contextText + `
-`
-	}
-
-	reviewSection := ""
-	if fullReview {
-		reviewSection = `
-REVIEW MODE: In addition to analyzing new statements, review existing claims in light of the full conversation context.
-If any existing claims need corrections (e.g. misattributed speaker, wrong type, should be nested differently), include them in an "updates" array.
-Each update has:
-- "msg_index": the msg_index of the existing statement to update
-- "text": new text (only if it should change)
-- "type": new type (only if it should change)  
-- "parent_text": new parent to nest under (only if it should be moved)
-Only include updates for claims that genuinely need fixing. Most calls should have zero updates.
-`
-	}
-
-	prompt := `You are analyzing a LIVE conversation incrementally. You've already analyzed earlier parts.
-
-EXISTING ANALYSIS (for context — do NOT repeat these):
-` + existingSummary + contextSection + `
-NEW PORTION to analyze (each line is pre-numbered: [N] (speaker_id) Name: text):
-` + newText + `
-` + reviewSection + `
-Return a JSON object with:
-- "statements": array of NEW statements only (from the new portion). Each has:
-  - "speaker": display name
-  - "speaker_id": identifier (e.g. "speaker_1")
-  - "text": core claim (paraphrased concisely)
-  - "type": "claim"|"response"|"question"|"agreement"|"rebuttal"|"tangent"|"clarification"|"evidence"
-  - "msg_index": the [N] label number
-  - "children": sub-statements array (direct responses within new text only)
-  - "parent_text": text of existing statement this responds to (omit for top-level)
-  - "fact_check": only if objectively false/misleading. {"verdict","correction","search_query"}
-  - "fallacy": only if clear logical fallacy. {"name","explanation"}
-` + func() string {
-		if fullReview {
-			return `- "updates": array of corrections to existing claims (empty if none needed). Each has "msg_index" plus changed fields.
-`
-		}
-		return ""
-	}() + `
-Rules:
-- Only NEW statements from the new text
-- Empty "statements" array if no new claims
-- Keep speaker labels consistent
-- Only flag objective factual claims, not opinions
-- Be CONCISE: summarize each message's key argument in 1-2 statements max, not every sentence
-- NEST responses: if someone responds to or rebuts an existing claim, use parent_text to nest it
-- The msg_index MUST match the [N] number from the transcript line — do NOT guess or shift numbers
-- Use the speaker_id from the parentheses (e.g. "speaker_1") — do NOT confuse it with the [N] number
-
-Return ONLY valid JSON object, no markdown fences.`
-
-	reqBody, _ := json.Marshal(map[string]any{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 4096,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	})
-
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(reqBody))
+	opts := CompletionOptions{MaxTokens: 4096}
+	prompt, run, err := renderPrompt(promptExtractIncremental, struct {
+		Existing, Context, NewText string
+		FullReview                 bool
+	}{existingSummary, contextText, newText, fullReview}, opts)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("x-api-key", anthropicKey)
-	req.Header.Set("content-type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	// Overlap restatements may cite context lines; mergeWindowStatements
+	// drops them later. msg_index is only checkable on pre-numbered text.
+	bounds := transcriptBounds(contextText+"\n"+newText, speakers)
+	if !numberedLinePattern.MatchString(strings.TrimSpace(newText)) {
+		bounds.MaxIndex = 0
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("claude API %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
+	var result *IncrementalResult
+	repairs, err := completeJSON(ctx, prompt, opts, func(text string) ([]string, error) {
+		parsed, err := parseIncremental(text)
+		if err != nil {
+			return nil, err
+		}
+		report := &ValidationReport{}
+		parsed.Statements = validateStatements(parsed.Statements, bounds, report)
+		parsed.Updates = validateUpdates(parsed.Updates, report)
+		parsed.Validation = report
+		result = parsed
+		return report.problems(), nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	if len(result.Content) == 0 {
-		return nil, fmt.Errorf("empty response")
+	result.Validation.Repairs = repairs
+	if result.Validation.empty() {
+		result.Validation = nil
 	}
+	result.Provenance = []storage.PromptRun{run}
+	return result, nil
+}
 
-	text := strings.TrimSpace(result.Content[0].Text)
-	text = strings.TrimPrefix(text, "```json")
-	text = strings.TrimPrefix(text, "```")
-	text = strings.TrimSuffix(text, "```")
-	text = strings.TrimSpace(text)
-
+func parseIncremental(text string) (*IncrementalResult, error) {
 	// Try parsing as JSON object {statements, updates} first
 	var objResult struct {
 		Statements []json.RawMessage `json:"statements"`
@@ -895,7 +991,6 @@ Return ONLY valid JSON object, no markdown fences.`
 		for _, r := range objResult.Statements {
 			var s Statement
 			json.Unmarshal(r, &s)
-			s.Type = strings.ToLower(s.Type)
 			statements = append(statements, s)
 		}
 		return &IncrementalResult{Statements: statements, Updates: objResult.Updates}, nil
@@ -904,14 +999,13 @@ Return ONLY valid JSON object, no markdown fences.`
 	// Fallback: bare JSON array of statements
 	var raw []json.RawMessage
 	if err := json.Unmarshal([]byte(text), &raw); err != nil {
-		return nil, fmt.Errorf("parse error: %v", err)
+		return nil, err
 	}
 
 	var statements []Statement
 	for _, r := range raw {
 		var s Statement
 		json.Unmarshal(r, &s)
-		s.Type = strings.ToLower(s.Type)
 		statements = append(statements, s)
 	}
 
@@ -936,8 +1030,9 @@ func summarizeStatements(statements []Statement, depth int) string {
 // --- Diarization ---
 
 type DiarizeResult struct {
-	Speakers map[string]string        `json:"speakers"`
-	Messages []storage.DiarizeMessage `json:"messages"`
+	Speakers   map[string]string        `json:"speakers"`
+	Messages   []storage.DiarizeMessage `json:"messages"`
+	Provenance []storage.PromptRun      `json:"provenance,omitempty"`
 }
 
 func assignTimestamps(messages []storage.DiarizeMessage, segments []TimedSegment) {
@@ -969,7 +1064,8 @@ func assignTimestamps(messages []storage.DiarizeMessage, segments []TimedSegment
 		}
 	nextMsg:
 	}
-	// Compute end_ms: each message ends when the next one starts
+	// Compute end_ms: each message ends when the next one starts; the last
+	// one ends with the final segment when the source reports segment ends
 	for i := range messages {
 		if messages[i].StartMs == nil {
 			continue
@@ -977,94 +1073,43 @@ func assignTimestamps(messages []storage.DiarizeMessage, segments []TimedSegment
 		if i+1 < len(messages) && messages[i+1].StartMs != nil {
 			end := *messages[i+1].StartMs
 			messages[i].EndMs = &end
+		} else if i == len(messages)-1 && len(segments) > 0 {
+			if end := segments[len(segments)-1].EndMs; end > *messages[i].StartMs {
+				messages[i].EndMs = &end
+			}
 		}
 	}
 }
 
-func diarizeTranscript(transcript string) (*DiarizeResult, error) {
-	prompt := `You are a conversation diarization system. Given a raw transcript (which may have no speaker labels), identify distinct speakers and split the text into a conversation.
-
-Rules:
-- Identify speaker changes from context: opinion shifts, turn-taking, Q&A patterns, different perspectives
-- If it's a monologue, use a single speaker
-- Keep the original wording, don't paraphrase
-- Split at natural speaker boundaries
-
-NAME DETECTION (important):
-- When someone says a name, they are almost always addressing the OTHER person, not themselves
-- "Hey John, what do you think?" → the LISTENER is John, not the speaker
-- "Thanks Sarah" → Sarah is the person being thanked, not the one speaking
-- "I'm Mike" or "My name is Mike" → rare case where they ARE naming themselves
-- Apply this logic carefully to assign detected names to the correct speaker
-
-Return JSON with this exact structure:
-{
-  "speakers": {
-    "speaker_1": "detected name or empty string",
-    "speaker_2": "detected name or empty string"
-  },
-  "messages": [
-    {"speaker": "speaker_1", "text": "what they said"},
-    {"speaker": "speaker_2", "text": "what they said"}
-  ]
-}
-
-Use speaker IDs like "speaker_1", "speaker_2", etc. Put detected names in the speakers map for the correct person (the one being addressed, not the one speaking). Leave as empty string if no name detected.
-
-Return ONLY valid JSON, no markdown fences.
-
-Transcript:
-` + transcript
-
-	reqBody, _ := json.Marshal(map[string]any{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 4096,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	})
-
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(reqBody))
+func diarizeTranscript(ctx context.Context, transcript string) (*DiarizeResult, error) {
+	opts := CompletionOptions{MaxTokens: 4096}
+	prompt, run, err := renderPrompt(promptDiarize, struct{ Transcript string }{transcript}, opts)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("x-api-key", anthropicKey)
-	req.Header.Set("content-type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
+	var result DiarizeResult
+	_, err = completeJSON(ctx, prompt, opts, func(text string) ([]string, error) {
+		var parsed DiarizeResult
+		if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+			return nil, err
+		}
+		// Every message speaker must be in the speakers map
+		if parsed.Speakers == nil {
+			parsed.Speakers = map[string]string{}
+		}
+		for _, m := range parsed.Messages {
+			if _, ok := parsed.Speakers[m.Speaker]; !ok {
+				parsed.Speakers[m.Speaker] = ""
+			}
+		}
+		result = parsed
+		return nil, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("claude API %d: %s", resp.StatusCode, string(body))
-	}
-
-	var apiResult struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &apiResult); err != nil {
-		return nil, err
-	}
-	if len(apiResult.Content) == 0 {
-		return nil, fmt.Errorf("empty response")
-	}
-
-	text := strings.TrimSpace(apiResult.Content[0].Text)
-	text = strings.TrimPrefix(text, "```json")
-	text = strings.TrimPrefix(text, "```")
-	text = strings.TrimSuffix(text, "```")
-	text = strings.TrimSpace(text)
-
-	var result DiarizeResult
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
-		return nil, fmt.Errorf("parse error: %v\nraw: %s", err, text)
-	}
+	result.Provenance = []storage.PromptRun{run}
 	return &result, nil
 }
 
@@ -1079,6 +1124,12 @@ func persistStatements(audioPath string, statements []Statement, speakers map[st
 	if existingID > 0 {
 		tid = existingID
 		err = store.UpdateTranscript(tid, audioPath, "")
+		if err == nil {
+			err = store.DeleteAnnotations(tid)
+		}
+		if err == nil {
+			err = store.DeleteClaimMentions(tid)
+		}
 	} else {
 		tid, err = store.SaveTranscript(audioPath, "")
 	}
@@ -1089,17 +1140,21 @@ func persistStatements(audioPath string, statements []Statement, speakers map[st
 
 	// Save diarization data if available
 	if speakers != nil && len(messages) > 0 {
+		speakers = resolveSpeakerAliases(speakers)
 		if err := store.SaveDiarization(tid, speakers, messages); err != nil {
 			log.Printf("persistStatements: save diarization: %v", err)
 		}
+		indexUtterancesSearch(tid, speakers, messages)
 		// Save speakers with explicit auto_generated flags from frontend
 		if speakerAutoGen != nil {
 			store.SaveSpeakersWithFlags(tid, speakers, speakerAutoGen)
 		}
+		publishUtterances(tid, 0, speakers, messages)
 	}
 
-	var walk func(stmts []Statement, parentClaimID *int64, pos *int)
-	walk = func(stmts []Statement, parentClaimID *int64, pos *int) {
+	var indexed []storage.IndexedClaim
+	var walk func(stmts []Statement, parentClaimID, parentCanonicalID *int64, pos *int)
+	walk = func(stmts []Statement, parentClaimID, parentCanonicalID *int64, pos *int) {
 		for _, s := range stmts {
 			cid, err := store.SaveClaim(s.Text, s.Type)
 			if err != nil {
@@ -1112,17 +1167,41 @@ func persistStatements(audioPath string, statements []Statement, speakers map[st
 				speakerKey = s.Speaker
 			}
 			store.SaveOccurrence(cid, tid, speakerKey, *pos, s.Text, s.MsgIndex)
+			indexed = append(indexed, storage.IndexedClaim{ClaimID: cid, SpeakerID: speakerKey, MsgIndex: s.MsgIndex, Text: s.Text, Type: s.Type})
 			*pos++
+			var canonicalID *int64
+			if id, err := statementCanonicalID(s); err != nil {
+				log.Printf("persistStatements: canonicalize claim: %v", err)
+			} else {
+				canonicalID = &id
+				mention := storage.ClaimMention{CanonicalID: id, ClaimID: cid, TranscriptID: tid, Speaker: speakerKey,
+					MsgIndex: s.MsgIndex, Text: s.Text, Type: s.Type, ParentCanonicalID: parentCanonicalID}
+				if err := store.SaveClaimMention(mention); err != nil {
+					log.Printf("persistStatements: save claim mention: %v", err)
+				}
+			}
+			if s.FactCheck != nil {
+				if err := store.SaveFactCheck(cid, tid, s.MsgIndex, s.Text, storage.FactCheck(*s.FactCheck)); err != nil {
+					log.Printf("persistStatements: save fact check: %v", err)
+				}
+			}
+			if s.Fallacy != nil {
+				if err := store.SaveFallacy(cid, tid, s.MsgIndex, s.Text, storage.Fallacy(*s.Fallacy)); err != nil {
+					log.Printf("persistStatements: save fallacy: %v", err)
+				}
+			}
 			if parentClaimID != nil {
 				store.SaveEdge(*parentClaimID, cid, s.Type, tid)
 			}
 			if len(s.Children) > 0 {
-				walk(s.Children, &cid, pos)
+				walk(s.Children, &cid, canonicalID, pos)
 			}
 		}
 	}
 	pos := 0
-	walk(statements, nil, &pos)
+	walk(statements, nil, nil, &pos)
+	indexClaimsSearch(tid, indexed)
+	publishStatements(tid, transcriptStatements(tid), true)
 	return tid
 }
 
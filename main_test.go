@@ -20,11 +20,29 @@ func init() {
 	openaiKey = os.Getenv("OPENAI_API_KEY")
 	os.MkdirAll("uploads", 0755)
 
+	// Tests run offline against the fake unless a provider is chosen explicitly
 	var err error
+	if os.Getenv("LLM_PROVIDER") == "" {
+		llm = newFakeLLM()
+	} else if llm, err = newLLMFromEnv(); err != nil {
+		panic("failed to configure LLM: " + err.Error())
+	}
+	if os.Getenv("TRANSCRIBER") == "" {
+		transcriber = &fakeTranscriber{Segments: []TimedSegment{
+			{StartMs: 0, EndMs: 1000, Text: "Testing one two."},
+		}}
+	} else if transcriber, err = newTranscriberFromEnv(); err != nil {
+		panic("failed to configure transcriber: " + err.Error())
+	}
+
 	templates, err = loadTemplates()
 	if err != nil {
 		panic("failed to load templates: " + err.Error())
 	}
+	prompts, err = loadPrompts("prompts", "")
+	if err != nil {
+		panic("failed to load prompts: " + err.Error())
+	}
 }
 
 func setupTestStore(t *testing.T) {
@@ -34,6 +52,9 @@ func setupTestStore(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
 	t.Cleanup(func() { store.Close(); store = nil })
 }
 
@@ -43,7 +64,7 @@ func setupMux() *http.ServeMux {
 	for _, prefix := range []string{"/argraphments", ""} {
 		p := prefix
 		mux.HandleFunc(p+"/", handleIndex)
-		mux.HandleFunc(p+"/convo/", handleIndex) // conversation URLs
+		mux.HandleFunc(p+"/convo/", handleConvo) // conversation URLs and reports
 		mux.Handle(p+"/static/", http.StripPrefix(p+"/static/", staticFS))
 		mux.HandleFunc(p+"/api/session/new", handleAPINewSession)
 		mux.HandleFunc(p+"/api/transcribe", handleAPITranscribe)
@@ -56,8 +77,15 @@ func setupMux() *http.ServeMux {
 		mux.HandleFunc(p+"/api/speakers", handleAPISpeakers)
 		mux.HandleFunc(p+"/api/speakers/", handleAPISpeakers)
 		mux.HandleFunc(p+"/api/import/youtube", handleAPIImportYouTube)
+		mux.HandleFunc(p+"/api/import/transcript", handleAPIImportTranscript)
+		mux.HandleFunc(p+"/api/search", handleAPISearch)
+		mux.HandleFunc(p+"/api/auth/", handleAPIAuth)
 		mux.HandleFunc(p+"/api/graph", handleAPIGraph)
 		mux.HandleFunc(p+"/api/sample", handleAPISample)
+		mux.HandleFunc(p+"/api/jobs", handleAPIJobs)
+		mux.HandleFunc(p+"/api/jobs/", handleAPIJobs)
+		mux.HandleFunc(p+"/api/prompts", handleAPIPrompts)
+		mux.HandleFunc(p+"/api/llm-cache", handleAPILLMCache)
 	}
 	return mux
 }
@@ -78,10 +106,6 @@ func TestIndex(t *testing.T) {
 }
 
 func TestAnalyzeAPI(t *testing.T) {
-	if anthropicKey == "" {
-		t.Skip("ANTHROPIC_API_KEY not set")
-	}
-
 	mux := setupMux()
 	payload := map[string]string{
 		"transcript": `Speaker 1: I think we should use Go for the backend.
@@ -114,10 +138,6 @@ Speaker 2: OK, I'm convinced. Let's go with Go.`,
 }
 
 func TestTranscribeAPI(t *testing.T) {
-	if openaiKey == "" {
-		t.Skip("OPENAI_API_KEY not set")
-	}
-
 	wavData := generateSilentWAV(1)
 
 	var buf bytes.Buffer
@@ -139,14 +159,20 @@ func TestTranscribeAPI(t *testing.T) {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
 
-	var result map[string]string
+	var result struct {
+		Text     *string        `json:"text"`
+		Segments []TimedSegment `json:"segments"`
+	}
 	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
 		t.Fatalf("invalid JSON response: %v", err)
 	}
-	if _, ok := result["text"]; !ok {
-		t.Fatalf("response missing 'text' field: %v", result)
+	if result.Text == nil {
+		t.Fatalf("response missing 'text' field: %s", w.Body.String())
+	}
+	if result.Segments == nil {
+		t.Fatalf("response missing 'segments' field: %s", w.Body.String())
 	}
-	t.Logf("Transcribe response: %q", result["text"])
+	t.Logf("Transcribe response: %q, %d segments", *result.Text, len(result.Segments))
 }
 
 // generateSilentWAV creates a minimal valid WAV file with silence
@@ -253,9 +279,6 @@ func TestE2E_CreateAndRetrieveBySlug(t *testing.T) {
 }
 
 func TestE2E_AnalyzeWithSlugAndRetrieve(t *testing.T) {
-	if anthropicKey == "" {
-		t.Skip("ANTHROPIC_API_KEY not set")
-	}
 	setupTestStore(t)
 	mux := setupMux()
 
@@ -565,9 +588,6 @@ func TestE2E_SpeakerRename(t *testing.T) {
 }
 
 func TestE2E_AnalyzeUpdatesExistingTranscript(t *testing.T) {
-	if anthropicKey == "" {
-		t.Skip("ANTHROPIC_API_KEY not set")
-	}
 	setupTestStore(t)
 	mux := setupMux()
 
@@ -673,14 +693,14 @@ func TestDiarizeEndpoint(t *testing.T) {
 	mux.ServeHTTP(w, req)
 
 	if w.Code != 200 {
-		t.Skip("diarize requires API key or returned error:", w.Body.String())
+		t.Fatalf("diarize: expected 200, got %d: %s", w.Code, w.Body.String())
 	}
 
 	var result map[string]any
 	json.Unmarshal(w.Body.Bytes(), &result)
 
 	if _, ok := result["error"]; ok {
-		t.Skip("diarize requires API key:", result["error"])
+		t.Fatal("diarize returned error:", result["error"])
 	}
 
 	speakers, ok := result["speakers"].(map[string]any)
@@ -713,13 +733,13 @@ func TestDiarizeWithSegments(t *testing.T) {
 	mux.ServeHTTP(w, req)
 
 	if w.Code != 200 {
-		t.Skip("diarize requires API key or returned error:", w.Body.String())
+		t.Fatalf("diarize: expected 200, got %d: %s", w.Code, w.Body.String())
 	}
 
 	var result map[string]any
 	json.Unmarshal(w.Body.Bytes(), &result)
 	if _, ok := result["error"]; ok {
-		t.Skip("diarize requires API key:", result["error"])
+		t.Fatal("diarize returned error:", result["error"])
 	}
 
 	messages, ok := result["messages"].([]any)
@@ -814,12 +834,12 @@ func TestSampleConvoFlow(t *testing.T) {
 	w = httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 	if w.Code != 200 {
-		t.Skip("diarize requires API key or returned error:", w.Code)
+		t.Fatalf("diarize: expected 200, got %d: %s", w.Code, w.Body.String())
 	}
 	var diarize map[string]any
 	json.Unmarshal(w.Body.Bytes(), &diarize)
 	if _, ok := diarize["error"]; ok {
-		t.Skip("requires API key")
+		t.Fatal("diarize returned error:", diarize["error"])
 	}
 
 	// 3. Retrieve by slug — should serve SPA
@@ -835,3 +855,74 @@ func TestSampleConvoFlow(t *testing.T) {
 
 	t.Logf("Sample flow OK: session=%s, diarize speakers=%v", slug, diarize["speakers"])
 }
+
+func TestAnnotationsPersistAndReload(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+
+	msg1, msg2 := 1, 2
+	statements := []Statement{
+		{
+			Speaker: "Alice", SpeakerID: "speaker_1", Text: "The Great Wall is visible from space", Type: "claim", MsgIndex: &msg1,
+			FactCheck: &FactCheck{Verdict: "false", Correction: "It is not visible to the naked eye from orbit", SearchQuery: "great wall visible from space"},
+			Children: []Statement{
+				{
+					Speaker: "Bob", SpeakerID: "speaker_2", Text: "You also believe in astrology", Type: "rebuttal", MsgIndex: &msg2,
+					Fallacy: &Fallacy{Name: "Ad Hominem", Explanation: "Attacks the speaker rather than the claim"},
+				},
+			},
+		},
+	}
+	tid := persistStatements("", statements, map[string]string{"speaker_1": "Alice", "speaker_2": "Bob"}, []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "The Great Wall is visible from space."},
+		{Speaker: "speaker_2", Text: "You also believe in astrology."},
+	}, nil, 0)
+	if tid == 0 {
+		t.Fatal("persistStatements failed")
+	}
+	tr, _ := store.GetTranscript(tid)
+
+	req := httptest.NewRequest("GET", "/api/transcripts/"+tr.Slug, nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var data struct {
+		Statements []Statement `json:"statements"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &data)
+	if len(data.Statements) != 1 || len(data.Statements[0].Children) != 1 {
+		t.Fatalf("unexpected tree: %s", w.Body.String())
+	}
+	root := data.Statements[0]
+	if root.FactCheck == nil || root.FactCheck.Verdict != "false" || root.FactCheck.SearchQuery == "" {
+		t.Fatalf("fact_check not restored: %+v", root.FactCheck)
+	}
+	if root.Fallacy != nil {
+		t.Fatalf("unexpected fallacy on root: %+v", root.Fallacy)
+	}
+	child := root.Children[0]
+	if child.Fallacy == nil || child.Fallacy.Name != "Ad Hominem" {
+		t.Fatalf("fallacy not restored: %+v", child.Fallacy)
+	}
+
+	// Re-persisting into the same transcript replaces, not duplicates, annotations
+	statements[0].FactCheck = nil
+	persistStatements("", statements, nil, nil, nil, tid)
+	annotations, _ := store.GetAnnotations(tid)
+	if len(annotations) != 1 || annotations[0].Fallacy == nil || annotations[0].FactCheck != nil {
+		t.Fatalf("expected only the fallacy after re-persist, got %+v", annotations)
+	}
+
+	// Occurrences sharing a claim keep their own annotations
+	other, _ := store.SaveTranscript("", "")
+	cid, _ := store.SaveClaim("Taxes are theft", "claim")
+	store.SaveFactCheck(cid, other, intp(1), "Taxes are theft", storage.FactCheck{Verdict: "misleading"})
+	store.SaveFallacy(cid, other, intp(4), "Taxes are theft", storage.Fallacy{Name: "Loaded Language"})
+	annotations, _ = store.GetAnnotations(other)
+	if len(annotations) != 2 || *annotations[0].MsgIndex != 1 || annotations[0].Fallacy != nil ||
+		*annotations[1].MsgIndex != 4 || annotations[1].FactCheck != nil {
+		t.Fatalf("annotations merged across occurrences: %+v", annotations)
+	}
+}
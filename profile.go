@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// maxProfileOpponents caps the opponents listed in a speaker profile.
+const maxProfileOpponents = 10
+
+// speakerProfile aggregates a speaker's part in every conversation the
+// requester can see.
+type speakerProfile struct {
+	Name              string            `json:"name"`
+	Conversations     int               `json:"conversations"`
+	Messages          int               `json:"messages"`
+	Words             int               `json:"words"`
+	SpeakingMs        int64             `json:"speaking_ms"`
+	AvgSpeakingMs     int64             `json:"avg_speaking_ms"` // per conversation with timestamps
+	Statements        int               `json:"statements"`
+	ByType            map[string]int    `json:"by_type"`
+	RebuttalsGiven    int               `json:"rebuttals_given"`
+	RebuttalsReceived int               `json:"rebuttals_received"`
+	Verdicts          map[string]int    `json:"fact_check_verdicts"`
+	Fallacies         map[string]int    `json:"fallacies"`
+	Opponents         []speakerOpponent `json:"opponents"`
+}
+
+// speakerOpponent counts rebuttals between the profiled speaker and one
+// other speaker, in both directions.
+type speakerOpponent struct {
+	Name       string `json:"name"`
+	Rebutted   int    `json:"rebutted"`    // by the profiled speaker
+	RebuttedBy int    `json:"rebutted_by"` // rebuttals of the profiled speaker
+}
+
+func buildSpeakerProfile(sp *storage.Speaker, hidden map[string]bool) speakerProfile {
+	p := speakerProfile{
+		Name:      sp.Name,
+		ByType:    map[string]int{},
+		Verdicts:  map[string]int{},
+		Fallacies: map[string]int{},
+		Opponents: []speakerOpponent{},
+	}
+
+	// A speaker can appear under several local ids in one conversation
+	// after a merge.
+	locals := map[string]map[string]bool{}
+	var slugs []string
+	for _, a := range speakerAppearances(sp, hidden) {
+		if locals[a.Slug] == nil {
+			locals[a.Slug] = map[string]bool{}
+			slugs = append(slugs, a.Slug)
+		}
+		locals[a.Slug][a.Speaker] = true
+	}
+
+	opponents := map[string]*speakerOpponent{}
+	opponent := func(name string) *speakerOpponent {
+		o, ok := opponents[name]
+		if !ok {
+			o = &speakerOpponent{Name: name}
+			opponents[name] = o
+		}
+		return o
+	}
+
+	timed := 0
+	for _, slug := range slugs {
+		t, err := store.GetTranscriptBySlug(slug)
+		if err != nil {
+			continue
+		}
+		mine := locals[slug]
+		speakers, messages, _ := store.GetDiarization(t.ID)
+		statements := transcriptStatements(t.ID)
+		p.Conversations++
+
+		var speakingMs int64
+		for _, st := range conversationSpeakerStats(speakers, messages, statements) {
+			if !mine[st.SpeakerID] {
+				continue
+			}
+			p.Messages += st.Messages
+			p.Words += st.Words
+			p.Statements += st.Statements
+			speakingMs += st.SpeakingMs
+			for typ, n := range st.ByType {
+				p.ByType[typ] += n
+			}
+		}
+		if speakingMs > 0 {
+			p.SpeakingMs += speakingMs
+			timed++
+		}
+
+		name := func(local string) string {
+			if n := speakers[local]; n != "" {
+				return n
+			}
+			return local
+		}
+		var walk func(stmts []Statement, parent *Statement)
+		walk = func(stmts []Statement, parent *Statement) {
+			for i := range stmts {
+				st := &stmts[i]
+				if mine[st.Speaker] {
+					if st.FactCheck != nil && st.FactCheck.Verdict != "" {
+						p.Verdicts[strings.ToLower(st.FactCheck.Verdict)]++
+					}
+					if st.Fallacy != nil && st.Fallacy.Name != "" {
+						p.Fallacies[strings.TrimSpace(st.Fallacy.Name)]++
+					}
+				}
+				if st.Type == "rebuttal" && parent != nil && mine[st.Speaker] != mine[parent.Speaker] {
+					if mine[st.Speaker] {
+						p.RebuttalsGiven++
+						opponent(name(parent.Speaker)).Rebutted++
+					} else {
+						p.RebuttalsReceived++
+						opponent(name(st.Speaker)).RebuttedBy++
+					}
+				}
+				walk(st.Children, st)
+			}
+		}
+		walk(statements, nil)
+	}
+	if timed > 0 {
+		p.AvgSpeakingMs = p.SpeakingMs / int64(timed)
+	}
+
+	for _, o := range opponents {
+		p.Opponents = append(p.Opponents, *o)
+	}
+	sort.Slice(p.Opponents, func(a, b int) bool {
+		oa, ob := p.Opponents[a], p.Opponents[b]
+		if ta, tb := oa.Rebutted+oa.RebuttedBy, ob.Rebutted+ob.RebuttedBy; ta != tb {
+			return ta > tb
+		}
+		return oa.Name < ob.Name
+	})
+	if len(p.Opponents) > maxProfileOpponents {
+		p.Opponents = p.Opponents[:maxProfileOpponents]
+	}
+	return p
+}
+
+// GET /api/speakers/{name}/profile
+func handleSpeakerProfile(w http.ResponseWriter, r *http.Request, sp *storage.Speaker) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hidden := hiddenSlugs(hiddenTranscripts(requestUser(r)))
+	json.NewEncoder(w).Encode(buildSpeakerProfile(sp, hidden))
+}
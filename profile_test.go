@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func TestSpeakerProfile(t *testing.T) {
+	setupTestStore(t)
+	ms := func(n int64) *int64 { return &n }
+	for i := 0; i < 2; i++ {
+		tid, _ := store.SaveTranscript("", "")
+		persistStatements("", []Statement{
+			{Speaker: "speaker_1", Text: "Rent control lowers rents", Type: "claim", MsgIndex: intp(1),
+				FactCheck: &FactCheck{Verdict: "False"}, Children: []Statement{
+					{Speaker: "speaker_2", Text: "It shrinks supply", Type: "rebuttal", MsgIndex: intp(2), Children: []Statement{
+						{Speaker: "speaker_1", Text: "Not in the short run", Type: "rebuttal", MsgIndex: intp(3),
+							Fallacy: &Fallacy{Name: "Moving the goalposts"}},
+					}},
+				}},
+		}, map[string]string{"speaker_1": "Lane", "speaker_2": "Kim"}, []storage.DiarizeMessage{
+			{Speaker: "speaker_1", Text: "Rent control lowers rents", StartMs: ms(0), EndMs: ms(3000)},
+			{Speaker: "speaker_2", Text: "It shrinks supply", StartMs: ms(3000), EndMs: ms(5000)},
+			{Speaker: "speaker_1", Text: "Not in the short run", StartMs: ms(5000), EndMs: ms(6000)},
+		}, nil, tid)
+	}
+
+	w := authRequestAs(t, "", "GET", "/api/speakers/Lane/profile", "")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var p speakerProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Conversations != 2 || p.Messages != 4 || p.Statements != 4 {
+		t.Fatalf("counts: %+v", p)
+	}
+	if p.ByType["claim"] != 2 || p.ByType["rebuttal"] != 2 {
+		t.Fatalf("by type: %v", p.ByType)
+	}
+	if p.RebuttalsGiven != 2 || p.RebuttalsReceived != 2 {
+		t.Fatalf("rebuttals: given %d received %d", p.RebuttalsGiven, p.RebuttalsReceived)
+	}
+	if p.Verdicts["false"] != 2 || p.Fallacies["Moving the goalposts"] != 2 {
+		t.Fatalf("flags: %v %v", p.Verdicts, p.Fallacies)
+	}
+	if p.SpeakingMs != 8000 || p.AvgSpeakingMs != 4000 {
+		t.Fatalf("talk time: %d avg %d", p.SpeakingMs, p.AvgSpeakingMs)
+	}
+	if len(p.Opponents) != 1 || p.Opponents[0] != (speakerOpponent{Name: "Kim", Rebutted: 2, RebuttedBy: 2}) {
+		t.Fatalf("opponents: %+v", p.Opponents)
+	}
+
+	if w := authRequestAs(t, "", "GET", "/api/speakers/Nobody/profile", ""); w.Code != 404 {
+		t.Fatalf("unknown speaker: status %d", w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// LLM prompts are text/template files named <id>.v<version>.tmpl in
+// PROMPTS_DIR (default "prompts"). The highest version of each id is used
+// unless PROMPT_VERSIONS pins another ("extract-structure=1,diarize=2"),
+// which is how a prompt change is A/B tested: run two instances with
+// different pins and compare their output. A single trailing newline is
+// dropped so files can end with one.
+//
+// Every run is described by a storage.PromptRun (id, version, a hash of the
+// template source, provider, model and max tokens) that is saved against
+// the transcript it produced.
+const (
+	promptExtractStructure   = "extract-structure"
+	promptExtractIncremental = "extract-incremental"
+	promptDiarize            = "diarize"
+	promptGenerate           = "generate-conversation"
+)
+
+var requiredPrompts = []string{promptExtractStructure, promptExtractIncremental, promptDiarize, promptGenerate}
+
+var promptFilePattern = regexp.MustCompile(`^([a-z0-9-]+)\.v(\d+)\.tmpl$`)
+
+type promptTemplate struct {
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	Active  bool   `json:"active"`
+	tmpl    *template.Template
+}
+
+type promptLibrary struct {
+	byID   map[string][]*promptTemplate // ascending version
+	active map[string]*promptTemplate
+}
+
+var prompts *promptLibrary
+
+// loadPrompts reads every template in dir and picks each id's active
+// version. pins is PROMPT_VERSIONS.
+func loadPrompts(dir, pins string) (*promptLibrary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	lib := &promptLibrary{byID: map[string][]*promptTemplate{}, active: map[string]*promptTemplate{}}
+	for _, e := range entries {
+		m := promptFilePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimSuffix(string(src), "\n")
+		tmpl, err := template.New(e.Name()).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		version, _ := strconv.Atoi(m[2])
+		sum := sha256.Sum256([]byte(text))
+		lib.byID[m[1]] = append(lib.byID[m[1]], &promptTemplate{ID: m[1], Version: version, Hash: hex.EncodeToString(sum[:])[:12], tmpl: tmpl})
+	}
+	for id, versions := range lib.byID {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+		lib.active[id] = versions[len(versions)-1]
+	}
+
+	for _, pin := range strings.Split(pins, ",") {
+		if strings.TrimSpace(pin) == "" {
+			continue
+		}
+		id, v, ok := strings.Cut(strings.TrimSpace(pin), "=")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("PROMPT_VERSIONS: want id=version, got %q", pin)
+		}
+		p := lib.lookup(id, version)
+		if p == nil {
+			return nil, fmt.Errorf("PROMPT_VERSIONS: no prompt %s version %d in %s", id, version, dir)
+		}
+		lib.active[id] = p
+	}
+	for _, id := range requiredPrompts {
+		if lib.active[id] == nil {
+			return nil, fmt.Errorf("missing prompt %s in %s", id, dir)
+		}
+	}
+	for _, p := range lib.active {
+		p.Active = true
+	}
+	return lib, nil
+}
+
+func (l *promptLibrary) lookup(id string, version int) *promptTemplate {
+	for _, p := range l.byID[id] {
+		if p.Version == version {
+			return p
+		}
+	}
+	return nil
+}
+
+// renderPrompt fills in the active version of prompt id and describes the
+// run for provenance.
+func renderPrompt(id string, data any, opts CompletionOptions) (string, storage.PromptRun, error) {
+	p := prompts.active[id]
+	if p == nil {
+		return "", storage.PromptRun{}, fmt.Errorf("no prompt %q loaded", id)
+	}
+	var sb strings.Builder
+	if err := p.tmpl.Execute(&sb, data); err != nil {
+		return "", storage.PromptRun{}, fmt.Errorf("prompt %s v%d: %w", id, p.Version, err)
+	}
+	provider, model := describeLLM()
+	return sb.String(), storage.PromptRun{
+		PromptID: p.ID, PromptVersion: p.Version, PromptHash: p.Hash,
+		Provider: provider, Model: model, MaxTokens: opts.MaxTokens,
+	}, nil
+}
+
+// mergePromptRuns appends the runs in more that aren't already in runs.
+// Windowed analysis repeats the same prompt once per window.
+func mergePromptRuns(runs []storage.PromptRun, more ...storage.PromptRun) []storage.PromptRun {
+	for _, r := range more {
+		seen := false
+		for _, have := range runs {
+			if have == r {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			runs = append(runs, r)
+		}
+	}
+	return runs
+}
+
+// knownPromptRuns keeps client-reported runs (from a diarize or sample
+// response) that name a loaded prompt version with a matching hash.
+func knownPromptRuns(runs []storage.PromptRun) []storage.PromptRun {
+	var out []storage.PromptRun
+	for _, r := range runs {
+		if p := prompts.lookup(r.PromptID, r.PromptVersion); p != nil && p.Hash == r.PromptHash {
+			r.CreatedAt = nil
+			out = mergePromptRuns(out, r)
+		}
+	}
+	return out
+}
+
+func savePromptRuns(tid int64, runs []storage.PromptRun) {
+	if store == nil || tid == 0 || len(runs) == 0 {
+		return
+	}
+	if err := store.SavePromptRuns(tid, runs); err != nil {
+		log.Printf("save prompt runs for %d: %v", tid, err)
+	}
+}
+
+// transcriptPromptRuns is the provenance listed in a transcript's detail.
+func transcriptPromptRuns(tid int64) []storage.PromptRun {
+	runs, err := store.GetPromptRuns(tid)
+	if err != nil {
+		return []storage.PromptRun{}
+	}
+	return runs
+}
+
+// GET /api/prompts lists every loaded prompt version and which are active.
+func handleAPIPrompts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list := []*promptTemplate{}
+	ids := make([]string, 0, len(prompts.byID))
+	for id := range prompts.byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		list = append(list, prompts.byID[id]...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// writePromptDir writes a minimal template for every required prompt plus
+// the given extra files.
+func writePromptDir(t *testing.T, extra map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{}
+	for _, id := range requiredPrompts {
+		files[id+".v1.tmpl"] = id + " v1: {{.}}\n"
+	}
+	for name, text := range extra {
+		files[name] = text
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadPrompts(t *testing.T) {
+	dir := writePromptDir(t, map[string]string{
+		"diarize.v2.tmpl":  "diarize v2: {{.Transcript}}\n",
+		"diarize.v10.tmpl": "diarize v10: {{.Transcript}}\n",
+		"notes.txt":        "not a prompt",
+	})
+
+	lib, err := loadPrompts(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lib.active[promptDiarize]; got.Version != 10 || !got.Active || lib.lookup(promptDiarize, 2).Active {
+		t.Fatalf("active diarize = v%d, want the highest version", got.Version)
+	}
+
+	lib, err = loadPrompts(dir, "diarize=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lib.active[promptDiarize].Version; got != 2 {
+		t.Errorf("pinned diarize = v%d, want v2", got)
+	}
+
+	if _, err := loadPrompts(dir, "diarize=3"); err == nil {
+		t.Error("pinning a missing version should fail")
+	}
+	if _, err := loadPrompts(dir, "diarize"); err == nil {
+		t.Error("a malformed pin should fail")
+	}
+	os.Remove(filepath.Join(dir, promptGenerate+".v1.tmpl"))
+	if _, err := loadPrompts(dir, ""); err == nil || !strings.Contains(err.Error(), promptGenerate) {
+		t.Errorf("missing required prompt: err = %v", err)
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	prev := prompts
+	t.Cleanup(func() { prompts = prev })
+	var err error
+	prompts, err = loadPrompts(writePromptDir(t, map[string]string{"diarize.v2.tmpl": "Transcript:\n{{.Transcript}}\n"}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, run, err := renderPrompt(promptDiarize, struct{ Transcript string }{"A: hi"}, CompletionOptions{MaxTokens: 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Transcript:\nA: hi" {
+		t.Errorf("rendered %q", text)
+	}
+	want := storage.PromptRun{PromptID: promptDiarize, PromptVersion: 2, PromptHash: prompts.active[promptDiarize].Hash,
+		Provider: "fake", MaxTokens: 99}
+	if run != want {
+		t.Errorf("run = %+v, want %+v", run, want)
+	}
+
+	if _, _, err := renderPrompt(promptDiarize, struct{ Other string }{}, CompletionOptions{}); err == nil {
+		t.Error("a template field missing from the data should fail")
+	}
+}
+
+func TestAnalyzeRecordsPromptProvenance(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+
+	diarized, err := diarizeTranscript(t.Context(), "Ada: Go is simpler\nBen: Python is faster to write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diarized.Provenance) != 1 || diarized.Provenance[0].PromptID != promptDiarize {
+		t.Fatalf("diarize provenance = %+v", diarized.Provenance)
+	}
+	forged := diarized.Provenance[0]
+	forged.PromptHash = "000000000000"
+
+	body, _ := json.Marshal(map[string]any{
+		"transcript": "[1] (speaker_1) Ada: Go is simpler\n[2] (speaker_2) Ben: Python is faster to write",
+		"speakers":   diarized.Speakers,
+		"messages":   diarized.Messages,
+		"provenance": []storage.PromptRun{diarized.Provenance[0], forged},
+	})
+	req := httptest.NewRequest("POST", "/api/analyze", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("analyze: %d %s", w.Code, w.Body.String())
+	}
+	var analyzed analyzeResponse
+	json.Unmarshal(w.Body.Bytes(), &analyzed)
+
+	body, _ = json.Marshal(map[string]any{"new_text": "[3] (speaker_1) Ada: Deploys matter more", "slug": analyzed.Slug})
+	req = httptest.NewRequest("POST", "/api/analyze-incremental", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("incremental: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/transcripts/"+analyzed.Slug, nil))
+	var detail struct {
+		Provenance []storage.PromptRun `json:"provenance"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &detail)
+	var ids []string
+	for _, r := range detail.Provenance {
+		ids = append(ids, r.PromptID)
+		if r.Provider != "fake" || r.PromptVersion != 1 || r.MaxTokens != 4096 || r.CreatedAt == nil {
+			t.Errorf("unexpected run %+v", r)
+		}
+	}
+	if got := strings.Join(ids, ","); got != "diarize,extract-structure,extract-incremental" {
+		t.Errorf("provenance = %s, want diarize,extract-structure,extract-incremental", got)
+	}
+}
+
+func TestWindowedAnalysisProvenance(t *testing.T) {
+	prevLines := analyzeWindowLines
+	t.Cleanup(func() { analyzeWindowLines = prevLines })
+	analyzeWindowLines = 10
+
+	result, err := analyzeTranscript(t.Context(), longTranscript(25), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Provenance) != 2 || result.Provenance[0].PromptID != promptExtractStructure ||
+		result.Provenance[1].PromptID != promptExtractIncremental {
+		t.Errorf("windowed provenance = %+v, want one run per prompt", result.Provenance)
+	}
+}
+
+func TestPromptsAPI(t *testing.T) {
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", "/api/prompts", nil))
+	var list []promptTemplate
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	active := map[string]bool{}
+	for _, p := range list {
+		if p.Active {
+			active[p.ID] = true
+		}
+	}
+	for _, id := range requiredPrompts {
+		if !active[id] {
+			t.Errorf("%s has no active version in %+v", id, list)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// statementEmojis mirrors TYPE_EMOJIS in the frontend.
+var statementEmojis = map[string]string{
+	"claim":         "💬",
+	"response":      "↩️",
+	"question":      "❓",
+	"agreement":     "✅",
+	"rebuttal":      "⚔️",
+	"tangent":       "🌀",
+	"clarification": "🔍",
+	"evidence":      "📎",
+}
+
+// speakerStats summarizes one speaker's part in a conversation.
+type speakerStats struct {
+	SpeakerID  string         `json:"speaker_id"`
+	Name       string         `json:"name"`
+	Messages   int            `json:"messages"`
+	Words      int            `json:"words"`
+	SpeakingMs int64          `json:"speaking_ms"`
+	Statements int            `json:"statements"`
+	ByType     map[string]int `json:"by_type"`
+	FactChecks int            `json:"fact_checks"`
+	Fallacies  int            `json:"fallacies"`
+}
+
+type typeCount struct {
+	Type  string
+	Emoji string
+	Count int
+}
+
+// conversationSpeakerStats counts each speaker's utterances and statements.
+// Statements are attributed by their occurrence speaker, which is the
+// speaker id for conversations analyzed with diarization.
+func conversationSpeakerStats(speakers map[string]string, messages []storage.DiarizeMessage, statements []Statement) []speakerStats {
+	byID := map[string]*speakerStats{}
+	var order []string
+	get := func(id string) *speakerStats {
+		if s, ok := byID[id]; ok {
+			return s
+		}
+		name := speakers[id]
+		if name == "" {
+			name = id
+		}
+		s := &speakerStats{SpeakerID: id, Name: name, ByType: map[string]int{}}
+		byID[id] = s
+		order = append(order, id)
+		return s
+	}
+	ids := make([]string, 0, len(speakers))
+	for id := range speakers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		get(id)
+	}
+
+	for _, m := range messages {
+		s := get(m.Speaker)
+		s.Messages++
+		s.Words += len(strings.Fields(m.Text))
+		if m.StartMs != nil && m.EndMs != nil && *m.EndMs > *m.StartMs {
+			s.SpeakingMs += *m.EndMs - *m.StartMs
+		}
+	}
+	var walk func(stmts []Statement)
+	walk = func(stmts []Statement) {
+		for _, st := range stmts {
+			s := get(st.Speaker)
+			s.Statements++
+			s.ByType[st.Type]++
+			if st.FactCheck != nil {
+				s.FactChecks++
+			}
+			if st.Fallacy != nil {
+				s.Fallacies++
+			}
+			walk(st.Children)
+		}
+	}
+	walk(statements)
+
+	out := make([]speakerStats, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	return out
+}
+
+// reportStatement is a Statement prepared for templates/report.html.
+type reportStatement struct {
+	Emoji     string
+	Speaker   string
+	Type      string
+	Text      string
+	MsgIndex  *int
+	Time      string
+	FactCheck *FactCheck
+	Fallacy   *Fallacy
+	Children  []reportStatement
+}
+
+type reportFlag struct {
+	Speaker   string
+	Text      string
+	Time      string
+	FactCheck *FactCheck
+	Fallacy   *Fallacy
+}
+
+type reportSpeaker struct {
+	speakerStats
+	Speaking string
+	Types    []typeCount
+}
+
+type reportData struct {
+	Title      string
+	SourceURL  string
+	Speakers   []reportSpeaker
+	Statements []reportStatement
+	Flags      []reportFlag
+	Messages   int
+}
+
+func formatClock(ms int64) string {
+	s := ms / 1000
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func buildReport(t *storage.Transcript) reportData {
+	speakers, messages, _ := store.GetDiarization(t.ID)
+	statements := transcriptStatements(t.ID)
+
+	data := reportData{Title: t.Title, SourceURL: t.SourceURL, Messages: len(messages)}
+	if data.Title == "" {
+		data.Title = t.Slug
+	}
+	for _, st := range conversationSpeakerStats(speakers, messages, statements) {
+		rs := reportSpeaker{speakerStats: st}
+		if st.SpeakingMs > 0 {
+			rs.Speaking = formatClock(st.SpeakingMs)
+		}
+		for typ, n := range st.ByType {
+			rs.Types = append(rs.Types, typeCount{Type: typ, Emoji: statementEmojis[typ], Count: n})
+		}
+		sort.Slice(rs.Types, func(a, b int) bool {
+			if rs.Types[a].Count != rs.Types[b].Count {
+				return rs.Types[a].Count > rs.Types[b].Count
+			}
+			return rs.Types[a].Type < rs.Types[b].Type
+		})
+		data.Speakers = append(data.Speakers, rs)
+	}
+
+	speakerName := func(key string) string {
+		if name := speakers[key]; name != "" {
+			return name
+		}
+		return key
+	}
+	timeOf := func(msgIndex *int) string {
+		if msgIndex == nil || *msgIndex < 1 || *msgIndex > len(messages) || messages[*msgIndex-1].StartMs == nil {
+			return ""
+		}
+		return formatClock(*messages[*msgIndex-1].StartMs)
+	}
+	var convert func(stmts []Statement) []reportStatement
+	convert = func(stmts []Statement) []reportStatement {
+		var out []reportStatement
+		for _, s := range stmts {
+			rs := reportStatement{
+				Emoji:     statementEmojis[s.Type],
+				Speaker:   speakerName(s.Speaker),
+				Type:      s.Type,
+				Text:      s.Text,
+				MsgIndex:  s.MsgIndex,
+				Time:      timeOf(s.MsgIndex),
+				FactCheck: s.FactCheck,
+				Fallacy:   s.Fallacy,
+				Children:  convert(s.Children),
+			}
+			if s.FactCheck != nil || s.Fallacy != nil {
+				data.Flags = append(data.Flags, reportFlag{Speaker: rs.Speaker, Text: s.Text, Time: rs.Time, FactCheck: s.FactCheck, Fallacy: s.Fallacy})
+			}
+			out = append(out, rs)
+		}
+		return out
+	}
+	data.Statements = convert(statements)
+	return data
+}
+
+// GET /convo/{slug}/report — a self-contained, print-friendly summary.
+func handleReport(w http.ResponseWriter, r *http.Request, slug string) {
+	t, err := store.GetTranscriptBySlug(slug)
+	if err != nil || !canView(requestUser(r), transcriptAccess(t.ID)) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, "report.html", buildReport(t)); err != nil {
+		log.Printf("report %s: %v", slug, err)
+	}
+}
+
+// handleConvo serves /convo/{slug}/report and leaves every other
+// conversation URL to the SPA.
+func handleConvo(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/argraphments")
+	rest := strings.TrimPrefix(path, "/convo/")
+	if slug, ok := strings.CutSuffix(rest, "/report"); ok && slug != "" && !strings.Contains(slug, "/") {
+		handleReport(w, r, slug)
+		return
+	}
+	handleIndex(w, r)
+}
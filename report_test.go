@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func TestConversationSpeakerStats(t *testing.T) {
+	ms := func(n int64) *int64 { return &n }
+	stats := conversationSpeakerStats(
+		map[string]string{"speaker_1": "Ada", "speaker_2": ""},
+		[]storage.DiarizeMessage{
+			{Speaker: "speaker_1", Text: "Go is simpler to deploy", StartMs: ms(0), EndMs: ms(2000)},
+			{Speaker: "speaker_2", Text: "Not really"},
+			{Speaker: "speaker_1", Text: "It is", StartMs: ms(3000), EndMs: ms(3500)},
+		},
+		[]Statement{{Speaker: "speaker_1", Type: "claim", Children: []Statement{
+			{Speaker: "speaker_2", Type: "rebuttal", Fallacy: &Fallacy{Name: "Appeal to ignorance"}},
+		}}},
+	)
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 speakers, got %+v", stats)
+	}
+	ada, other := stats[0], stats[1]
+	if ada.Name != "Ada" || ada.Messages != 2 || ada.Words != 7 || ada.SpeakingMs != 2500 || ada.ByType["claim"] != 1 {
+		t.Fatalf("unexpected stats for Ada: %+v", ada)
+	}
+	if other.Name != "speaker_2" || other.Statements != 1 || other.Fallacies != 1 || other.SpeakingMs != 0 {
+		t.Fatalf("unexpected stats for speaker_2: %+v", other)
+	}
+}
+
+func TestConversationReport(t *testing.T) {
+	setupTestStore(t)
+	ms := func(n int64) *int64 { return &n }
+	tid, _ := store.SaveTranscript("", "")
+	store.UpdateTitle(tid, "Go vs <Python>")
+	persistStatements("", []Statement{
+		{Speaker: "speaker_1", Text: "Go is simpler to deploy", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_2", Text: "Python is always faster", Type: "rebuttal", MsgIndex: intp(2),
+				FactCheck: &FactCheck{Verdict: "false", Correction: "It depends on the workload"}},
+		}},
+	}, map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}, []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "Go is simpler to deploy", StartMs: ms(0), EndMs: ms(2000)},
+		{Speaker: "speaker_2", Text: "Python is always faster", StartMs: ms(65000), EndMs: ms(67000)},
+	}, nil, tid)
+	tr, _ := store.GetTranscript(tid)
+
+	mux := setupMux()
+	for _, path := range []string{"/convo/" + tr.Slug + "/report", "/argraphments/convo/" + tr.Slug + "/report"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Header().Get("Content-Type"))
+		}
+		body := w.Body.String()
+		for _, want := range []string{
+			"<h1>Go vs &lt;Python&gt;</h1>",
+			"<td>Ben</td>",
+			"⚔️ <span class=\"who\">Ben</span> <span class=\"type\">rebuttal</span><span class=\"when\">1:05</span>",
+			"<strong>false</strong> — It depends on the workload",
+			"Flagged statements",
+		} {
+			if !strings.Contains(body, want) {
+				t.Fatalf("%s: missing %q", path, want)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/convo/no-such-convo/report", nil))
+	if w.Code != 404 {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Revision sources: corrections from a full-review incremental pass, and
+// reverts of those.
+const (
+	revisionSourceReview = "review"
+	revisionSourceRevert = "revert"
+)
+
+var (
+	errRevisionNotFound = errors.New("revision not found")
+	errRevisionConflict = errors.New("statement has changed since this revision")
+	errRevisionReverted = storage.ErrRevisionReverted
+)
+
+// applyStatementUpdates applies review corrections to the first statement
+// with each update's msg_index, or to the statement with its claimID when
+// set, and returns the tree with one revision per field actually changed. A parent_text moves that statement, with its
+// children, under the matching statement; an empty one moves it to the top
+// level. Updates whose statement or parent can't be found change nothing
+// structurally.
+func applyStatementUpdates(tree []Statement, updates []StatementUpdate) ([]Statement, []storage.Revision) {
+	var revisions []storage.Revision
+	for _, u := range updates {
+		var s *Statement
+		if u.claimID != 0 {
+			s = findStatementByClaimID(tree, u.claimID)
+		} else {
+			s = findStatementByMsgIndex(tree, u.MsgIndex)
+		}
+		if s == nil {
+			continue
+		}
+		claimID := s.claimID
+		record := func(field, oldValue, newValue string) {
+			revisions = append(revisions, storage.Revision{MsgIndex: u.MsgIndex, ClaimID: claimID, Field: field, OldValue: oldValue, NewValue: newValue})
+		}
+		if u.Text != nil && *u.Text != "" && *u.Text != s.Text {
+			record(storage.RevisionText, s.Text, *u.Text)
+			s.Text, s.canonicalID = *u.Text, u.canonicalID
+		}
+		if u.Type != nil && *u.Type != "" && *u.Type != s.Type {
+			record(storage.RevisionType, s.Type, *u.Type)
+			s.Type = *u.Type
+		}
+		if u.ParentText == nil {
+			continue
+		}
+
+		oldParent := ""
+		if p := findParentStatement(tree, s); p != nil {
+			oldParent = p.Text
+		}
+		if *u.ParentText == oldParent {
+			continue
+		}
+		if *u.ParentText != "" {
+			// Refuse to nest a statement under itself or its own subtree
+			if target := findStatementByText([]Statement{*s}, *u.ParentText); target != nil {
+				continue
+			}
+			if findStatementByText(tree, *u.ParentText) == nil {
+				continue
+			}
+		}
+		record(storage.RevisionParent, oldParent, *u.ParentText)
+		var moved Statement
+		tree, moved, _ = removeStatement(tree, s)
+		if *u.ParentText == "" {
+			tree = append(tree, moved)
+		} else {
+			parent := findStatementByText(tree, *u.ParentText)
+			parent.Children = append(parent.Children, moved)
+		}
+	}
+	return tree, revisions
+}
+
+// revisionUpdates turns applied revisions back into one StatementUpdate
+// each, in order, for live viewers.
+func revisionUpdates(revisions []storage.Revision) []StatementUpdate {
+	var updates []StatementUpdate
+	for _, r := range revisions {
+		u := StatementUpdate{MsgIndex: r.MsgIndex}
+		value := r.NewValue
+		switch r.Field {
+		case storage.RevisionText:
+			u.Text = &value
+		case storage.RevisionType:
+			u.Type = &value
+		case storage.RevisionParent:
+			u.ParentText = &value
+		}
+		updates = append(updates, u)
+	}
+	return updates
+}
+
+// findParentStatement returns the statement whose children hold target, or
+// nil when target is top-level.
+func findParentStatement(stmts []Statement, target *Statement) *Statement {
+	for i := range stmts {
+		for j := range stmts[i].Children {
+			if &stmts[i].Children[j] == target {
+				return &stmts[i]
+			}
+		}
+		if p := findParentStatement(stmts[i].Children, target); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// stampRevisions sets the transcript, source and reverted revision on
+// revisions about to be logged.
+func stampRevisions(tid int64, source string, revertsID *int64, revisions []storage.Revision) []storage.Revision {
+	for i := range revisions {
+		revisions[i].TranscriptID = tid
+		revisions[i].Source = source
+		revisions[i].RevertsID = revertsID
+	}
+	return revisions
+}
+
+// revertRevision restores a revision's old value, provided the statement
+// still holds the value the revision set. Only that statement is rewritten,
+// in place, and the revert is itself logged.
+func revertRevision(tid, id int64) ([]Statement, error) {
+	// A restored text is matched to its canonical claim before locking,
+	// since matching may ask the LLM.
+	var canonicalID int64
+	if rev, err := store.GetRevision(id); err == nil && rev.TranscriptID == tid && rev.Field == storage.RevisionText && rev.OldValue != "" {
+		if cid, err := canonicalizeClaim(rev.OldValue); err == nil {
+			canonicalID = cid
+		}
+	}
+
+	unlock := lockTranscript(tid)
+	defer unlock()
+
+	rev, err := store.GetRevision(id)
+	if err != nil || rev.TranscriptID != tid {
+		return nil, errRevisionNotFound
+	}
+	if rev.RevertedAt != nil {
+		return nil, errRevisionReverted
+	}
+	tree := transcriptStatements(tid)
+	stored := storedPlacements(tree, 0, map[int64]claimPlacement{})
+	// Revisions from before claim ids were recorded fall back to msg_index
+	var s *Statement
+	if rev.ClaimID != 0 {
+		s = findStatementByClaimID(tree, rev.ClaimID)
+	} else {
+		s = findStatementByMsgIndex(tree, rev.MsgIndex)
+	}
+	if s == nil {
+		return nil, errRevisionConflict
+	}
+
+	oldValue := rev.OldValue
+	u := StatementUpdate{MsgIndex: rev.MsgIndex, canonicalID: canonicalID, claimID: s.claimID}
+	var current string
+	switch rev.Field {
+	case storage.RevisionText:
+		current, u.Text = s.Text, &oldValue
+	case storage.RevisionType:
+		current, u.Type = s.Type, &oldValue
+	case storage.RevisionParent:
+		if p := findParentStatement(tree, s); p != nil {
+			current = p.Text
+		}
+		u.ParentText = &oldValue
+	}
+	if current != rev.NewValue {
+		return nil, errRevisionConflict
+	}
+
+	tree, applied := applyStatementUpdates(tree, []StatementUpdate{u})
+	if len(applied) == 0 {
+		// e.g. the old parent is gone
+		return nil, errRevisionConflict
+	}
+	edits, added := claimTreeChanges(tid, tree, stored)
+	if _, err := store.ApplyClaimTreeChanges(tid, edits, added, stampRevisions(tid, revisionSourceRevert, &rev.ID, applied)); err != nil {
+		return nil, fmt.Errorf("revert revision %d: %w", rev.ID, err)
+	}
+	publishUpdates(tid, revisionUpdates(applied))
+	return transcriptStatements(tid), nil
+}
+
+// GET /api/transcripts/{slug}/revisions
+// POST /api/transcripts/{slug}/revisions/{id}/revert
+func handleRevisions(w http.ResponseWriter, r *http.Request, t *storage.Transcript, rest string) {
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		revisions, err := store.GetRevisions(t.ID)
+		if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		json.NewEncoder(w).Encode(revisions)
+		return
+	}
+
+	idStr, ok := strings.CutSuffix(rest, "/revert")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if !ok || err != nil {
+		jsonError(w, "not found", 404)
+		return
+	}
+	if r.Method != http.MethodPost {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	statements, err := revertRevision(t.ID, id)
+	if errors.Is(err, errRevisionNotFound) {
+		jsonError(w, err.Error(), 404)
+		return
+	}
+	if errors.Is(err, errRevisionConflict) || errors.Is(err, errRevisionReverted) {
+		jsonError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("handleRevisions: %v", err)
+		jsonError(w, "db error", 500)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"statements": statements})
+}
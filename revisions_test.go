@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func strp(s string) *string { return &s }
+
+func TestApplyStatementUpdates(t *testing.T) {
+	tree := []Statement{
+		{Text: "Go is simpler", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Text: "Python has libraries", Type: "response", MsgIndex: intp(2), Children: []Statement{
+				{Text: "Go has enough", Type: "response", MsgIndex: intp(3)},
+			}},
+		}},
+		{Text: "Deploys matter", Type: "claim", MsgIndex: intp(4)},
+	}
+
+	tree, revisions := applyStatementUpdates(tree, []StatementUpdate{
+		{MsgIndex: 1, Text: strp("Go is simpler to deploy")},
+		{MsgIndex: 2, Type: strp("rebuttal")},
+		// Move msg 2 (with its child) under msg 4
+		{MsgIndex: 2, ParentText: strp("Deploys matter")},
+		// Nesting msg 4 under its own descendant is refused
+		{MsgIndex: 4, ParentText: strp("Go has enough")},
+		// Unknown parent changes nothing
+		{MsgIndex: 3, ParentText: strp("No such statement")},
+	})
+
+	want := []storage.Revision{
+		{MsgIndex: 1, Field: storage.RevisionText, OldValue: "Go is simpler", NewValue: "Go is simpler to deploy"},
+		{MsgIndex: 2, Field: storage.RevisionType, OldValue: "response", NewValue: "rebuttal"},
+		{MsgIndex: 2, Field: storage.RevisionParent, OldValue: "Go is simpler to deploy", NewValue: "Deploys matter"},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("expected %d revisions, got %+v", len(want), revisions)
+	}
+	for i := range want {
+		if revisions[i] != want[i] {
+			t.Fatalf("revision %d: got %+v, want %+v", i, revisions[i], want[i])
+		}
+	}
+	if len(tree) != 2 || tree[0].Text != "Go is simpler to deploy" || len(tree[0].Children) != 0 {
+		t.Fatalf("unexpected first root: %+v", tree[0])
+	}
+	moved := tree[1].Children
+	if len(moved) != 1 || moved[0].Type != "rebuttal" || len(moved[0].Children) != 1 {
+		t.Fatalf("msg 2 not re-nested with its children: %+v", tree[1])
+	}
+
+	// An empty parent_text promotes to the top level
+	tree, _ = applyStatementUpdates(tree, []StatementUpdate{{MsgIndex: 3, ParentText: strp("")}})
+	if len(tree) != 3 || tree[2].Text != "Go has enough" || len(tree[1].Children[0].Children) != 0 {
+		t.Fatalf("msg 3 not promoted: %+v", tree)
+	}
+}
+
+func TestRevertRevision(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+
+	tid, _ := store.SaveTranscript("", "")
+	tr, _ := store.GetTranscript(tid)
+	persistStatements("", []Statement{
+		{Text: "Go is simpler to deploy", Type: "claim", MsgIndex: intp(1)},
+		{Text: "Python has more libraries", Type: "response", MsgIndex: intp(2)},
+	}, nil, nil, nil, tid)
+	persistIncremental(tid, &IncrementalResult{Updates: []StatementUpdate{
+		{MsgIndex: 2, Type: strp("rebuttal"), ParentText: strp("Go is simpler to deploy")},
+	}})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, "/api/transcripts/"+tr.Slug+path, nil))
+		return w
+	}
+
+	var revisions []storage.Revision
+	json.Unmarshal(do("GET", "/revisions").Body.Bytes(), &revisions)
+	if len(revisions) != 2 || revisions[0].Field != storage.RevisionType || revisions[0].Source != revisionSourceReview {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+
+	// Undo the re-nesting; the retype stays. The statement is rewritten in
+	// place, keeping its claim.
+	before, _ := store.GetClaimTree(tid)
+	parentRev := revisions[1]
+	w := do("POST", "/revisions/"+fmt.Sprint(parentRev.ID)+"/revert")
+	if w.Code != 200 {
+		t.Fatalf("revert: %d %s", w.Code, w.Body.String())
+	}
+	tree := transcriptStatements(tid)
+	if len(tree) != 2 || len(tree[0].Children) != 0 || tree[1].Type != "rebuttal" {
+		t.Fatalf("unexpected tree after revert: %+v", tree)
+	}
+	after, _ := store.GetClaimTree(tid)
+	if len(after) != 2 || len(before) != 1 || after[0].ClaimID != before[0].ClaimID || after[1].ClaimID != before[0].Children[0].ClaimID {
+		t.Fatalf("revert replaced claims: %+v, was %+v", after, before)
+	}
+
+	if w := do("POST", "/revisions/"+fmt.Sprint(parentRev.ID)+"/revert"); w.Code != 409 {
+		t.Fatalf("second revert: expected 409, got %d", w.Code)
+	}
+	if w := do("POST", "/revisions/999/revert"); w.Code != 404 {
+		t.Fatalf("unknown revision: expected 404, got %d", w.Code)
+	}
+
+	json.Unmarshal(do("GET", "/revisions").Body.Bytes(), &revisions)
+	if len(revisions) != 3 || revisions[1].RevertedAt == nil || revisions[2].Source != revisionSourceRevert ||
+		revisions[2].RevertsID == nil || *revisions[2].RevertsID != parentRev.ID {
+		t.Fatalf("revert not logged: %+v", revisions)
+	}
+}
+
+func TestClaimTreeChangesLogRevisionsAtomically(t *testing.T) {
+	setupTestStore(t)
+	tid, _ := store.SaveTranscript("", "")
+	persistStatements("", []Statement{{Text: "Go is simpler to deploy", Type: "claim", MsgIndex: intp(1)}}, nil, nil, nil, tid)
+	persistIncremental(tid, &IncrementalResult{Updates: []StatementUpdate{{MsgIndex: 1, Type: strp("response")}}})
+	revisions, _ := store.GetRevisions(tid)
+	if len(revisions) != 1 {
+		t.Fatalf("review not logged: %+v", revisions)
+	}
+	tree, _ := store.GetClaimTree(tid)
+	revert := func(text string) error {
+		_, err := store.ApplyClaimTreeChanges(tid, []storage.ClaimEdit{{ClaimID: tree[0].ClaimID, Text: text, Type: "claim"}}, nil,
+			[]storage.Revision{{TranscriptID: tid, MsgIndex: 1, Field: storage.RevisionType, OldValue: "response", NewValue: "claim",
+				Source: revisionSourceRevert, RevertsID: &revisions[0].ID}})
+		return err
+	}
+	if err := revert("Go is simpler to deploy"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second revert of the same revision rolls back its tree edit too
+	if err := revert("Go deploys as one binary"); !errors.Is(err, storage.ErrRevisionReverted) {
+		t.Fatalf("second revert: %v", err)
+	}
+	if tree, _ := store.GetClaimTree(tid); tree[0].Text != "Go is simpler to deploy" {
+		t.Fatalf("rejected revert changed the tree: %+v", tree)
+	}
+	if revisions, _ := store.GetRevisions(tid); len(revisions) != 2 || revisions[0].RevertedAt == nil {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+}
+
+func TestRevertRevisionFindsStatementByClaim(t *testing.T) {
+	setupTestStore(t)
+	tid, _ := store.SaveTranscript("", "")
+	tr, _ := store.GetTranscript(tid)
+	// One message made two statements; moving the first leaves the second
+	// as msg 1's first match
+	persistStatements("", []Statement{
+		{Text: "Go is simpler to deploy", Type: "claim", MsgIndex: intp(1)},
+		{Text: "Go compiles faster", Type: "claim", MsgIndex: intp(1)},
+		{Text: "Python has more libraries", Type: "claim", MsgIndex: intp(2)},
+	}, nil, nil, nil, tid)
+	persistIncremental(tid, &IncrementalResult{Updates: []StatementUpdate{
+		{MsgIndex: 1, ParentText: strp("Python has more libraries")},
+	}})
+	revisions, _ := store.GetRevisions(tid)
+	if len(revisions) != 1 || revisions[0].ClaimID == 0 {
+		t.Fatalf("revision without its claim: %+v", revisions)
+	}
+
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/api/transcripts/%s/revisions/%d/revert", tr.Slug, revisions[0].ID), nil))
+	if w.Code != 200 {
+		t.Fatalf("revert: %d %s", w.Code, w.Body.String())
+	}
+	tree := transcriptStatements(tid)
+	if len(tree) != 3 || len(tree[0].Children)+len(tree[1].Children)+len(tree[2].Children) != 0 {
+		t.Fatalf("unexpected tree after revert: %+v", tree)
+	}
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"math/rand"
 	"net/http"
 	"strings"
@@ -35,81 +34,25 @@ var sampleYouTubeURLs = []string{
 	"https://www.youtube.com/watch?v=yOjSMKMXpCA",
 }
 
-func generateConversation(title string) (map[string]string, []storage.DiarizeMessage, error) {
-	prompt := fmt.Sprintf(`Generate a realistic 10-14 message debate conversation between exactly two people about this topic: "%s"
-
-Rules:
-- Two speakers with short first names (different from each other)
-- They should disagree but engage thoughtfully
-- Include claims, rebuttals, evidence, and at least one point of agreement
-- Keep each message 1-3 sentences
-- Make it feel natural, not scripted
-
-Return JSON:
-{
-  "speakers": {"speaker_1": "Name1", "speaker_2": "Name2"},
-  "messages": [
-    {"speaker": "speaker_1", "text": "what they said"},
-    {"speaker": "speaker_2", "text": "what they said"}
-  ]
-}
-
-Return ONLY valid JSON, no markdown fences.`, title)
-
-	reqBody, _ := json.Marshal(map[string]any{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 2048,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	})
-
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(reqBody))
-	if err != nil {
-		return nil, nil, err
-	}
-	req.Header.Set("x-api-key", anthropicKey)
-	req.Header.Set("content-type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := http.DefaultClient.Do(req)
+func generateConversation(ctx context.Context, title string) (map[string]string, []storage.DiarizeMessage, storage.PromptRun, error) {
+	opts := CompletionOptions{MaxTokens: 2048}
+	prompt, run, err := renderPrompt(promptGenerate, struct{ Topic string }{title}, opts)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, storage.PromptRun{}, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("claude API %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, nil, err
-	}
-	if len(result.Content) == 0 {
-		return nil, nil, fmt.Errorf("empty response")
-	}
-
-	text := strings.TrimSpace(result.Content[0].Text)
-	text = strings.TrimPrefix(text, "```json")
-	text = strings.TrimPrefix(text, "```")
-	text = strings.TrimSuffix(text, "```")
-	text = strings.TrimSpace(text)
 
 	var convo struct {
 		Speakers map[string]string        `json:"speakers"`
 		Messages []storage.DiarizeMessage `json:"messages"`
 	}
-	if err := json.Unmarshal([]byte(text), &convo); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse conversation: %v", err)
+	_, err = completeJSON(ctx, prompt, opts, func(text string) ([]string, error) {
+		return nil, json.Unmarshal([]byte(text), &convo)
+	})
+	if err != nil {
+		return nil, nil, storage.PromptRun{}, err
 	}
 
-	return convo.Speakers, convo.Messages, nil
+	return convo.Speakers, convo.Messages, run, nil
 }
 
 func handleAPISample(w http.ResponseWriter, r *http.Request) {
@@ -122,13 +65,17 @@ func handleAPISample(w http.ResponseWriter, r *http.Request) {
 	url := sampleYouTubeURLs[rand.Intn(len(sampleYouTubeURLs))]
 
 	// Try to fetch title from YouTube
-	_, title, _, err := fetchYouTubeTranscript(url)
+	_, title, _, err := fetchYouTube(url)
 	if err != nil || title == "" {
 		title = "an interesting debate topic"
 	}
 
 	// Generate a fake conversation about the topic
-	speakers, messages, err := generateConversation(title)
+	ctx := r.Context()
+	if r.URL.Query().Get("no_cache") != "" {
+		ctx = withoutLLMCache(ctx)
+	}
+	speakers, messages, run, err := generateConversation(ctx, title)
 	if err != nil {
 		jsonError(w, fmt.Sprintf("generation failed: %v", err), 500)
 		return
@@ -166,10 +113,11 @@ func handleAPISample(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"speakers": speakers,
-		"messages": messages,
-		"text":     sb.String(),
-		"title":    title,
-		"url":      url,
+		"speakers":   speakers,
+		"messages":   messages,
+		"text":       sb.String(),
+		"title":      title,
+		"url":        url,
+		"provenance": []storage.PromptRun{run},
 	})
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// The search index is kept in step with the core tables at each place a
+// diarization, argument tree or title is saved. Index errors are logged and
+// never fail the write they follow.
+
+func indexTranscriptSearch(tid int64) {
+	t, err := store.GetTranscript(tid)
+	if err != nil {
+		log.Printf("search index %d: %v", tid, err)
+		return
+	}
+	if err := store.IndexTranscript(t.ID, t.Slug, t.Title, t.CreatedAt); err != nil {
+		log.Printf("search index %d: %v", tid, err)
+	}
+}
+
+func indexUtterancesSearch(tid int64, speakers map[string]string, messages []storage.DiarizeMessage) {
+	indexTranscriptSearch(tid)
+	if err := store.IndexUtterances(tid, speakers, messages); err != nil {
+		log.Printf("search index %d: utterances: %v", tid, err)
+	}
+}
+
+// indexClaimsSearch fills in speaker names and start times from the
+// transcript's diarization before indexing.
+func indexClaimsSearch(tid int64, claims []storage.IndexedClaim) {
+	speakers, messages, _ := store.GetDiarization(tid)
+	for i := range claims {
+		resolveIndexedClaim(&claims[i], speakers, messages)
+	}
+	indexTranscriptSearch(tid)
+	if err := store.IndexClaims(tid, claims); err != nil {
+		log.Printf("search index %d: claims: %v", tid, err)
+	}
+}
+
+func resolveIndexedClaim(c *storage.IndexedClaim, speakers map[string]string, messages []storage.DiarizeMessage) {
+	c.Speaker = c.SpeakerID
+	if name := speakers[c.SpeakerID]; name != "" {
+		c.Speaker = name
+	}
+	if c.MsgIndex != nil && *c.MsgIndex >= 1 && *c.MsgIndex <= len(messages) {
+		c.StartMs = messages[*c.MsgIndex-1].StartMs
+	}
+}
+
+// backfillSearchIndex indexes conversations saved before the index existed.
+// Their claim hits carry no claim id until the conversation is re-analyzed.
+func backfillSearchIndex() {
+	indexed, err := store.SearchIndexed()
+	if err != nil {
+		log.Printf("search backfill: %v", err)
+		return
+	}
+	transcripts, err := store.ListTranscripts()
+	if err != nil {
+		log.Printf("search backfill: %v", err)
+		return
+	}
+	n := 0
+	for _, t := range transcripts {
+		if indexed[t.ID] {
+			continue
+		}
+		speakers, messages, _ := store.GetDiarization(t.ID)
+		indexUtterancesSearch(t.ID, speakers, messages)
+		var claims []storage.IndexedClaim
+		var walk func(stmts []Statement)
+		walk = func(stmts []Statement) {
+			for _, s := range stmts {
+				claims = append(claims, storage.IndexedClaim{SpeakerID: s.Speaker, MsgIndex: s.MsgIndex, Text: s.Text, Type: s.Type})
+				walk(s.Children)
+			}
+		}
+		walk(transcriptStatements(t.ID))
+		indexClaimsSearch(t.ID, claims)
+		n++
+	}
+	if n > 0 {
+		log.Printf("search backfill: indexed %d conversations", n)
+	}
+}
+
+// parseSearchDate accepts YYYY-MM-DD or RFC 3339. A bare date used as an
+// upper bound includes that whole day.
+func parseSearchDate(s string, upper bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// GET /api/search?q=&speaker=&kind=&type=&from=&to=&limit=&offset=
+//
+// kind is utterance, claim or title; type is a statement type and so
+// restricts hits to claims.
+func handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	q := storage.SearchQuery{
+		Text:    strings.TrimSpace(query.Get("q")),
+		Speaker: query.Get("speaker"),
+		Kind:    query.Get("kind"),
+		Type:    query.Get("type"),
+	}
+	if q.Text == "" {
+		jsonError(w, "q is required", 400)
+		return
+	}
+	switch q.Kind {
+	case "", storage.SearchUtterance, storage.SearchClaim, storage.SearchTitle:
+	default:
+		jsonError(w, "kind must be utterance, claim or title", 400)
+		return
+	}
+	var err error
+	if v := query.Get("from"); v != "" {
+		if q.From, err = parseSearchDate(v, false); err != nil {
+			jsonError(w, "invalid from date", 400)
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if q.To, err = parseSearchDate(v, true); err != nil {
+			jsonError(w, "invalid to date", 400)
+			return
+		}
+	}
+	q.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 20
+	}
+	if q.Offset, _ = strconv.Atoi(query.Get("offset")); q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	q.Exclude = idList(hiddenTranscripts(requestUser(r)))
+
+	hits, err := store.Search(q)
+	if err != nil {
+		log.Printf("search %q: %v", q.Text, err)
+		jsonError(w, "search failed", 500)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"query": q.Text, "hits": hits})
+}
+
+// reindexSpeakerConversations refreshes speaker names in the index after a
+// global rename.
+func reindexSpeakerConversations(name string) {
+	convos, err := store.GetSpeakerConversations(name)
+	if err != nil {
+		return
+	}
+	for _, c := range convos {
+		t, err := store.GetTranscriptBySlug(c.Slug)
+		if err != nil {
+			continue
+		}
+		speakers, messages, _ := store.GetDiarization(t.ID)
+		indexUtterancesSearch(t.ID, speakers, messages)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func setupSearchSession(t *testing.T) string {
+	t.Helper()
+	setupTestStore(t)
+	start := func(ms int64) *int64 { return &ms }
+	tid, _ := store.SaveTranscript("", "")
+	persistStatements("", []Statement{
+		{Speaker: "speaker_1", Text: "Nuclear energy is the safest power source", Type: "claim", MsgIndex: intp(1), Children: []Statement{
+			{Speaker: "speaker_2", Text: "Waste storage remains unsolved", Type: "rebuttal", MsgIndex: intp(2)},
+		}},
+	}, map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"}, []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "Honestly, nuclear energy is the safest power source we have.", StartMs: start(0)},
+		{Speaker: "speaker_2", Text: "Sure, but the waste storage problem remains unsolved.", StartMs: start(4200)},
+	}, nil, tid)
+	store.UpdateTitle(tid, "Nuclear power debate")
+	indexTranscriptSearch(tid)
+	tr, _ := store.GetTranscript(tid)
+	return tr.Slug
+}
+
+func search(t *testing.T, query string) []storage.SearchHit {
+	t.Helper()
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", "/api/search?"+query, nil))
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Hits []storage.SearchHit `json:"hits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Hits
+}
+
+func TestSearchFindsUtterancesClaimsAndTitles(t *testing.T) {
+	slug := setupSearchSession(t)
+
+	hits := search(t, "q=nuclear")
+	kinds := map[string]bool{}
+	for _, h := range hits {
+		kinds[h.Kind] = true
+		if h.Slug != slug {
+			t.Fatalf("hit without slug: %+v", h)
+		}
+	}
+	if !kinds["utterance"] || !kinds["claim"] || !kinds["title"] {
+		t.Fatalf("want utterance, claim and title hits, got %+v", hits)
+	}
+
+	hits = search(t, "q=wast&kind=utterance")
+	if len(hits) != 1 {
+		t.Fatalf("want 1 prefix hit, got %+v", hits)
+	}
+	h := hits[0]
+	if h.Speaker != "Ben" || h.MsgIndex == nil || *h.MsgIndex != 2 || h.StartMs == nil || *h.StartMs != 4200 {
+		t.Fatalf("unexpected hit: %+v", h)
+	}
+	if !strings.Contains(h.Snippet, "<mark>waste</mark>") {
+		t.Fatalf("snippet %q", h.Snippet)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	setupSearchSession(t)
+
+	if hits := search(t, "q=unsolved&type=rebuttal"); len(hits) != 1 || hits[0].Kind != "claim" || hits[0].ClaimID == nil {
+		t.Fatalf("type filter: %+v", hits)
+	}
+	if hits := search(t, "q=unsolved&speaker=ada"); len(hits) != 0 {
+		t.Fatalf("speaker filter: %+v", hits)
+	}
+	if hits := search(t, "q=safest&speaker=ada"); len(hits) != 2 {
+		t.Fatalf("speaker filter: %+v", hits)
+	}
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	if hits := search(t, "q=safest&from="+tomorrow); len(hits) != 0 {
+		t.Fatalf("date filter: %+v", hits)
+	}
+	if hits := search(t, "q="+url.QueryEscape(`"safest (`)); len(hits) != 2 {
+		t.Fatalf("query syntax should be treated as text: %+v", hits)
+	}
+}
+
+func TestSearchTracksSpeakerRenames(t *testing.T) {
+	slug := setupSearchSession(t)
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("PUT", "/api/transcripts/"+slug+"/speakers",
+		strings.NewReader(`{"speakers":{"speaker_1":"Ada","speaker_2":"Bea"}}`)))
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if hits := search(t, "q=unsolved&speaker=bea"); len(hits) != 2 {
+		t.Fatalf("want renamed speaker on utterance and claim, got %+v", hits)
+	}
+}
+
+func TestSearchRequiresQuery(t *testing.T) {
+	setupTestStore(t)
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, httptest.NewRequest("GET", "/api/search?q=+", nil))
+	if w.Code != 400 {
+		t.Fatalf("status %d", w.Code)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Speakers are global rows matched by name, so the same person can end up
+// under two spellings and two people can share one. Merge folds one speaker
+// into another, split moves chosen transcript appearances to a different
+// speaker, and aliases catch known spellings before a transcript's
+// speakers are saved.
+
+// resolveSpeakerAliases maps names that are aliases to the speaker they
+// belong to. A speaker's own name always wins over an alias.
+func resolveSpeakerAliases(speakers map[string]string) map[string]string {
+	if store == nil || len(speakers) == 0 {
+		return speakers
+	}
+	resolved := make(map[string]string, len(speakers))
+	for local, name := range speakers {
+		resolved[local] = resolveSpeakerName(name)
+	}
+	return resolved
+}
+
+func resolveSpeakerName(name string) string {
+	if name == "" {
+		return name
+	}
+	if _, err := store.GetSpeakerByName(name); err == nil {
+		return name
+	}
+	if canonical, err := store.ResolveSpeakerAlias(name); err == nil {
+		return canonical
+	}
+	return name
+}
+
+// speakerAppearance is one transcript's local speaker (speaker_1, ...)
+// bound to a global speaker.
+type speakerAppearance struct {
+	Slug    string `json:"slug"`
+	Title   string `json:"title"`
+	Speaker string `json:"speaker"`
+}
+
+func speakerAppearances(sp *storage.Speaker, hidden map[string]bool) []speakerAppearance {
+	out := []speakerAppearance{}
+	convos, _ := store.GetSpeakerConversations(sp.Name)
+	seen := map[string]bool{}
+	for _, c := range convos {
+		if hidden[c.Slug] || seen[c.Slug] {
+			continue
+		}
+		seen[c.Slug] = true
+		t, err := store.GetTranscriptBySlug(c.Slug)
+		if err != nil {
+			continue
+		}
+		speakers, _ := store.GetTranscriptSpeakers(t.ID)
+		for local, ts := range speakers {
+			if ts.ID == sp.ID {
+				out = append(out, speakerAppearance{Slug: t.Slug, Title: t.Title, Speaker: local})
+			}
+		}
+	}
+	return out
+}
+
+// refreshSpeakerTranscripts re-indexes and notifies viewers of transcripts
+// whose speakers changed.
+func refreshSpeakerTranscripts(tids []int64) {
+	for _, tid := range tids {
+		speakers, messages, err := store.GetDiarization(tid)
+		if err != nil {
+			continue
+		}
+		indexUtterancesSearch(tid, speakers, messages)
+		publishSpeakers(tid, speakers)
+	}
+}
+
+// splitSpeakerPath separates a trailing profile, merge, split or aliases
+// subresource from a speaker name.
+func splitSpeakerPath(path string) (name, sub string) {
+	for _, s := range []string{"profile", "merge", "split", "aliases"} {
+		if name, ok := strings.CutSuffix(path, "/"+s); ok && name != "" {
+			return name, s
+		}
+	}
+	if i := strings.LastIndex(path, "/aliases/"); i > 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// POST /api/speakers/{name}/merge, POST /api/speakers/{name}/split,
+// GET/POST /api/speakers/{name}/aliases and
+// DELETE /api/speakers/{name}/aliases/{alias}
+func handleSpeakerIdentity(w http.ResponseWriter, r *http.Request, sp *storage.Speaker, sub string) {
+	u := requestUser(r)
+	// Split checks each conversation it touches instead
+	if r.Method != http.MethodGet && sub != "split" && !canEditSpeaker(u, sp.Name) {
+		jsonError(w, "not allowed to edit a speaker in conversations you don't own", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case sub == "merge" && r.Method == http.MethodPost:
+		mergeSpeaker(w, r, u, sp)
+	case sub == "split" && r.Method == http.MethodPost:
+		splitSpeaker(w, r, u, sp)
+	case sub == "aliases" && r.Method == http.MethodGet:
+		aliases, err := store.ListSpeakerAliases(sp.ID)
+		if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		json.NewEncoder(w).Encode(aliases)
+	case sub == "aliases" && r.Method == http.MethodPost:
+		var req struct {
+			Alias string `json:"alias"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Alias) == "" {
+			jsonError(w, "invalid request", 400)
+			return
+		}
+		if other, err := store.GetSpeakerByName(strings.TrimSpace(req.Alias)); err == nil && other.ID != sp.ID {
+			jsonError(w, "a speaker with that name exists; merge them instead", http.StatusConflict)
+			return
+		}
+		if err := store.AddSpeakerAlias(sp.ID, req.Alias); errors.Is(err, storage.ErrAliasTaken) {
+			jsonError(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		aliases, _ := store.ListSpeakerAliases(sp.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(aliases)
+	case strings.HasPrefix(sub, "aliases/") && r.Method == http.MethodDelete:
+		if err := store.DeleteSpeakerAlias(sp.ID, strings.TrimPrefix(sub, "aliases/")); errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "alias not found", 404)
+			return
+		} else if err != nil {
+			jsonError(w, "db error", 500)
+			return
+		}
+		aliases, _ := store.ListSpeakerAliases(sp.ID)
+		json.NewEncoder(w).Encode(aliases)
+	default:
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// mergeSpeaker folds the speaker named in {"from": ...} into sp.
+func mergeSpeaker(w http.ResponseWriter, r *http.Request, u *storage.User, sp *storage.Speaker) {
+	var req struct {
+		From string `json:"from"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" {
+		jsonError(w, "invalid request", 400)
+		return
+	}
+	from, err := store.GetSpeakerByName(req.From)
+	if err != nil {
+		jsonError(w, "speaker not found", 404)
+		return
+	}
+	if from.ID == sp.ID {
+		jsonError(w, "cannot merge a speaker into itself", 400)
+		return
+	}
+	if !canEditSpeaker(u, from.Name) {
+		jsonError(w, "not allowed to edit a speaker in conversations you don't own", http.StatusForbidden)
+		return
+	}
+	tids, err := store.MergeSpeakers(sp.ID, from.ID)
+	if err != nil {
+		log.Printf("merge speaker %d into %d: %v", from.ID, sp.ID, err)
+		jsonError(w, "merge failed", 500)
+		return
+	}
+	refreshSpeakerTranscripts(tids)
+	json.NewEncoder(w).Encode(speakerDetail(sp, u))
+}
+
+// splitSpeaker moves the listed appearances of sp to the speaker called
+// name, creating it if needed:
+// {"name": "Alex B.", "appearances": [{"slug": "...", "speaker": "speaker_2"}]}
+func splitSpeaker(w http.ResponseWriter, r *http.Request, u *storage.User, sp *storage.Speaker) {
+	var req struct {
+		Name        string              `json:"name"`
+		Appearances []speakerAppearance `json:"appearances"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" || len(req.Appearances) == 0 {
+		jsonError(w, "name and appearances are required", 400)
+		return
+	}
+	name := resolveSpeakerName(strings.TrimSpace(req.Name))
+	if name == sp.Name {
+		jsonError(w, "appearances already belong to "+sp.Name, 400)
+		return
+	}
+
+	// Check every appearance before changing any
+	type change struct {
+		tid      int64
+		speakers map[string]string
+		flags    map[string]bool
+		ids      map[string]int64
+	}
+	var changes []*change
+	byTranscript := map[string]*change{}
+	for _, a := range req.Appearances {
+		c := byTranscript[a.Slug]
+		if c == nil {
+			t, err := store.GetTranscriptBySlug(a.Slug)
+			if err != nil {
+				jsonError(w, fmt.Sprintf("conversation %q not found", a.Slug), 404)
+				return
+			}
+			if !canEdit(u, transcriptAccess(t.ID)) {
+				jsonError(w, "not allowed to edit this conversation", http.StatusForbidden)
+				return
+			}
+			speakers, err := store.GetTranscriptSpeakers(t.ID)
+			if err != nil {
+				jsonError(w, "db error", 500)
+				return
+			}
+			c = &change{tid: t.ID, speakers: map[string]string{}, flags: map[string]bool{}, ids: map[string]int64{}}
+			for local, ts := range speakers {
+				c.speakers[local] = ts.Name
+				c.flags[local] = ts.AutoGenerated
+				c.ids[local] = ts.ID
+			}
+			byTranscript[a.Slug] = c
+			changes = append(changes, c)
+		}
+		if c.ids[a.Speaker] != sp.ID {
+			jsonError(w, fmt.Sprintf("%s is not %s in %s", a.Speaker, sp.Name, a.Slug), 400)
+			return
+		}
+		c.speakers[a.Speaker] = name
+		c.flags[a.Speaker] = false
+	}
+
+	var tids []int64
+	for _, c := range changes {
+		if err := store.SaveSpeakersWithFlags(c.tid, c.speakers, c.flags); err != nil {
+			log.Printf("split speaker %d in %d: %v", sp.ID, c.tid, err)
+			jsonError(w, "split failed", 500)
+			return
+		}
+		tids = append(tids, c.tid)
+	}
+	refreshSpeakerTranscripts(tids)
+
+	target, err := store.GetSpeakerByName(name)
+	if err != nil {
+		jsonError(w, "db error", 500)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"from": speakerDetail(sp, u),
+		"to":   speakerDetail(target, u),
+	})
+}
+
+// speakerDetail is GET /api/speakers/{name}: the speaker's conversations,
+// appearances and aliases, leaving out conversations hidden from u.
+func speakerDetail(sp *storage.Speaker, u *storage.User) map[string]any {
+	hidden := hiddenSlugs(hiddenTranscripts(u))
+	convos, _ := store.GetSpeakerConversations(sp.Name)
+	visible := []storage.SpeakerConversation{}
+	for _, c := range convos {
+		if !hidden[c.Slug] {
+			visible = append(visible, c)
+		}
+	}
+	aliases, err := store.ListSpeakerAliases(sp.ID)
+	if err != nil {
+		aliases = []string{}
+	}
+	return map[string]any{
+		"id":            sp.ID,
+		"name":          sp.Name,
+		"conversations": visible,
+		"appearances":   speakerAppearances(sp, hidden),
+		"aliases":       aliases,
+	}
+}
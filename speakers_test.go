@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// newSpeakerSession stores a conversation whose speaker_1 is called name
+// and returns its slug.
+func newSpeakerSession(t *testing.T, name, text string) string {
+	t.Helper()
+	tid, _ := store.SaveTranscript("", "")
+	persistStatements("", []Statement{{Speaker: "speaker_1", Text: text, Type: "claim", MsgIndex: intp(1)}},
+		map[string]string{"speaker_1": name}, []storage.DiarizeMessage{{Speaker: "speaker_1", Text: text}}, nil, tid)
+	tr, _ := store.GetTranscript(tid)
+	return tr.Slug
+}
+
+func speakerJSON(t *testing.T, method, path, body string, want int) map[string]any {
+	t.Helper()
+	w := authRequestAs(t, "", method, path, body)
+	if w.Code != want {
+		t.Fatalf("%s %s: status %d: %s", method, path, w.Code, w.Body.String())
+	}
+	var out map[string]any
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return out
+}
+
+func TestMergeSpeakers(t *testing.T) {
+	setupTestStore(t)
+	newSpeakerSession(t, "Lane", "Rents are too high")
+	second := newSpeakerSession(t, "lane k.", "Zoning is the problem")
+
+	d := speakerJSON(t, "POST", "/api/speakers/Lane/merge", `{"from":"lane k."}`, 200)
+	if convos := d["conversations"].([]any); len(convos) != 2 {
+		t.Fatalf("merged conversations: %v", convos)
+	}
+	if aliases := d["aliases"].([]any); len(aliases) != 1 || aliases[0] != "lane k." {
+		t.Fatalf("aliases: %v", aliases)
+	}
+	if _, err := store.GetSpeakerByName("lane k."); err == nil {
+		t.Fatal("merged speaker still exists")
+	}
+	speakers, _, _ := store.GetDiarization(mustTranscript(t, second).ID)
+	if speakers["speaker_1"] != "Lane" {
+		t.Fatalf("second conversation speakers: %v", speakers)
+	}
+	if hits := search(t, "q=zoning&speaker=Lane"); len(hits) == 0 {
+		t.Fatal("search index not refreshed after merge")
+	}
+
+	// The old spelling now resolves to Lane when speakers are saved
+	third := newSpeakerSession(t, "lane k.", "Build more housing")
+	speakers, _, _ = store.GetDiarization(mustTranscript(t, third).ID)
+	if speakers["speaker_1"] != "Lane" {
+		t.Fatalf("alias not resolved: %v", speakers)
+	}
+	speakerJSON(t, "POST", "/api/speakers/Lane/merge", `{"from":"Lane"}`, 400)
+	speakerJSON(t, "POST", "/api/speakers/Lane/merge", `{"from":"Nobody"}`, 404)
+}
+
+func TestSplitSpeaker(t *testing.T) {
+	setupTestStore(t)
+	newSpeakerSession(t, "Alex", "Taxes should be lower")
+	other := newSpeakerSession(t, "Alex", "Vaccines are safe")
+
+	body := `{"name":"Alex B.","appearances":[{"slug":"` + other + `","speaker":"speaker_1"}]}`
+	d := speakerJSON(t, "POST", "/api/speakers/Alex/split", body, 200)
+	from, to := d["from"].(map[string]any), d["to"].(map[string]any)
+	if len(from["conversations"].([]any)) != 1 || len(to["conversations"].([]any)) != 1 {
+		t.Fatalf("split: %v", d)
+	}
+	if to["name"] != "Alex B." {
+		t.Fatalf("split target: %v", to)
+	}
+
+	// Appearances must belong to the speaker being split
+	speakerJSON(t, "POST", "/api/speakers/Alex/split", body, 400)
+}
+
+func TestSpeakerAliases(t *testing.T) {
+	setupTestStore(t)
+	newSpeakerSession(t, "Lane", "Rents are too high")
+	newSpeakerSession(t, "Kim", "Rents are fine")
+
+	w := authRequestAs(t, "", "POST", "/api/speakers/Lane/aliases", `{"alias":"L. Kim"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add alias: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := authRequestAs(t, "", "POST", "/api/speakers/Lane/aliases", `{"alias":"Kim"}`); w.Code != http.StatusConflict {
+		t.Fatalf("alias shadowing a speaker: status %d", w.Code)
+	}
+	if w := authRequestAs(t, "", "POST", "/api/speakers/Kim/aliases", `{"alias":"l. kim"}`); w.Code != http.StatusConflict {
+		t.Fatalf("alias taken: status %d", w.Code)
+	}
+	if w := authRequestAs(t, "", "DELETE", "/api/speakers/Lane/aliases/"+url.PathEscape("L. Kim"), ""); w.Code != 200 || strings.Contains(w.Body.String(), "Kim") {
+		t.Fatalf("delete alias: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := authRequestAs(t, "", "DELETE", "/api/speakers/Lane/aliases/"+url.PathEscape("L. Kim"), ""); w.Code != 404 {
+		t.Fatalf("delete missing alias: status %d", w.Code)
+	}
+}
+
+func TestSpeakerIdentityRequiresOwnership(t *testing.T) {
+	setupAuth(t)
+	ada := signup(t, "ada")
+	ben := signup(t, "ben")
+	newOwnedSession(t, ada, "Housing")
+
+	if w := authRequestAs(t, ben, "POST", "/api/speakers/Ada/aliases", `{"alias":"A."}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non-owner alias: status %d", w.Code)
+	}
+	if w := authRequestAs(t, ada, "POST", "/api/speakers/Ada/aliases", `{"alias":"A."}`); w.Code != http.StatusCreated {
+		t.Fatalf("owner alias: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func mustTranscript(t *testing.T, slug string) *storage.Transcript {
+	t.Helper()
+	tr, err := store.GetTranscriptBySlug(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// analysis_runs keeps every full analysis of a transcript with the model
+// and prompt that produced it, so re-analysis no longer discards the
+// previous tree. The current run is the one the live claim tree was last
+// reset from.
+const analysisRunsSchema = `
+CREATE TABLE IF NOT EXISTS analysis_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transcript_id INTEGER NOT NULL,
+	provider TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	prompt_version INTEGER NOT NULL DEFAULT 0,
+	prompt_hash TEXT NOT NULL DEFAULT '',
+	statements TEXT NOT NULL DEFAULT '[]',
+	statement_count INTEGER NOT NULL DEFAULT 0,
+	current INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_analysis_runs_transcript ON analysis_runs(transcript_id, id);
+`
+
+// AnalysisRun is one saved analysis. Statements holds the tree as JSON and
+// is only loaded by GetAnalysisRun. PromptVersion and PromptHash are those
+// of the extract-structure prompt; zero for a tree saved before run history
+// existed.
+type AnalysisRun struct {
+	ID             int64           `json:"id"`
+	TranscriptID   int64           `json:"transcript_id"`
+	Provider       string          `json:"provider"`
+	Model          string          `json:"model"`
+	PromptVersion  int             `json:"prompt_version"`
+	PromptHash     string          `json:"prompt_hash"`
+	StatementCount int             `json:"statement_count"`
+	Current        bool            `json:"current"`
+	Statements     json.RawMessage `json:"statements,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func (s *Store) SaveAnalysisRun(r AnalysisRun) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO analysis_runs (transcript_id, provider, model, prompt_version, prompt_hash, statements, statement_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, r.TranscriptID, r.Provider, r.Model, r.PromptVersion, r.PromptHash, string(r.Statements), r.StatementCount)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) GetAnalysisRun(id int64) (*AnalysisRun, error) {
+	var r AnalysisRun
+	var statements string
+	err := s.db.QueryRow(`SELECT id, transcript_id, provider, model, prompt_version, prompt_hash, statements, statement_count, current, created_at
+		FROM analysis_runs WHERE id = ?`, id).Scan(&r.ID, &r.TranscriptID, &r.Provider, &r.Model, &r.PromptVersion, &r.PromptHash,
+		&statements, &r.StatementCount, &r.Current, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Statements = json.RawMessage(statements)
+	return &r, nil
+}
+
+// ListAnalysisRuns returns a transcript's runs, oldest first, without their
+// statements.
+func (s *Store) ListAnalysisRuns(transcriptID int64) ([]AnalysisRun, error) {
+	rows, err := s.db.Query(`SELECT id, transcript_id, provider, model, prompt_version, prompt_hash, statement_count, current, created_at
+		FROM analysis_runs WHERE transcript_id = ? ORDER BY id`, transcriptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []AnalysisRun{}
+	for rows.Next() {
+		var r AnalysisRun
+		if err := rows.Scan(&r.ID, &r.TranscriptID, &r.Provider, &r.Model, &r.PromptVersion, &r.PromptHash,
+			&r.StatementCount, &r.Current, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// SetCurrentAnalysisRun marks id as the transcript's current run and clears
+// the flag on the others.
+func (s *Store) SetCurrentAnalysisRun(transcriptID, id int64) error {
+	_, err := s.db.Exec(`UPDATE analysis_runs SET current = (id = ?) WHERE transcript_id = ?`, id, transcriptID)
+	return err
+}
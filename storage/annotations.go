@@ -0,0 +1,149 @@
+package storage
+
+import "database/sql"
+
+// Fact checks and fallacies are attached per occurrence: the same claim text
+// can be accurate in one conversation and misleading in another. Rows are
+// keyed by (transcript_id, msg_index, text) so they can be matched back onto
+// ClaimTreeNodes without depending on claim dedup.
+const annotationsSchema = `
+CREATE TABLE IF NOT EXISTS fact_checks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transcript_id INTEGER NOT NULL,
+	claim_id INTEGER NOT NULL,
+	msg_index INTEGER,
+	text TEXT NOT NULL,
+	verdict TEXT NOT NULL,
+	correction TEXT NOT NULL DEFAULT '',
+	search_query TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_fact_checks_transcript ON fact_checks(transcript_id);
+
+CREATE TABLE IF NOT EXISTS fallacies (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transcript_id INTEGER NOT NULL,
+	claim_id INTEGER NOT NULL,
+	msg_index INTEGER,
+	text TEXT NOT NULL,
+	name TEXT NOT NULL,
+	explanation TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_fallacies_transcript ON fallacies(transcript_id);
+`
+
+type FactCheck struct {
+	Verdict     string `json:"verdict"`
+	Correction  string `json:"correction"`
+	SearchQuery string `json:"search_query"`
+}
+
+type Fallacy struct {
+	Name        string `json:"name"`
+	Explanation string `json:"explanation"`
+}
+
+// Annotation is the fact check and/or fallacy recorded for one occurrence.
+type Annotation struct {
+	ClaimID   int64      `json:"claim_id"`
+	MsgIndex  *int       `json:"msg_index,omitempty"`
+	Text      string     `json:"text"`
+	FactCheck *FactCheck `json:"fact_check,omitempty"`
+	Fallacy   *Fallacy   `json:"fallacy,omitempty"`
+}
+
+func (s *Store) SaveFactCheck(claimID, transcriptID int64, msgIndex *int, text string, fc FactCheck) error {
+	_, err := s.db.Exec(`INSERT INTO fact_checks (transcript_id, claim_id, msg_index, text, verdict, correction, search_query)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, transcriptID, claimID, msgIndex, text, fc.Verdict, fc.Correction, fc.SearchQuery)
+	return err
+}
+
+func (s *Store) SaveFallacy(claimID, transcriptID int64, msgIndex *int, text string, f Fallacy) error {
+	_, err := s.db.Exec(`INSERT INTO fallacies (transcript_id, claim_id, msg_index, text, name, explanation)
+		VALUES (?, ?, ?, ?, ?, ?)`, transcriptID, claimID, msgIndex, text, f.Name, f.Explanation)
+	return err
+}
+
+// DeleteAnnotations drops every fact check and fallacy for a transcript,
+// used before re-persisting a re-analyzed conversation.
+func (s *Store) DeleteAnnotations(transcriptID int64) error {
+	if _, err := s.db.Exec(`DELETE FROM fact_checks WHERE transcript_id = ?`, transcriptID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM fallacies WHERE transcript_id = ?`, transcriptID)
+	return err
+}
+
+// annotationKey identifies an annotated occurrence the way statements are
+// matched back to annotations: by msg_index and text, not by claim id.
+type annotationKey struct {
+	msgIndex sql.NullInt64
+	text     string
+}
+
+// GetAnnotations returns all annotations for a transcript, one entry per
+// annotated occurrence with fact check and fallacy merged.
+func (s *Store) GetAnnotations(transcriptID int64) ([]Annotation, error) {
+	byKey := map[annotationKey]*Annotation{}
+	var order []annotationKey
+	get := func(claimID int64, msgIndex sql.NullInt64, text string) *Annotation {
+		key := annotationKey{msgIndex, text}
+		if a, ok := byKey[key]; ok {
+			return a
+		}
+		a := &Annotation{ClaimID: claimID, Text: text}
+		if msgIndex.Valid {
+			mi := int(msgIndex.Int64)
+			a.MsgIndex = &mi
+		}
+		byKey[key] = a
+		order = append(order, key)
+		return a
+	}
+
+	rows, err := s.db.Query(`SELECT claim_id, msg_index, text, verdict, correction, search_query
+		FROM fact_checks WHERE transcript_id = ? ORDER BY id`, transcriptID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var claimID int64
+		var msgIndex sql.NullInt64
+		var text string
+		var fc FactCheck
+		if err := rows.Scan(&claimID, &msgIndex, &text, &fc.Verdict, &fc.Correction, &fc.SearchQuery); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		get(claimID, msgIndex, text).FactCheck = &fc
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT claim_id, msg_index, text, name, explanation
+		FROM fallacies WHERE transcript_id = ? ORDER BY id`, transcriptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var claimID int64
+		var msgIndex sql.NullInt64
+		var text string
+		var f Fallacy
+		if err := rows.Scan(&claimID, &msgIndex, &text, &f.Name, &f.Explanation); err != nil {
+			return nil, err
+		}
+		get(claimID, msgIndex, text).Fallacy = &f
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Annotation, 0, len(order))
+	for _, key := range order {
+		result = append(result, *byKey[key])
+	}
+	return result, nil
+}
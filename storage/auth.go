@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Users sign in with a local password; both browser sessions and API
+// tokens are rows in auth_tokens, stored as SHA-256 hashes. Transcript
+// ownership lives in transcript_access: a transcript without a row has no
+// owner and is public, as every transcript was before accounts existed.
+// job_owners records who queued a job so only they can read its result.
+const authSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	password_hash TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS auth_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at DATETIME,
+	last_used_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user ON auth_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS transcript_access (
+	transcript_id INTEGER PRIMARY KEY,
+	owner_id INTEGER NOT NULL,
+	visibility TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS job_owners (
+	job_id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL
+);
+`
+
+// Token kinds.
+const (
+	TokenSession = "session"
+	TokenAPI     = "api"
+)
+
+// Visibility levels. Unlisted transcripts are readable by anyone with the
+// slug but left out of lists and search.
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+var ErrUsernameTaken = errors.New("username taken")
+
+type User struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuthToken struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TranscriptAccess is a transcript's owner and visibility; OwnerID is 0
+// for transcripts nobody owns.
+type TranscriptAccess struct {
+	TranscriptID int64  `json:"transcript_id"`
+	OwnerID      int64  `json:"owner_id,omitempty"`
+	Visibility   string `json:"visibility"`
+}
+
+func (s *Store) CreateUser(username, passwordHash string) (*User, error) {
+	res, err := s.db.Exec(`INSERT INTO users (username, password_hash) VALUES (?, ?)`, username, passwordHash)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(id)
+}
+
+func (s *Store) GetUser(id int64) (*User, error) {
+	var u User
+	err := s.db.QueryRow(`SELECT id, username, created_at FROM users WHERE id = ?`, id).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserByUsername returns the user and their password hash.
+func (s *Store) GetUserByUsername(username string) (*User, string, error) {
+	var u User
+	var hash string
+	err := s.db.QueryRow(`SELECT id, username, created_at, password_hash FROM users WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &u.CreatedAt, &hash)
+	if err != nil {
+		return nil, "", err
+	}
+	return &u, hash, nil
+}
+
+func (s *Store) CreateAuthToken(userID int64, kind, name, tokenHash string, expiresAt *time.Time) (*AuthToken, error) {
+	res, err := s.db.Exec(`INSERT INTO auth_tokens (user_id, kind, name, token_hash, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, kind, name, tokenHash, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &AuthToken{ID: id, Kind: kind, Name: name, ExpiresAt: expiresAt, CreatedAt: time.Now().UTC()}, nil
+}
+
+// UserForToken returns the owner of an unexpired token and records its use.
+func (s *Store) UserForToken(tokenHash string) (*User, error) {
+	var tokenID int64
+	var u User
+	err := s.db.QueryRow(`SELECT t.id, u.id, u.username, u.created_at FROM auth_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND (t.expires_at IS NULL OR t.expires_at > ?)`, tokenHash, time.Now().UTC()).
+		Scan(&tokenID, &u.ID, &u.Username, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.db.Exec(`UPDATE auth_tokens SET last_used_at = ? WHERE id = ?`, time.Now().UTC(), tokenID)
+	return &u, nil
+}
+
+// ListAuthTokens returns a user's API tokens, newest first.
+func (s *Store) ListAuthTokens(userID int64) ([]AuthToken, error) {
+	rows, err := s.db.Query(`SELECT id, kind, name, expires_at, last_used_at, created_at FROM auth_tokens
+		WHERE user_id = ? AND kind = ? ORDER BY id DESC`, userID, TokenAPI)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []AuthToken{}
+	for rows.Next() {
+		var t AuthToken
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Kind, &t.Name, &expiresAt, &lastUsedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			t.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAuthToken revokes one of a user's tokens, returning sql.ErrNoRows
+// if they have no such token.
+func (s *Store) DeleteAuthToken(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM auth_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) DeleteAuthTokenByHash(tokenHash string) error {
+	_, err := s.db.Exec(`DELETE FROM auth_tokens WHERE token_hash = ?`, tokenHash)
+	return err
+}
+
+func (s *Store) SetTranscriptAccess(a TranscriptAccess) error {
+	_, err := s.db.Exec(`INSERT INTO transcript_access (transcript_id, owner_id, visibility) VALUES (?, ?, ?)
+		ON CONFLICT(transcript_id) DO UPDATE SET owner_id = excluded.owner_id, visibility = excluded.visibility`,
+		a.TranscriptID, a.OwnerID, a.Visibility)
+	return err
+}
+
+// GetTranscriptAccess returns a transcript's access row, or a public
+// ownerless one when it has none.
+func (s *Store) GetTranscriptAccess(tid int64) (TranscriptAccess, error) {
+	a := TranscriptAccess{TranscriptID: tid}
+	err := s.db.QueryRow(`SELECT owner_id, visibility FROM transcript_access WHERE transcript_id = ?`, tid).Scan(&a.OwnerID, &a.Visibility)
+	if errors.Is(err, sql.ErrNoRows) {
+		a.Visibility = VisibilityPublic
+		return a, nil
+	}
+	return a, err
+}
+
+// HiddenTranscriptIDs returns the transcripts left out of the given
+// user's lists: those neither public nor owned by them. userID is 0 for
+// anonymous requests.
+func (s *Store) HiddenTranscriptIDs(userID int64) (map[int64]bool, error) {
+	rows, err := s.db.Query(`SELECT transcript_id FROM transcript_access WHERE visibility != ? AND owner_id != ?`,
+		VisibilityPublic, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hidden := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden[id] = true
+	}
+	return hidden, rows.Err()
+}
+
+// ListListedSpeakers is ListSpeakers restricted to the transcripts listed
+// for the given user: speakers who only appear elsewhere are left out, and
+// conversation and claim counts cover listed transcripts only.
+func (s *Store) ListListedSpeakers(userID int64) ([]SpeakerSummary, error) {
+	rows, err := s.db.Query(`SELECT sp.id, sp.name, COUNT(DISTINCT ts.transcript_id),
+		SUM((SELECT COUNT(*) FROM occurrences o WHERE o.transcript_id = ts.transcript_id AND o.speaker = ts.local_id))
+		FROM transcript_speakers ts
+		JOIN speakers sp ON sp.id = ts.speaker_id
+		LEFT JOIN transcript_access a ON a.transcript_id = ts.transcript_id
+		WHERE a.transcript_id IS NULL OR a.visibility = ? OR a.owner_id = ?
+		GROUP BY sp.id ORDER BY sp.name`, VisibilityPublic, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SpeakerSummary{}
+	for rows.Next() {
+		var sp SpeakerSummary
+		if err := rows.Scan(&sp.ID, &sp.Name, &sp.ConversationCount, &sp.ClaimCount); err != nil {
+			return nil, err
+		}
+		out = append(out, sp)
+	}
+	return out, rows.Err()
+}
+
+// HiddenClaimIDs returns the claims whose every occurrence is in one of
+// the given transcripts. Occurrences rather than claim_mentions decide
+// this: a claim that never got a mention row still appears somewhere.
+func (s *Store) HiddenClaimIDs(transcriptIDs []int64) (map[int64]bool, error) {
+	hidden := map[int64]bool{}
+	if len(transcriptIDs) == 0 {
+		return hidden, nil
+	}
+	args := make([]any, len(transcriptIDs))
+	for i, id := range transcriptIDs {
+		args[i] = id
+	}
+	rows, err := s.db.Query(`SELECT claim_id FROM occurrences GROUP BY claim_id
+		HAVING SUM(transcript_id IN (?`+strings.Repeat(",?", len(args)-1)+`)) = COUNT(*)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden[id] = true
+	}
+	return hidden, rows.Err()
+}
+
+// setJobOwner records, within the transaction creating a job, the user who
+// queued it; a zero userID leaves the job unowned.
+func setJobOwner(tx *sql.Tx, jobID, userID int64) error {
+	if userID == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO job_owners (job_id, user_id) VALUES (?, ?)`, jobID, userID)
+	return err
+}
+
+// JobOwner returns the user who queued a job, or 0.
+func (s *Store) JobOwner(jobID int64) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT user_id FROM job_owners WHERE job_id = ?`, jobID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Canonical claims group paraphrases of one claim across conversations.
+// Each persisted statement is recorded as a claim mention linking its claim
+// and transcript to a canonical claim; mentions are rewritten whenever a
+// transcript's tree is, like annotations. canonical_claim_tokens indexes
+// canonical texts by content word for candidate lookup.
+const canonicalSchema = `
+CREATE TABLE IF NOT EXISTS canonical_claims (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	text TEXT NOT NULL,
+	normalized TEXT NOT NULL,
+	tokens TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_canonical_claims_normalized ON canonical_claims(normalized);
+
+CREATE TABLE IF NOT EXISTS canonical_claim_tokens (
+	canonical_id INTEGER NOT NULL,
+	token TEXT NOT NULL,
+	PRIMARY KEY (token, canonical_id)
+);
+
+CREATE TABLE IF NOT EXISTS claim_mentions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	canonical_id INTEGER NOT NULL,
+	claim_id INTEGER NOT NULL,
+	transcript_id INTEGER NOT NULL,
+	speaker TEXT NOT NULL DEFAULT '',
+	msg_index INTEGER,
+	text TEXT NOT NULL,
+	type TEXT NOT NULL DEFAULT '',
+	parent_canonical_id INTEGER,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_claim_mentions_canonical ON claim_mentions(canonical_id);
+CREATE INDEX IF NOT EXISTS idx_claim_mentions_parent ON claim_mentions(parent_canonical_id);
+CREATE INDEX IF NOT EXISTS idx_claim_mentions_claim ON claim_mentions(claim_id);
+CREATE INDEX IF NOT EXISTS idx_claim_mentions_transcript ON claim_mentions(transcript_id);
+`
+
+type CanonicalClaim struct {
+	ID        int64     `json:"id"`
+	Text      string    `json:"text"`
+	Tokens    []string  `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ClaimMention is one statement's link to a canonical claim. Speaker is the
+// occurrence speaker key (usually a speaker id local to the transcript).
+type ClaimMention struct {
+	ID                int64  `json:"id"`
+	CanonicalID       int64  `json:"canonical_id"`
+	ClaimID           int64  `json:"claim_id"`
+	TranscriptID      int64  `json:"transcript_id"`
+	Speaker           string `json:"speaker"`
+	MsgIndex          *int   `json:"msg_index,omitempty"`
+	Text              string `json:"text"`
+	Type              string `json:"type"`
+	ParentCanonicalID *int64 `json:"parent_canonical_id,omitempty"`
+}
+
+func (s *Store) CreateCanonicalClaim(text, normalized string, tokens []string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO canonical_claims (text, normalized, tokens) VALUES (?, ?, ?)`,
+		text, normalized, strings.Join(tokens, " "))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, tok := range tokens {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO canonical_claim_tokens (canonical_id, token) VALUES (?, ?)`, id, tok); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// FindCanonicalClaim returns the canonical claim with exactly this
+// normalized text, or sql.ErrNoRows.
+func (s *Store) FindCanonicalClaim(normalized string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT id FROM canonical_claims WHERE normalized = ? ORDER BY id LIMIT 1`, normalized).Scan(&id)
+	return id, err
+}
+
+// CanonicalCandidates returns up to limit canonical claims with the highest
+// token Jaccard similarity to the given distinct tokens. Ranking by
+// similarity rather than shared-token count keeps long claims that share a
+// common word from crowding out the closest match.
+func (s *Store) CanonicalCandidates(tokens []string, limit int) ([]CanonicalClaim, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, len(tokens)+2)
+	for _, tok := range tokens {
+		args = append(args, tok)
+	}
+	args = append(args, len(tokens), limit)
+	// A candidate's token count is the number of words in its tokens column,
+	// which holds its distinct tokens joined by single spaces.
+	rows, err := s.db.Query(`SELECT c.id, c.text, c.tokens, c.created_at FROM canonical_claim_tokens t
+		JOIN canonical_claims c ON c.id = t.canonical_id
+		WHERE t.token IN (?`+strings.Repeat(",?", len(tokens)-1)+`)
+		GROUP BY c.id
+		ORDER BY COUNT(*) * 1.0 / (length(c.tokens) - length(replace(c.tokens, ' ', '')) + 1 + ? - COUNT(*)) DESC, c.id
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []CanonicalClaim
+	for rows.Next() {
+		var c CanonicalClaim
+		var toks string
+		if err := rows.Scan(&c.ID, &c.Text, &toks, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Tokens = strings.Fields(toks)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetCanonicalClaim(id int64) (*CanonicalClaim, error) {
+	var c CanonicalClaim
+	var toks string
+	err := s.db.QueryRow(`SELECT id, text, tokens, created_at FROM canonical_claims WHERE id = ?`, id).
+		Scan(&c.ID, &c.Text, &toks, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.Tokens = strings.Fields(toks)
+	return &c, nil
+}
+
+func (s *Store) SaveClaimMention(m ClaimMention) error {
+	_, err := s.db.Exec(`INSERT INTO claim_mentions (canonical_id, claim_id, transcript_id, speaker, msg_index, text, type, parent_canonical_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, m.CanonicalID, m.ClaimID, m.TranscriptID, m.Speaker, m.MsgIndex, m.Text, m.Type, m.ParentCanonicalID)
+	return err
+}
+
+// DeleteClaimMentions drops a transcript's mentions before its tree is
+// re-persisted.
+func (s *Store) DeleteClaimMentions(transcriptID int64) error {
+	_, err := s.db.Exec(`DELETE FROM claim_mentions WHERE transcript_id = ?`, transcriptID)
+	return err
+}
+
+// MentionedTranscripts returns the ids of transcripts with claim mentions.
+func (s *Store) MentionedTranscripts() (map[int64]bool, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT transcript_id FROM claim_mentions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// BackfillClaimMentions saves mentions for a transcript that has none, in
+// one transaction, and reports whether it did.
+func (s *Store) BackfillClaimMentions(transcriptID int64, mentions []ClaimMention) (bool, error) {
+	if len(mentions) == 0 {
+		return false, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM claim_mentions WHERE transcript_id = ?)`, transcriptID).Scan(&exists); err != nil || exists {
+		return false, err
+	}
+	for _, m := range mentions {
+		if _, err := tx.Exec(`INSERT INTO claim_mentions (canonical_id, claim_id, transcript_id, speaker, msg_index, text, type, parent_canonical_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, m.CanonicalID, m.ClaimID, transcriptID, m.Speaker, m.MsgIndex, m.Text, m.Type, m.ParentCanonicalID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// CanonicalIDForClaim returns the canonical claim a claim was last linked to.
+func (s *Store) CanonicalIDForClaim(claimID int64) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT canonical_id FROM claim_mentions WHERE claim_id = ? ORDER BY id DESC LIMIT 1`, claimID).Scan(&id)
+	return id, err
+}
+
+const mentionColumns = `id, canonical_id, claim_id, transcript_id, speaker, msg_index, text, type, parent_canonical_id`
+
+func (s *Store) queryMentions(where string, args ...any) ([]ClaimMention, error) {
+	rows, err := s.db.Query(`SELECT `+mentionColumns+` FROM claim_mentions WHERE `+where+` ORDER BY transcript_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mentions := []ClaimMention{}
+	for rows.Next() {
+		var m ClaimMention
+		var msgIndex, parent sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.CanonicalID, &m.ClaimID, &m.TranscriptID, &m.Speaker, &msgIndex, &m.Text, &m.Type, &parent); err != nil {
+			return nil, err
+		}
+		if msgIndex.Valid {
+			mi := int(msgIndex.Int64)
+			m.MsgIndex = &mi
+		}
+		if parent.Valid {
+			m.ParentCanonicalID = &parent.Int64
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// GetClaimMentions returns every statement linked to a canonical claim.
+func (s *Store) GetClaimMentions(canonicalID int64) ([]ClaimMention, error) {
+	return s.queryMentions(`canonical_id = ?`, canonicalID)
+}
+
+// GetClaimReplies returns statements made in reply to a canonical claim.
+func (s *Store) GetClaimReplies(canonicalID int64) ([]ClaimMention, error) {
+	return s.queryMentions(`parent_canonical_id = ?`, canonicalID)
+}
@@ -0,0 +1,169 @@
+package storage
+
+import "database/sql"
+
+// ClaimEdit corrects one claim already in a transcript's tree. Text and
+// Type are the claim's values after the edit. CanonicalID, when set, is the
+// canonical claim of a changed text; the claim's mention and its replies'
+// mentions are relinked to it. When Reparent is set the claim moves under
+// ParentID, or to the top level when that is zero; ParentCanonicalID is
+// the new parent's canonical claim for its mention.
+type ClaimEdit struct {
+	ClaimID           int64
+	Text              string
+	Type              string
+	CanonicalID       *int64
+	Reparent          bool
+	ParentID          int64
+	ParentCanonicalID *int64
+}
+
+// NewClaim is a statement added to a transcript's tree. It nests under the
+// existing claim ParentID, or under the earlier NewClaim numbered Parent
+// (1-based), or at the top level when both are zero. Mention and Indexed,
+// when set, are saved with the claim id filled in.
+type NewClaim struct {
+	Speaker   string
+	Text      string
+	Type      string
+	MsgIndex  *int
+	ParentID  int64
+	Parent    int
+	FactCheck *FactCheck
+	Fallacy   *Fallacy
+	Mention   *ClaimMention
+	Indexed   *IndexedClaim
+}
+
+// ApplyClaimTreeChanges edits a transcript's tree in place in one
+// transaction: edited claims are updated along with their occurrence,
+// edge, annotations, mention and search row, added claims are appended
+// after the existing occurrences, and the revisions describing the edits
+// are logged. It returns the added claims' ids.
+func (s *Store) ApplyClaimTreeChanges(transcriptID int64, edits []ClaimEdit, added []NewClaim, revisions []Revision) ([]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, e := range edits {
+		for _, q := range []string{
+			`UPDATE occurrences SET text = ? WHERE claim_id = ? AND transcript_id = ?`,
+			`UPDATE fact_checks SET text = ? WHERE claim_id = ? AND transcript_id = ?`,
+			`UPDATE fallacies SET text = ? WHERE claim_id = ? AND transcript_id = ?`,
+		} {
+			if _, err := tx.Exec(q, e.Text, e.ClaimID, transcriptID); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE claims SET text = ?, type = ? WHERE id = ?`, e.Text, e.Type, e.ClaimID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE edges SET type = ? WHERE to_claim_id = ? AND transcript_id = ?`, e.Type, e.ClaimID, transcriptID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE claim_mentions SET text = ?, type = ? WHERE claim_id = ? AND transcript_id = ?`,
+			e.Text, e.Type, e.ClaimID, transcriptID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE search_index SET text = ?, type = ? WHERE kind = ? AND transcript_id = ? AND claim_id = ?`,
+			e.Text, e.Type, SearchClaim, transcriptID, e.ClaimID); err != nil {
+			return nil, err
+		}
+		if e.CanonicalID != nil {
+			if _, err := tx.Exec(`UPDATE claim_mentions SET canonical_id = ? WHERE claim_id = ? AND transcript_id = ?`,
+				*e.CanonicalID, e.ClaimID, transcriptID); err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec(`UPDATE claim_mentions SET parent_canonical_id = ? WHERE transcript_id = ?
+				AND claim_id IN (SELECT to_claim_id FROM edges WHERE from_claim_id = ? AND transcript_id = ?)`,
+				*e.CanonicalID, transcriptID, e.ClaimID, transcriptID); err != nil {
+				return nil, err
+			}
+		}
+		if !e.Reparent {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM edges WHERE to_claim_id = ? AND transcript_id = ?`, e.ClaimID, transcriptID); err != nil {
+			return nil, err
+		}
+		if e.ParentID > 0 {
+			if _, err := tx.Exec(`INSERT INTO edges (from_claim_id, to_claim_id, type, transcript_id) VALUES (?, ?, ?, ?)`,
+				e.ParentID, e.ClaimID, e.Type, transcriptID); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE claim_mentions SET parent_canonical_id = ? WHERE claim_id = ? AND transcript_id = ?`,
+			e.ParentCanonicalID, e.ClaimID, transcriptID); err != nil {
+			return nil, err
+		}
+	}
+
+	var pos int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM occurrences WHERE transcript_id = ?`, transcriptID).Scan(&pos); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(added))
+	for i, c := range added {
+		id, err := insertNewClaim(tx, transcriptID, pos+i, c, ids)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	if err := insertRevisions(tx, revisions); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+func insertNewClaim(tx *sql.Tx, transcriptID int64, pos int, c NewClaim, ids []int64) (int64, error) {
+	res, err := tx.Exec(`INSERT INTO claims (text, type) VALUES (?, ?)`, c.Text, c.Type)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO occurrences (claim_id, transcript_id, speaker, position, text, msg_index) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, transcriptID, c.Speaker, pos, c.Text, c.MsgIndex); err != nil {
+		return 0, err
+	}
+	parent := c.ParentID
+	if c.Parent > 0 {
+		parent = ids[c.Parent-1]
+	}
+	if parent > 0 {
+		if _, err := tx.Exec(`INSERT INTO edges (from_claim_id, to_claim_id, type, transcript_id) VALUES (?, ?, ?, ?)`,
+			parent, id, c.Type, transcriptID); err != nil {
+			return 0, err
+		}
+	}
+	if fc := c.FactCheck; fc != nil {
+		if _, err := tx.Exec(`INSERT INTO fact_checks (transcript_id, claim_id, msg_index, text, verdict, correction, search_query)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, transcriptID, id, c.MsgIndex, c.Text, fc.Verdict, fc.Correction, fc.SearchQuery); err != nil {
+			return 0, err
+		}
+	}
+	if f := c.Fallacy; f != nil {
+		if _, err := tx.Exec(`INSERT INTO fallacies (transcript_id, claim_id, msg_index, text, name, explanation)
+			VALUES (?, ?, ?, ?, ?, ?)`, transcriptID, id, c.MsgIndex, c.Text, f.Name, f.Explanation); err != nil {
+			return 0, err
+		}
+	}
+	if m := c.Mention; m != nil {
+		if _, err := tx.Exec(`INSERT INTO claim_mentions (canonical_id, claim_id, transcript_id, speaker, msg_index, text, type, parent_canonical_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, m.CanonicalID, id, transcriptID, c.Speaker, c.MsgIndex, c.Text, c.Type, m.ParentCanonicalID); err != nil {
+			return 0, err
+		}
+	}
+	if x := c.Indexed; x != nil {
+		if _, err := tx.Exec(`INSERT INTO search_index (text, kind, transcript_id, claim_id, speaker_id, speaker, msg_index, start_ms, type)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, c.Text, SearchClaim, transcriptID, id, c.Speaker, x.Speaker, c.MsgIndex, x.StartMs, c.Type); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const jobsSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'queued',
+	payload TEXT NOT NULL DEFAULT '{}',
+	result TEXT,
+	error TEXT NOT NULL DEFAULT '',
+	progress TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, id);
+
+CREATE TABLE IF NOT EXISTS job_handles (
+	job_id INTEGER PRIMARY KEY,
+	handle_hash TEXT NOT NULL
+);
+`
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Status      string          `json:"status"`
+	Payload     json.RawMessage `json:"-"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Progress    string          `json:"progress,omitempty"`
+	Handle      string          `json:"handle,omitempty"` // only set on the job as created
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Done reports whether the job has reached a terminal status.
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// CreateJob queues a job, recording ownerID (when non-zero) as the user
+// who queued it and handleHash (when non-empty) as the hash of the handle
+// that reads it, in the same transaction so the job is never unguarded.
+func (s *Store) CreateJob(kind string, payload json.RawMessage, maxAttempts int, ownerID int64, handleHash string) (int64, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO jobs (kind, payload, max_attempts) VALUES (?, ?, ?)`, kind, string(payload), maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setJobOwner(tx, id, ownerID); err != nil {
+		return 0, err
+	}
+	if handleHash != "" {
+		if _, err := tx.Exec(`INSERT INTO job_handles (job_id, handle_hash) VALUES (?, ?)`, id, handleHash); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// JobHandleMatches reports whether handleHash is the hash of the job's
+// handle.
+func (s *Store) JobHandleMatches(jobID int64, handleHash string) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM job_handles WHERE job_id = ? AND handle_hash = ?)`, jobID, handleHash).Scan(&ok)
+	return ok, err
+}
+
+func (s *Store) GetJob(id int64) (*Job, error) {
+	var j Job
+	var payload string
+	var result sql.NullString
+	err := s.db.QueryRow(`SELECT id, kind, status, payload, result, error, progress, attempts, max_attempts, created_at, updated_at
+		FROM jobs WHERE id = ?`, id).Scan(&j.ID, &j.Kind, &j.Status, &payload, &result, &j.Error, &j.Progress,
+		&j.Attempts, &j.MaxAttempts, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	j.Payload = json.RawMessage(payload)
+	if result.Valid {
+		j.Result = json.RawMessage(result.String)
+	}
+	return &j, nil
+}
+
+// ClaimNextJob atomically moves the oldest queued job to running and bumps
+// its attempt count. Returns sql.ErrNoRows when the queue is empty.
+func (s *Store) ClaimNextJob() (*Job, error) {
+	var id int64
+	err := s.db.QueryRow(`UPDATE jobs SET status = 'running', attempts = attempts + 1, progress = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT id FROM jobs WHERE status = 'queued' ORDER BY id LIMIT 1)
+		RETURNING id`).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetJob(id)
+}
+
+func (s *Store) UpdateJobProgress(id int64, progress string) error {
+	_, err := s.db.Exec(`UPDATE jobs SET progress = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, progress, id)
+	return err
+}
+
+func (s *Store) CompleteJob(id int64, result json.RawMessage) error {
+	_, err := s.db.Exec(`UPDATE jobs SET status = 'succeeded', result = ?, error = '', progress = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, string(result), id)
+	return err
+}
+
+// FailJob records an attempt's error. The job goes back to the queue while
+// it has attempts left, otherwise it is marked failed.
+func (s *Store) FailJob(id int64, errMsg string) error {
+	_, err := s.db.Exec(`UPDATE jobs SET
+		status = CASE WHEN attempts < max_attempts THEN 'queued' ELSE 'failed' END,
+		error = ?, progress = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, errMsg, id)
+	return err
+}
+
+// ReleaseJob puts a running job back in the queue without spending the
+// attempt it was on, for runs cut short by a graceful shutdown.
+func (s *Store) ReleaseJob(id int64) error {
+	_, err := s.db.Exec(`UPDATE jobs SET status = 'queued', attempts = attempts - 1, progress = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = 'running'`, id)
+	return err
+}
+
+// RequeueRunningJobs puts jobs left running by a previous process back in
+// the queue, or marks them failed when the interrupted run was their last
+// attempt. Call once at startup before workers begin.
+func (s *Store) RequeueRunningJobs() (requeued, failed int64, err error) {
+	res, err := s.db.Exec(`UPDATE jobs SET status = 'failed', error = 'interrupted by a restart', progress = '', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'running' AND attempts >= max_attempts`)
+	if err != nil {
+		return 0, 0, err
+	}
+	if failed, err = res.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+	res, err = s.db.Exec(`UPDATE jobs SET status = 'queued', progress = '', updated_at = CURRENT_TIMESTAMP WHERE status = 'running'`)
+	if err != nil {
+		return 0, failed, err
+	}
+	requeued, err = res.RowsAffected()
+	return requeued, failed, err
+}
@@ -0,0 +1,33 @@
+package storage
+
+// Per-transcript counts used to sort and filter the conversation list.
+
+// TranscriptClaimCounts returns the number of claim occurrences in each
+// transcript that has any.
+func (s *Store) TranscriptClaimCounts() (map[int64]int, error) {
+	return s.countByTranscript(`SELECT transcript_id, COUNT(*) FROM occurrences GROUP BY transcript_id`)
+}
+
+// TranscriptFactCheckCounts returns the number of fact-checked statements in
+// each transcript that has any.
+func (s *Store) TranscriptFactCheckCounts() (map[int64]int, error) {
+	return s.countByTranscript(`SELECT transcript_id, COUNT(*) FROM fact_checks GROUP BY transcript_id`)
+}
+
+func (s *Store) countByTranscript(query string) (map[int64]int, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[int64]int{}
+	for rows.Next() {
+		var tid int64
+		var n int
+		if err := rows.Scan(&tid, &n); err != nil {
+			return nil, err
+		}
+		counts[tid] = n
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// llm_cache holds LLM replies keyed by a hash of provider, model, prompt and
+// parameters. Timestamps are written by the caller so expiry comparisons
+// use one format.
+const llmCacheSchema = `
+CREATE TABLE IF NOT EXISTS llm_cache (
+	key TEXT PRIMARY KEY,
+	provider TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	response TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	hits INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	last_used_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_llm_cache_last_used ON llm_cache(last_used_at);
+`
+
+type LLMCacheEntry struct {
+	Key       string
+	Provider  string
+	Model     string
+	Response  string
+	Hits      int
+	CreatedAt time.Time
+}
+
+// GetLLMCache returns the reply cached under key if it was stored after
+// notBefore, and counts the hit.
+func (s *Store) GetLLMCache(key string, notBefore time.Time) (string, bool, error) {
+	var response string
+	err := s.db.QueryRow(`SELECT response FROM llm_cache WHERE key = ? AND created_at > ?`, key, notBefore.UTC()).Scan(&response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	_, err = s.db.Exec(`UPDATE llm_cache SET hits = hits + 1, last_used_at = ? WHERE key = ?`, time.Now().UTC(), key)
+	return response, true, err
+}
+
+// GetLLMCacheEntry returns the entry under key without counting a hit.
+func (s *Store) GetLLMCacheEntry(key string) (*LLMCacheEntry, error) {
+	e := LLMCacheEntry{Key: key}
+	err := s.db.QueryRow(`SELECT provider, model, response, hits, created_at FROM llm_cache WHERE key = ?`, key).
+		Scan(&e.Provider, &e.Model, &e.Response, &e.Hits, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *Store) PutLLMCache(e LLMCacheEntry) error {
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO llm_cache (key, provider, model, response, size, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, e.Key, e.Provider, e.Model, e.Response, len(e.Response), now, now)
+	return err
+}
+
+// PruneLLMCache drops entries stored before notBefore, then the least
+// recently used until the cached replies total at most maxBytes (no limit
+// when zero).
+func (s *Store) PruneLLMCache(notBefore time.Time, maxBytes int64) error {
+	if _, err := s.db.Exec(`DELETE FROM llm_cache WHERE created_at <= ?`, notBefore.UTC()); err != nil {
+		return err
+	}
+	if maxBytes <= 0 {
+		return nil
+	}
+	_, total, err := s.LLMCacheSize()
+	if err != nil || total <= maxBytes {
+		return err
+	}
+	rows, err := s.db.Query(`SELECT key, size FROM llm_cache ORDER BY last_used_at, key`)
+	if err != nil {
+		return err
+	}
+	var evict []string
+	for rows.Next() && total > maxBytes {
+		var key string
+		var size int64
+		if err := rows.Scan(&key, &size); err != nil {
+			rows.Close()
+			return err
+		}
+		evict = append(evict, key)
+		total -= size
+	}
+	rows.Close()
+	for _, key := range evict {
+		if _, err := s.db.Exec(`DELETE FROM llm_cache WHERE key = ?`, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LLMCacheSize returns the number of cached replies and their total size.
+func (s *Store) LLMCacheSize() (entries int, bytes int64, err error) {
+	err = s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM llm_cache`).Scan(&entries, &bytes)
+	return entries, bytes, err
+}
@@ -0,0 +1,50 @@
+package storage
+
+import "fmt"
+
+// schemaMigrations are tables layered on top of the core schema. Every
+// statement must be idempotent: Migrate runs them all on each startup.
+var schemaMigrations = []string{
+	annotationsSchema,
+	jobsSchema,
+	revisionsSchema,
+	canonicalSchema,
+	searchSchema,
+	authSchema,
+	speakerAliasesSchema,
+	provenanceSchema,
+	analysisRunsSchema,
+	llmCacheSchema,
+}
+
+// columnMigrations are columns added to a migration's table after it
+// first shipped. Tables created since already have them; older ones get
+// them added once.
+var columnMigrations = []struct {
+	table, column, ddl string
+}{
+	{"statement_revisions", "claim_id", `ALTER TABLE statement_revisions ADD COLUMN claim_id INTEGER`},
+}
+
+// Migrate creates any tables, indexes or columns added since the core
+// schema.
+func (s *Store) Migrate() error {
+	for i, ddl := range schemaMigrations {
+		if _, err := s.db.Exec(ddl); err != nil {
+			return fmt.Errorf("migration %d: %w", i, err)
+		}
+	}
+	for _, c := range columnMigrations {
+		var exists bool
+		if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, c.table, c.column).Scan(&exists); err != nil {
+			return fmt.Errorf("migration %s.%s: %w", c.table, c.column, err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.db.Exec(c.ddl); err != nil {
+			return fmt.Errorf("migration %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"time"
+)
+
+// prompt_runs records which prompt template, model and parameters produced
+// a transcript's diarization and analysis, one row per distinct prompt used
+// in each save, so differently analyzed conversations can be told apart.
+const provenanceSchema = `
+CREATE TABLE IF NOT EXISTS prompt_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transcript_id INTEGER NOT NULL,
+	prompt_id TEXT NOT NULL,
+	prompt_version INTEGER NOT NULL,
+	prompt_hash TEXT NOT NULL DEFAULT '',
+	provider TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	max_tokens INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_prompt_runs_transcript ON prompt_runs(transcript_id, id);
+`
+
+// PromptRun describes one prompt sent to the LLM. CreatedAt is set once
+// the run is saved against a transcript.
+type PromptRun struct {
+	PromptID      string     `json:"prompt_id"`
+	PromptVersion int        `json:"prompt_version"`
+	PromptHash    string     `json:"prompt_hash"`
+	Provider      string     `json:"provider"`
+	Model         string     `json:"model"`
+	MaxTokens     int        `json:"max_tokens"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+}
+
+func (s *Store) SavePromptRuns(transcriptID int64, runs []PromptRun) error {
+	for _, r := range runs {
+		if _, err := s.db.Exec(`INSERT INTO prompt_runs (transcript_id, prompt_id, prompt_version, prompt_hash, provider, model, max_tokens)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, transcriptID, r.PromptID, r.PromptVersion, r.PromptHash, r.Provider, r.Model, r.MaxTokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPromptRuns returns a transcript's prompt runs, oldest first.
+func (s *Store) GetPromptRuns(transcriptID int64) ([]PromptRun, error) {
+	rows, err := s.db.Query(`SELECT prompt_id, prompt_version, prompt_hash, provider, model, max_tokens, created_at
+		FROM prompt_runs WHERE transcript_id = ? ORDER BY id`, transcriptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []PromptRun{}
+	for rows.Next() {
+		var r PromptRun
+		var created time.Time
+		if err := rows.Scan(&r.PromptID, &r.PromptVersion, &r.PromptHash, &r.Provider, &r.Model, &r.MaxTokens, &created); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = &created
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
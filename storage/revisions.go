@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Statement revisions record each correction applied to a stored argument
+// tree, one row per changed field, so a review can be inspected and undone.
+// Statements are addressed by their claim_id; rows from before that column
+// existed only have (transcript_id, msg_index), like annotations.
+const revisionsSchema = `
+CREATE TABLE IF NOT EXISTS statement_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transcript_id INTEGER NOT NULL,
+	msg_index INTEGER NOT NULL,
+	claim_id INTEGER,
+	field TEXT NOT NULL,
+	old_value TEXT NOT NULL DEFAULT '',
+	new_value TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL DEFAULT '',
+	reverts_id INTEGER,
+	reverted_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_statement_revisions_transcript ON statement_revisions(transcript_id, id);
+`
+
+// Revision fields; "parent" values are the parent statement's text, empty
+// for the top level.
+const (
+	RevisionText   = "text"
+	RevisionType   = "type"
+	RevisionParent = "parent"
+)
+
+var ErrRevisionReverted = errors.New("revision already reverted")
+
+type Revision struct {
+	ID           int64      `json:"id"`
+	TranscriptID int64      `json:"transcript_id"`
+	MsgIndex     int        `json:"msg_index"`
+	ClaimID      int64      `json:"claim_id,omitempty"`
+	Field        string     `json:"field"`
+	OldValue     string     `json:"old_value"`
+	NewValue     string     `json:"new_value"`
+	Source       string     `json:"source"`
+	RevertsID    *int64     `json:"reverts_id,omitempty"`
+	RevertedAt   *time.Time `json:"reverted_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// insertRevisions logs applied revisions within a tree edit's transaction
+// and marks the revisions they revert as reverted. A revision already
+// marked fails the transaction with ErrRevisionReverted, so a revert can't
+// be applied twice.
+func insertRevisions(tx *sql.Tx, revisions []Revision) error {
+	marked := map[int64]bool{}
+	for _, r := range revisions {
+		var claimID *int64
+		if r.ClaimID != 0 {
+			claimID = &r.ClaimID
+		}
+		if _, err := tx.Exec(`INSERT INTO statement_revisions (transcript_id, msg_index, claim_id, field, old_value, new_value, source, reverts_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, r.TranscriptID, r.MsgIndex, claimID, r.Field, r.OldValue, r.NewValue, r.Source, r.RevertsID); err != nil {
+			return err
+		}
+		if r.RevertsID == nil || marked[*r.RevertsID] {
+			continue
+		}
+		marked[*r.RevertsID] = true
+		res, err := tx.Exec(`UPDATE statement_revisions SET reverted_at = CURRENT_TIMESTAMP WHERE id = ? AND reverted_at IS NULL`, *r.RevertsID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrRevisionReverted
+		}
+	}
+	return nil
+}
+
+const revisionColumns = `id, transcript_id, msg_index, claim_id, field, old_value, new_value, source, reverts_id, reverted_at, created_at`
+
+func scanRevision(row interface{ Scan(...any) error }) (*Revision, error) {
+	var r Revision
+	var claimID, revertsID sql.NullInt64
+	var revertedAt sql.NullTime
+	if err := row.Scan(&r.ID, &r.TranscriptID, &r.MsgIndex, &claimID, &r.Field, &r.OldValue, &r.NewValue, &r.Source,
+		&revertsID, &revertedAt, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	r.ClaimID = claimID.Int64
+	if revertsID.Valid {
+		r.RevertsID = &revertsID.Int64
+	}
+	if revertedAt.Valid {
+		r.RevertedAt = &revertedAt.Time
+	}
+	return &r, nil
+}
+
+func (s *Store) GetRevision(id int64) (*Revision, error) {
+	return scanRevision(s.db.QueryRow(`SELECT `+revisionColumns+` FROM statement_revisions WHERE id = ?`, id))
+}
+
+// GetRevisions returns a transcript's revisions, oldest first.
+func (s *Store) GetRevisions(transcriptID int64) ([]Revision, error) {
+	rows, err := s.db.Query(`SELECT `+revisionColumns+` FROM statement_revisions
+		WHERE transcript_id = ? ORDER BY id`, transcriptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []Revision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *r)
+	}
+	return revisions, rows.Err()
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The search index is an FTS5 table holding one row per utterance, claim
+// occurrence and title. It is maintained alongside the core tables: each
+// kind is rewritten per transcript whenever the diarization, argument tree
+// or title is saved. search_transcripts carries the slug and date hits are
+// reported and filtered with.
+const searchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+	text,
+	kind UNINDEXED,
+	transcript_id UNINDEXED,
+	claim_id UNINDEXED,
+	speaker_id UNINDEXED,
+	speaker UNINDEXED,
+	msg_index UNINDEXED,
+	start_ms UNINDEXED,
+	type UNINDEXED,
+	tokenize = 'porter unicode61'
+);
+
+CREATE TABLE IF NOT EXISTS search_transcripts (
+	transcript_id INTEGER PRIMARY KEY,
+	slug TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+`
+
+// Search hit kinds.
+const (
+	SearchUtterance = "utterance"
+	SearchClaim     = "claim"
+	SearchTitle     = "title"
+)
+
+// searchTimeLayout sorts lexically, so date filters compare strings.
+const searchTimeLayout = "2006-01-02T15:04:05Z"
+
+// IndexedClaim is a claim occurrence as stored in the search index.
+type IndexedClaim struct {
+	ClaimID   int64
+	SpeakerID string
+	Speaker   string
+	MsgIndex  *int
+	StartMs   *int64
+	Text      string
+	Type      string
+}
+
+type SearchQuery struct {
+	Text    string
+	Speaker string // display name (case-insensitive) or transcript speaker id
+	Kind    string
+	Type    string // statement type; only claims have one
+	From    time.Time
+	To      time.Time // exclusive
+	Limit   int
+	Offset  int
+	Exclude []int64 // transcripts to leave out
+}
+
+type SearchHit struct {
+	Kind         string    `json:"kind"`
+	TranscriptID int64     `json:"transcript_id"`
+	Slug         string    `json:"slug"`
+	Title        string    `json:"title"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClaimID      *int64    `json:"claim_id,omitempty"`
+	SpeakerID    string    `json:"speaker_id,omitempty"`
+	Speaker      string    `json:"speaker,omitempty"`
+	MsgIndex     *int      `json:"msg_index,omitempty"`
+	StartMs      *int64    `json:"start_ms,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	Text         string    `json:"text"`
+	Snippet      string    `json:"snippet"`
+	Score        float64   `json:"score"`
+}
+
+// IndexTranscript records a transcript's slug, title and date and replaces
+// its title row.
+func (s *Store) IndexTranscript(tid int64, slug, title string, createdAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO search_transcripts (transcript_id, slug, title, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(transcript_id) DO UPDATE SET slug = excluded.slug, title = excluded.title`,
+		tid, slug, title, createdAt.UTC().Format(searchTimeLayout)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM search_index WHERE transcript_id = ? AND kind = ?`, tid, SearchTitle); err != nil {
+		return err
+	}
+	if title != "" {
+		if _, err := tx.Exec(`INSERT INTO search_index (text, kind, transcript_id) VALUES (?, ?, ?)`, title, SearchTitle, tid); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IndexUtterances replaces a transcript's utterance rows and refreshes the
+// speaker names on its claim rows.
+func (s *Store) IndexUtterances(tid int64, speakers map[string]string, messages []DiarizeMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM search_index WHERE transcript_id = ? AND kind = ?`, tid, SearchUtterance); err != nil {
+		return err
+	}
+	for i, m := range messages {
+		if _, err := tx.Exec(`INSERT INTO search_index (text, kind, transcript_id, speaker_id, speaker, msg_index, start_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, m.Text, SearchUtterance, tid, m.Speaker, indexedSpeakerName(speakers, m.Speaker), i+1, m.StartMs); err != nil {
+			return err
+		}
+	}
+	for id := range speakers {
+		if _, err := tx.Exec(`UPDATE search_index SET speaker = ? WHERE transcript_id = ? AND kind = ? AND speaker_id = ?`,
+			indexedSpeakerName(speakers, id), tid, SearchClaim, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IndexClaims replaces a transcript's claim rows.
+func (s *Store) IndexClaims(tid int64, claims []IndexedClaim) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM search_index WHERE transcript_id = ? AND kind = ?`, tid, SearchClaim); err != nil {
+		return err
+	}
+	for _, c := range claims {
+		var claimID any
+		if c.ClaimID > 0 {
+			claimID = c.ClaimID
+		}
+		if _, err := tx.Exec(`INSERT INTO search_index (text, kind, transcript_id, claim_id, speaker_id, speaker, msg_index, start_ms, type)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, c.Text, SearchClaim, tid, claimID, c.SpeakerID, c.Speaker, c.MsgIndex, c.StartMs, c.Type); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SearchIndexed returns the ids of transcripts present in the index.
+func (s *Store) SearchIndexed() (map[int64]bool, error) {
+	rows, err := s.db.Query(`SELECT transcript_id FROM search_transcripts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// Search returns hits ranked by BM25. Snippets wrap matched terms in
+// <mark></mark>; the surrounding text is not escaped.
+func (s *Store) Search(q SearchQuery) ([]SearchHit, error) {
+	match := ftsMatch(q.Text)
+	if match == "" {
+		return []SearchHit{}, nil
+	}
+	where := []string{`search_index MATCH ?`}
+	args := []any{match}
+	if q.Speaker != "" {
+		where = append(where, `(search_index.speaker = ? COLLATE NOCASE OR search_index.speaker_id = ?)`)
+		args = append(args, q.Speaker, q.Speaker)
+	}
+	if q.Kind != "" {
+		where = append(where, `search_index.kind = ?`)
+		args = append(args, q.Kind)
+	}
+	if q.Type != "" {
+		where = append(where, `search_index.type = ?`)
+		args = append(args, q.Type)
+	}
+	if len(q.Exclude) > 0 {
+		where = append(where, `search_index.transcript_id NOT IN (?`+strings.Repeat(",?", len(q.Exclude)-1)+`)`)
+		for _, id := range q.Exclude {
+			args = append(args, id)
+		}
+	}
+	if !q.From.IsZero() {
+		where = append(where, `t.created_at >= ?`)
+		args = append(args, q.From.UTC().Format(searchTimeLayout))
+	}
+	if !q.To.IsZero() {
+		where = append(where, `t.created_at < ?`)
+		args = append(args, q.To.UTC().Format(searchTimeLayout))
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	args = append(args, limit, q.Offset)
+
+	rows, err := s.db.Query(`SELECT search_index.kind, search_index.transcript_id, t.slug, t.title, t.created_at,
+			search_index.claim_id, search_index.speaker_id, search_index.speaker, search_index.msg_index,
+			search_index.start_ms, search_index.type, search_index.text,
+			snippet(search_index, 0, '<mark>', '</mark>', '…', 16), bm25(search_index)
+		FROM search_index JOIN search_transcripts t ON t.transcript_id = search_index.transcript_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY bm25(search_index) LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hits := []SearchHit{}
+	for rows.Next() {
+		var h SearchHit
+		var createdAt string
+		var claimID, msgIndex, startMs sql.NullInt64
+		var speakerID, speaker, typ sql.NullString
+		if err := rows.Scan(&h.Kind, &h.TranscriptID, &h.Slug, &h.Title, &createdAt, &claimID, &speakerID, &speaker,
+			&msgIndex, &startMs, &typ, &h.Text, &h.Snippet, &h.Score); err != nil {
+			return nil, err
+		}
+		h.CreatedAt, _ = time.Parse(searchTimeLayout, createdAt)
+		if claimID.Valid {
+			h.ClaimID = &claimID.Int64
+		}
+		if msgIndex.Valid {
+			mi := int(msgIndex.Int64)
+			h.MsgIndex = &mi
+		}
+		if startMs.Valid {
+			h.StartMs = &startMs.Int64
+		}
+		h.SpeakerID, h.Speaker, h.Type = speakerID.String, speaker.String, typ.String
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// ftsMatch turns free text into an FTS5 query: every word must appear, the
+// last one as a prefix so results update while typing. Words are split the
+// way the unicode61 tokenizer splits them and quoted, so user input can't
+// use (or break) the query syntax.
+func ftsMatch(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	words[len(words)-1] += "*"
+	return strings.Join(words, " ")
+}
+
+func indexedSpeakerName(speakers map[string]string, id string) string {
+	if name := speakers[id]; name != "" {
+		return name
+	}
+	return id
+}
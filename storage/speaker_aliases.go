@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// speaker_aliases maps other spellings of a name to a speaker, so
+// "lane k." resolves to Lane when a transcript's speakers are saved.
+// Aliases never shadow a speaker's own name.
+const speakerAliasesSchema = `
+CREATE TABLE IF NOT EXISTS speaker_aliases (
+	alias TEXT PRIMARY KEY COLLATE NOCASE,
+	speaker_id INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_speaker_aliases_speaker ON speaker_aliases(speaker_id);
+`
+
+var ErrAliasTaken = errors.New("alias belongs to another speaker")
+
+type SpeakerAlias struct {
+	Alias     string `json:"alias"`
+	SpeakerID int64  `json:"speaker_id"`
+}
+
+// AddSpeakerAlias records alias as another name for the speaker. Adding an
+// alias the speaker already has is a no-op.
+func (s *Store) AddSpeakerAlias(speakerID int64, alias string) error {
+	alias = strings.TrimSpace(alias)
+	var owner int64
+	err := s.db.QueryRow(`SELECT speaker_id FROM speaker_aliases WHERE alias = ?`, alias).Scan(&owner)
+	switch {
+	case err == nil && owner != speakerID:
+		return ErrAliasTaken
+	case err == nil:
+		return nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO speaker_aliases (alias, speaker_id) VALUES (?, ?)`, alias, speakerID)
+	return err
+}
+
+// DeleteSpeakerAlias removes one of a speaker's aliases, returning
+// sql.ErrNoRows if the speaker has no such alias.
+func (s *Store) DeleteSpeakerAlias(speakerID int64, alias string) error {
+	res, err := s.db.Exec(`DELETE FROM speaker_aliases WHERE alias = ? AND speaker_id = ?`, strings.TrimSpace(alias), speakerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) ListSpeakerAliases(speakerID int64) ([]string, error) {
+	rows, err := s.db.Query(`SELECT alias FROM speaker_aliases WHERE speaker_id = ? ORDER BY alias`, speakerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aliases := []string{}
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// ResolveSpeakerAlias returns the name of the speaker an alias belongs to,
+// or sql.ErrNoRows if name is not an alias.
+func (s *Store) ResolveSpeakerAlias(name string) (string, error) {
+	var resolved string
+	err := s.db.QueryRow(`SELECT sp.name FROM speaker_aliases a JOIN speakers sp ON sp.id = a.speaker_id WHERE a.alias = ?`,
+		strings.TrimSpace(name)).Scan(&resolved)
+	return resolved, err
+}
+
+// MergeSpeakers folds dropID into keepID: every transcript appearance of
+// the dropped speaker is repointed, its aliases move over and its name
+// becomes an alias of the kept speaker. Occurrences reference speakers by
+// their per-transcript local id, so they follow transcript_speakers. It
+// returns the transcripts that changed.
+func (s *Store) MergeSpeakers(keepID, dropID int64) ([]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var dropName string
+	if err := tx.QueryRow(`SELECT name FROM speakers WHERE id = ?`, dropID).Scan(&dropName); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`SELECT DISTINCT transcript_id FROM transcript_speakers WHERE speaker_id = ?`, dropID)
+	if err != nil {
+		return nil, err
+	}
+	var tids []int64
+	for rows.Next() {
+		var tid int64
+		if err := rows.Scan(&tid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tids = append(tids, tid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []string{
+		`UPDATE transcript_speakers SET speaker_id = ? WHERE speaker_id = ?`,
+		`UPDATE speaker_aliases SET speaker_id = ? WHERE speaker_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, keepID, dropID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM speakers WHERE id = ?`, dropID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO speaker_aliases (alias, speaker_id) VALUES (?, ?)`, dropName, keepID); err != nil {
+		return nil, err
+	}
+	return tids, tx.Commit()
+}
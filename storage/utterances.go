@@ -0,0 +1,38 @@
+package storage
+
+// AppendUtterance adds m after a transcript's last utterance, with its
+// search row, and returns its position (the 1-based msg_index). speakerName
+// is the display name indexed for m.Speaker, if known.
+func (s *Store) AppendUtterance(transcriptID int64, m DiarizeMessage, speakerName string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if speakerName == "" {
+		speakerName = m.Speaker
+	}
+	var pos int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position), 0) + 1 FROM utterances WHERE transcript_id = ?`, transcriptID).Scan(&pos); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO utterances (transcript_id, position, speaker, text, start_ms, end_ms) VALUES (?, ?, ?, ?, ?, ?)`,
+		transcriptID, pos, m.Speaker, m.Text, m.StartMs, m.EndMs); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO search_index (text, kind, transcript_id, speaker_id, speaker, msg_index, start_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, m.Text, SearchUtterance, transcriptID, m.Speaker,
+		speakerName, pos, m.StartMs); err != nil {
+		return 0, err
+	}
+	return pos, tx.Commit()
+}
+
+// LastUtteranceEndMs returns when a transcript's latest utterance ends, or
+// 0 when none has a time.
+func (s *Store) LastUtteranceEndMs(transcriptID int64) (int64, error) {
+	var end int64
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(end_ms), 0) FROM utterances WHERE transcript_id = ?`, transcriptID).Scan(&end)
+	return end, err
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Transcriber turns an audio file into timed text. Segment times are
+// relative to the start of the file.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioPath string) ([]TimedSegment, error)
+}
+
+var transcriber Transcriber
+
+// newTranscriberFromEnv selects a backend from TRANSCRIBER:
+//   - "openai" (default): Whisper API, OPENAI_API_KEY
+//   - "whisper.cpp": local whisper.cpp CLI, WHISPER_BIN and WHISPER_MODEL
+//   - "faster-whisper": local whisper-ctranslate2 CLI, WHISPER_BIN and WHISPER_MODEL
+//   - "fake": segments read from TRANSCRIBER_FIXTURE (a JSON array)
+func newTranscriberFromEnv() (Transcriber, error) {
+	backend := strings.ToLower(getEnv("TRANSCRIBER", "openai"))
+	switch backend {
+	case "openai":
+		if openaiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY required for TRANSCRIBER=openai")
+		}
+		return &openAITranscriber{
+			apiKey:  openaiKey,
+			baseURL: strings.TrimSuffix(getEnv("WHISPER_BASE_URL", "https://api.openai.com/v1"), "/"),
+		}, nil
+	case "whisper.cpp", "whispercpp":
+		model := os.Getenv("WHISPER_MODEL")
+		if model == "" {
+			return nil, fmt.Errorf("WHISPER_MODEL (path to a ggml model) required for TRANSCRIBER=whisper.cpp")
+		}
+		return &localWhisperTranscriber{flavor: "whisper.cpp", bin: getEnv("WHISPER_BIN", "whisper-cli"), model: model}, nil
+	case "faster-whisper":
+		return &localWhisperTranscriber{flavor: "faster-whisper", bin: getEnv("WHISPER_BIN", "whisper-ctranslate2"), model: getEnv("WHISPER_MODEL", "small")}, nil
+	case "fake":
+		path := os.Getenv("TRANSCRIBER_FIXTURE")
+		if path == "" {
+			return &fakeTranscriber{}, nil
+		}
+		return loadFakeTranscriber(path)
+	}
+	return nil, fmt.Errorf("unknown TRANSCRIBER %q (want openai, whisper.cpp, faster-whisper or fake)", backend)
+}
+
+// segmentsText joins segment texts into the plain transcript string the
+// diarizer expects.
+func segmentsText(segments []TimedSegment) string {
+	parts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		if t := strings.TrimSpace(s.Text); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// --- OpenAI Whisper API ---
+
+type openAITranscriber struct {
+	apiKey  string
+	baseURL string
+}
+
+func (o *openAITranscriber) Transcribe(ctx context.Context, audioPath string) ([]TimedSegment, error) {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(part, f)
+
+	writer.WriteField("model", "whisper-1")
+	writer.WriteField("response_format", "verbose_json")
+	writer.WriteField("timestamp_granularities[]", "segment")
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/audio/transcriptions", &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("whisper API %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Text     string `json:"text"`
+		Segments []struct {
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+			Text  string  `json:"text"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper response: %v", err)
+	}
+	if len(result.Segments) == 0 && strings.TrimSpace(result.Text) != "" {
+		return []TimedSegment{{Text: strings.TrimSpace(result.Text)}}, nil
+	}
+	segments := make([]TimedSegment, 0, len(result.Segments))
+	for _, s := range result.Segments {
+		segments = append(segments, TimedSegment{
+			StartMs: int64(s.Start * 1000),
+			EndMs:   int64(s.End * 1000),
+			Text:    strings.TrimSpace(s.Text),
+		})
+	}
+	return segments, nil
+}
+
+// --- Local whisper.cpp / faster-whisper ---
+
+type localWhisperTranscriber struct {
+	flavor string // "whisper.cpp" or "faster-whisper"
+	bin    string
+	model  string
+}
+
+func (l *localWhisperTranscriber) Transcribe(ctx context.Context, audioPath string) ([]TimedSegment, error) {
+	tmpDir, err := os.MkdirTemp("", "whisper-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// whisper.cpp only reads 16kHz mono WAV; browser recordings are webm
+	input := audioPath
+	if l.flavor == "whisper.cpp" && !strings.EqualFold(filepath.Ext(audioPath), ".wav") {
+		input = filepath.Join(tmpDir, "input.wav")
+		conv := exec.CommandContext(ctx, "ffmpeg", "-y", "-i", audioPath, "-ar", "16000", "-ac", "1", input)
+		if out, err := conv.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	var cmd *exec.Cmd
+	if l.flavor == "whisper.cpp" {
+		cmd = exec.CommandContext(ctx, l.bin, "-m", l.model, "-f", input, "-oj", "-of", filepath.Join(tmpDir, "out"))
+	} else {
+		cmd = exec.CommandContext(ctx, l.bin, "--model", l.model, "--output_format", "json", "--output_dir", tmpDir, input)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", l.flavor, err, strings.TrimSpace(stderr.String()))
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(tmpDir, "*.json"))
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%s produced no JSON output", l.flavor)
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		return nil, err
+	}
+	if l.flavor == "whisper.cpp" {
+		return parseWhisperCppJSON(data)
+	}
+	return parseWhisperJSON(data)
+}
+
+// parseWhisperCppJSON reads whisper.cpp's -oj output, whose offsets are
+// already in milliseconds.
+func parseWhisperCppJSON(data []byte) ([]TimedSegment, error) {
+	var out struct {
+		Transcription []struct {
+			Offsets struct {
+				From int64 `json:"from"`
+				To   int64 `json:"to"`
+			} `json:"offsets"`
+			Text string `json:"text"`
+		} `json:"transcription"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper.cpp output: %w", err)
+	}
+	var segments []TimedSegment
+	for _, t := range out.Transcription {
+		if text := strings.TrimSpace(t.Text); text != "" {
+			segments = append(segments, TimedSegment{StartMs: t.Offsets.From, EndMs: t.Offsets.To, Text: text})
+		}
+	}
+	return segments, nil
+}
+
+// parseWhisperJSON reads the openai-whisper style JSON written by
+// faster-whisper frontends, with times in seconds.
+func parseWhisperJSON(data []byte) ([]TimedSegment, error) {
+	var out struct {
+		Segments []struct {
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+			Text  string  `json:"text"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper output: %w", err)
+	}
+	var segments []TimedSegment
+	for _, s := range out.Segments {
+		if text := strings.TrimSpace(s.Text); text != "" {
+			segments = append(segments, TimedSegment{StartMs: int64(s.Start * 1000), EndMs: int64(s.End * 1000), Text: text})
+		}
+	}
+	return segments, nil
+}
+
+// --- Fake ---
+
+// fakeTranscriber returns the same fixture segments for every file.
+type fakeTranscriber struct {
+	Segments []TimedSegment
+}
+
+func loadFakeTranscriber(path string) (*fakeTranscriber, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcriber fixture: %w", err)
+	}
+	var segments []TimedSegment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return nil, fmt.Errorf("failed to parse transcriber fixture: %w", err)
+	}
+	return &fakeTranscriber{Segments: segments}, nil
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, audioPath string) ([]TimedSegment, error) {
+	if _, err := os.Stat(audioPath); err != nil {
+		return nil, err
+	}
+	return append([]TimedSegment(nil), f.Segments...), nil
+}
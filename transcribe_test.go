@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+func TestOpenAITranscriberSegments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		if r.FormValue("response_format") != "verbose_json" {
+			t.Errorf("expected verbose_json, got %q", r.FormValue("response_format"))
+		}
+		w.Write([]byte(`{"text":"Hello there. General Kenobi.","segments":[
+			{"start":0.0,"end":1.5,"text":" Hello there."},
+			{"start":1.5,"end":3.25,"text":" General Kenobi."}]}`))
+	}))
+	defer srv.Close()
+
+	audio := filepath.Join(t.TempDir(), "a.wav")
+	os.WriteFile(audio, generateSilentWAV(1), 0644)
+
+	o := &openAITranscriber{apiKey: "k", baseURL: srv.URL}
+	segs, err := o.Transcribe(context.Background(), audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 2 || segs[1].StartMs != 1500 || segs[1].EndMs != 3250 || segs[1].Text != "General Kenobi." {
+		t.Fatalf("unexpected segments: %+v", segs)
+	}
+	if got := segmentsText(segs); got != "Hello there. General Kenobi." {
+		t.Fatalf("segmentsText = %q", got)
+	}
+}
+
+func TestParseWhisperCppJSON(t *testing.T) {
+	data := []byte(`{"transcription":[
+		{"offsets":{"from":0,"to":2000},"text":" First line."},
+		{"offsets":{"from":2000,"to":2100},"text":" "},
+		{"offsets":{"from":2100,"to":4000},"text":" Second line."}]}`)
+	segs, err := parseWhisperCppJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 2 || segs[1].StartMs != 2100 || segs[1].EndMs != 4000 {
+		t.Fatalf("unexpected segments: %+v", segs)
+	}
+}
+
+func TestParseWhisperJSON(t *testing.T) {
+	segs, err := parseWhisperJSON([]byte(`{"segments":[{"start":0.5,"end":1.25,"text":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 1 || segs[0].StartMs != 500 || segs[0].EndMs != 1250 {
+		t.Fatalf("unexpected segments: %+v", segs)
+	}
+}
+
+func TestAssignTimestampsUsesSegmentEnd(t *testing.T) {
+	messages := []storage.DiarizeMessage{
+		{Speaker: "speaker_1", Text: "Remote work is better"},
+		{Speaker: "speaker_2", Text: "Offices build culture"},
+	}
+	assignTimestamps(messages, []TimedSegment{
+		{StartMs: 1000, EndMs: 4000, Text: "remote work is better"},
+		{StartMs: 4000, EndMs: 7000, Text: "offices build culture"},
+	})
+	if messages[0].EndMs == nil || *messages[0].EndMs != 4000 {
+		t.Fatalf("first message end = %v", messages[0].EndMs)
+	}
+	if messages[1].EndMs == nil || *messages[1].EndMs != 7000 {
+		t.Fatalf("last message should end with final segment, got %v", messages[1].EndMs)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Live session events, published on a transcript's topic as the server
+// persists changes:
+//
+//	utterances  {offset, speakers, messages}  messages replace everything from offset on
+//	statements  {statements, replace}         replace swaps the whole tree; otherwise
+//	                                          statements nest under parent_text
+//	updates     {updates}                     StatementUpdate corrections
+//	speakers    {speakers}                    speaker_id → display name
+//	transcript  {...}                         title or source URL changed
+type utterancesEvent struct {
+	Offset   int                      `json:"offset"`
+	Speakers map[string]string        `json:"speakers,omitempty"`
+	Messages []storage.DiarizeMessage `json:"messages"`
+}
+
+type statementsEvent struct {
+	Statements []Statement `json:"statements"`
+	Replace    bool        `json:"replace,omitempty"`
+}
+
+type updatesEvent struct {
+	Updates []StatementUpdate `json:"updates"`
+}
+
+type speakersEvent struct {
+	Speakers map[string]string `json:"speakers"`
+}
+
+func transcriptTopic(id int64) string {
+	return "transcript:" + strconv.FormatInt(id, 10)
+}
+
+func publishUtterances(tid int64, offset int, speakers map[string]string, messages []storage.DiarizeMessage) {
+	if messages == nil {
+		messages = []storage.DiarizeMessage{}
+	}
+	events.publish(transcriptTopic(tid), sseEvent{Name: "utterances", Data: utterancesEvent{Offset: offset, Speakers: speakers, Messages: messages}})
+}
+
+func publishStatements(tid int64, statements []Statement, replace bool) {
+	if statements == nil {
+		statements = []Statement{}
+	}
+	events.publish(transcriptTopic(tid), sseEvent{Name: "statements", Data: statementsEvent{Statements: statements, Replace: replace}})
+}
+
+func publishUpdates(tid int64, updates []StatementUpdate) {
+	if len(updates) > 0 {
+		events.publish(transcriptTopic(tid), sseEvent{Name: "updates", Data: updatesEvent{Updates: updates}})
+	}
+}
+
+func publishSpeakers(tid int64, speakers map[string]string) {
+	events.publish(transcriptTopic(tid), sseEvent{Name: "speakers", Data: speakersEvent{Speakers: speakers}})
+}
+
+func publishTranscriptMeta(tid int64) {
+	if t, err := store.GetTranscript(tid); err == nil {
+		events.publish(transcriptTopic(tid), sseEvent{Name: "transcript", Data: t})
+	}
+}
+
+// streamTranscript sends the session's current utterances and tree, then
+// every change, as SSE events until the client goes away.
+func streamTranscript(w http.ResponseWriter, r *http.Request, t *storage.Transcript) {
+	ch, unsubscribe := events.subscribe(transcriptTopic(t.ID))
+	defer unsubscribe()
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	// Snapshot after subscribing so nothing persisted in between is lost. A
+	// change can land in both; clients skip statements they already have.
+	speakers, messages, _ := store.GetDiarization(t.ID)
+	if messages == nil {
+		messages = []storage.DiarizeMessage{}
+	}
+	snapshot := []sseEvent{
+		{Name: "transcript", Data: t},
+		{Name: "utterances", Data: utterancesEvent{Speakers: speakers, Messages: messages}},
+		{Name: "statements", Data: statementsEvent{Statements: transcriptStatements(t.ID), Replace: true}},
+	}
+	for _, ev := range snapshot {
+		if err := writeSSE(w, flusher, ev); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case ev := <-ch:
+			if err := writeSSE(w, flusher, ev); err != nil {
+				return
+			}
+		}
+	}
+}
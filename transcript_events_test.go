@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSSE struct {
+	name string
+	data string
+}
+
+// readSSE delivers the stream's events on a channel until it closes.
+func readSSE(t *testing.T, resp *http.Response) <-chan testSSE {
+	t.Helper()
+	ch := make(chan testSSE, 16)
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20)
+		var ev testSSE
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && ev.name != "":
+				ch <- ev
+				ev = testSSE{}
+			}
+		}
+	}()
+	return ch
+}
+
+func nextSSE(t *testing.T, ch <-chan testSSE, name string) testSSE {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatalf("stream closed waiting for %q", name)
+			}
+			if ev.name == name {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %q", name)
+		}
+	}
+}
+
+func TestTranscriptEventsStream(t *testing.T) {
+	setupTestStore(t)
+	mux := setupMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/session/new", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session struct {
+		Slug string `json:"slug"`
+	}
+	json.NewDecoder(resp.Body).Decode(&session)
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/api/transcripts/" + session.Slug + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+	stream := readSSE(t, resp)
+
+	// Snapshot of the empty session
+	var snap statementsEvent
+	json.Unmarshal([]byte(nextSSE(t, stream, "statements").data), &snap)
+	if !snap.Replace || len(snap.Statements) != 0 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+
+	// A second client analyzes into the session
+	body, _ := json.Marshal(map[string]any{
+		"transcript": "[1] (speaker_1) Ada: Go is simpler to deploy\n[2] (speaker_2) Ben: Python has more libraries",
+		"slug":       session.Slug,
+		"speakers":   map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"},
+		"messages": []map[string]any{
+			{"speaker": "speaker_1", "text": "Go is simpler to deploy"},
+			{"speaker": "speaker_2", "text": "Python has more libraries"},
+		},
+	})
+	resp2, err := http.Post(srv.URL+"/api/analyze", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+
+	var utts utterancesEvent
+	json.Unmarshal([]byte(nextSSE(t, stream, "utterances").data), &utts)
+	if utts.Offset != 0 || len(utts.Messages) != 2 || utts.Speakers["speaker_2"] != "Ben" {
+		t.Fatalf("unexpected utterances: %+v", utts)
+	}
+
+	var stmts statementsEvent
+	json.Unmarshal([]byte(nextSSE(t, stream, "statements").data), &stmts)
+	if !stmts.Replace || len(stmts.Statements) != 1 || len(stmts.Statements[0].Children) != 1 {
+		t.Fatalf("unexpected statements: %+v", stmts)
+	}
+
+	nextSSE(t, stream, "transcript")
+
+	// Speaker renames are pushed too
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/transcripts/"+session.Slug+"/speakers",
+		strings.NewReader(`{"speakers":{"speaker_1":"Ada L","speaker_2":"Ben"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp3, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp3.Body.Close()
+
+	var sp speakersEvent
+	json.Unmarshal([]byte(nextSSE(t, stream, "speakers").data), &sp)
+	if sp.Speakers["speaker_1"] != "Ada L" {
+		t.Fatalf("unexpected speakers: %+v", sp)
+	}
+
+	// Incremental corrections arrive as updates, then the new statements;
+	// ones already in the tree are neither stored nor sent again
+	prev := llm
+	fake := newFakeLLM()
+	fake.Respond = func(string) (string, error) {
+		return `{"statements":[{"speaker":"Ada","speaker_id":"speaker_1","text":"Go is simpler to deploy","type":"claim","msg_index":1},` +
+			`{"speaker":"Ada","speaker_id":"speaker_1","text":"Go has enough libraries","type":"response","msg_index":3,"parent_text":"Python has more libraries"}],` +
+			`"updates":[{"msg_index":2,"type":"rebuttal"}]}`, nil
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+	body, _ = json.Marshal(map[string]any{
+		"new_text":     "[3] (speaker_1) Ada: Go has enough libraries",
+		"context_text": "[1] (speaker_1) Ada: Go is simpler to deploy\n[2] (speaker_2) Ben: Python has more libraries",
+		"slug":         session.Slug,
+	})
+	resp4, err := http.Post(srv.URL+"/api/analyze-incremental", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp4.Body.Close()
+
+	var ups updatesEvent
+	json.Unmarshal([]byte(nextSSE(t, stream, "updates").data), &ups)
+	if len(ups.Updates) != 1 || ups.Updates[0].MsgIndex != 2 || *ups.Updates[0].Type != "rebuttal" {
+		t.Fatalf("unexpected updates: %+v", ups)
+	}
+	var added statementsEvent
+	json.Unmarshal([]byte(nextSSE(t, stream, "statements").data), &added)
+	if added.Replace || len(added.Statements) != 1 || added.Statements[0].ParentText != "Python has more libraries" {
+		t.Fatalf("unexpected incremental statements: %+v", added)
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+// Imports turn already-labeled transcripts into diarized messages, so they
+// skip the LLM diarization pass. Every parser yields cues; cues are then
+// grouped into one message per speaker turn.
+const maxImportBytes = 10 << 20
+
+// importCue is one timed line of a transcript. Speaker is the label as
+// written (a name, or a speaker id in JSON imports), empty when unlabeled.
+type importCue struct {
+	Speaker string
+	Text    string
+	StartMs *int64
+	EndMs   *int64
+}
+
+var importParsers = map[string]func(string) ([]importCue, error){
+	"srt":   parseSRT,
+	"vtt":   parseVTT,
+	"otter": parseOtter,
+}
+
+// POST /api/import/transcript — multipart "file" or the raw body, with an
+// optional "format" (srt, vtt, otter, json) that is otherwise detected.
+func handleAPIImportTranscript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	format := r.URL.Query().Get("format")
+	var data []byte
+	var filename string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			jsonError(w, "no file", 400)
+			return
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		if err != nil {
+			jsonError(w, "failed to read file", 400)
+			return
+		}
+		filename = header.Filename
+		if f := r.FormValue("format"); f != "" {
+			format = f
+		}
+	} else {
+		var err error
+		data, err = io.ReadAll(r.Body)
+		if err != nil {
+			jsonError(w, "failed to read body", 400)
+			return
+		}
+	}
+
+	content := strings.TrimPrefix(string(data), "\ufeff")
+	if strings.TrimSpace(content) == "" {
+		jsonError(w, "empty transcript", 400)
+		return
+	}
+	if format == "" {
+		format = detectImportFormat(filename, content)
+	}
+
+	var speakers map[string]string
+	var messages []storage.DiarizeMessage
+	var err error
+	if format == "json" {
+		speakers, messages, err = parseImportJSON(content)
+	} else if parse, ok := importParsers[format]; ok {
+		var cues []importCue
+		if cues, err = parse(content); err == nil {
+			speakers, messages = groupCues(cues)
+		}
+	} else {
+		err = fmt.Errorf("unsupported format %q (want srt, vtt, otter or json)", format)
+	}
+	if err == nil && len(messages) == 0 {
+		err = fmt.Errorf("no utterances found")
+	}
+	if err != nil {
+		jsonError(w, "import failed: "+err.Error(), 400)
+		return
+	}
+
+	var sb strings.Builder
+	for _, msg := range messages {
+		name := speakers[msg.Speaker]
+		if name == "" {
+			name = msg.Speaker
+		}
+		sb.WriteString(name + ": " + msg.Text + "\n")
+	}
+
+	title := ""
+	if filename != "" {
+		title = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"format":   format,
+		"speakers": speakers,
+		"messages": messages,
+		"text":     sb.String(),
+		"title":    title,
+	})
+}
+
+func detectImportFormat(filename, content string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".srt":
+		return "srt"
+	case ".vtt":
+		return "vtt"
+	case ".json":
+		return "json"
+	}
+	trimmed := strings.TrimSpace(content)
+	switch {
+	case strings.HasPrefix(trimmed, "WEBVTT"):
+		return "vtt"
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		return "json"
+	case strings.Contains(trimmed, "-->"):
+		return "srt"
+	}
+	return "otter"
+}
+
+// --- SRT and WebVTT ---
+
+// cueTiming matches "00:01:02,500 --> 00:01:04,000" (SRT) and
+// "01:02.500 --> 01:04.000 align:start" (WebVTT, hours optional).
+var cueTiming = regexp.MustCompile(`^((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+
+// parseTimestamp reads "h:mm:ss.mmm", "mm:ss,mmm", "h:mm:ss" or "m:ss".
+func parseTimestamp(s string) (int64, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	var frac int64
+	if i := strings.Index(s, "."); i != -1 {
+		digits := (s[i+1:] + "00")[:3]
+		f, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad timestamp %q", s)
+		}
+		frac = f
+		s = s[:i]
+	}
+	var total int64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad timestamp %q", s)
+		}
+		total = total*60 + n
+	}
+	return total*1000 + frac, nil
+}
+
+// splitBlocks splits on blank lines, normalizing line endings.
+func splitBlocks(content string) [][]string {
+	var blocks [][]string
+	var cur []string
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(content, "\r\n", "\n")))
+	scanner.Buffer(make([]byte, 64<<10), maxImportBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			if len(cur) > 0 {
+				blocks = append(blocks, cur)
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, line)
+	}
+	if len(cur) > 0 {
+		blocks = append(blocks, cur)
+	}
+	return blocks
+}
+
+// parseCueBlock finds the timing line in a block and returns the timed cue
+// and the text lines after it; ok is false for blocks without one.
+func parseCueBlock(block []string) (cue importCue, lines []string, ok bool, err error) {
+	for i, line := range block {
+		m := cueTiming.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		start, err := parseTimestamp(m[1])
+		if err != nil {
+			return cue, nil, false, err
+		}
+		end, err := parseTimestamp(m[2])
+		if err != nil {
+			return cue, nil, false, err
+		}
+		cue.StartMs, cue.EndMs = &start, &end
+		return cue, block[i+1:], true, nil
+	}
+	return cue, nil, false, nil
+}
+
+// speakerPrefix matches a leading "Name: " or "- Name: " label.
+var speakerPrefix = regexp.MustCompile(`^-?\s*([^:\[\]()<>]{1,40}?):\s+(.*)$`)
+
+func splitSpeakerPrefix(text string) (speaker, rest string) {
+	if m := speakerPrefix.FindStringSubmatch(text); m != nil {
+		return strings.TrimSpace(m[1]), m[2]
+	}
+	return "", text
+}
+
+func parseSRT(content string) ([]importCue, error) {
+	var cues []importCue
+	for _, block := range splitBlocks(content) {
+		cue, lines, ok, err := parseCueBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		text := oneLine(stripCueTags(strings.Join(lines, " ")))
+		cue.Speaker, cue.Text = splitSpeakerPrefix(text)
+		if cue.Text != "" {
+			cues = append(cues, cue)
+		}
+	}
+	return cues, nil
+}
+
+var (
+	vttVoiceTag = regexp.MustCompile(`<v(?:\.[^\s>]+)*\s+([^>]+)>`)
+	cueTag      = regexp.MustCompile(`</?[^>]*>`)
+)
+
+func stripCueTags(s string) string {
+	s = cueTag.ReplaceAllString(s, "")
+	return strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", " ").Replace(s)
+}
+
+// parseVTT reads WebVTT cues. A cue may hold several voices
+// ("<v Ada>Yes.</v> <v Ben>No.</v>"); each becomes its own cue sharing the
+// timing. NOTE, STYLE and REGION blocks have no timing line and are skipped.
+func parseVTT(content string) ([]importCue, error) {
+	if !strings.HasPrefix(strings.TrimSpace(content), "WEBVTT") {
+		return nil, fmt.Errorf("missing WEBVTT header")
+	}
+	var cues []importCue
+	for _, block := range splitBlocks(content) {
+		cue, lines, ok, err := parseCueBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		raw := strings.Join(lines, " ")
+		voices := vttVoiceTag.FindAllStringSubmatchIndex(raw, -1)
+		if len(voices) == 0 {
+			c := cue
+			c.Speaker, c.Text = splitSpeakerPrefix(oneLine(stripCueTags(raw)))
+			if c.Text != "" {
+				cues = append(cues, c)
+			}
+			continue
+		}
+		for i, v := range voices {
+			end := len(raw)
+			if i+1 < len(voices) {
+				end = voices[i+1][0]
+			}
+			c := cue
+			c.Speaker = strings.TrimSpace(raw[v[2]:v[3]])
+			c.Text = oneLine(stripCueTags(raw[v[1]:end]))
+			if c.Text != "" {
+				cues = append(cues, c)
+			}
+		}
+	}
+	return cues, nil
+}
+
+// --- Otter / Zoom ---
+
+var otterHeaderLine = regexp.MustCompile(`^(.{1,60}?)\s{2,}(\d{1,2}(?::\d{2}){1,2})$`)
+
+// parseOtter reads "Name  0:01:23" header lines (two or more spaces before
+// the timestamp) each followed by that speaker's text. A turn ends where the
+// next begins.
+func parseOtter(content string) ([]importCue, error) {
+	var cues []importCue
+	var cur *importCue
+	var text []string
+	flush := func() {
+		if cur != nil {
+			cur.Text = oneLine(strings.Join(text, " "))
+			if cur.Text != "" {
+				cues = append(cues, *cur)
+			}
+		}
+		text = nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if m := otterHeaderLine.FindStringSubmatch(line); m != nil {
+			start, err := parseTimestamp(m[2])
+			if err != nil {
+				return nil, err
+			}
+			if cur != nil {
+				end := start
+				cur.EndMs = &end
+			}
+			flush()
+			cur = &importCue{Speaker: strings.TrimSpace(m[1]), StartMs: &start}
+			continue
+		}
+		if line != "" && cur != nil {
+			text = append(text, line)
+		}
+	}
+	flush()
+	if len(cues) == 0 {
+		return nil, fmt.Errorf(`no "Name  00:00" speaker lines found`)
+	}
+	return cues, nil
+}
+
+// groupCues assigns speaker ids in order of appearance and merges
+// consecutive cues from the same speaker into one message. Unlabeled cues
+// continue the previous speaker's turn; in a transcript with no labels at
+// all each cue stays its own message.
+func groupCues(cues []importCue) (map[string]string, []storage.DiarizeMessage) {
+	speakers := map[string]string{}
+	ids := map[string]string{}
+	labeled := false
+	for _, c := range cues {
+		if c.Speaker != "" {
+			labeled = true
+			break
+		}
+	}
+
+	var messages []storage.DiarizeMessage
+	prevID := ""
+	for _, c := range cues {
+		id := prevID
+		if c.Speaker != "" {
+			var ok bool
+			if id, ok = ids[c.Speaker]; !ok {
+				id = fmt.Sprintf("speaker_%d", len(ids)+1)
+				ids[c.Speaker] = id
+				speakers[id] = c.Speaker
+			}
+		} else if id == "" {
+			id = "speaker_1"
+			if _, ok := speakers[id]; !ok {
+				speakers[id] = ""
+				ids[""] = id
+			}
+		}
+
+		if labeled && id == prevID && len(messages) > 0 {
+			last := &messages[len(messages)-1]
+			last.Text += " " + c.Text
+			if c.EndMs != nil {
+				last.EndMs = c.EndMs
+			}
+			continue
+		}
+		messages = append(messages, storage.DiarizeMessage{
+			Speaker:  id,
+			Text:     c.Text,
+			Position: len(messages) + 1,
+			StartMs:  c.StartMs,
+			EndMs:    c.EndMs,
+		})
+		prevID = id
+	}
+	return speakers, messages
+}
+
+// --- JSON ---
+
+// importJSON is the documented JSON import format. Messages name their
+// speaker by id (a key of speakers) or by display name; times are optional.
+//
+//	{"speakers": {"speaker_1": "Ada"},
+//	 "messages": [{"speaker": "speaker_1", "text": "...", "start_ms": 0, "end_ms": 2100}]}
+//
+// A bare array of messages is accepted too.
+type importJSON struct {
+	Speakers map[string]string `json:"speakers"`
+	Messages []struct {
+		Speaker string `json:"speaker"`
+		Text    string `json:"text"`
+		StartMs *int64 `json:"start_ms"`
+		EndMs   *int64 `json:"end_ms"`
+	} `json:"messages"`
+}
+
+func parseImportJSON(content string) (map[string]string, []storage.DiarizeMessage, error) {
+	var doc importJSON
+	trimmed := strings.TrimSpace(content)
+	var err error
+	if strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal([]byte(trimmed), &doc.Messages)
+	} else {
+		err = json.Unmarshal([]byte(trimmed), &doc)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	speakers := map[string]string{}
+	ids := map[string]string{} // display name → id, for messages naming speakers
+	for id, name := range doc.Speakers {
+		speakers[id] = name
+		ids[name] = id
+	}
+	var messages []storage.DiarizeMessage
+	for i, m := range doc.Messages {
+		text := strings.TrimSpace(m.Text)
+		if text == "" {
+			continue
+		}
+		if m.StartMs != nil && m.EndMs != nil && *m.EndMs < *m.StartMs {
+			return nil, nil, fmt.Errorf("message %d ends before it starts", i+1)
+		}
+		id := m.Speaker
+		_, ok := speakers[id]
+		if !ok {
+			id, ok = ids[m.Speaker]
+		}
+		if !ok {
+			for n := len(speakers) + 1; ; n++ {
+				if id = fmt.Sprintf("speaker_%d", n); !hasKey(speakers, id) {
+					break
+				}
+			}
+			speakers[id] = m.Speaker
+			ids[m.Speaker] = id
+		}
+		messages = append(messages, storage.DiarizeMessage{
+			Speaker:  id,
+			Text:     text,
+			Position: len(messages) + 1,
+			StartMs:  m.StartMs,
+			EndMs:    m.EndMs,
+		})
+	}
+	return speakers, messages, nil
+}
+
+func hasKey(m map[string]string, k string) bool {
+	_, ok := m[k]
+	return ok
+}
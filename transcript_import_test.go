@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kayushkin/argraphments/storage"
+)
+
+type importResponse struct {
+	Format   string                   `json:"format"`
+	Speakers map[string]string        `json:"speakers"`
+	Messages []storage.DiarizeMessage `json:"messages"`
+	Text     string                   `json:"text"`
+	Title    string                   `json:"title"`
+	Error    string                   `json:"error"`
+}
+
+func importTranscript(t *testing.T, filename, content string) (int, importResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/import/transcript", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, req)
+	var resp importResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func msgTimes(m storage.DiarizeMessage) (int64, int64) {
+	var start, end int64 = -1, -1
+	if m.StartMs != nil {
+		start = *m.StartMs
+	}
+	if m.EndMs != nil {
+		end = *m.EndMs
+	}
+	return start, end
+}
+
+func TestImportSRT(t *testing.T) {
+	srt := "1\r\n00:00:01,000 --> 00:00:03,500\r\nAda: Go is simpler\r\nto deploy.\r\n\r\n" +
+		"2\r\n00:00:03,600 --> 00:00:05,000\r\nA single binary.\r\n\r\n" +
+		"3\r\n00:00:05,200 --> 00:00:07,000\r\n- Ben: Python has <i>more</i> libraries.\r\n"
+	code, resp := importTranscript(t, "standup.srt", srt)
+	if code != 200 {
+		t.Fatalf("status %d: %s", code, resp.Error)
+	}
+	if resp.Format != "srt" || resp.Title != "standup" || resp.Speakers["speaker_1"] != "Ada" || resp.Speakers["speaker_2"] != "Ben" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(resp.Messages) != 2 || resp.Messages[0].Text != "Go is simpler to deploy. A single binary." ||
+		resp.Messages[1].Text != "Python has more libraries." {
+		t.Fatalf("unexpected messages: %+v", resp.Messages)
+	}
+	if start, end := msgTimes(resp.Messages[0]); start != 1000 || end != 5000 {
+		t.Fatalf("first message timed %d-%d", start, end)
+	}
+}
+
+func TestImportVTTVoiceTags(t *testing.T) {
+	vtt := `WEBVTT
+
+NOTE exported from a meeting tool
+
+intro
+00:01.000 --> 00:02.500 align:start
+<v.loud Ada Lovelace>Yes.</v> <v Ben>No, &amp; here's why.</v>
+
+00:00:02.600 --> 00:00:04.000
+<v Ben>It <b>doesn't</b> scale.
+`
+	code, resp := importTranscript(t, "captions.txt", vtt)
+	if code != 200 {
+		t.Fatalf("status %d: %s", code, resp.Error)
+	}
+	if resp.Format != "vtt" || resp.Speakers["speaker_1"] != "Ada Lovelace" || len(resp.Messages) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Messages[1].Speaker != "speaker_2" || resp.Messages[1].Text != "No, & here's why. It doesn't scale." {
+		t.Fatalf("unexpected second message: %+v", resp.Messages[1])
+	}
+	if start, end := msgTimes(resp.Messages[1]); start != 1000 || end != 4000 {
+		t.Fatalf("second message timed %d-%d", start, end)
+	}
+}
+
+func TestImportOtter(t *testing.T) {
+	otter := "Ada Lovelace  0:03\nGo is simpler to deploy.\nA single binary.\n\nBen  1:02:10\nPython has more libraries.\n"
+	code, resp := importTranscript(t, "meeting.txt", otter)
+	if code != 200 {
+		t.Fatalf("status %d: %s", code, resp.Error)
+	}
+	if resp.Format != "otter" || len(resp.Messages) != 2 || resp.Messages[0].Text != "Go is simpler to deploy. A single binary." {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if start, end := msgTimes(resp.Messages[0]); start != 3000 || end != 3730000 {
+		t.Fatalf("first message timed %d-%d", start, end)
+	}
+	if start, end := msgTimes(resp.Messages[1]); start != 3730000 || end != -1 {
+		t.Fatalf("last message timed %d-%d", start, end)
+	}
+	if !strings.HasPrefix(resp.Text, "Ada Lovelace: Go is simpler") {
+		t.Fatalf("unexpected text: %q", resp.Text)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	doc := `{"speakers":{"speaker_1":"Ada"},"messages":[
+		{"speaker":"speaker_1","text":"Go is simpler","start_ms":0,"end_ms":1500},
+		{"speaker":"Ben","text":"Python has more libraries"},
+		{"speaker":"Ada","text":"Deploys matter"}]}`
+	code, resp := importTranscript(t, "convo.json", doc)
+	if code != 200 {
+		t.Fatalf("status %d: %s", code, resp.Error)
+	}
+	if resp.Speakers["speaker_2"] != "Ben" || len(resp.Messages) != 3 || resp.Messages[1].Speaker != "speaker_2" ||
+		resp.Messages[2].Speaker != "speaker_1" || resp.Messages[1].StartMs != nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	if code, resp := importTranscript(t, "bad.json", `[{"speaker":"A","text":"x","start_ms":5,"end_ms":1}]`); code != 400 || !strings.Contains(resp.Error, "ends before") {
+		t.Fatalf("expected 400 for inverted times, got %d %+v", code, resp)
+	}
+}
+
+func TestImportUnlabeledCuesStaySeparate(t *testing.T) {
+	srt := "1\n00:00:01,000 --> 00:00:02,000\nFirst line.\n\n2\n00:00:02,000 --> 00:00:03,000\nSecond line.\n"
+	_, resp := importTranscript(t, "captions.srt", srt)
+	if len(resp.Messages) != 2 || resp.Messages[1].Speaker != "speaker_1" || resp.Speakers["speaker_1"] != "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestImportRejectsEmptyAndUnknown(t *testing.T) {
+	if code, _ := importTranscript(t, "x.srt", "  "); code != 400 {
+		t.Fatalf("expected 400 for empty file, got %d", code)
+	}
+	if code, _ := importTranscript(t, "notes.txt", "just some prose without speaker lines"); code != 400 {
+		t.Fatalf("expected 400 for unrecognized text, got %d", code)
+	}
+}
+
+func TestImportRawBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/import/transcript?format=otter", strings.NewReader("Ada  0:01\nHello there.\n"))
+	w := httptest.NewRecorder()
+	setupMux().ServeHTTP(w, req)
+	var resp importResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || len(resp.Messages) != 1 || resp.Speakers["speaker_1"] != "Ada" || resp.Title != "" {
+		t.Fatalf("unexpected response: %d %+v", w.Code, resp)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// llmRepairAttempts is how many times an extractor re-prompts the model
+// with the problems found in its previous answer.
+var llmRepairAttempts = getEnvInt("LLM_REPAIR_ATTEMPTS", 1)
+
+// ValidationReport lists what was done to make an LLM answer usable. It is
+// returned alongside results so clients can tell what the model actually said.
+type ValidationReport struct {
+	Repairs   []string          `json:"repairs,omitempty"`
+	Dropped   []ValidationIssue `json:"dropped,omitempty"`
+	Corrected []ValidationIssue `json:"corrected,omitempty"`
+}
+
+type ValidationIssue struct {
+	Text     string `json:"text"`
+	MsgIndex *int   `json:"msg_index,omitempty"`
+	Field    string `json:"field"`
+	Problem  string `json:"problem"`
+}
+
+func (r *ValidationReport) empty() bool {
+	return r == nil || len(r.Repairs) == 0 && len(r.Dropped) == 0 && len(r.Corrected) == 0
+}
+
+// merge folds other into r, allocating r if needed, and returns nil when
+// the result has nothing to report.
+func (r *ValidationReport) merge(other *ValidationReport) *ValidationReport {
+	if other.empty() {
+		if r.empty() {
+			return nil
+		}
+		return r
+	}
+	if r == nil {
+		r = &ValidationReport{}
+	}
+	r.Repairs = append(r.Repairs, other.Repairs...)
+	r.Dropped = append(r.Dropped, other.Dropped...)
+	r.Corrected = append(r.Corrected, other.Corrected...)
+	return r
+}
+
+func (r *ValidationReport) drop(s Statement, field, problem string) {
+	r.Dropped = append(r.Dropped, ValidationIssue{Text: s.Text, MsgIndex: s.MsgIndex, Field: field, Problem: problem})
+}
+
+func (r *ValidationReport) correct(s Statement, field, problem string) {
+	r.Corrected = append(r.Corrected, ValidationIssue{Text: s.Text, MsgIndex: s.MsgIndex, Field: field, Problem: problem})
+}
+
+// problems describes dropped statements for a re-prompt. Corrections are
+// applied locally and aren't worth another round trip.
+func (r *ValidationReport) problems() []string {
+	var out []string
+	for _, d := range r.Dropped {
+		out = append(out, fmt.Sprintf("statement %q: %s", d.Text, d.Problem))
+	}
+	return out
+}
+
+// completeJSON runs prompt and hands the reply to decode, which parses,
+// validates and keeps the result. A reply that doesn't parse is retried as
+// truncated JSON first. If decode still fails or reports problems, the model
+// is re-prompted with them up to llmRepairAttempts times. Leftover problems
+// after the last attempt are not an error; a reply that never parsed is.
+// Errors from the LLM itself are returned unchanged. Only a reply decode
+// takes without problems is cached.
+func completeJSON(ctx context.Context, prompt string, opts CompletionOptions, decode func(text string) (problems []string, err error)) ([]string, error) {
+	var repairs []string
+	parsed := false
+	current := prompt
+	for attempt := 0; ; attempt++ {
+		callCtx := trackLLMCacheHit(ctx)
+		text, err := llm.Complete(callCtx, current, opts)
+		if err != nil {
+			return repairs, err
+		}
+		raw := text
+		text = stripCodeFences(text)
+
+		problems, derr := decode(text)
+		if derr != nil {
+			if fixed, ok := repairTruncatedJSON(text); ok {
+				if problems, err = decode(fixed); err == nil {
+					derr = nil
+					repairs = append(repairs, "completed truncated JSON")
+				}
+			}
+		}
+		parsed = parsed || derr == nil
+		if derr == nil && len(problems) == 0 {
+			acceptLLMReply(callCtx, current, opts, raw)
+			return repairs, nil
+		}
+		if attempt >= llmRepairAttempts {
+			if !parsed {
+				return repairs, fmt.Errorf("unparseable LLM reply: %v\nraw: %s", derr, text)
+			}
+			return repairs, nil
+		}
+		if derr != nil {
+			problems = []string{"invalid JSON: " + derr.Error()}
+		}
+		repairs = append(repairs, "re-prompted: "+strings.Join(problems, "; "))
+		current = prompt + repairFeedback(problems)
+	}
+}
+
+func repairFeedback(problems []string) string {
+	var sb strings.Builder
+	sb.WriteString("\n\nYour previous answer could not be used as-is:\n")
+	for _, p := range problems {
+		sb.WriteString("- " + p + "\n")
+	}
+	sb.WriteString("Return the complete corrected JSON only, in the format described above.")
+	return sb.String()
+}
+
+// repairTruncatedJSON recovers a reply cut off mid-document (usually at the
+// token limit) by cutting back to the last complete object and closing
+// whatever arrays and objects are still open.
+func repairTruncatedJSON(text string) (string, bool) {
+	end := len(text)
+	for tries := 0; tries < 200; tries++ {
+		i := strings.LastIndex(text[:end], "}")
+		if i < 0 {
+			return "", false
+		}
+		if closed, ok := closeJSON(text[:i+1]); ok && json.Valid([]byte(closed)) {
+			return closed, true
+		}
+		end = i
+	}
+	return "", false
+}
+
+// closeJSON appends the closers for every bracket left open in s. It fails
+// if s ends inside a string.
+func closeJSON(s string) (string, bool) {
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			stack = append(stack, '}')
+		case c == '[':
+			stack = append(stack, ']')
+		case c == '}' || c == ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if inString {
+		return "", false
+	}
+	var sb strings.Builder
+	sb.WriteString(s)
+	for i := len(stack) - 1; i >= 0; i-- {
+		sb.WriteByte(stack[i])
+	}
+	return sb.String(), true
+}
+
+// --- Statement schema ---
+
+var statementTypes = map[string]bool{
+	"claim": true, "response": true, "question": true, "agreement": true,
+	"rebuttal": true, "tangent": true, "clarification": true, "evidence": true,
+}
+
+// statementTypeAliases maps near-miss types models produce to the closest
+// allowed one.
+var statementTypeAliases = map[string]string{
+	"assertion":       "claim",
+	"statement":       "claim",
+	"answer":          "response",
+	"reply":           "response",
+	"follow-up":       "response",
+	"followup":        "response",
+	"agree":           "agreement",
+	"concession":      "agreement",
+	"counterclaim":    "rebuttal",
+	"counterargument": "rebuttal",
+	"counterpoint":    "rebuttal",
+	"disagreement":    "rebuttal",
+	"objection":       "rebuttal",
+	"clarify":         "clarification",
+	"support":         "evidence",
+	"example":         "evidence",
+}
+
+var factCheckVerdicts = map[string]bool{
+	"false": true, "misleading": true, "unverified": true, "mostly-true": true,
+}
+
+func normalizeEnum(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer(" ", "-", "_", "-").Replace(s)
+}
+
+// normalizeStatementType returns the allowed type for t, or "" if there is
+// no sensible match.
+func normalizeStatementType(t string) string {
+	t = normalizeEnum(t)
+	if statementTypes[t] {
+		return t
+	}
+	return statementTypeAliases[t]
+}
+
+// statementBounds is what a statement can legitimately refer to in the
+// transcript it was extracted from.
+type statementBounds struct {
+	MinIndex, MaxIndex int               // inclusive msg_index range; MaxIndex 0 skips the check
+	Speakers           map[string]string // speaker_id → display name; empty skips the check
+	LineSpeakers       map[int]string    // msg_index → speaker_id on that line
+}
+
+var speakerTagPattern = regexp.MustCompile(`^\((speaker_\d+)\)\s*(?:([^:]{1,40}):)?`)
+
+// transcriptBounds reads msg_index range and speaker ids from the
+// "[N] (speaker_id) Name: text" lines sent to the model. The valid speakers
+// are those in speakers, or the line tags when it is empty.
+func transcriptBounds(transcript string, speakers map[string]string) statementBounds {
+	b := statementBounds{Speakers: map[string]string{}, LineSpeakers: map[int]string{}}
+	for id, name := range speakers {
+		b.Speakers[id] = name
+	}
+	for i, line := range numberedLines(transcript) {
+		n := msgIndexOfLine(line, i+1)
+		if b.MinIndex == 0 || n < b.MinIndex {
+			b.MinIndex = n
+		}
+		b.MaxIndex = max(b.MaxIndex, n)
+		rest := strings.TrimSpace(numberedLinePattern.ReplaceAllString(line, ""))
+		if m := speakerTagPattern.FindStringSubmatch(rest); m != nil {
+			if name := strings.TrimSpace(m[2]); len(speakers) == 0 && (name != "" || b.Speakers[m[1]] == "") {
+				b.Speakers[m[1]] = name
+			}
+			b.LineSpeakers[n] = m[1]
+		}
+	}
+	return b
+}
+
+// validateStatements checks each statement against the schema and bounds,
+// fixing what it can and dropping what it can't. Children of a dropped
+// statement take its place.
+func validateStatements(stmts []Statement, b statementBounds, report *ValidationReport) []Statement {
+	return validateLevel(stmts, b, report, 0)
+}
+
+func validateLevel(stmts []Statement, b statementBounds, report *ValidationReport, depth int) []Statement {
+	out := []Statement{}
+	for _, s := range stmts {
+		if strings.TrimSpace(s.Text) == "" {
+			report.drop(s, "text", "empty text")
+			out = append(out, validateLevel(s.Children, b, report, depth)...)
+			continue
+		}
+
+		if t := normalizeStatementType(s.Type); t == "" {
+			fallback := "claim"
+			if depth > 0 {
+				fallback = "response"
+			}
+			report.correct(s, "type", fmt.Sprintf("unknown type %q, using %q", s.Type, fallback))
+			s.Type = fallback
+		} else {
+			s.Type = t
+		}
+
+		if s.MsgIndex != nil && b.MaxIndex > 0 && (*s.MsgIndex < b.MinIndex || *s.MsgIndex > b.MaxIndex) {
+			report.correct(s, "msg_index", fmt.Sprintf("msg_index %d outside %d-%d, removed", *s.MsgIndex, b.MinIndex, b.MaxIndex))
+			s.MsgIndex = nil
+		}
+
+		if len(b.Speakers) > 0 {
+			if _, ok := b.Speakers[s.SpeakerID]; !ok || s.SpeakerID == "" {
+				s.SpeakerID = resolveSpeakerID(s, b, report)
+			}
+		}
+
+		if s.FactCheck != nil {
+			if v := normalizeEnum(s.FactCheck.Verdict); factCheckVerdicts[v] {
+				s.FactCheck.Verdict = v
+			} else {
+				report.correct(s, "fact_check", fmt.Sprintf("verdict %q not flaggable, fact check removed", s.FactCheck.Verdict))
+				s.FactCheck = nil
+			}
+		}
+		if s.Fallacy != nil && strings.TrimSpace(s.Fallacy.Name) == "" {
+			report.correct(s, "fallacy", "unnamed fallacy removed")
+			s.Fallacy = nil
+		}
+
+		s.Children = validateLevel(s.Children, b, report, depth+1)
+		out = append(out, s)
+	}
+	return out
+}
+
+// resolveSpeakerID replaces a missing or unknown speaker_id by matching the
+// display name, then by the speaker on the statement's line, and otherwise
+// clears it.
+func resolveSpeakerID(s Statement, b statementBounds, report *ValidationReport) string {
+	problem := fmt.Sprintf("unknown speaker_id %q", s.SpeakerID)
+	if s.SpeakerID == "" {
+		problem = "missing speaker_id"
+	}
+	for id, name := range b.Speakers {
+		if name != "" && strings.EqualFold(name, strings.TrimSpace(s.Speaker)) {
+			report.correct(s, "speaker_id", fmt.Sprintf("%s, matched %q by name", problem, id))
+			return id
+		}
+	}
+	if s.MsgIndex != nil {
+		if id, ok := b.LineSpeakers[*s.MsgIndex]; ok {
+			if _, known := b.Speakers[id]; known {
+				report.correct(s, "speaker_id", fmt.Sprintf("%s, using %q from message %d", problem, id, *s.MsgIndex))
+				return id
+			}
+		}
+	}
+	if s.SpeakerID != "" {
+		report.correct(s, "speaker_id", problem+" removed")
+	}
+	return ""
+}
+
+// validateUpdates normalizes update types and drops updates that no longer
+// change anything.
+func validateUpdates(updates []StatementUpdate, report *ValidationReport) []StatementUpdate {
+	var out []StatementUpdate
+	for _, u := range updates {
+		idx := u.MsgIndex
+		issue := Statement{MsgIndex: &idx}
+		if u.Text != nil {
+			issue.Text = *u.Text
+		}
+		if u.MsgIndex < 1 {
+			report.drop(issue, "msg_index", fmt.Sprintf("update has invalid msg_index %d", u.MsgIndex))
+			continue
+		}
+		if u.Type != nil {
+			if t := normalizeStatementType(*u.Type); t != "" {
+				u.Type = &t
+			} else {
+				report.correct(issue, "type", fmt.Sprintf("unknown type %q in update, ignored", *u.Type))
+				u.Type = nil
+			}
+		}
+		if u.Text == nil && u.Type == nil && u.ParentText == nil {
+			report.drop(issue, "updates", "update changes nothing")
+			continue
+		}
+		out = append(out, u)
+	}
+	return out
+}
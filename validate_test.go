@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRepairTruncatedJSON(t *testing.T) {
+	truncated := `{"title":"T","statements":[{"text":"one","type":"claim","children":[{"text":"two","type":"response"}]},{"text":"thr`
+	fixed, ok := repairTruncatedJSON(truncated)
+	if !ok {
+		t.Fatal("expected repair")
+	}
+	var result AnalysisResult
+	if err := json.Unmarshal([]byte(fixed), &result); err != nil {
+		t.Fatalf("repaired JSON invalid: %v\n%s", err, fixed)
+	}
+	if len(result.Statements) != 1 || len(result.Statements[0].Children) != 1 {
+		t.Fatalf("unexpected statements: %+v", result.Statements)
+	}
+
+	if _, ok := repairTruncatedJSON(`not json at all`); ok {
+		t.Fatal("expected no repair")
+	}
+}
+
+func TestValidateStatements(t *testing.T) {
+	bounds := transcriptBounds("[1] (speaker_1) Ada: Go is fast\n[2] (speaker_2) Ben: Python is faster\n[3] (speaker_1) Ada: No", nil)
+	if bounds.MinIndex != 1 || bounds.MaxIndex != 3 || bounds.Speakers["speaker_2"] != "Ben" {
+		t.Fatalf("unexpected bounds: %+v", bounds)
+	}
+
+	idx := func(n int) *int { return &n }
+	stmts := []Statement{{
+		Speaker: "Ada", SpeakerID: "speaker_1", Text: "Go is fast", Type: "Claim", MsgIndex: idx(1),
+		Children: []Statement{
+			{Speaker: "Ben", SpeakerID: "speaker_9", Text: "Python is faster", Type: "counterargument", MsgIndex: idx(2),
+				FactCheck: &FactCheck{Verdict: "Mostly True"}},
+			{Speaker: "Someone", SpeakerID: "speaker_7", Text: "", Type: "response", MsgIndex: idx(3),
+				Children: []Statement{{Speaker: "Ada", SpeakerID: "ada", Text: "No", Type: "vibes", MsgIndex: idx(3)}}},
+			{Speaker: "Ben", SpeakerID: "speaker_2", Text: "Out of range", Type: "response", MsgIndex: idx(12),
+				FactCheck: &FactCheck{Verdict: "true"}},
+		},
+	}}
+
+	report := &ValidationReport{}
+	got := validateStatements(stmts, bounds, report)
+
+	if len(got) != 1 || got[0].Type != "claim" {
+		t.Fatalf("unexpected root: %+v", got)
+	}
+	children := got[0].Children
+	if len(children) != 3 {
+		t.Fatalf("expected empty statement dropped and its child promoted, got %+v", children)
+	}
+	if c := children[0]; c.Type != "rebuttal" || c.SpeakerID != "speaker_2" || c.FactCheck.Verdict != "mostly-true" {
+		t.Fatalf("unexpected first child: %+v", c)
+	}
+	if c := children[1]; c.Text != "No" || c.Type != "response" || c.SpeakerID != "speaker_1" {
+		t.Fatalf("unexpected promoted child: %+v", c)
+	}
+	if c := children[2]; c.MsgIndex != nil || c.FactCheck != nil {
+		t.Fatalf("expected msg_index and fact check removed: %+v", c)
+	}
+	if len(report.Dropped) != 1 || report.Dropped[0].Field != "text" {
+		t.Fatalf("unexpected dropped: %+v", report.Dropped)
+	}
+	if len(report.Corrected) != 5 {
+		t.Fatalf("expected 5 corrections, got %+v", report.Corrected)
+	}
+}
+
+func TestTranscriptBoundsPreferSpeakerMap(t *testing.T) {
+	// Ben is a known speaker who hasn't spoken in this window, and the
+	// line tag speaker_9 isn't in the conversation's speaker map
+	bounds := transcriptBounds("[1] (speaker_1) Ada: Go is fast\n[2] (speaker_9) Ghost: Boo",
+		map[string]string{"speaker_1": "Ada", "speaker_2": "Ben"})
+	if len(bounds.Speakers) != 2 || bounds.Speakers["speaker_2"] != "Ben" || bounds.LineSpeakers[2] != "speaker_9" {
+		t.Fatalf("unexpected bounds: %+v", bounds)
+	}
+
+	report := &ValidationReport{}
+	got := validateStatements([]Statement{
+		{Speaker: "Ben", SpeakerID: "speaker_2", Text: "Python is faster", Type: "claim"},
+		{Speaker: "Ghost", SpeakerID: "speaker_9", Text: "Boo", Type: "claim", MsgIndex: intp(2)},
+		// Statements without a speaker_id are resolved too
+		{Speaker: "Ben", Text: "Libraries matter", Type: "claim"},
+		{Speaker: "A", Text: "Go is fast", Type: "claim", MsgIndex: intp(1)},
+	}, bounds, report)
+	if got[0].SpeakerID != "speaker_2" || got[1].SpeakerID != "" || got[2].SpeakerID != "speaker_2" || got[3].SpeakerID != "speaker_1" {
+		t.Fatalf("unexpected speakers: %+v", got)
+	}
+	if len(report.Corrected) != 3 {
+		t.Fatalf("unexpected corrections: %+v", report.Corrected)
+	}
+}
+
+func TestValidateUpdates(t *testing.T) {
+	str := func(s string) *string { return &s }
+	report := &ValidationReport{}
+	got := validateUpdates([]StatementUpdate{
+		{MsgIndex: 2, Type: str("Rebuttal")},
+		{MsgIndex: 3, Type: str("nonsense")},
+		{MsgIndex: 0, Text: str("x")},
+	}, report)
+	if len(got) != 1 || *got[0].Type != "rebuttal" {
+		t.Fatalf("unexpected updates: %+v", got)
+	}
+	if len(report.Dropped) != 2 || len(report.Corrected) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestExtractStructureRepromptsOnInvalidJSON(t *testing.T) {
+	prev := llm
+	fake := newFakeLLM()
+	calls := 0
+	fake.Respond = func(prompt string) (string, error) {
+		calls++
+		if calls == 1 {
+			return `Sure! Here is the analysis you asked for.`, nil
+		}
+		return `{"title":"T","statements":[{"speaker":"A","text":"Opening claim","type":"claim","msg_index":1,"children":[]}]}`, nil
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	result, err := extractStructure(context.Background(), "[1] A: Opening claim", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Statements) != 1 || result.Validation == nil || len(result.Validation.Repairs) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if retry := fake.Prompts()[1]; !strings.Contains(retry, "could not be used as-is") || !strings.Contains(retry, "invalid JSON") {
+		t.Fatalf("re-prompt missing feedback: %q", retry)
+	}
+}
+
+func TestExtractStructureFailsAfterRepairAttempts(t *testing.T) {
+	prev := llm
+	fake := newFakeLLM()
+	fake.Respond = func(prompt string) (string, error) { return `nope`, nil }
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	if _, err := extractStructure(context.Background(), "[1] A: hi", nil); err == nil || !strings.Contains(err.Error(), "unparseable") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+	if n := len(fake.Prompts()); n != 1+llmRepairAttempts {
+		t.Fatalf("expected %d attempts, got %d", 1+llmRepairAttempts, n)
+	}
+}
+
+func TestAnalyzeAPIReportsValidation(t *testing.T) {
+	setupTestStore(t)
+	prev := llm
+	fake := newFakeLLM()
+	fake.Respond = func(prompt string) (string, error) {
+		// Truncated mid-statement, with an out-of-range msg_index
+		return `{"title":"T","statements":[{"speaker":"A","speaker_id":"speaker_1","text":"Claim","type":"claim","msg_index":9,"children":[]},{"speaker":"B","text":"Cut o`, nil
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	mux := setupMux()
+	body, _ := json.Marshal(map[string]string{"transcript": "[1] (speaker_1) A: Claim\n[2] (speaker_2) B: Cut off"})
+	req := httptest.NewRequest("POST", "/api/analyze", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp analyzeResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Statements) != 1 || resp.Statements[0].MsgIndex != nil {
+		t.Fatalf("unexpected statements: %+v", resp.Statements)
+	}
+	v := resp.Validation
+	if v == nil || len(v.Repairs) == 0 || v.Repairs[0] != "completed truncated JSON" {
+		t.Fatalf("expected truncation repair reported, got %+v", v)
+	}
+	if len(v.Corrected) != 1 || v.Corrected[0].Field != "msg_index" {
+		t.Fatalf("expected msg_index correction, got %+v", v.Corrected)
+	}
+}
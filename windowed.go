@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Long transcripts are analyzed in windows of numbered lines. The first
+// window goes through extractStructure; each later window goes through
+// extractIncremental with the tail of the previous window as context, and
+// its statements are nested under existing ones via parent_text. Lines are
+// numbered once up front so msg_index stays global across windows.
+var (
+	analyzeWindowLines   = getEnvInt("ANALYZE_WINDOW_LINES", 40)
+	analyzeWindowChars   = getEnvInt("ANALYZE_WINDOW_CHARS", 12000)
+	analyzeWindowOverlap = getEnvInt("ANALYZE_WINDOW_OVERLAP", 6)
+)
+
+var numberedLinePattern = regexp.MustCompile(`^\[(\d+)\]`)
+
+// numberedLines splits a transcript into "[N] ..." lines, numbering them
+// unless the client already did.
+func numberedLines(transcript string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(transcript), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 && !numberedLinePattern.MatchString(lines[0]) {
+		lines = strings.Split(strings.TrimSpace(numberTranscriptLines(transcript)), "\n")
+	}
+	return lines
+}
+
+// analysisWindows splits lines into consecutive [start, end) ranges bounded
+// by analyzeWindowLines and analyzeWindowChars. Every window has at least one line.
+func analysisWindows(lines []string) [][2]int {
+	var windows [][2]int
+	start, chars := 0, 0
+	for i, line := range lines {
+		if i > start && (i-start >= analyzeWindowLines || chars+len(line) > analyzeWindowChars) {
+			windows = append(windows, [2]int{start, i})
+			start, chars = i, 0
+		}
+		chars += len(line) + 1
+	}
+	if start < len(lines) {
+		windows = append(windows, [2]int{start, len(lines)})
+	}
+	return windows
+}
+
+// analyzeTranscript runs a single extractStructure call when the transcript
+// fits in one window and falls back to windowed analysis otherwise. speakers
+// (speaker_id → name) bounds the speaker ids statements may cite; when empty
+// the transcript's line tags are used.
+func analyzeTranscript(ctx context.Context, transcript string, speakers map[string]string, progress progressFunc) (*AnalysisResult, error) {
+	lines := numberedLines(transcript)
+	windows := analysisWindows(lines)
+	if len(windows) <= 1 {
+		progress.report("analyzing")
+		return extractStructure(ctx, transcript, speakers)
+	}
+	return analyzeWindowed(ctx, lines, windows, speakers, progress)
+}
+
+func analyzeWindowed(ctx context.Context, lines []string, windows [][2]int, speakers map[string]string, progress progressFunc) (*AnalysisResult, error) {
+	var result *AnalysisResult
+	for i, win := range windows {
+		progress.report(fmt.Sprintf("analyzing window %d/%d", i+1, len(windows)))
+		windowText := strings.Join(lines[win[0]:win[1]], "\n")
+
+		if i == 0 {
+			first, err := extractStructure(ctx, windowText, speakers)
+			if err != nil {
+				return nil, fmt.Errorf("window %d/%d: %w", i+1, len(windows), err)
+			}
+			result = first
+			continue
+		}
+
+		ctxStart := max(win[0]-analyzeWindowOverlap, 0)
+		contextText := strings.Join(lines[ctxStart:win[0]], "\n")
+		minIndex := msgIndexOfLine(lines[ctxStart], ctxStart+1)
+		existing := recentStatements(result.Statements, minIndex)
+
+		inc, err := extractIncremental(ctx, windowText, contextText, existing, 0, false, speakers)
+		if err != nil {
+			return nil, fmt.Errorf("window %d/%d: %w", i+1, len(windows), err)
+		}
+		firstIndex := msgIndexOfLine(lines[win[0]], win[0]+1)
+		result.Statements = mergeWindowStatements(result.Statements, inc.Statements, firstIndex)
+		result.Validation = result.Validation.merge(inc.Validation)
+		result.Provenance = mergePromptRuns(result.Provenance, inc.Provenance...)
+	}
+	return result, nil
+}
+
+func msgIndexOfLine(line string, fallback int) int {
+	if m := numberedLinePattern.FindStringSubmatch(line); m != nil {
+		var n int
+		fmt.Sscanf(m[1], "%d", &n)
+		return n
+	}
+	return fallback
+}
+
+// recentStatements prunes the tree to statements at or after minIndex plus
+// the ancestors needed to reach them, keeping the existing-analysis summary
+// sent with each window bounded.
+func recentStatements(stmts []Statement, minIndex int) []Statement {
+	var out []Statement
+	for _, s := range stmts {
+		children := recentStatements(s.Children, minIndex)
+		if len(children) > 0 || (s.MsgIndex != nil && *s.MsgIndex >= minIndex) {
+			s.Children = children
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// mergeWindowStatements attaches a window's statements to the tree, nesting
+// those with a parent_text under the matching statement. Statements that
+// point back before the window (restating overlap context) are dropped.
+func mergeWindowStatements(tree, added []Statement, firstIndex int) []Statement {
+	for _, s := range added {
+		if s.MsgIndex != nil && *s.MsgIndex < firstIndex {
+			continue
+		}
+		tree = nestStatement(tree, s)
+	}
+	return tree
+}
+
+// findStatementByText finds a statement by case-insensitive text, matching
+// how the frontend resolves parent_text.
+func findStatementByText(stmts []Statement, text string) *Statement {
+	needle := strings.ToLower(strings.TrimSpace(text))
+	for i := range stmts {
+		if strings.ToLower(strings.TrimSpace(stmts[i].Text)) == needle {
+			return &stmts[i]
+		}
+		if found := findStatementByText(stmts[i].Children, text); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func longTranscript(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		speaker := 1 + i%2
+		fmt.Fprintf(&sb, "[%d] (speaker_%d) Person%d: point number %d\n", i, speaker, speaker, i)
+	}
+	return sb.String()
+}
+
+func collectMsgIndexes(stmts []Statement, into map[int]int) {
+	for _, s := range stmts {
+		if s.MsgIndex != nil {
+			into[*s.MsgIndex]++
+		}
+		collectMsgIndexes(s.Children, into)
+	}
+}
+
+func TestAnalysisWindows(t *testing.T) {
+	prevLines, prevChars := analyzeWindowLines, analyzeWindowChars
+	t.Cleanup(func() { analyzeWindowLines, analyzeWindowChars = prevLines, prevChars })
+	analyzeWindowLines, analyzeWindowChars = 4, 1000
+
+	lines := numberedLines("a: 1\nb: 2\n\nc: 3\nd: 4\ne: 5\nf: 6\ng: 7\nh: 8\ni: 9")
+	if len(lines) != 9 || lines[2] != "[3] c: 3" {
+		t.Fatalf("numberedLines = %q", lines)
+	}
+	windows := analysisWindows(lines)
+	want := [][2]int{{0, 4}, {4, 8}, {8, 9}}
+	if fmt.Sprint(windows) != fmt.Sprint(want) {
+		t.Fatalf("analysisWindows = %v, want %v", windows, want)
+	}
+
+	// A single oversized line still gets its own window
+	analyzeWindowChars = 10
+	if w := analysisWindows([]string{strings.Repeat("x", 50), "y"}); len(w) != 2 {
+		t.Fatalf("expected 2 windows by chars, got %v", w)
+	}
+}
+
+func TestAnalyzeWindowedStableMsgIndex(t *testing.T) {
+	prevLines, prevOverlap := analyzeWindowLines, analyzeWindowOverlap
+	t.Cleanup(func() { analyzeWindowLines, analyzeWindowOverlap = prevLines, prevOverlap })
+	analyzeWindowLines, analyzeWindowOverlap = 10, 3
+
+	prev := llm
+	fake := newFakeLLM()
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	var stages []string
+	result, err := analyzeTranscript(context.Background(), longTranscript(25), nil, func(s string) { stages = append(stages, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Prompts()) != 3 || len(stages) != 3 || stages[2] != "analyzing window 3/3" {
+		t.Fatalf("expected 3 windows, got %d prompts, stages %v", len(fake.Prompts()), stages)
+	}
+
+	counts := map[int]int{}
+	collectMsgIndexes(result.Statements, counts)
+	for i := 1; i <= 25; i++ {
+		if counts[i] != 1 {
+			t.Fatalf("msg_index %d appears %d times", i, counts[i])
+		}
+	}
+
+	// Later windows carry the overlap lines as context, not as new text
+	second := fake.Prompts()[1]
+	ctxSection := sectionBetween(second, "RECENT CONVERSATION CONTEXT", "NEW PORTION")
+	if !strings.Contains(ctxSection, "[8] ") || !strings.Contains(ctxSection, "[10] ") || strings.Contains(ctxSection, "[7] ") {
+		t.Fatalf("unexpected context section: %q", ctxSection)
+	}
+	newPortion := sectionBetween(second, "NEW PORTION to analyze", "Return a JSON object")
+	if !strings.Contains(newPortion, "[11] ") || strings.Contains(newPortion, "[10] ") {
+		t.Fatalf("unexpected new portion: %q", newPortion)
+	}
+}
+
+func TestAnalyzeWindowedNestsByParentText(t *testing.T) {
+	prevLines := analyzeWindowLines
+	t.Cleanup(func() { analyzeWindowLines = prevLines })
+	analyzeWindowLines = 2
+
+	prev := llm
+	fake := newFakeLLM()
+	fake.Respond = func(prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Analyze this conversation") {
+			return `{"title":"T","statements":[{"speaker":"A","text":"Opening claim","type":"claim","msg_index":1,"children":[]}]}`, nil
+		}
+		// Restates an overlap statement (dropped) and rebuts the opening claim
+		return `{"statements":[
+			{"speaker":"A","text":"Opening claim","type":"claim","msg_index":1,"children":[]},
+			{"speaker":"B","text":"That is wrong","type":"rebuttal","msg_index":3,"parent_text":"opening claim","children":[]}]}`, nil
+	}
+	llm = fake
+	t.Cleanup(func() { llm = prev })
+
+	result, err := analyzeTranscript(context.Background(), "A: one\nB: two\nB: three", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Statements) != 1 || len(result.Statements[0].Children) != 1 {
+		t.Fatalf("expected rebuttal nested under claim, got %+v", result.Statements)
+	}
+	child := result.Statements[0].Children[0]
+	if child.Text != "That is wrong" || child.ParentText != "" {
+		t.Fatalf("unexpected child: %+v", child)
+	}
+}
@@ -27,9 +27,14 @@ func extractVideoID(rawURL string) (string, error) {
 // fetchYouTubeTranscript uses yt-dlp to grab auto-generated captions.
 type TimedSegment struct {
 	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms,omitempty"`
 	Text    string `json:"text"`
 }
 
+// fetchYouTube is the caption fetcher handlers call. Tests swap it to
+// replay recorded yt-dlp output.
+var fetchYouTube = fetchYouTubeTranscript
+
 func fetchYouTubeTranscript(videoURL string) (text string, title string, segments []TimedSegment, err error) {
 	videoID, err := extractVideoID(videoURL)
 	if err != nil {
@@ -114,8 +119,9 @@ func fetchYouTubeTranscript(videoURL string) (text string, title string, segment
 	// Parse json3 format — extract text with timestamps
 	var captionData struct {
 		Events []struct {
-			TStartMs int64 `json:"tStartMs"`
-			Segs     []struct {
+			TStartMs    int64 `json:"tStartMs"`
+			DDurationMs int64 `json:"dDurationMs"`
+			Segs        []struct {
 				UTF8 string `json:"utf8"`
 			} `json:"segs"`
 		} `json:"events"`
@@ -134,7 +140,7 @@ func fetchYouTubeTranscript(videoURL string) (text string, title string, segment
 		}
 		t := strings.TrimSpace(eventText.String())
 		if t != "" {
-			segments = append(segments, TimedSegment{StartMs: event.TStartMs, Text: t})
+			segments = append(segments, TimedSegment{StartMs: event.TStartMs, EndMs: event.TStartMs + event.DDurationMs, Text: t})
 		}
 	}
 
@@ -187,7 +193,7 @@ func handleAPIImportYouTube(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	text, title, segments, err := fetchYouTubeTranscript(req.URL)
+	text, title, segments, err := fetchYouTube(req.URL)
 	if err != nil {
 		// For title_only, try to at least return what we can
 		if req.TitleOnly && title != "" {